@@ -0,0 +1,757 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+	"text/tabwriter"
+	"time"
+
+	"github.com/qba73/bookshop/internal/bookcsv"
+	"github.com/qba73/bookshop/internal/bookshop"
+	"github.com/qba73/bookshop/internal/money"
+	"github.com/qba73/bookshop/internal/onix"
+	"github.com/qba73/bookshop/internal/search"
+)
+
+const booksUsage = `Usage: bookshop-admin books <subcommand> [flags] [args]
+
+Subcommands:
+  list     list books in the catalog
+  show     show a single book
+  add      add a new book
+  update   update an existing book
+  delete   delete a book
+  search   search books by title, authors and description
+  import   import books from a JSON, CSV or ONIX 3.0 file
+  export   export books to a JSON or CSV file
+`
+
+// Output formats supported by the books subcommands.
+const (
+	formatTable = "table"
+	formatJSON  = "json"
+	formatText  = "text"
+	formatCSV   = "csv"
+	formatONIX  = "onix"
+)
+
+func (a *app) books(args []string) error {
+	if len(args) == 0 {
+		fmt.Fprint(a.stderr, booksUsage)
+		return flag.ErrHelp
+	}
+
+	switch sub := args[0]; sub {
+	case "list":
+		return a.booksList(args[1:])
+	case "show":
+		return a.booksShow(args[1:])
+	case "add":
+		return a.booksAdd(args[1:])
+	case "update":
+		return a.booksUpdate(args[1:])
+	case "delete":
+		return a.booksDelete(args[1:])
+	case "search":
+		return a.booksSearch(args[1:])
+	case "import":
+		return a.booksImport(args[1:])
+	case "export":
+		return a.booksExport(args[1:])
+	case "-h", "-help", "--help", "help":
+		fmt.Fprint(a.stderr, booksUsage)
+		return flag.ErrHelp
+	default:
+		fmt.Fprint(a.stderr, booksUsage)
+		return fmt.Errorf("unknown books subcommand: %s", sub)
+	}
+}
+
+func (a *app) newFlagSet(name, args string) *flag.FlagSet {
+	fs := flag.NewFlagSet(name, flag.ContinueOnError)
+	fs.SetOutput(a.stderr)
+	fs.Usage = func() {
+		fmt.Fprintf(a.stderr, "Usage: bookshop-admin %s [flags] %s\n", name, args)
+		fs.PrintDefaults()
+	}
+	return fs
+}
+
+func (a *app) booksList(args []string) error {
+	fs := a.newFlagSet("books list", "")
+	author := fs.String("author", "", "list only books written by the author")
+	category := fs.String("category", "", "list only books in the category or its subcategories")
+	format := fs.String("o", formatTable, "output format: table, json or text")
+	currency := fs.String("currency", "", "show table prices in the currency")
+	ratesPath := fs.String("rates", "", "exchange rate table used for prices missing in the currency")
+	date := fs.String("date", "", "date of exchange rates, for example 2021-03-01, the latest rates when empty")
+	if err := fs.Parse(args); err != nil {
+		return err
+	}
+	prices, err := pricesIn(*currency, *ratesPath, *date)
+	if err != nil {
+		return err
+	}
+
+	if *category != "" {
+		c, err := findCategory(a.taxonomy, *category)
+		if err != nil {
+			return err
+		}
+		books, err := a.queryAll(bookshop.Query{Categories: []int{c.ID}, Author: *author})
+		if err != nil {
+			return err
+		}
+		return a.printBooks(*format, books, prices)
+	}
+
+	if *format == formatText && *author == "" {
+		details, err := bookshop.GetAllBookDetails(a.store)
+		if err != nil {
+			return err
+		}
+		fmt.Fprint(a.stdout, details)
+		return nil
+	}
+
+	books, err := a.store.List()
+	if err != nil {
+		return err
+	}
+
+	if *author != "" {
+		ids, err := bookshop.GetAllByAuthor(*author, a.store)
+		if err != nil {
+			return err
+		}
+		books = books[:0]
+		for _, id := range ids {
+			b, err := a.store.Get(id)
+			if err != nil {
+				return err
+			}
+			books = append(books, b)
+		}
+	}
+
+	return a.printBooks(*format, books, prices)
+}
+
+// priceColumns returns the list and sale price of a book
+// shown in the table output.
+type priceColumns func(b bookshop.Book) (list, sale string)
+
+// listPrices shows the book price and sale price.
+func listPrices(b bookshop.Book) (string, string) {
+	return b.Price.String(), b.SalePrice().String()
+}
+
+// pricesIn returns price columns for prices in the currency,
+// converted with rates from the file when a book has no price
+// in it. Books without a price in the currency show a dash.
+func pricesIn(currency, ratesPath, date string) (priceColumns, error) {
+	if currency == "" {
+		if ratesPath != "" || date != "" {
+			return nil, errors.New("-rates and -date need -currency")
+		}
+		return listPrices, nil
+	}
+	c, err := money.ParseCurrency(currency)
+	if err != nil {
+		return nil, err
+	}
+
+	var conv bookshop.Converter
+	if ratesPath != "" {
+		table, err := money.OpenRates(ratesPath)
+		if err != nil {
+			return nil, err
+		}
+		var rates *money.Rates
+		if date == "" {
+			rates, err = table.Latest()
+		} else {
+			var at time.Time
+			if at, err = time.Parse("2006-01-02", date); err != nil {
+				return nil, fmt.Errorf("invalid date %q", date)
+			}
+			rates, err = table.At(at)
+		}
+		if err != nil {
+			return nil, err
+		}
+		conv = rates
+	} else if date != "" {
+		return nil, errors.New("-date needs -rates")
+	}
+
+	return func(b bookshop.Book) (string, string) {
+		list, ok := b.PriceIn(c)
+		if !ok && conv != nil {
+			var err error
+			if list, err = conv.Convert(b.Price, c, bookshop.ConversionRounding); err == nil {
+				ok = true
+			}
+		}
+		sale, err := b.SalePriceIn(c, conv)
+		if !ok || err != nil {
+			return "-", "-"
+		}
+		return list.String(), sale.String()
+	}, nil
+}
+
+// queryAll returns books matching the query from all result pages.
+func (a *app) queryAll(q bookshop.Query) ([]bookshop.Book, error) {
+	c := a.catalog()
+	q.Limit = bookshop.MaxPageSize
+
+	books := make([]bookshop.Book, 0)
+	for {
+		page, err := c.Query(q)
+		if err != nil {
+			return nil, err
+		}
+		books = append(books, page.Books...)
+		if page.NextCursor == "" {
+			return books, nil
+		}
+		q.Cursor = page.NextCursor
+	}
+}
+
+func (a *app) booksShow(args []string) error {
+	fs := a.newFlagSet("books show", "<id>")
+	format := fs.String("o", formatText, "output format: table, json or text")
+	byISBN := fs.Bool("isbn", false, "look the book up by ISBN instead of id")
+	if err := fs.Parse(args); err != nil {
+		return err
+	}
+	id, err := bookIDArg(fs)
+	if err != nil {
+		return err
+	}
+	if *byISBN {
+		b, err := a.catalog().GetByISBN(id)
+		if err != nil {
+			return err
+		}
+		id = b.ID
+	}
+
+	if *format == formatText {
+		details, err := bookshop.GetBookDetails(id, a.store)
+		if err != nil {
+			return err
+		}
+		fmt.Fprintln(a.stdout, details)
+		return nil
+	}
+
+	b, err := a.store.Get(id)
+	if err != nil {
+		return err
+	}
+	return a.printBooks(*format, []bookshop.Book{b}, listPrices)
+}
+
+func (a *app) booksAdd(args []string) error {
+	fs := a.newFlagSet("books add", "")
+	id := fs.String("id", "", "book id, generated when empty")
+	bf := newBookFlags(fs)
+	if err := fs.Parse(args); err != nil {
+		return err
+	}
+	if fs.NArg() > 0 {
+		return fmt.Errorf("unexpected arguments: %v", fs.Args())
+	}
+
+	b := bookshop.Book{ID: *id}
+	if b.ID == "" {
+		b.ID = bookshop.NewID()
+	}
+	if err := bf.apply(fs, &b, a.taxonomy); err != nil {
+		return err
+	}
+	if b.Title == "" {
+		return errors.New("missing book title")
+	}
+
+	if err := a.catalog().CreateBook(b); err != nil {
+		return err
+	}
+	fmt.Fprintln(a.stdout, b.ID)
+	return nil
+}
+
+func (a *app) booksUpdate(args []string) error {
+	fs := a.newFlagSet("books update", "<id>")
+	bf := newBookFlags(fs)
+	if err := fs.Parse(args); err != nil {
+		return err
+	}
+	id, err := bookIDArg(fs)
+	if err != nil {
+		return err
+	}
+
+	b, err := a.store.Get(id)
+	if err != nil {
+		return err
+	}
+	if err := bf.apply(fs, &b, a.taxonomy); err != nil {
+		return err
+	}
+	return a.catalog().UpdateBook(b)
+}
+
+func (a *app) booksDelete(args []string) error {
+	fs := a.newFlagSet("books delete", "<id>")
+	if err := fs.Parse(args); err != nil {
+		return err
+	}
+	id, err := bookIDArg(fs)
+	if err != nil {
+		return err
+	}
+	return a.store.Delete(id)
+}
+
+func (a *app) booksSearch(args []string) error {
+	fs := a.newFlagSet("books search", "<query>")
+	limit := fs.Int("n", 10, "maximum number of results, 0 for all")
+	fuzzy := fs.Bool("fuzzy", false, "tolerate typos in titles and authors")
+	format := fs.String("o", formatTable, "output format: table, json or text")
+	if err := fs.Parse(args); err != nil {
+		return err
+	}
+	query := strings.Join(fs.Args(), " ")
+	if strings.TrimSpace(query) == "" {
+		fs.Usage()
+		return errors.New("missing search query")
+	}
+
+	books, err := a.store.List()
+	if err != nil {
+		return err
+	}
+	ix := search.NewIndex(books...)
+	results := ix.Search(query, *limit)
+	if *fuzzy {
+		results = ix.Fuzzy(query, *limit)
+	}
+
+	found := make([]bookshop.Book, 0, len(results))
+	for _, r := range results {
+		b, err := a.store.Get(r.BookID)
+		if err != nil {
+			return err
+		}
+		found = append(found, b)
+	}
+
+	if *format != formatTable {
+		return a.printBooks(*format, found, listPrices)
+	}
+	w := tabwriter.NewWriter(a.stdout, 0, 4, 2, ' ', 0)
+	fmt.Fprintln(w, "SCORE\tID\tTITLE\tAUTHORS")
+	for i, b := range found {
+		fmt.Fprintf(w, "%.2f\t%s\t%s\t%s\n", results[i].Score, b.ID, b.Title, strings.Join(b.Authors, ", "))
+	}
+	return w.Flush()
+}
+
+func (a *app) booksImport(args []string) error {
+	fs := a.newFlagSet("books import", "<file|->")
+	format := fs.String("format", "", "input format: json, csv or onix, detected from the file extension when empty")
+	dryRun := fs.Bool("dry-run", false, "validate CSV rows or ONIX records without changing the catalog")
+	mapping := fs.String("map", "", "CSV header mapping, for example 'Tytuł=title,Cena=price'")
+	comma := fs.String("comma", ",", "CSV field delimiter")
+	currency := fs.String("currency", "", "ONIX price currency, the message default currency when empty")
+	if err := fs.Parse(args); err != nil {
+		return err
+	}
+	if fs.NArg() != 1 {
+		fs.Usage()
+		return errors.New("missing import file")
+	}
+
+	var r io.Reader = a.stdin
+	name := fs.Arg(0)
+	if name != "-" {
+		f, err := os.Open(name)
+		if err != nil {
+			return err
+		}
+		defer f.Close()
+		r = f
+	}
+
+	switch fileFormat(*format, name) {
+	case formatJSON:
+		if *dryRun {
+			return errors.New("-dry-run requires CSV or ONIX input")
+		}
+		return a.importJSON(r)
+	case formatCSV:
+		m, err := parseMapping(*mapping)
+		if err != nil {
+			return err
+		}
+		delim := []rune(*comma)
+		if len(delim) != 1 {
+			return fmt.Errorf("invalid CSV delimiter: %q", *comma)
+		}
+		return a.importCSV(r, bookcsv.Options{Mapping: m, DryRun: *dryRun, Comma: delim[0]})
+	case formatONIX:
+		return a.importONIX(r, onix.Options{Currency: strings.ToUpper(*currency), DryRun: *dryRun})
+	default:
+		return fmt.Errorf("unknown import format: %s", *format)
+	}
+}
+
+func (a *app) importJSON(r io.Reader) error {
+	data, err := io.ReadAll(r)
+	if err != nil {
+		return err
+	}
+	var books []bookshop.Book
+	if err := json.Unmarshal(data, &books); err != nil {
+		return fmt.Errorf("decoding books: %w", err)
+	}
+
+	c := a.catalog()
+	for i, b := range books {
+		if err := c.AddBook(b); err != nil {
+			return fmt.Errorf("book %d: %w", i+1, err)
+		}
+	}
+	fmt.Fprintf(a.stdout, "imported %d books\n", len(books))
+	return nil
+}
+
+func (a *app) importCSV(r io.Reader, opts bookcsv.Options) error {
+	report, err := bookcsv.Import(a.catalog(), r, opts)
+	for _, h := range report.Ignored {
+		fmt.Fprintf(a.stderr, "ignored column: %s\n", h)
+	}
+	for _, e := range report.Errors {
+		fmt.Fprintln(a.stderr, e)
+	}
+	if err != nil {
+		if n := len(report.Imported); n > 0 {
+			fmt.Fprintf(a.stderr, "imported %d books from lines %d-%d before the error\n", n, report.Imported[0], report.Imported[n-1])
+		}
+		return err
+	}
+
+	verb := "imported"
+	if opts.DryRun {
+		verb = "dry run: would import"
+	}
+	fmt.Fprintf(a.stdout, "%s %d books: %d added, %d updated\n", verb, report.Added+report.Updated, report.Added, report.Updated)
+	return nil
+}
+
+func (a *app) importONIX(r io.Reader, opts onix.Options) error {
+	report, err := onix.Import(a.catalog(), r, opts)
+	for _, e := range report.Unmapped {
+		fmt.Fprintln(a.stderr, e)
+	}
+	for _, e := range report.Invalid {
+		fmt.Fprintln(a.stderr, e)
+	}
+	if err != nil {
+		return err
+	}
+
+	verb := "imported"
+	if opts.DryRun {
+		verb = "dry run: would import"
+	}
+	fmt.Fprintf(a.stdout, "%s %d books: %d added, %d updated, %d unmapped, %d invalid\n", verb,
+		report.Added+report.Updated, report.Added, report.Updated, len(report.Unmapped), len(report.Invalid))
+	return nil
+}
+
+func (a *app) booksExport(args []string) error {
+	fs := a.newFlagSet("books export", "[file]")
+	format := fs.String("format", "", "output format: json or csv, detected from the file extension when empty")
+	if err := fs.Parse(args); err != nil {
+		return err
+	}
+
+	name := fs.Arg(0)
+	outFormat := fileFormat(*format, name)
+	write := func(w io.Writer) error {
+		switch outFormat {
+		case formatJSON:
+			books, err := a.store.List()
+			if err != nil {
+				return err
+			}
+			return writeJSON(w, books)
+		case formatCSV:
+			return bookcsv.Export(a.catalog(), w)
+		default:
+			return fmt.Errorf("unknown export format: %s", outFormat)
+		}
+	}
+
+	if name == "" || name == "-" {
+		return write(a.stdout)
+	}
+
+	f, err := os.Create(name)
+	if err != nil {
+		return err
+	}
+	if err := write(f); err != nil {
+		f.Close()
+		return err
+	}
+	return f.Close()
+}
+
+// fileFormat returns format, or the format matching the
+// file name extension when format is empty. JSON is the default.
+func fileFormat(format, name string) string {
+	if format != "" {
+		return format
+	}
+	switch strings.ToLower(filepath.Ext(name)) {
+	case ".csv":
+		return formatCSV
+	case ".xml", ".onix":
+		return formatONIX
+	default:
+		return formatJSON
+	}
+}
+
+// parseMapping parses CSV header mappings given
+// as comma separated header=column pairs.
+func parseMapping(s string) (map[string]string, error) {
+	if strings.TrimSpace(s) == "" {
+		return nil, nil
+	}
+	m := make(map[string]string)
+	for _, pair := range strings.Split(s, ",") {
+		kv := strings.SplitN(pair, "=", 2)
+		if len(kv) != 2 || strings.TrimSpace(kv[0]) == "" || strings.TrimSpace(kv[1]) == "" {
+			return nil, fmt.Errorf("invalid header mapping: %q", pair)
+		}
+		m[strings.TrimSpace(kv[0])] = strings.TrimSpace(kv[1])
+	}
+	return m, nil
+}
+
+func (a *app) printBooks(format string, books []bookshop.Book, prices priceColumns) error {
+	switch format {
+	case formatJSON:
+		if books == nil {
+			books = []bookshop.Book{}
+		}
+		return writeJSON(a.stdout, books)
+	case formatText:
+		for _, b := range books {
+			fmt.Fprintln(a.stdout, &b)
+		}
+		return nil
+	case formatTable:
+		w := tabwriter.NewWriter(a.stdout, 0, 4, 2, ' ', 0)
+		fmt.Fprintln(w, "ID\tTITLE\tAUTHORS\tYEAR\tPRICE\tSALE PRICE")
+		for _, b := range books {
+			list, sale := prices(b)
+			fmt.Fprintf(w, "%s\t%s\t%s\t%d\t%s\t%s\n",
+				b.ID, b.Title, strings.Join(b.Authors, ", "), b.ReleaseYear,
+				list, sale)
+		}
+		return w.Flush()
+	default:
+		return fmt.Errorf("unknown output format: %s", format)
+	}
+}
+
+// bookFlags holds flags used to set book fields
+// by the add and update subcommands.
+type bookFlags struct {
+	isbn        *string
+	title       *string
+	authors     *string
+	description *string
+	edition     *int
+	year        *int
+	series      *int
+	format      *string
+	price       *string
+	currency    *string
+	prices      *string
+	discount    *int
+	category    *string
+	pick        *bool
+}
+
+func newBookFlags(fs *flag.FlagSet) *bookFlags {
+	return &bookFlags{
+		isbn:        fs.String("isbn", "", "ISBN-10 or ISBN-13"),
+		title:       fs.String("title", "", "book title"),
+		authors:     fs.String("authors", "", "comma separated list of authors"),
+		description: fs.String("description", "", "book description"),
+		edition:     fs.Int("edition", 1, "edition number"),
+		year:        fs.Int("year", 0, "release year"),
+		series:      fs.Int("series", 0, "series number"),
+		format:      fs.String("format", string(bookshop.FormatPrint), "book format: print, ebook or audiobook"),
+		price:       fs.String("price", "0", "price, for example 19.99"),
+		currency:    fs.String("currency", string(bookshop.DefaultCurrency), "ISO 4217 currency of -price"),
+		prices:      fs.String("prices", "", "comma separated prices in other currencies, for example EUR=9.99,GBP=8.49, an empty price removes it"),
+		discount:    fs.Int("discount", 0, "discount percentage"),
+		category:    fs.String("category", "autobiography", "comma separated category slugs or ids, the first one is primary"),
+		pick:        fs.Bool("pick", false, "mark as pick of the month"),
+	}
+}
+
+// apply sets book fields for flags given on the command line.
+// On add all flags apply, so defaults end up in the new book.
+func (bf *bookFlags) apply(fs *flag.FlagSet, b *bookshop.Book, t *bookshop.Taxonomy) error {
+	set := make(map[string]bool)
+	fs.Visit(func(f *flag.Flag) { set[f.Name] = true })
+	all := fs.Name() == "books add"
+
+	if all || set["title"] {
+		b.Title = *bf.title
+	}
+	if all || set["authors"] {
+		b.Authors = splitList(*bf.authors)
+	}
+	if all || set["isbn"] {
+		if err := b.SetISBN(*bf.isbn); err != nil {
+			return err
+		}
+	}
+	if all || set["description"] {
+		b.Description = *bf.description
+	}
+	if all || set["edition"] {
+		b.Edition = *bf.edition
+	}
+	if all || set["year"] {
+		b.ReleaseYear = *bf.year
+	}
+	if all || set["series"] {
+		b.SeriesNumber = *bf.series
+	}
+	if all || set["format"] {
+		f, err := bookshop.ParseFormat(*bf.format)
+		if err != nil {
+			return err
+		}
+		b.Format = f
+	}
+	if all || set["pick"] {
+		b.PickOfTheMonth = *bf.pick
+	}
+	// The currency of a stored price is not changed without its
+	// amount, so 19.99 PLN does not become 19.99 EUR.
+	if set["currency"] && !set["price"] {
+		return errors.New("-currency needs -price")
+	}
+	if all || set["price"] {
+		c := b.Price.Currency()
+		if c == "" || set["currency"] {
+			var err error
+			if c, err = money.ParseCurrency(*bf.currency); err != nil {
+				return err
+			}
+		}
+		p, err := money.Parse(*bf.price, c)
+		if err != nil {
+			return err
+		}
+		if err := b.SetPrice(p); err != nil {
+			return err
+		}
+	}
+	if set["prices"] {
+		if err := applyPrices(b, *bf.prices); err != nil {
+			return err
+		}
+	}
+	if all || set["discount"] {
+		if err := b.SetDiscountPercent(*bf.discount); err != nil {
+			return err
+		}
+	}
+	if all || set["category"] {
+		var ids []int
+		for _, v := range splitList(*bf.category) {
+			c, err := findCategory(t, v)
+			if err != nil {
+				return err
+			}
+			ids = append(ids, c.ID)
+		}
+		if err := b.SetCategories(ids...); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// applyPrices sets book prices given as a comma separated
+// list of CURRENCY=AMOUNT, an empty amount removes the price.
+func applyPrices(b *bookshop.Book, s string) error {
+	for _, v := range splitList(s) {
+		kv := strings.SplitN(v, "=", 2)
+		if len(kv) != 2 {
+			return fmt.Errorf("invalid price %q, want CURRENCY=AMOUNT", v)
+		}
+		c, err := money.ParseCurrency(strings.TrimSpace(kv[0]))
+		if err != nil {
+			return err
+		}
+		amount := strings.TrimSpace(kv[1])
+		if amount == "" {
+			b.RemovePriceIn(c)
+			continue
+		}
+		p, err := money.Parse(amount, c)
+		if err != nil {
+			return err
+		}
+		if err := b.SetPriceIn(p); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func bookIDArg(fs *flag.FlagSet) (string, error) {
+	if fs.NArg() != 1 {
+		fs.Usage()
+		return "", errors.New("missing book id")
+	}
+	return fs.Arg(0), nil
+}
+
+func splitList(s string) []string {
+	var items []string
+	for _, v := range strings.Split(s, ",") {
+		if v = strings.TrimSpace(v); v != "" {
+			items = append(items, v)
+		}
+	}
+	return items
+}
+
+func writeJSON(w io.Writer, v interface{}) error {
+	enc := json.NewEncoder(w)
+	enc.SetIndent("", "  ")
+	return enc.Encode(v)
+}
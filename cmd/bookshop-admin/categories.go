@@ -0,0 +1,136 @@
+package main
+
+import (
+	"errors"
+	"flag"
+	"fmt"
+	"strconv"
+	"strings"
+	"text/tabwriter"
+
+	"github.com/qba73/bookshop/internal/bookshop"
+)
+
+const categoriesUsage = `Usage: bookshop-admin categories <subcommand> [flags] [args]
+
+Subcommands:
+  list     list categories as a tree
+  add      add a new category
+  rename   rename a category
+`
+
+func (a *app) categories(args []string) error {
+	if len(args) == 0 {
+		fmt.Fprint(a.stderr, categoriesUsage)
+		return flag.ErrHelp
+	}
+
+	switch sub := args[0]; sub {
+	case "list":
+		return a.categoriesList(args[1:])
+	case "add":
+		return a.categoriesAdd(args[1:])
+	case "rename":
+		return a.categoriesRename(args[1:])
+	case "-h", "-help", "--help", "help":
+		fmt.Fprint(a.stderr, categoriesUsage)
+		return flag.ErrHelp
+	default:
+		fmt.Fprint(a.stderr, categoriesUsage)
+		return fmt.Errorf("unknown categories subcommand: %s", sub)
+	}
+}
+
+func (a *app) categoriesList(args []string) error {
+	fs := a.newFlagSet("categories list", "")
+	format := fs.String("o", formatTable, "output format: table or json")
+	if err := fs.Parse(args); err != nil {
+		return err
+	}
+
+	switch *format {
+	case formatJSON:
+		return writeJSON(a.stdout, a.taxonomy)
+	case formatTable:
+		w := tabwriter.NewWriter(a.stdout, 0, 4, 2, ' ', 0)
+		fmt.Fprintln(w, "ID\tSLUG\tNAME")
+		a.printCategoryTree(w, bookshop.NoParent, 0)
+		return w.Flush()
+	default:
+		return fmt.Errorf("unknown output format: %s", *format)
+	}
+}
+
+// printCategoryTree prints subcategories of parent,
+// each indented below its parent.
+func (a *app) printCategoryTree(w *tabwriter.Writer, parent, depth int) {
+	for _, c := range a.taxonomy.Children(parent) {
+		fmt.Fprintf(w, "%d\t%s\t%s%s\n", c.ID, c.Slug, strings.Repeat("  ", depth), c.Name)
+		a.printCategoryTree(w, c.ID, depth+1)
+	}
+}
+
+func (a *app) categoriesAdd(args []string) error {
+	fs := a.newFlagSet("categories add", "<name>")
+	parent := fs.String("parent", "", "slug or id of the parent category, top level when empty")
+	if err := fs.Parse(args); err != nil {
+		return err
+	}
+	name := strings.Join(fs.Args(), " ")
+	if strings.TrimSpace(name) == "" {
+		fs.Usage()
+		return errors.New("missing category name")
+	}
+
+	parentID := bookshop.NoParent
+	if *parent != "" {
+		p, err := findCategory(a.taxonomy, *parent)
+		if err != nil {
+			return err
+		}
+		parentID = p.ID
+	}
+
+	c, err := a.taxonomy.Add(name, parentID)
+	if err != nil {
+		return err
+	}
+	if err := a.taxonomy.Save(a.taxonomyPath); err != nil {
+		return err
+	}
+	fmt.Fprintln(a.stdout, c.Slug)
+	return nil
+}
+
+func (a *app) categoriesRename(args []string) error {
+	fs := a.newFlagSet("categories rename", "<slug|id> <new name>")
+	if err := fs.Parse(args); err != nil {
+		return err
+	}
+	if fs.NArg() < 2 {
+		fs.Usage()
+		return errors.New("missing category or new name")
+	}
+
+	c, err := findCategory(a.taxonomy, fs.Arg(0))
+	if err != nil {
+		return err
+	}
+	c, err = a.taxonomy.Rename(c.ID, strings.Join(fs.Args()[1:], " "))
+	if err != nil {
+		return err
+	}
+	if err := a.taxonomy.Save(a.taxonomyPath); err != nil {
+		return err
+	}
+	fmt.Fprintln(a.stdout, c.Slug)
+	return nil
+}
+
+// findCategory looks a category up by slug or ID.
+func findCategory(t *bookshop.Taxonomy, s string) (bookshop.Category, error) {
+	if id, err := strconv.Atoi(s); err == nil {
+		return t.Get(id)
+	}
+	return t.BySlug(s)
+}
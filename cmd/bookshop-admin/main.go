@@ -1 +1,142 @@
+// Command bookshop-admin is an administration tool for the bookshop.
+//
+// Usage:
+//
+//	bookshop-admin [-store path] [-categories path] <command> <subcommand> [flags] [args]
+//
+// The store path selects the data store. Files with the .json
+// extension are opened as a JSON store, all other paths as an
+// embedded database. The BOOKSHOP_STORE environment variable
+// sets the default path.
+//
+// Categories are kept in a JSON file next to the store, for
+// example bookshop.categories.json for bookshop.db. The
+// BOOKSHOP_CATEGORIES environment variable or the -categories
+// flag select a different file.
 package main
+
+import (
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/qba73/bookshop/internal/boltstore"
+	"github.com/qba73/bookshop/internal/bookshop"
+)
+
+const defaultStorePath = "bookshop.db"
+
+const usage = `Usage: bookshop-admin [-store path] [-categories path] <command> [args]
+
+Commands:
+  books       manage the book catalog
+  categories  manage book categories
+  serve       serve the catalog REST API and OPDS feeds
+
+Run 'bookshop-admin <command> -h' for more information on a command.
+`
+
+func main() {
+	if err := run(os.Args[1:], os.Stdin, os.Stdout, os.Stderr); err != nil {
+		if !errors.Is(err, flag.ErrHelp) {
+			fmt.Fprintln(os.Stderr, "bookshop-admin:", err)
+		}
+		os.Exit(1)
+	}
+}
+
+// app holds dependencies shared by all commands.
+type app struct {
+	store        bookshop.Store
+	taxonomy     *bookshop.Taxonomy
+	taxonomyPath string
+	stdin        io.Reader
+	stdout       io.Writer
+	stderr       io.Writer
+}
+
+func run(args []string, stdin io.Reader, stdout, stderr io.Writer) error {
+	fs := flag.NewFlagSet("bookshop-admin", flag.ContinueOnError)
+	fs.SetOutput(stderr)
+	fs.Usage = func() { fmt.Fprint(stderr, usage) }
+
+	storePath := fs.String("store", envOr("BOOKSHOP_STORE", defaultStorePath), "path to the data store")
+	taxonomyPath := fs.String("categories", os.Getenv("BOOKSHOP_CATEGORIES"), "path to the categories file, next to the store when empty")
+	if err := fs.Parse(args); err != nil {
+		return err
+	}
+	if fs.NArg() == 0 {
+		fs.Usage()
+		return flag.ErrHelp
+	}
+
+	store, closeStore, err := openStore(*storePath)
+	if err != nil {
+		return err
+	}
+	defer closeStore()
+
+	if *taxonomyPath == "" {
+		*taxonomyPath = strings.TrimSuffix(*storePath, filepath.Ext(*storePath)) + ".categories.json"
+	}
+	taxonomy, err := bookshop.OpenTaxonomy(*taxonomyPath)
+	if err != nil {
+		return err
+	}
+
+	a := app{
+		store:        store,
+		taxonomy:     taxonomy,
+		taxonomyPath: *taxonomyPath,
+		stdin:        stdin,
+		stdout:       stdout,
+		stderr:       stderr,
+	}
+
+	switch cmd := fs.Arg(0); cmd {
+	case "books":
+		return a.books(fs.Args()[1:])
+	case "categories":
+		return a.categories(fs.Args()[1:])
+	case "serve":
+		return a.serve(fs.Args()[1:])
+	default:
+		fs.Usage()
+		return fmt.Errorf("unknown command: %s", cmd)
+	}
+}
+
+// catalog returns the catalog backed by the app store and categories.
+func (a *app) catalog() *bookshop.Catalog {
+	c := bookshop.NewCatalog(a.store)
+	c.SetTaxonomy(a.taxonomy)
+	return c
+}
+
+// openStore knows how to open a data store for the given path.
+func openStore(path string) (bookshop.Store, func() error, error) {
+	if filepath.Ext(path) == ".json" {
+		s, err := bookshop.OpenJSONStore(path)
+		if err != nil {
+			return nil, nil, err
+		}
+		return s, func() error { return nil }, nil
+	}
+
+	db, err := boltstore.Open(path)
+	if err != nil {
+		return nil, nil, err
+	}
+	return db, db.Close, nil
+}
+
+func envOr(key, fallback string) string {
+	if v, ok := os.LookupEnv(key); ok && v != "" {
+		return v
+	}
+	return fallback
+}
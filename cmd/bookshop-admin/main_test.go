@@ -0,0 +1,463 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/google/go-cmp/cmp"
+	"github.com/qba73/bookshop/internal/bookcsv"
+	"github.com/qba73/bookshop/internal/bookshop"
+	"github.com/qba73/bookshop/internal/money"
+)
+
+func runCmd(t *testing.T, stdin string, args ...string) (string, error) {
+	t.Helper()
+
+	var stdout, stderr bytes.Buffer
+	err := run(args, strings.NewReader(stdin), &stdout, &stderr)
+	return stdout.String(), err
+}
+
+func TestBooksCommands(t *testing.T) {
+	t.Parallel()
+
+	for _, name := range []string{"books.json", "bookshop.db"} {
+		name := name
+		t.Run(name, func(t *testing.T) {
+			t.Parallel()
+
+			store := filepath.Join(t.TempDir(), name)
+
+			id, err := runCmd(t, "", "-store", store, "books", "add",
+				"-id", "1912bbf7-3f26-4196-b062-071b81b855e9",
+				"-title", "Bolek i Lolek", "-authors", "Bolek",
+				"-year", "1997", "-price", "20.00", "-discount", "20")
+			if err != nil {
+				t.Fatal(err)
+			}
+			if strings.TrimSpace(id) != "1912bbf7-3f26-4196-b062-071b81b855e9" {
+				t.Errorf("books add = %q, want book id", id)
+			}
+			_, err = runCmd(t, "", "-store", store, "books", "add",
+				"-id", "1912bbf7-3f26-4196-b062-071b81b855e9", "-title", "Bolek")
+			if !errors.Is(err, bookshop.ErrBookExists) {
+				t.Errorf("books add with existing id = %v, want: %v", err, bookshop.ErrBookExists)
+			}
+
+			_, err = runCmd(t, "", "-store", store, "books", "add",
+				"-id", "1923bbf9-3f36-4196-b062-171b81b855e9",
+				"-title", "Zosia Samosia", "-authors", "Papcio Chmiel, Zigmas Laurin",
+				"-year", "2011", "-price", "10", "-category", "2")
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			_, err = runCmd(t, "", "-store", store, "books", "update", "-isbn", "83-240-0016-6", "1923bbf9-3f36-4196-b062-171b81b855e9")
+			if err == nil {
+				t.Errorf("books update with invalid ISBN should return error")
+			}
+			_, err = runCmd(t, "", "-store", store, "books", "update", "-isbn", "83-240-0016-X", "1923bbf9-3f36-4196-b062-171b81b855e9")
+			if err != nil {
+				t.Fatal(err)
+			}
+			got, err := runCmd(t, "", "-store", store, "books", "show", "-isbn", "978-83-240-0016-6")
+			if err != nil {
+				t.Fatal(err)
+			}
+			if want := "Title: Zosia Samosia, Authors: Papcio Chmiel, Zigmas Laurin, Year: 2011, ID: 1923bbf9-3f36-4196-b062-171b81b855e9\n"; got != want {
+				t.Errorf("books show -isbn \n%s", cmp.Diff(want, got))
+			}
+			_, err = runCmd(t, "", "-store", store, "books", "update", "-isbn", "9788324000166", "1912bbf7-3f26-4196-b062-071b81b855e9")
+			if !errors.Is(err, bookshop.ErrDuplicateISBN) {
+				t.Errorf("books update with duplicate ISBN = %v, want: %v", err, bookshop.ErrDuplicateISBN)
+			}
+
+			got, err = runCmd(t, "", "-store", store, "books", "list", "-o", "text")
+			if err != nil {
+				t.Fatal(err)
+			}
+			want := `Title: Bolek i Lolek, Author: Bolek, Year: 1997, ID: 1912bbf7-3f26-4196-b062-071b81b855e9
+Title: Zosia Samosia, Authors: Papcio Chmiel, Zigmas Laurin, Year: 2011, ID: 1923bbf9-3f36-4196-b062-171b81b855e9
+`
+			if !cmp.Equal(got, want) {
+				t.Errorf("books list -o text \n%s", cmp.Diff(want, got))
+			}
+
+			got, err = runCmd(t, "", "-store", store, "books", "list", "-author", "Zigmas Laurin")
+			if err != nil {
+				t.Fatal(err)
+			}
+			want = `ID                                    TITLE          AUTHORS                       YEAR  PRICE      SALE PRICE
+1923bbf9-3f36-4196-b062-171b81b855e9  Zosia Samosia  Papcio Chmiel, Zigmas Laurin  2011  10.00 PLN  10.00 PLN
+`
+			if !cmp.Equal(got, want) {
+				t.Errorf("books list -author \n%s", cmp.Diff(want, got))
+			}
+
+			got, err = runCmd(t, "", "-store", store, "books", "search", "-o", "text", "samo")
+			if err != nil {
+				t.Fatal(err)
+			}
+			want = "Title: Zosia Samosia, Authors: Papcio Chmiel, Zigmas Laurin, Year: 2011, ID: 1923bbf9-3f36-4196-b062-171b81b855e9\n"
+			if !cmp.Equal(got, want) {
+				t.Errorf("books search \n%s", cmp.Diff(want, got))
+			}
+
+			got, err = runCmd(t, "", "-store", store, "books", "search", "-fuzzy", "papcio chmeil")
+			if err != nil {
+				t.Fatal(err)
+			}
+			want = `SCORE  ID                                    TITLE          AUTHORS
+0.92   1923bbf9-3f36-4196-b062-171b81b855e9  Zosia Samosia  Papcio Chmiel, Zigmas Laurin
+`
+			if !cmp.Equal(got, want) {
+				t.Errorf("books search -fuzzy \n%s", cmp.Diff(want, got))
+			}
+
+			_, err = runCmd(t, "", "-store", store, "books", "update", "-discount", "50", "-title", "Bolek", "1912bbf7-3f26-4196-b062-071b81b855e9")
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			got, err = runCmd(t, "", "-store", store, "books", "show", "-o", "json", "1912bbf7-3f26-4196-b062-071b81b855e9")
+			if err != nil {
+				t.Fatal(err)
+			}
+			var books []bookshop.Book
+			if err := json.Unmarshal([]byte(got), &books); err != nil {
+				t.Fatal(err)
+			}
+			if len(books) != 1 || books[0].Title != "Bolek" || books[0].ReleaseYear != 1997 || books[0].SalePrice() != money.New(1000, money.PLN) {
+				t.Errorf("books show after update = %s", got)
+			}
+
+			if _, err := runCmd(t, "", "-store", store, "books", "update", "-discount", "150", "1912bbf7-3f26-4196-b062-071b81b855e9"); err == nil {
+				t.Errorf("books update with invalid discount should return error")
+			}
+
+			exported, err := runCmd(t, "", "-store", store, "books", "export")
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			if _, err := runCmd(t, "", "-store", store, "books", "delete", "1912bbf7-3f26-4196-b062-071b81b855e9"); err != nil {
+				t.Fatal(err)
+			}
+			if _, err := runCmd(t, "", "-store", store, "books", "show", "1912bbf7-3f26-4196-b062-071b81b855e9"); err == nil {
+				t.Errorf("books show of deleted book should return error")
+			}
+
+			imported := filepath.Join(t.TempDir(), "imported.json")
+			got, err = runCmd(t, exported, "-store", imported, "books", "import", "-")
+			if err != nil {
+				t.Fatal(err)
+			}
+			if got != "imported 2 books\n" {
+				t.Errorf("books import = %q", got)
+			}
+
+			got, err = runCmd(t, "", "-store", imported, "books", "export")
+			if err != nil {
+				t.Fatal(err)
+			}
+			if !cmp.Equal(got, exported) {
+				t.Errorf("export after import \n%s", cmp.Diff(exported, got))
+			}
+		})
+	}
+}
+
+func TestBooksCSVCommands(t *testing.T) {
+	t.Parallel()
+
+	dir := t.TempDir()
+	store := filepath.Join(dir, "books.json")
+	input := `Tytuł;Autor;Cena;Rabat;Kategoria
+Zosia Samosia;Papcio Chmiel;"19,99";10;romance
+Bolek i Lolek;Bolek;20;;tech
+`
+	mapping := "Tytuł=title,Autor=authors,Cena=price,Rabat=discount,Kategoria=categories"
+
+	got, err := runCmd(t, input, "-store", store, "books", "import", "-format", "csv", "-comma", ";", "-map", mapping, "-dry-run", "-")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got != "dry run: would import 2 books: 2 added, 0 updated\n" {
+		t.Errorf("books import -dry-run = %q", got)
+	}
+	got, err = runCmd(t, "", "-store", store, "books", "list")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if strings.Contains(got, "Zosia") {
+		t.Errorf("books import -dry-run changed the catalog:\n%s", got)
+	}
+
+	got, err = runCmd(t, input, "-store", store, "books", "import", "-format", "csv", "-comma", ";", "-map", mapping, "-")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got != "imported 2 books: 2 added, 0 updated\n" {
+		t.Errorf("books import = %q", got)
+	}
+
+	invalid := "title,price,discount\nZosia,abc,200\n"
+	if _, err := runCmd(t, invalid, "-store", store, "books", "import", "-format", "csv", "-"); !errors.Is(err, bookcsv.ErrInvalidRows) {
+		t.Errorf("books import of invalid rows = %v, want: %v", err, bookcsv.ErrInvalidRows)
+	}
+
+	exported := filepath.Join(dir, "books.csv")
+	if _, err := runCmd(t, "", "-store", store, "books", "export", exported); err != nil {
+		t.Fatal(err)
+	}
+	data, err := os.ReadFile(exported)
+	if err != nil {
+		t.Fatal(err)
+	}
+	lines := strings.Split(strings.TrimSpace(string(data)), "\n")
+	if len(lines) != 3 || !strings.HasPrefix(lines[0], "id,isbn,title,") {
+		t.Fatalf("books export csv = %s", data)
+	}
+	for _, want := range []string{",Zosia Samosia,Papcio Chmiel,,0,0,0,19.99,PLN,10,18.00,romance,false", ",Bolek i Lolek,Bolek,,0,0,0,20.00,PLN,0,20.00,tech,false"} {
+		if !strings.Contains(string(data), want) {
+			t.Errorf("books export csv = %s, want row with %s", data, want)
+		}
+	}
+}
+
+func TestBooksUpdateCurrency(t *testing.T) {
+	t.Parallel()
+
+	store := filepath.Join(t.TempDir(), "books.json")
+	if _, err := runCmd(t, "", "-store", store, "books", "add", "-id", "1", "-title", "Tytus", "-price", "19.99"); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := runCmd(t, "", "-store", store, "books", "update", "-currency", "EUR", "1"); err == nil {
+		t.Errorf("books update with -currency without -price should return error")
+	}
+	out, err := runCmd(t, "", "-store", store, "books", "show", "-o", "json", "1")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !strings.Contains(out, `"price_cents": 1999`) || !strings.Contains(out, `"currency": "PLN"`) {
+		t.Errorf("books show after rejected update = %s, want price 19.99 PLN", out)
+	}
+
+	if _, err := runCmd(t, "", "-store", store, "books", "update", "-price", "4.99", "-currency", "EUR", "1"); err != nil {
+		t.Fatal(err)
+	}
+	out, err = runCmd(t, "", "-store", store, "books", "show", "-o", "json", "1")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !strings.Contains(out, `"price_cents": 499`) || !strings.Contains(out, `"currency": "EUR"`) {
+		t.Errorf("books show after update = %s, want price 4.99 EUR", out)
+	}
+}
+
+func TestBooksPricesInCurrency(t *testing.T) {
+	t.Parallel()
+
+	dir := t.TempDir()
+	store := filepath.Join(dir, "books.json")
+	rates := filepath.Join(dir, "rates.csv")
+	err := os.WriteFile(rates, []byte("date,from,to,rate\n2021-03-01,EUR,PLN,4.5\n2021-03-02,EUR,PLN,5.0\n"), 0o644)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	_, err = runCmd(t, "", "-store", store, "books", "add", "-id", "1", "-title", "Tytus",
+		"-price", "45.00", "-discount", "10", "-prices", "EUR=9.99,GBP=8.49")
+	if err != nil {
+		t.Fatal(err)
+	}
+	_, err = runCmd(t, "", "-store", store, "books", "add", "-id", "2", "-title", "Kajko", "-price", "52.00")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := runCmd(t, "", "-store", store, "books", "update", "-prices", "GBP=", "1"); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := runCmd(t, "", "-store", store, "books", "update", "-prices", "EUR=-1", "1"); err == nil {
+		t.Errorf("books update with negative price should return error")
+	}
+
+	tt := []struct {
+		name string
+		args []string
+		want string
+	}{
+		{
+			name: "Price list only",
+			args: []string{"-currency", "GBP"},
+			want: `ID  TITLE  AUTHORS  YEAR  PRICE  SALE PRICE
+1   Tytus           0     -      -
+2   Kajko           0     -      -
+`,
+		},
+		{
+			name: "Latest rates",
+			args: []string{"-currency", "EUR", "-rates", rates},
+			want: `ID  TITLE  AUTHORS  YEAR  PRICE      SALE PRICE
+1   Tytus           0     9.99 EUR   9.00 EUR
+2   Kajko           0     10.40 EUR  10.40 EUR
+`,
+		},
+		{
+			name: "Rates of date",
+			args: []string{"-currency", "EUR", "-rates", rates, "-date", "2021-03-01"},
+			want: `ID  TITLE  AUTHORS  YEAR  PRICE      SALE PRICE
+1   Tytus           0     9.99 EUR   9.00 EUR
+2   Kajko           0     11.56 EUR  11.56 EUR
+`,
+		},
+	}
+
+	for _, tc := range tt {
+		got, err := runCmd(t, "", append([]string{"-store", store, "books", "list"}, tc.args...)...)
+		if err != nil {
+			t.Fatalf("%s, books list: %v", tc.name, err)
+		}
+		if !cmp.Equal(tc.want, got) {
+			t.Errorf("%s, books list \n%s", tc.name, cmp.Diff(tc.want, got))
+		}
+	}
+
+	if _, err := runCmd(t, "", "-store", store, "books", "list", "-currency", "EUR", "-rates", rates, "-date", "2021-02-01"); !errors.Is(err, money.ErrNoRate) {
+		t.Errorf("books list with rates before first date = %v, want: %v", err, money.ErrNoRate)
+	}
+}
+
+func TestBooksONIXImport(t *testing.T) {
+	t.Parallel()
+
+	store := filepath.Join(t.TempDir(), "books.json")
+	input := `<ONIXMessage release="3.0">
+  <Header><DefaultCurrencyCode>PLN</DefaultCurrencyCode></Header>
+  <Product>
+    <RecordReference>1</RecordReference>
+    <NotificationType>03</NotificationType>
+    <ProductIdentifier><ProductIDType>15</ProductIDType><IDValue>9780306406157</IDValue></ProductIdentifier>
+    <DescriptiveDetail>
+      <TitleDetail><TitleType>01</TitleType><TitleElement><TitleElementLevel>01</TitleElementLevel><TitleText>Zosia Samosia</TitleText></TitleElement></TitleDetail>
+      <Contributor><ContributorRole>A01</ContributorRole><PersonName>Julian Tuwim</PersonName></Contributor>
+    </DescriptiveDetail>
+    <ProductSupply><SupplyDetail><Price><PriceType>02</PriceType><PriceAmount>15.00</PriceAmount></Price></SupplyDetail></ProductSupply>
+  </Product>
+  <Product>
+    <RecordReference>2</RecordReference>
+    <NotificationType>03</NotificationType>
+  </Product>
+</ONIXMessage>`
+
+	got, err := runCmd(t, input, "-store", store, "books", "import", "-format", "onix", "-")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got != "imported 1 books: 1 added, 0 updated, 1 unmapped, 0 invalid\n" {
+		t.Errorf("books import -format onix = %q", got)
+	}
+
+	got, err = runCmd(t, "", "-store", store, "books", "show", "-isbn", "0306406152")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !strings.Contains(got, "Zosia Samosia") {
+		t.Errorf("books show after ONIX import = %q", got)
+	}
+}
+
+func TestCategoriesCommands(t *testing.T) {
+	t.Parallel()
+
+	dir := t.TempDir()
+	store := filepath.Join(dir, "books.json")
+
+	for _, args := range [][]string{
+		{"categories", "add", "Literatura dziecięca"},
+		{"categories", "add", "-parent", "literatura-dziecieca", "Komiksy"},
+		{"categories", "add", "-parent", "programming", "Go"},
+		{"categories", "rename", "komiksy", "Komiksy i ilustracje"},
+		{"books", "add", "-id", "1", "-title", "Tytus", "-category", "komiksy-i-ilustracje,romance"},
+		{"books", "add", "-id", "2", "-title", "Go in Action", "-category", "go"},
+		{"books", "add", "-id", "3", "-title", "Pan Samochodzik", "-category", "2"},
+	} {
+		if _, err := runCmd(t, "", append([]string{"-store", store}, args...)...); err != nil {
+			t.Fatalf("run(%v) got error: %v", args, err)
+		}
+	}
+
+	got, err := runCmd(t, "", "-store", store, "categories", "list")
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := `ID  SLUG                  NAME
+0   autobiography         Autobiography
+1   tech                  Tech
+2   romance               Romance
+3   programming           Programming
+6   go                      Go
+4   literatura-dziecieca  Literatura dziecięca
+5   komiksy-i-ilustracje    Komiksy i ilustracje
+`
+	if !cmp.Equal(got, want) {
+		t.Errorf("categories list \n%s", cmp.Diff(want, got))
+	}
+
+	tt := []struct {
+		category string
+		want     string
+	}{
+		{category: "literatura-dziecieca", want: "Title: Tytus, Author: , Year: 0, ID: 1\n"},
+		{category: "programming", want: "Title: Go in Action, Author: , Year: 0, ID: 2\n"},
+		{category: "romance", want: "Title: Tytus, Author: , Year: 0, ID: 1\nTitle: Pan Samochodzik, Author: , Year: 0, ID: 3\n"},
+		{category: "tech", want: ""},
+	}
+	for _, tc := range tt {
+		got, err := runCmd(t, "", "-store", store, "books", "list", "-o", "text", "-category", tc.category)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if !cmp.Equal(got, tc.want) {
+			t.Errorf("books list -category %s \n%s", tc.category, cmp.Diff(tc.want, got))
+		}
+	}
+
+	for _, args := range [][]string{
+		{"categories", "add", "-parent", "missing", "Rust"},
+		{"categories", "add", "Go"},
+		{"categories", "rename", "missing", "Nowa"},
+		{"books", "add", "-id", "4", "-title", "Rust", "-category", "rust"},
+	} {
+		if _, err := runCmd(t, "", append([]string{"-store", store}, args...)...); err == nil {
+			t.Errorf("run(%v) should return error", args)
+		}
+	}
+}
+
+func TestUnknownCommand(t *testing.T) {
+	t.Parallel()
+
+	store := filepath.Join(t.TempDir(), "books.json")
+
+	tt := []struct {
+		name string
+		args []string
+	}{
+		{name: "Unknown command", args: []string{"-store", store, "authors"}},
+		{name: "Unknown books subcommand", args: []string{"-store", store, "books", "sell"}},
+		{name: "Unknown output format", args: []string{"-store", store, "books", "list", "-o", "xml"}},
+		{name: "Missing book id", args: []string{"-store", store, "books", "show"}},
+	}
+
+	for _, tc := range tt {
+		if _, err := runCmd(t, "", tc.args...); err == nil {
+			t.Errorf("%s run(%v) should return error", tc.name, tc.args)
+		}
+	}
+}
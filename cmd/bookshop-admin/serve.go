@@ -0,0 +1,27 @@
+package main
+
+import (
+	"fmt"
+	"net/http"
+
+	"github.com/qba73/bookshop/internal/api"
+	"github.com/qba73/bookshop/internal/opds"
+)
+
+func (a *app) serve(args []string) error {
+	fs := a.newFlagSet("serve", "")
+	addr := fs.String("addr", ":8080", "address to listen on")
+	if err := fs.Parse(args); err != nil {
+		return err
+	}
+
+	c := a.catalog()
+	feeds := opds.NewFeeds(c, opds.Config{})
+	mux := http.NewServeMux()
+	mux.Handle("/", api.NewServer(c))
+	mux.Handle("/opds", feeds)
+	mux.Handle("/opds/", feeds)
+
+	fmt.Fprintf(a.stderr, "serving catalog API on %s, OPDS feeds at /opds\n", *addr)
+	return http.ListenAndServe(*addr, mux)
+}
@@ -1,9 +1,14 @@
 module github.com/qba73/bookshop
 
-go 1.15
+go 1.17
 
 require (
 	github.com/google/go-cmp v0.5.4
 	github.com/google/uuid v1.2.0
+	go.etcd.io/bbolt v1.3.6
+)
+
+require (
+	golang.org/x/sys v0.0.0-20200923182605-d9f96fdee20d // indirect
 	golang.org/x/xerrors v0.0.0-20200804184101-5ec99f83aff1 // indirect
 )
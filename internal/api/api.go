@@ -0,0 +1,368 @@
+// Package api exposes the bookshop catalog over a JSON REST API.
+package api
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"net/http"
+	"strings"
+
+	"github.com/qba73/bookshop/internal/bookshop"
+	"github.com/qba73/bookshop/internal/money"
+)
+
+// maxBodyBytes limits the size of request bodies.
+const maxBodyBytes = 1 << 20
+
+// Server is an http.Handler serving the catalog API:
+//
+//	GET    /books           list books, optionally ?author=name or ?isbn=isbn
+//	POST   /books           add a book
+//	GET    /books/{id}      get a book
+//	PUT    /books/{id}      update a book
+//	DELETE /books/{id}      delete a book
+//	GET    /authors         list unique authors
+type Server struct {
+	catalog *bookshop.Catalog
+	mux     *http.ServeMux
+	logger  *log.Logger
+}
+
+// NewServer knows how to construct an API server for the catalog.
+// Internal errors are logged to the standard logger, see SetLogger.
+func NewServer(c *bookshop.Catalog) *Server {
+	s := Server{
+		catalog: c,
+		mux:     http.NewServeMux(),
+		logger:  log.Default(),
+	}
+	s.mux.HandleFunc("/books", s.handleBooks)
+	s.mux.HandleFunc("/books/", s.handleBook)
+	s.mux.HandleFunc("/authors", s.handleAuthors)
+	return &s
+}
+
+// SetLogger sets the logger of internal errors. Clients get
+// a generic message, so the logs are the only place the errors
+// are recorded.
+func (s *Server) SetLogger(l *log.Logger) {
+	s.logger = l
+}
+
+// ServeHTTP implements http.Handler interface.
+func (s *Server) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	s.mux.ServeHTTP(w, r)
+}
+
+func (s *Server) handleBooks(w http.ResponseWriter, r *http.Request) {
+	switch r.Method {
+	case http.MethodGet:
+		s.listBooks(w, r)
+	case http.MethodPost:
+		s.createBook(w, r)
+	default:
+		methodNotAllowed(w, http.MethodGet, http.MethodPost)
+	}
+}
+
+func (s *Server) handleBook(w http.ResponseWriter, r *http.Request) {
+	id := strings.TrimPrefix(r.URL.Path, "/books/")
+	if id == "" || strings.Contains(id, "/") {
+		writeError(w, http.StatusNotFound, "not found")
+		return
+	}
+
+	switch r.Method {
+	case http.MethodGet:
+		s.getBook(w, r, id)
+	case http.MethodPut:
+		s.updateBook(w, r, id)
+	case http.MethodDelete:
+		s.deleteBook(w, r, id)
+	default:
+		methodNotAllowed(w, http.MethodGet, http.MethodPut, http.MethodDelete)
+	}
+}
+
+func (s *Server) handleAuthors(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		methodNotAllowed(w, http.MethodGet)
+		return
+	}
+
+	authors, err := s.catalog.GetUniqueAuthors()
+	if err != nil {
+		s.writeStoreError(w, r, err)
+		return
+	}
+	if authors == nil {
+		authors = []string{}
+	}
+	writeJSON(w, http.StatusOK, authors)
+}
+
+func (s *Server) listBooks(w http.ResponseWriter, r *http.Request) {
+	store := s.catalog.Store()
+
+	if isbn := r.URL.Query().Get("isbn"); isbn != "" {
+		b, err := s.catalog.GetByISBN(isbn)
+		if errors.Is(err, bookshop.ErrBookNotFound) {
+			writeJSON(w, http.StatusOK, []bookshop.Book{})
+			return
+		}
+		if errors.Is(err, bookshop.ErrInvalidISBN) {
+			writeError(w, http.StatusBadRequest, err.Error())
+			return
+		}
+		if err != nil {
+			s.writeStoreError(w, r, err)
+			return
+		}
+		writeJSON(w, http.StatusOK, []bookshop.Book{b})
+		return
+	}
+
+	author := r.URL.Query().Get("author")
+	if author == "" {
+		books, err := s.catalog.GetAllBooks()
+		if err != nil {
+			s.writeStoreError(w, r, err)
+			return
+		}
+		if books == nil {
+			books = []bookshop.Book{}
+		}
+		writeJSON(w, http.StatusOK, books)
+		return
+	}
+
+	ids, err := bookshop.GetAllByAuthor(author, store)
+	if err != nil {
+		s.writeStoreError(w, r, err)
+		return
+	}
+	books := []bookshop.Book{}
+	for _, id := range ids {
+		b, err := store.Get(id)
+		if err != nil {
+			s.writeStoreError(w, r, err)
+			return
+		}
+		books = append(books, b)
+	}
+	writeJSON(w, http.StatusOK, books)
+}
+
+func (s *Server) getBook(w http.ResponseWriter, r *http.Request, id string) {
+	b, err := s.catalog.Store().Get(id)
+	if err != nil {
+		s.writeStoreError(w, r, err)
+		return
+	}
+	writeJSON(w, http.StatusOK, b)
+}
+
+func (s *Server) createBook(w http.ResponseWriter, r *http.Request) {
+	var req bookRequest
+	if !decodeBody(w, r, &req) {
+		return
+	}
+	if req.ID == "" {
+		req.ID = bookshop.NewID()
+	}
+
+	b, verr := req.book(s.catalog.Taxonomy())
+	if verr != nil {
+		writeJSON(w, http.StatusBadRequest, verr)
+		return
+	}
+
+	if err := s.catalog.CreateBook(b); errors.Is(err, bookshop.ErrBookExists) {
+		writeError(w, http.StatusConflict, fmt.Sprintf("book id %s already exists", b.ID))
+		return
+	} else if err != nil {
+		s.writeStoreError(w, r, err)
+		return
+	}
+	w.Header().Set("Location", "/books/"+b.ID)
+	writeJSON(w, http.StatusCreated, b)
+}
+
+func (s *Server) updateBook(w http.ResponseWriter, r *http.Request, id string) {
+	var req bookRequest
+	if !decodeBody(w, r, &req) {
+		return
+	}
+	if req.ID != "" && req.ID != id {
+		writeJSON(w, http.StatusBadRequest, &errorResponse{
+			Message: "invalid book",
+			Fields:  map[string]string{"id": "book id does not match the URL"},
+		})
+		return
+	}
+	req.ID = id
+
+	b, verr := req.book(s.catalog.Taxonomy())
+	if verr != nil {
+		writeJSON(w, http.StatusBadRequest, verr)
+		return
+	}
+
+	if err := s.catalog.UpdateBook(b); err != nil {
+		s.writeStoreError(w, r, err)
+		return
+	}
+	writeJSON(w, http.StatusOK, b)
+}
+
+func (s *Server) deleteBook(w http.ResponseWriter, r *http.Request, id string) {
+	if err := s.catalog.Store().Delete(id); err != nil {
+		s.writeStoreError(w, r, err)
+		return
+	}
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// bookRequest is the body of POST and PUT book requests.
+// It mirrors the JSON representation of bookshop.Book.
+type bookRequest struct {
+	ID             string           `json:"id"`
+	ISBN           string           `json:"isbn,omitempty"`
+	Edition        int              `json:"edition"`
+	Title          string           `json:"title"`
+	Authors        []string         `json:"authors"`
+	Description    string           `json:"description"`
+	ReleaseYear    int              `json:"release_year"`
+	SeriesNumber   int              `json:"series_number"`
+	Format         string           `json:"format,omitempty"`
+	PriceCents     int64            `json:"price_cents"`
+	Currency       string           `json:"currency,omitempty"`
+	Prices         map[string]int64 `json:"prices,omitempty"`
+	PickOfTheMonth bool             `json:"pick_of_the_month"`
+	Discount       int              `json:"discount"`
+	Category       int              `json:"category"`
+	Categories     []int            `json:"categories,omitempty"`
+}
+
+// book knows how to build a valid book from the request.
+// Prices, discounts and categories are validated by the
+// bookshop.Book setters and reported per field. Categories
+// must exist in the taxonomy. Prices without a currency are
+// in bookshop.DefaultCurrency. Prices holds the book price list
+// in other currencies, keyed by the currency code.
+func (req bookRequest) book(t *bookshop.Taxonomy) (bookshop.Book, *errorResponse) {
+	b := bookshop.Book{
+		ID:             req.ID,
+		Edition:        req.Edition,
+		Title:          req.Title,
+		Authors:        req.Authors,
+		Description:    req.Description,
+		ReleaseYear:    req.ReleaseYear,
+		SeriesNumber:   req.SeriesNumber,
+		PickOfTheMonth: req.PickOfTheMonth,
+	}
+
+	fields := make(map[string]string)
+	if strings.TrimSpace(b.Title) == "" {
+		fields["title"] = "missing book title"
+	}
+	if err := b.SetISBN(req.ISBN); err != nil {
+		fields["isbn"] = err.Error()
+	}
+	if req.Format != "" {
+		f, err := bookshop.ParseFormat(req.Format)
+		if err != nil {
+			fields["format"] = err.Error()
+		}
+		b.Format = f
+	}
+	currency := bookshop.DefaultCurrency
+	if req.Currency != "" {
+		c, err := money.ParseCurrency(req.Currency)
+		if err != nil {
+			fields["currency"] = err.Error()
+		}
+		currency = c
+	}
+	if req.PriceCents != 0 || req.Currency != "" {
+		if err := b.SetPrice(money.New(req.PriceCents, currency)); err != nil && fields["currency"] == "" {
+			fields["price_cents"] = err.Error()
+		}
+	}
+	for code, cents := range req.Prices {
+		c, err := money.ParseCurrency(code)
+		if err == nil {
+			err = b.SetPriceIn(money.New(cents, c))
+		}
+		if err != nil {
+			fields["prices"] = err.Error()
+		}
+	}
+	if err := b.SetDiscountPercent(req.Discount); err != nil {
+		fields["discount"] = err.Error()
+	}
+	categories := req.Categories
+	if len(categories) == 0 {
+		categories = []int{req.Category}
+	}
+	if err := b.SetCategories(categories...); err != nil {
+		fields["category"] = err.Error()
+	} else if err := t.Validate(categories...); err != nil {
+		fields["category"] = err.Error()
+	}
+
+	if len(fields) > 0 {
+		return bookshop.Book{}, &errorResponse{Message: "invalid book", Fields: fields}
+	}
+	return b, nil
+}
+
+// errorResponse is the body of error responses. Fields holds
+// validation errors keyed by the JSON field name.
+type errorResponse struct {
+	Message string            `json:"error"`
+	Fields  map[string]string `json:"fields,omitempty"`
+}
+
+func decodeBody(w http.ResponseWriter, r *http.Request, v interface{}) bool {
+	dec := json.NewDecoder(http.MaxBytesReader(w, r.Body, maxBodyBytes))
+	dec.DisallowUnknownFields()
+	if err := dec.Decode(v); err != nil {
+		writeJSON(w, http.StatusBadRequest, &errorResponse{
+			Message: fmt.Sprintf("invalid request body: %v", err),
+		})
+		return false
+	}
+	return true
+}
+
+// writeStoreError writes the response of a failed store operation.
+// Internal errors are logged and not sent to the client.
+func (s *Server) writeStoreError(w http.ResponseWriter, r *http.Request, err error) {
+	switch {
+	case errors.Is(err, bookshop.ErrBookNotFound):
+		writeError(w, http.StatusNotFound, err.Error())
+	case errors.Is(err, bookshop.ErrDuplicateISBN):
+		writeError(w, http.StatusConflict, err.Error())
+	default:
+		s.logger.Printf("%s %s: %v", r.Method, r.URL.Path, err)
+		writeError(w, http.StatusInternalServerError, "internal server error")
+	}
+}
+
+func methodNotAllowed(w http.ResponseWriter, allowed ...string) {
+	w.Header().Set("Allow", strings.Join(allowed, ", "))
+	writeError(w, http.StatusMethodNotAllowed, "method not allowed")
+}
+
+func writeError(w http.ResponseWriter, status int, msg string) {
+	writeJSON(w, status, &errorResponse{Message: msg})
+}
+
+func writeJSON(w http.ResponseWriter, status int, v interface{}) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	json.NewEncoder(w).Encode(v)
+}
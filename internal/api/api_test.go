@@ -0,0 +1,326 @@
+package api_test
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"log"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+
+	"github.com/google/go-cmp/cmp"
+	"github.com/qba73/bookshop/internal/api"
+	"github.com/qba73/bookshop/internal/bookshop"
+)
+
+func newTestServer() *api.Server {
+	return api.NewServer(bookshop.NewCatalog(bookshop.NewMemoryStore(bookshop.Books)))
+}
+
+func TestServer(t *testing.T) {
+	t.Parallel()
+
+	tt := []struct {
+		name       string
+		method     string
+		target     string
+		body       string
+		wantStatus int
+		wantBody   string
+	}{
+		{
+			name: "List authors", method: http.MethodGet, target: "/authors", wantStatus: http.StatusOK,
+			wantBody: `["Bolek","Gienek","Gizmo","Papcio Chmiel","Zigmas Laurin"]`,
+		},
+		{
+			name: "Get book", method: http.MethodGet, target: "/books/1912bbf7-3f26-4196-b062-071b81b855e9", wantStatus: http.StatusOK,
+			wantBody: `{"id":"1912bbf7-3f26-4196-b062-071b81b855e9","edition":1,"title":"Bolek i Lolek","authors":["Bolek"],"description":"description","release_year":1997,"series_number":1,"price_cents":2000,"currency":"PLN","pick_of_the_month":true,"discount":20,"category":1}`,
+		},
+		{
+			name: "Get missing book", method: http.MethodGet, target: "/books/missing", wantStatus: http.StatusNotFound,
+			wantBody: `{"error":"book id missing: book not found"}`,
+		},
+		{
+			name: "List books by author", method: http.MethodGet, target: "/books?author=Gizmo", wantStatus: http.StatusOK,
+			wantBody: `[{"id":"1923bbf9-4f36-4196-b062-171b81b855e9","edition":1,"title":"Pan Samochodzik","authors":["Papcio Chmiel","Zigmas Laurin","Gizmo"],"description":"description","release_year":2011,"series_number":1,"price_cents":1000,"currency":"PLN","pick_of_the_month":true,"discount":5,"category":1}]`,
+		},
+		{
+			name: "Create book", method: http.MethodPost, target: "/books", wantStatus: http.StatusCreated,
+			body:     `{"id":"2a56f3c1-8d0e-4c43-9b7e-5a1de2f0c7aa","title":"Tytus, Romek i A'Tomek","authors":["Papcio Chmiel"],"price_cents":1500,"discount":10,"category":3}`,
+			wantBody: `{"id":"2a56f3c1-8d0e-4c43-9b7e-5a1de2f0c7aa","edition":0,"title":"Tytus, Romek i A'Tomek","authors":["Papcio Chmiel"],"description":"","release_year":0,"series_number":0,"price_cents":1500,"currency":"PLN","pick_of_the_month":false,"discount":10,"category":3}`,
+		},
+		{
+			name: "Create book priced in euro", method: http.MethodPost, target: "/books", wantStatus: http.StatusCreated,
+			body:     `{"id":"3b67a4d2-9e1f-4d54-8c8f-6b2ef3a1d8bb","title":"Tytus","price_cents":1250,"currency":"eur","category":3}`,
+			wantBody: `{"id":"3b67a4d2-9e1f-4d54-8c8f-6b2ef3a1d8bb","edition":0,"title":"Tytus","authors":null,"description":"","release_year":0,"series_number":0,"price_cents":1250,"currency":"EUR","pick_of_the_month":false,"discount":0,"category":3}`,
+		},
+		{
+			name: "Create book with price list", method: http.MethodPost, target: "/books", wantStatus: http.StatusCreated,
+			body:     `{"id":"4c78b5e3-af20-4e65-9d90-7c3f04b2e9cc","title":"Kajko","price_cents":4500,"currency":"PLN","prices":{"eur":999,"GBP":849},"category":3}`,
+			wantBody: `{"id":"4c78b5e3-af20-4e65-9d90-7c3f04b2e9cc","edition":0,"title":"Kajko","authors":null,"description":"","release_year":0,"series_number":0,"price_cents":4500,"currency":"PLN","prices":{"EUR":999,"GBP":849},"pick_of_the_month":false,"discount":0,"category":3}`,
+		},
+		{
+			name: "Create book with invalid price list", method: http.MethodPost, target: "/books", wantStatus: http.StatusBadRequest,
+			body:     `{"title":"Kajko","price_cents":4500,"prices":{"EUR":-1},"category":3}`,
+			wantBody: `{"error":"invalid book","fields":{"prices":"Invalid book price: -0.01 EUR"}}`,
+		},
+		{
+			name: "Create e-book", method: http.MethodPost, target: "/books", wantStatus: http.StatusCreated,
+			body:     `{"id":"5d89c6f4-b031-4f76-8ea1-8d4015c3fadd","title":"Kajko","format":"EBOOK","price_cents":2500,"currency":"PLN","category":3}`,
+			wantBody: `{"id":"5d89c6f4-b031-4f76-8ea1-8d4015c3fadd","edition":0,"title":"Kajko","authors":null,"description":"","release_year":0,"series_number":0,"format":"ebook","price_cents":2500,"currency":"PLN","pick_of_the_month":false,"discount":0,"category":3}`,
+		},
+		{
+			name: "Create book with invalid format", method: http.MethodPost, target: "/books", wantStatus: http.StatusBadRequest,
+			body:     `{"title":"Kajko","format":"scroll","price_cents":2500,"currency":"PLN","category":3}`,
+			wantBody: `{"error":"invalid book","fields":{"format":"invalid book format: \"scroll\""}}`,
+		},
+		{
+			name: "Create book with invalid currency", method: http.MethodPost, target: "/books", wantStatus: http.StatusBadRequest,
+			body:     `{"title":"Tytus","price_cents":1250,"currency":"zloty","category":3}`,
+			wantBody: `{"error":"invalid book","fields":{"currency":"invalid currency: \"zloty\""}}`,
+		},
+		{
+			name: "Create existing book", method: http.MethodPost, target: "/books", wantStatus: http.StatusConflict,
+			body:     `{"id":"1912bbf7-3f26-4196-b062-071b81b855e9","title":"Bolek i Lolek"}`,
+			wantBody: `{"error":"book id 1912bbf7-3f26-4196-b062-071b81b855e9 already exists"}`,
+		},
+		{
+			name: "Create invalid book", method: http.MethodPost, target: "/books", wantStatus: http.StatusBadRequest,
+			body:     `{"title":"Bolek i Lolek","price_cents":-100,"discount":120}`,
+			wantBody: `{"error":"invalid book","fields":{"discount":"Invalid discount value: 120","price_cents":"Invalid book price: -1.00 PLN"}}`,
+		},
+		{
+			name: "Create book with unknown category", method: http.MethodPost, target: "/books", wantStatus: http.StatusBadRequest,
+			body:     `{"title":"Bolek i Lolek","categories":[1,42]}`,
+			wantBody: `{"error":"invalid book","fields":{"category":"category id 42: category not found"}}`,
+		},
+		{
+			name: "Create book with many categories", method: http.MethodPost, target: "/books", wantStatus: http.StatusCreated,
+			body:     `{"id":"2a56f3c1-8d0e-4c43-9b7e-5a1de2f0c7aa","title":"Go","categories":[3,1]}`,
+			wantBody: `{"id":"2a56f3c1-8d0e-4c43-9b7e-5a1de2f0c7aa","edition":0,"title":"Go","authors":null,"description":"","release_year":0,"series_number":0,"price_cents":0,"pick_of_the_month":false,"discount":0,"category":3,"categories":[3,1]}`,
+		},
+		{
+			name: "Create book with ISBN-10", method: http.MethodPost, target: "/books", wantStatus: http.StatusCreated,
+			body:     `{"id":"2a56f3c1-8d0e-4c43-9b7e-5a1de2f0c7aa","title":"Go","isbn":"0-306-40615-2"}`,
+			wantBody: `{"id":"2a56f3c1-8d0e-4c43-9b7e-5a1de2f0c7aa","isbn":"9780306406157","edition":0,"title":"Go","authors":null,"description":"","release_year":0,"series_number":0,"price_cents":0,"pick_of_the_month":false,"discount":0,"category":0}`,
+		},
+		{
+			name: "Create book with invalid ISBN", method: http.MethodPost, target: "/books", wantStatus: http.StatusBadRequest,
+			body:     `{"title":"Go","isbn":"978-0-306-40615-8"}`,
+			wantBody: `{"error":"invalid book","fields":{"isbn":"invalid ISBN: 978-0-306-40615-8: wrong check digit"}}`,
+		},
+		{
+			name: "Create book with unknown field", method: http.MethodPost, target: "/books", wantStatus: http.StatusBadRequest,
+			body:     `{"title":"Bolek i Lolek","colour":"red"}`,
+			wantBody: `{"error":"invalid request body: json: unknown field \"colour\""}`,
+		},
+		{
+			name: "Update book", method: http.MethodPut, target: "/books/1912abf7-3f26-4196-b062-011b81b255e9", wantStatus: http.StatusOK,
+			body:     `{"title":"Tytus","authors":["Gienek"],"price_cents":3500,"discount":0}`,
+			wantBody: `{"id":"1912abf7-3f26-4196-b062-011b81b255e9","edition":0,"title":"Tytus","authors":["Gienek"],"description":"","release_year":0,"series_number":0,"price_cents":3500,"currency":"PLN","pick_of_the_month":false,"discount":0,"category":0}`,
+		},
+		{
+			name: "Update book with mismatched id", method: http.MethodPut, target: "/books/1912abf7-3f26-4196-b062-011b81b255e9", wantStatus: http.StatusBadRequest,
+			body:     `{"id":"other","title":"Tytus"}`,
+			wantBody: `{"error":"invalid book","fields":{"id":"book id does not match the URL"}}`,
+		},
+		{
+			name: "Update missing book", method: http.MethodPut, target: "/books/missing", wantStatus: http.StatusNotFound,
+			body:     `{"title":"Tytus"}`,
+			wantBody: `{"error":"book id missing: book not found"}`,
+		},
+		{
+			name: "Delete book", method: http.MethodDelete, target: "/books/2922bbf7-3g26-4196-b062-071b81b855e9", wantStatus: http.StatusNoContent,
+		},
+		{
+			name: "Method not allowed", method: http.MethodPatch, target: "/books", wantStatus: http.StatusMethodNotAllowed,
+			wantBody: `{"error":"method not allowed"}`,
+		},
+	}
+
+	for _, tc := range tt {
+		tc := tc
+		t.Run(tc.name, func(t *testing.T) {
+			t.Parallel()
+
+			req := httptest.NewRequest(tc.method, tc.target, strings.NewReader(tc.body))
+			rec := httptest.NewRecorder()
+
+			newTestServer().ServeHTTP(rec, req)
+
+			if rec.Code != tc.wantStatus {
+				t.Errorf("%s %s %s = %d, want: %d", tc.name, tc.method, tc.target, rec.Code, tc.wantStatus)
+			}
+
+			got := strings.TrimSpace(rec.Body.String())
+			if !cmp.Equal(got, tc.wantBody) {
+				t.Errorf("%s %s %s body\n%s", tc.name, tc.method, tc.target, cmp.Diff(tc.wantBody, got))
+			}
+		})
+	}
+}
+
+func TestServerISBN(t *testing.T) {
+	t.Parallel()
+
+	srv := newTestServer()
+
+	posts := []struct {
+		body       string
+		wantStatus int
+	}{
+		{body: `{"id":"a","title":"Go","isbn":"978-0-306-40615-7"}`, wantStatus: http.StatusCreated},
+		{body: `{"id":"b","title":"Go again","isbn":"0306406152"}`, wantStatus: http.StatusConflict},
+	}
+	for _, p := range posts {
+		rec := httptest.NewRecorder()
+		srv.ServeHTTP(rec, httptest.NewRequest(http.MethodPost, "/books", strings.NewReader(p.body)))
+		if rec.Code != p.wantStatus {
+			t.Fatalf("POST %s = %d %s, want: %d", p.body, rec.Code, rec.Body, p.wantStatus)
+		}
+	}
+
+	tt := []struct {
+		target     string
+		wantStatus int
+		wantBody   string
+	}{
+		{target: "/books?isbn=0-306-40615-2", wantStatus: http.StatusOK, wantBody: `[{"id":"a","isbn":"9780306406157","edition":0,"title":"Go","authors":null,"description":"","release_year":0,"series_number":0,"price_cents":0,"pick_of_the_month":false,"discount":0,"category":0}]`},
+		{target: "/books?isbn=9781234567897", wantStatus: http.StatusOK, wantBody: `[]`},
+		{target: "/books?isbn=123", wantStatus: http.StatusBadRequest, wantBody: `{"error":"invalid ISBN: 123: want 10 or 13 digits, got 3"}`},
+	}
+
+	for _, tc := range tt {
+		rec := httptest.NewRecorder()
+		srv.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, tc.target, nil))
+		if rec.Code != tc.wantStatus {
+			t.Errorf("GET %s status = %d, want: %d", tc.target, rec.Code, tc.wantStatus)
+		}
+		if got := strings.TrimSpace(rec.Body.String()); got != tc.wantBody {
+			t.Errorf("GET %s \n%s", tc.target, cmp.Diff(tc.wantBody, got))
+		}
+	}
+}
+
+func TestServerCreateConcurrent(t *testing.T) {
+	t.Parallel()
+
+	srv := newTestServer()
+
+	codes := make([]int, 10)
+	var wg sync.WaitGroup
+	for i := range codes {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			rec := httptest.NewRecorder()
+			srv.ServeHTTP(rec, httptest.NewRequest(http.MethodPost, "/books", strings.NewReader(`{"id":"kozio","title":"Koziolek Matolek","authors":["Kornel"]}`)))
+			codes[i] = rec.Code
+		}(i)
+	}
+	wg.Wait()
+
+	count := make(map[int]int)
+	for _, c := range codes {
+		count[c]++
+	}
+	want := map[int]int{http.StatusCreated: 1, http.StatusConflict: 9}
+	if !cmp.Equal(want, count) {
+		t.Errorf("POST /books status codes:\n%s", cmp.Diff(want, count))
+	}
+}
+
+func TestServerUpdateDeleteConcurrent(t *testing.T) {
+	t.Parallel()
+
+	const target = "/books/1912abf7-3f26-4196-b062-011b81b255e9"
+	srv := newTestServer()
+
+	var wg sync.WaitGroup
+	for i := 0; i < 10; i++ {
+		wg.Add(2)
+		go func() {
+			defer wg.Done()
+			rec := httptest.NewRecorder()
+			srv.ServeHTTP(rec, httptest.NewRequest(http.MethodPut, target, strings.NewReader(`{"title":"Tytus"}`)))
+			if rec.Code != http.StatusOK && rec.Code != http.StatusNotFound {
+				t.Errorf("PUT %s = %d, want: %d or %d", target, rec.Code, http.StatusOK, http.StatusNotFound)
+			}
+		}()
+		go func() {
+			defer wg.Done()
+			srv.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest(http.MethodDelete, target, nil))
+		}()
+	}
+	wg.Wait()
+
+	rec := httptest.NewRecorder()
+	srv.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, target, nil))
+	if rec.Code != http.StatusNotFound {
+		t.Errorf("GET %s after DELETE = %d, want: %d", target, rec.Code, http.StatusNotFound)
+	}
+}
+
+// failingStore is a store failing to read books.
+type failingStore struct {
+	bookshop.Store
+}
+
+func (failingStore) Get(id string) (bookshop.Book, error) {
+	return bookshop.Book{}, errors.New("reading /var/lib/bookshop/books.json: input/output error")
+}
+
+func TestServerInternalError(t *testing.T) {
+	t.Parallel()
+
+	var logs bytes.Buffer
+	srv := api.NewServer(bookshop.NewCatalog(failingStore{bookshop.NewMemoryStore(nil)}))
+	srv.SetLogger(log.New(&logs, "", 0))
+
+	rec := httptest.NewRecorder()
+	srv.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/books/1", nil))
+
+	if rec.Code != http.StatusInternalServerError {
+		t.Errorf("GET /books/1 = %d, want: %d", rec.Code, http.StatusInternalServerError)
+	}
+	want := `{"error":"internal server error"}`
+	if got := strings.TrimSpace(rec.Body.String()); got != want {
+		t.Errorf("GET /books/1 body\n%s", cmp.Diff(want, got))
+	}
+	wantLog := "GET /books/1: reading /var/lib/bookshop/books.json: input/output error\n"
+	if got := logs.String(); got != wantLog {
+		t.Errorf("logged\n%s", cmp.Diff(wantLog, got))
+	}
+}
+
+func TestServerCreateThenGet(t *testing.T) {
+	t.Parallel()
+
+	srv := newTestServer()
+
+	rec := httptest.NewRecorder()
+	srv.ServeHTTP(rec, httptest.NewRequest(http.MethodPost, "/books", strings.NewReader(`{"title":"Koziolek Matolek","authors":["Kornel"]}`)))
+	if rec.Code != http.StatusCreated {
+		t.Fatalf("POST /books = %d, want: %d", rec.Code, http.StatusCreated)
+	}
+
+	var created bookshop.Book
+	if err := json.Unmarshal(rec.Body.Bytes(), &created); err != nil {
+		t.Fatal(err)
+	}
+	if created.ID == "" {
+		t.Fatal("POST /books did not generate book id")
+	}
+	if loc := rec.Header().Get("Location"); loc != "/books/"+created.ID {
+		t.Errorf("POST /books Location = %s, want: /books/%s", loc, created.ID)
+	}
+
+	rec = httptest.NewRecorder()
+	srv.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/books/"+created.ID, nil))
+	if rec.Code != http.StatusOK {
+		t.Errorf("GET /books/%s = %d, want: %d", created.ID, rec.Code, http.StatusOK)
+	}
+}
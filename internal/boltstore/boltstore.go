@@ -0,0 +1,861 @@
+// Package boltstore provides an embedded, single file, transactional
+// database for books, orders, customers, coupons and invoices built
+// on top of bbolt.
+package boltstore
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/qba73/bookshop/internal/bookshop"
+	"github.com/qba73/bookshop/internal/bookshop/order"
+	"github.com/qba73/bookshop/internal/coupon"
+	"github.com/qba73/bookshop/internal/inventory"
+	"github.com/qba73/bookshop/internal/invoice"
+	bolt "go.etcd.io/bbolt"
+)
+
+var (
+	booksBucket = []byte("books")
+	// bookISBNsBucket maps ISBNs to book IDs.
+	bookISBNsBucket = []byte("book_isbns")
+	ordersBucket    = []byte("orders")
+	customersBucket = []byte("customers")
+	// customerEmailsBucket maps normalized customer
+	// emails to customer IDs.
+	customerEmailsBucket = []byte("customer_emails")
+	stockBucket          = []byte("stock")
+	couponsBucket        = []byte("coupons")
+	// redemptionsBucket holds redemptions of each coupon
+	// keyed by the coupon code.
+	redemptionsBucket = []byte("redemptions")
+	invoicesBucket    = []byte("invoices")
+	// invoiceSeqBucket holds the last number issued
+	// in each invoice series.
+	invoiceSeqBucket = []byte("invoice_seq")
+	// orderInvoicesBucket holds numbers of invoices of each
+	// order, in the order they were issued.
+	orderInvoicesBucket = []byte("order_invoices")
+)
+
+var (
+	// ErrOrderNotFound is returned when an order does not exist.
+	ErrOrderNotFound = errors.New("order not found")
+	// ErrCustomerNotFound is returned when a customer does not exist.
+	ErrCustomerNotFound = bookshop.ErrCustomerNotFound
+)
+
+// DB represents the bookshop database stored in a single file.
+// DB implements bookshop.Store, so it can back a Catalog directly,
+// bookshop.CustomerStore and inventory.Store, so stock taken by
+// placed orders and by inventory reservations is the same.
+type DB struct {
+	bolt *bolt.DB
+}
+
+// Open knows how to open the database file at the given path.
+// The file is created if it does not exist. The index of book ISBNs
+// is built when a database created without it is opened.
+func Open(path string) (*DB, error) {
+	b, err := bolt.Open(path, 0600, &bolt.Options{Timeout: time.Second})
+	if err != nil {
+		return nil, fmt.Errorf("opening database %s: %w", path, err)
+	}
+
+	err = b.Update(func(tx *bolt.Tx) error {
+		for _, name := range [][]byte{
+			booksBucket, ordersBucket, customersBucket, customerEmailsBucket, stockBucket, couponsBucket,
+			redemptionsBucket, invoicesBucket, invoiceSeqBucket, orderInvoicesBucket,
+		} {
+			if _, err := tx.CreateBucketIfNotExists(name); err != nil {
+				return err
+			}
+		}
+		if tx.Bucket(bookISBNsBucket) != nil {
+			return nil
+		}
+		if _, err := tx.CreateBucket(bookISBNsBucket); err != nil {
+			return err
+		}
+		return (&Tx{tx: tx}).indexISBNs()
+	})
+	if err != nil {
+		b.Close()
+		return nil, err
+	}
+
+	return &DB{bolt: b}, nil
+}
+
+// Close releases the database file.
+func (db *DB) Close() error {
+	return db.bolt.Close()
+}
+
+// Update executes fn within a read-write transaction. All writes
+// made by fn are committed together when it returns nil and
+// discarded when it returns an error.
+func (db *DB) Update(fn func(tx *Tx) error) error {
+	return db.bolt.Update(func(tx *bolt.Tx) error {
+		return fn(&Tx{tx: tx})
+	})
+}
+
+// View executes fn within a read-only transaction.
+func (db *DB) View(fn func(tx *Tx) error) error {
+	return db.bolt.View(func(tx *bolt.Tx) error {
+		return fn(&Tx{tx: tx})
+	})
+}
+
+// Get returns a book with the given ID.
+func (db *DB) Get(id string) (bookshop.Book, error) {
+	var b bookshop.Book
+	err := db.View(func(tx *Tx) error {
+		var err error
+		b, err = tx.Book(id)
+		return err
+	})
+	return b, err
+}
+
+// GetByISBN returns a book with the given ISBN-13.
+func (db *DB) GetByISBN(isbn string) (bookshop.Book, error) {
+	var b bookshop.Book
+	err := db.View(func(tx *Tx) error {
+		var err error
+		b, err = tx.BookByISBN(isbn)
+		return err
+	})
+	return b, err
+}
+
+// Put adds a new book or replaces an existing one with the same ID.
+func (db *DB) Put(b bookshop.Book) error {
+	return db.Update(func(tx *Tx) error {
+		return tx.PutBook(b)
+	})
+}
+
+// Create adds a new book. It returns bookshop.ErrBookExists
+// when a book with the same ID already exists.
+func (db *DB) Create(b bookshop.Book) error {
+	return db.Update(func(tx *Tx) error {
+		return tx.CreateBook(b)
+	})
+}
+
+// Replace replaces an existing book with the same ID. It returns
+// bookshop.ErrBookNotFound when the book does not exist.
+func (db *DB) Replace(b bookshop.Book) error {
+	return db.Update(func(tx *Tx) error {
+		return tx.ReplaceBook(b)
+	})
+}
+
+// Delete removes a book with the given ID.
+func (db *DB) Delete(id string) error {
+	return db.Update(func(tx *Tx) error {
+		return tx.DeleteBook(id)
+	})
+}
+
+// List returns all books sorted by ID.
+func (db *DB) List() ([]bookshop.Book, error) {
+	var books []bookshop.Book
+	err := db.View(func(tx *Tx) error {
+		var err error
+		books, err = tx.Books()
+		return err
+	})
+	return books, err
+}
+
+// PlaceOrder knows how to place a draft order and take its items
+// from stock in a single transaction. Either the order is stored
+// as placed and stock is decremented, or nothing changes and the
+// error explains why, for example *inventory.OutOfStockError.
+// Orders of customers must name a customer in the database.
+// Stock is shared with inventory.Inventory using the database as
+// its store. Copies it holds in memory are not seen here, so its
+// reservations fail to commit once the copies are taken.
+func (db *DB) PlaceOrder(o *order.Order) error {
+	placed := *o
+	placed.History = append([]order.Transition(nil), o.History...)
+	if err := placed.Place(); err != nil {
+		return err
+	}
+
+	err := db.Update(func(tx *Tx) error {
+		if placed.CustomerID != "" {
+			if _, err := tx.Customer(placed.CustomerID); err != nil {
+				return fmt.Errorf("order %s: %w", placed.ID(), err)
+			}
+		}
+		want := make(map[string]int)
+		for _, it := range placed.Items {
+			want[it.BookID] += it.Quantity
+		}
+		if err := tx.Take(want); err != nil {
+			return fmt.Errorf("order %s: %w", placed.ID(), err)
+		}
+		return tx.PutOrder(&placed)
+	})
+	if err != nil {
+		return err
+	}
+
+	*o = placed
+	return nil
+}
+
+// Stock returns stock level of the book.
+func (db *DB) Stock(bookID string) (inventory.Level, error) {
+	var l inventory.Level
+	err := db.View(func(tx *Tx) error {
+		var err error
+		l, err = tx.Stock(bookID)
+		return err
+	})
+	return l, err
+}
+
+// Restock knows how to add quantity copies of the book.
+func (db *DB) Restock(bookID string, quantity int) error {
+	return db.Update(func(tx *Tx) error {
+		return tx.Restock(bookID, quantity)
+	})
+}
+
+// Take removes sold copies of the books, either all of them or none.
+func (db *DB) Take(quantity map[string]int) error {
+	return db.Update(func(tx *Tx) error {
+		return tx.Take(quantity)
+	})
+}
+
+// Levels returns stock of all books ever restocked, sorted by book ID.
+func (db *DB) Levels() ([]inventory.Level, error) {
+	var levels []inventory.Level
+	err := db.View(func(tx *Tx) error {
+		var err error
+		levels, err = tx.Levels()
+		return err
+	})
+	return levels, err
+}
+
+// Customer returns a customer with the given ID.
+func (db *DB) Customer(id string) (bookshop.Customer, error) {
+	var c bookshop.Customer
+	err := db.View(func(tx *Tx) error {
+		var err error
+		c, err = tx.Customer(id)
+		return err
+	})
+	return c, err
+}
+
+// CustomerByEmail returns a customer with the given email, ignoring case.
+func (db *DB) CustomerByEmail(email string) (bookshop.Customer, error) {
+	var c bookshop.Customer
+	err := db.View(func(tx *Tx) error {
+		var err error
+		c, err = tx.CustomerByEmail(email)
+		return err
+	})
+	return c, err
+}
+
+// PutCustomer adds a new customer or replaces an existing one
+// with the same ID. Emails are checked in the same transaction,
+// so concurrent writes cannot store two customers with one email.
+func (db *DB) PutCustomer(c bookshop.Customer) error {
+	return db.Update(func(tx *Tx) error {
+		return tx.PutCustomer(c)
+	})
+}
+
+// DeleteCustomer removes a customer with the given ID.
+func (db *DB) DeleteCustomer(id string) error {
+	return db.Update(func(tx *Tx) error {
+		return tx.DeleteCustomer(id)
+	})
+}
+
+// Customers returns all customers sorted by ID.
+func (db *DB) Customers() ([]bookshop.Customer, error) {
+	var cs []bookshop.Customer
+	err := db.View(func(tx *Tx) error {
+		var err error
+		cs, err = tx.Customers()
+		return err
+	})
+	return cs, err
+}
+
+// Coupon returns a coupon with the given code.
+func (db *DB) Coupon(code string) (coupon.Coupon, error) {
+	var c coupon.Coupon
+	err := db.View(func(tx *Tx) error {
+		var err error
+		c, err = tx.Coupon(code)
+		return err
+	})
+	return c, err
+}
+
+// PutCoupon adds a new coupon or replaces an existing one
+// with the same code.
+func (db *DB) PutCoupon(c coupon.Coupon) error {
+	return db.Update(func(tx *Tx) error {
+		return tx.PutCoupon(c)
+	})
+}
+
+// Redemptions returns redemptions of the coupon, oldest first.
+func (db *DB) Redemptions(code string) ([]coupon.Redemption, error) {
+	var rs []coupon.Redemption
+	err := db.View(func(tx *Tx) error {
+		var err error
+		rs, err = tx.Redemptions(code)
+		return err
+	})
+	return rs, err
+}
+
+// Redeem records the redemption, provided the coupon limits
+// allow it. Limits are checked in the same transaction, so
+// concurrent redemptions cannot go over them.
+func (db *DB) Redeem(r coupon.Redemption) error {
+	return db.Update(func(tx *Tx) error {
+		return tx.Redeem(r)
+	})
+}
+
+// Cancel removes the redemption of the coupon with the order.
+func (db *DB) Cancel(code, orderID string) error {
+	return db.Update(func(tx *Tx) error {
+		return tx.CancelRedemption(code, orderID)
+	})
+}
+
+// Issue numbers the invoice with the next number of its series
+// and saves it. The number is assigned in the same transaction
+// the invoice is saved in, so there are no gaps in a series.
+func (db *DB) Issue(inv *invoice.Invoice) error {
+	return db.Update(func(tx *Tx) error {
+		return tx.IssueInvoice(inv)
+	})
+}
+
+// Invoice returns the invoice with the given number.
+func (db *DB) Invoice(number string) (invoice.Invoice, error) {
+	var inv invoice.Invoice
+	err := db.View(func(tx *Tx) error {
+		var err error
+		inv, err = tx.Invoice(number)
+		return err
+	})
+	return inv, err
+}
+
+// OrderInvoices returns the invoice of the order and its
+// corrections, in the order they were issued.
+func (db *DB) OrderInvoices(orderID string) ([]invoice.Invoice, error) {
+	var invs []invoice.Invoice
+	err := db.View(func(tx *Tx) error {
+		var err error
+		invs, err = tx.OrderInvoices(orderID)
+		return err
+	})
+	return invs, err
+}
+
+// Tx represents a database transaction.
+type Tx struct {
+	tx *bolt.Tx
+}
+
+// Book returns a book with the given ID.
+func (t *Tx) Book(id string) (bookshop.Book, error) {
+	var b bookshop.Book
+	if err := t.get(booksBucket, id, &b); err != nil {
+		if errors.Is(err, errNotFound) {
+			return bookshop.Book{}, fmt.Errorf("book id %s: %w", id, bookshop.ErrBookNotFound)
+		}
+		return bookshop.Book{}, err
+	}
+	return b, nil
+}
+
+// BookByISBN returns a book with the given ISBN-13.
+func (t *Tx) BookByISBN(isbn string) (bookshop.Book, error) {
+	id := t.tx.Bucket(bookISBNsBucket).Get([]byte(isbn))
+	if id == nil {
+		return bookshop.Book{}, fmt.Errorf("isbn %s: %w", isbn, bookshop.ErrBookNotFound)
+	}
+	return t.Book(string(id))
+}
+
+// PutBook adds a new book or replaces an existing one with the same ID.
+// It returns an error matching bookshop.ErrDuplicateISBN when another
+// book has the same ISBN.
+func (t *Tx) PutBook(b bookshop.Book) error {
+	if b.ID == "" {
+		return errors.New("invalid book id")
+	}
+	if err := t.checkISBN(b); err != nil {
+		return err
+	}
+	old, err := t.Book(b.ID)
+	switch {
+	case err == nil:
+		if err := t.unindexISBN(old); err != nil {
+			return err
+		}
+	case !errors.Is(err, bookshop.ErrBookNotFound):
+		return err
+	}
+	if err := t.indexISBN(b); err != nil {
+		return err
+	}
+	return t.put(booksBucket, b.ID, b)
+}
+
+// CreateBook adds a new book. It returns bookshop.ErrBookExists
+// when a book with the same ID already exists.
+func (t *Tx) CreateBook(b bookshop.Book) error {
+	if b.ID == "" {
+		return errors.New("invalid book id")
+	}
+	if t.tx.Bucket(booksBucket).Get([]byte(b.ID)) != nil {
+		return fmt.Errorf("book id %s: %w", b.ID, bookshop.ErrBookExists)
+	}
+	if err := t.checkISBN(b); err != nil {
+		return err
+	}
+	if err := t.indexISBN(b); err != nil {
+		return err
+	}
+	return t.put(booksBucket, b.ID, b)
+}
+
+// ReplaceBook replaces an existing book with the same ID. It returns
+// bookshop.ErrBookNotFound when the book does not exist.
+func (t *Tx) ReplaceBook(b bookshop.Book) error {
+	if _, err := t.Book(b.ID); err != nil {
+		return err
+	}
+	return t.PutBook(b)
+}
+
+// DeleteBook removes a book with the given ID.
+func (t *Tx) DeleteBook(id string) error {
+	b, err := t.Book(id)
+	if err != nil {
+		return err
+	}
+	if err := t.unindexISBN(b); err != nil {
+		return err
+	}
+	return t.delete(booksBucket, id)
+}
+
+// checkISBN returns an error matching bookshop.ErrDuplicateISBN
+// when another book has the ISBN of b.
+func (t *Tx) checkISBN(b bookshop.Book) error {
+	if b.ISBN == "" {
+		return nil
+	}
+	if id := t.tx.Bucket(bookISBNsBucket).Get([]byte(b.ISBN)); id != nil && string(id) != b.ID {
+		return fmt.Errorf("isbn %s of book id %s: %w", b.ISBN, id, bookshop.ErrDuplicateISBN)
+	}
+	return nil
+}
+
+// indexISBN adds the ISBN of the book to the index.
+func (t *Tx) indexISBN(b bookshop.Book) error {
+	if b.ISBN == "" {
+		return nil
+	}
+	return t.tx.Bucket(bookISBNsBucket).Put([]byte(b.ISBN), []byte(b.ID))
+}
+
+// unindexISBN removes the ISBN of the book from the index.
+func (t *Tx) unindexISBN(b bookshop.Book) error {
+	if b.ISBN == "" {
+		return nil
+	}
+	return t.tx.Bucket(bookISBNsBucket).Delete([]byte(b.ISBN))
+}
+
+// indexISBNs builds the index of ISBNs of all books. It returns
+// an error matching bookshop.ErrDuplicateISBN when books share
+// an ISBN.
+func (t *Tx) indexISBNs() error {
+	books, err := t.Books()
+	if err != nil {
+		return err
+	}
+	for _, b := range books {
+		if err := t.checkISBN(b); err != nil {
+			return err
+		}
+		if err := t.indexISBN(b); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// Books returns all books sorted by ID.
+func (t *Tx) Books() ([]bookshop.Book, error) {
+	var books []bookshop.Book
+	err := t.tx.Bucket(booksBucket).ForEach(func(k, v []byte) error {
+		var b bookshop.Book
+		if err := json.Unmarshal(v, &b); err != nil {
+			return fmt.Errorf("decoding book %s: %w", k, err)
+		}
+		books = append(books, b)
+		return nil
+	})
+	return books, err
+}
+
+// Order returns an order with the given ID.
+func (t *Tx) Order(id string) (*order.Order, error) {
+	var o order.Order
+	if err := t.get(ordersBucket, id, &o); err != nil {
+		if errors.Is(err, errNotFound) {
+			return nil, fmt.Errorf("order id %s: %w", id, ErrOrderNotFound)
+		}
+		return nil, err
+	}
+	return &o, nil
+}
+
+// PutOrder adds a new order or replaces an existing one with the same ID.
+func (t *Tx) PutOrder(o *order.Order) error {
+	if o == nil || o.ID() == "" {
+		return errors.New("invalid order id")
+	}
+	return t.put(ordersBucket, o.ID(), o)
+}
+
+// Orders returns all orders sorted by ID.
+func (t *Tx) Orders() ([]*order.Order, error) {
+	var orders []*order.Order
+	err := t.tx.Bucket(ordersBucket).ForEach(func(k, v []byte) error {
+		var o order.Order
+		if err := json.Unmarshal(v, &o); err != nil {
+			return fmt.Errorf("decoding order %s: %w", k, err)
+		}
+		orders = append(orders, &o)
+		return nil
+	})
+	return orders, err
+}
+
+// Customer returns a customer with the given ID.
+func (t *Tx) Customer(id string) (bookshop.Customer, error) {
+	var c bookshop.Customer
+	if err := t.get(customersBucket, id, &c); err != nil {
+		if errors.Is(err, errNotFound) {
+			return bookshop.Customer{}, fmt.Errorf("customer id %s: %w", id, ErrCustomerNotFound)
+		}
+		return bookshop.Customer{}, err
+	}
+	return c, nil
+}
+
+// CustomerByEmail returns a customer with the given email, ignoring case.
+func (t *Tx) CustomerByEmail(email string) (bookshop.Customer, error) {
+	id := t.tx.Bucket(customerEmailsBucket).Get([]byte(bookshop.NormalizeEmail(email)))
+	if id == nil {
+		return bookshop.Customer{}, fmt.Errorf("customer email %s: %w", email, ErrCustomerNotFound)
+	}
+	return t.Customer(string(id))
+}
+
+// PutCustomer adds a new customer or replaces an existing one
+// with the same ID. It returns an error matching
+// bookshop.ErrDuplicateEmail when another customer has
+// the same email.
+func (t *Tx) PutCustomer(c bookshop.Customer) error {
+	if err := c.Validate(); err != nil {
+		return err
+	}
+	emails := t.tx.Bucket(customerEmailsBucket)
+	email := []byte(bookshop.NormalizeEmail(c.Email))
+	if id := emails.Get(email); id != nil && string(id) != c.ID {
+		return fmt.Errorf("customer email %s: %w", c.Email, bookshop.ErrDuplicateEmail)
+	}
+	old, err := t.Customer(c.ID)
+	switch {
+	case err == nil:
+		if err := emails.Delete([]byte(bookshop.NormalizeEmail(old.Email))); err != nil {
+			return err
+		}
+	case !errors.Is(err, ErrCustomerNotFound):
+		return err
+	}
+	if err := emails.Put(email, []byte(c.ID)); err != nil {
+		return err
+	}
+	return t.put(customersBucket, c.ID, c)
+}
+
+// DeleteCustomer removes a customer with the given ID.
+func (t *Tx) DeleteCustomer(id string) error {
+	c, err := t.Customer(id)
+	if err != nil {
+		return err
+	}
+	if err := t.tx.Bucket(customerEmailsBucket).Delete([]byte(bookshop.NormalizeEmail(c.Email))); err != nil {
+		return err
+	}
+	return t.delete(customersBucket, id)
+}
+
+// Customers returns all customers sorted by ID.
+func (t *Tx) Customers() ([]bookshop.Customer, error) {
+	var customers []bookshop.Customer
+	err := t.tx.Bucket(customersBucket).ForEach(func(k, v []byte) error {
+		var c bookshop.Customer
+		if err := json.Unmarshal(v, &c); err != nil {
+			return fmt.Errorf("decoding customer %s: %w", k, err)
+		}
+		customers = append(customers, c)
+		return nil
+	})
+	return customers, err
+}
+
+// CustomerOrders returns orders of the customer with the given ID.
+func (t *Tx) CustomerOrders(id string) ([]*order.Order, error) {
+	orders, err := t.Orders()
+	if err != nil {
+		return nil, err
+	}
+	var placed []*order.Order
+	for _, o := range orders {
+		if o.CustomerID == id {
+			placed = append(placed, o)
+		}
+	}
+	return placed, nil
+}
+
+// Coupon returns a coupon with the given code.
+func (t *Tx) Coupon(code string) (coupon.Coupon, error) {
+	var c coupon.Coupon
+	if err := t.get(couponsBucket, coupon.Normalize(code), &c); err != nil {
+		if errors.Is(err, errNotFound) {
+			return coupon.Coupon{}, fmt.Errorf("coupon %s: %w", code, coupon.ErrNotFound)
+		}
+		return coupon.Coupon{}, err
+	}
+	return c, nil
+}
+
+// PutCoupon adds a new coupon or replaces an existing one
+// with the same code.
+func (t *Tx) PutCoupon(c coupon.Coupon) error {
+	if err := c.Validate(); err != nil {
+		return err
+	}
+	return t.put(couponsBucket, c.Code, c)
+}
+
+// Redemptions returns redemptions of the coupon, oldest first.
+func (t *Tx) Redemptions(code string) ([]coupon.Redemption, error) {
+	var rs []coupon.Redemption
+	if err := t.get(redemptionsBucket, coupon.Normalize(code), &rs); err != nil && !errors.Is(err, errNotFound) {
+		return nil, err
+	}
+	return rs, nil
+}
+
+// Redeem records the redemption, provided the coupon limits allow it.
+func (t *Tx) Redeem(r coupon.Redemption) error {
+	c, err := t.Coupon(r.Code)
+	if err != nil {
+		return err
+	}
+	past, err := t.Redemptions(c.Code)
+	if err != nil {
+		return err
+	}
+	if err := c.CanRedeem(past, r); err != nil {
+		return err
+	}
+	r.Code = c.Code
+	return t.put(redemptionsBucket, c.Code, coupon.Record(past, r))
+}
+
+// CancelRedemption removes the redemption of the coupon with the order.
+func (t *Tx) CancelRedemption(code, orderID string) error {
+	past, err := t.Redemptions(code)
+	if err != nil {
+		return err
+	}
+	return t.put(redemptionsBucket, coupon.Normalize(code), coupon.Remove(past, orderID))
+}
+
+// IssueInvoice numbers the invoice with the next number
+// of its series and saves it.
+func (t *Tx) IssueInvoice(inv *invoice.Invoice) error {
+	if err := inv.Validate(); err != nil {
+		return err
+	}
+	invs, err := t.OrderInvoices(inv.OrderID)
+	if err != nil {
+		return err
+	}
+	if err := inv.ValidateIssue(invs); err != nil {
+		return err
+	}
+
+	series := inv.Series()
+	var last int
+	if err := t.get(invoiceSeqBucket, series, &last); err != nil && !errors.Is(err, errNotFound) {
+		return err
+	}
+	inv.SetNumber(last + 1)
+	if err := t.put(invoiceSeqBucket, series, inv.Seq); err != nil {
+		return err
+	}
+	if err := t.put(invoicesBucket, inv.Number, inv); err != nil {
+		return err
+	}
+	numbers := make([]string, 0, len(invs)+1)
+	for _, v := range invs {
+		numbers = append(numbers, v.Number)
+	}
+	return t.put(orderInvoicesBucket, inv.OrderID, append(numbers, inv.Number))
+}
+
+// Invoice returns the invoice with the given number.
+func (t *Tx) Invoice(number string) (invoice.Invoice, error) {
+	var inv invoice.Invoice
+	if err := t.get(invoicesBucket, number, &inv); err != nil {
+		if errors.Is(err, errNotFound) {
+			return invoice.Invoice{}, fmt.Errorf("invoice %s: %w", number, invoice.ErrNotFound)
+		}
+		return invoice.Invoice{}, err
+	}
+	return inv, nil
+}
+
+// OrderInvoices returns the invoice of the order and its
+// corrections, in the order they were issued.
+func (t *Tx) OrderInvoices(orderID string) ([]invoice.Invoice, error) {
+	var numbers []string
+	if err := t.get(orderInvoicesBucket, orderID, &numbers); err != nil && !errors.Is(err, errNotFound) {
+		return nil, err
+	}
+	invs := make([]invoice.Invoice, 0, len(numbers))
+	for _, n := range numbers {
+		inv, err := t.Invoice(n)
+		if err != nil {
+			return nil, err
+		}
+		invs = append(invs, inv)
+	}
+	return invs, nil
+}
+
+// Stock returns stock level of the book. Books never
+// restocked have an empty level.
+func (t *Tx) Stock(bookID string) (inventory.Level, error) {
+	var l inventory.Level
+	if err := t.get(stockBucket, bookID, &l); err != nil {
+		if errors.Is(err, errNotFound) {
+			return inventory.Level{BookID: bookID}, nil
+		}
+		return inventory.Level{}, err
+	}
+	return l, nil
+}
+
+// PutStock stores stock level of the book.
+func (t *Tx) PutStock(l inventory.Level) error {
+	if l.BookID == "" {
+		return errors.New("invalid book id")
+	}
+	return t.put(stockBucket, l.BookID, l)
+}
+
+// Restock knows how to add quantity copies of the book.
+func (t *Tx) Restock(bookID string, quantity int) error {
+	if quantity <= 0 {
+		return fmt.Errorf("invalid quantity: %d", quantity)
+	}
+	l, err := t.Stock(bookID)
+	if err != nil {
+		return err
+	}
+	l.OnHand += quantity
+	return t.PutStock(l)
+}
+
+// Take removes sold copies of the books. It returns
+// *inventory.OutOfStockError if there are not enough copies.
+func (t *Tx) Take(quantity map[string]int) error {
+	for id, q := range quantity {
+		l, err := t.Stock(id)
+		if err != nil {
+			return err
+		}
+		if err := l.Take(q); err != nil {
+			return err
+		}
+		if err := t.PutStock(l); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// Levels returns stock of all books ever restocked, sorted by book ID.
+func (t *Tx) Levels() ([]inventory.Level, error) {
+	var levels []inventory.Level
+	err := t.tx.Bucket(stockBucket).ForEach(func(_, v []byte) error {
+		var l inventory.Level
+		if err := json.Unmarshal(v, &l); err != nil {
+			return err
+		}
+		levels = append(levels, l)
+		return nil
+	})
+	return levels, err
+}
+
+var errNotFound = errors.New("key not found")
+
+func (t *Tx) get(bucket []byte, key string, v interface{}) error {
+	data := t.tx.Bucket(bucket).Get([]byte(key))
+	if data == nil {
+		return errNotFound
+	}
+	return json.Unmarshal(data, v)
+}
+
+func (t *Tx) put(bucket []byte, key string, v interface{}) error {
+	data, err := json.Marshal(v)
+	if err != nil {
+		return err
+	}
+	return t.tx.Bucket(bucket).Put([]byte(key), data)
+}
+
+func (t *Tx) delete(bucket []byte, key string) error {
+	b := t.tx.Bucket(bucket)
+	if b.Get([]byte(key)) == nil {
+		return errNotFound
+	}
+	return b.Delete([]byte(key))
+}
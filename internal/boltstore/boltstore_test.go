@@ -0,0 +1,593 @@
+package boltstore_test
+
+import (
+	"errors"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/google/go-cmp/cmp"
+	"github.com/google/go-cmp/cmp/cmpopts"
+	"github.com/qba73/bookshop/internal/boltstore"
+	"github.com/qba73/bookshop/internal/bookshop"
+	"github.com/qba73/bookshop/internal/bookshop/order"
+	"github.com/qba73/bookshop/internal/coupon"
+	"github.com/qba73/bookshop/internal/inventory"
+	"github.com/qba73/bookshop/internal/invoice"
+	"github.com/qba73/bookshop/internal/money"
+)
+
+var testBook = bookshop.Book{
+	ID:             "1912bbf7-3f26-4196-b062-071b81b855e9",
+	Edition:        1,
+	Title:          "Bolek i Lolek",
+	Authors:        []string{"Bolek"},
+	Description:    "description",
+	ReleaseYear:    1997,
+	SeriesNumber:   1,
+	Price:          money.New(2000, money.PLN),
+	PickOfTheMonth: true,
+}
+
+func openTestDB(t *testing.T) (*boltstore.DB, string) {
+	t.Helper()
+
+	path := filepath.Join(t.TempDir(), "bookshop.db")
+	db, err := boltstore.Open(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { db.Close() })
+	return db, path
+}
+
+func TestDBStore(t *testing.T) {
+	t.Parallel()
+
+	db, path := openTestDB(t)
+
+	c := bookshop.NewCatalog(db)
+	if err := c.AddBook(testBook); err != nil {
+		t.Fatal(err)
+	}
+	if err := db.Close(); err != nil {
+		t.Fatal(err)
+	}
+
+	db, err := boltstore.Open(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer db.Close()
+
+	got, err := db.Get(testBook.ID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !cmp.Equal(got, testBook, cmp.AllowUnexported(bookshop.Book{})) {
+		t.Errorf("Get() \n%s", cmp.Diff(testBook, got, cmp.AllowUnexported(bookshop.Book{})))
+	}
+
+	if err := db.Delete(testBook.ID); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := db.Get(testBook.ID); !errors.Is(err, bookshop.ErrBookNotFound) {
+		t.Errorf("Get() after Delete() = %v, want: %v", err, bookshop.ErrBookNotFound)
+	}
+
+	books, err := db.List()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(books) != 0 {
+		t.Errorf("List() after Delete() returned %d books, want: 0", len(books))
+	}
+
+	if err := db.Create(testBook); err != nil {
+		t.Fatal(err)
+	}
+	if err := db.Create(testBook); !errors.Is(err, bookshop.ErrBookExists) {
+		t.Errorf("Create() existing book = %v, want: %v", err, bookshop.ErrBookExists)
+	}
+
+	b := testBook
+	b.Title = "Bolek i Lolek na wakacjach"
+	if err := db.Replace(b); err != nil {
+		t.Fatal(err)
+	}
+	if got, err := db.Get(b.ID); err != nil || got.Title != b.Title {
+		t.Errorf("Get() after Replace() = %q, %v, want: %q", got.Title, err, b.Title)
+	}
+	if err := db.Delete(b.ID); err != nil {
+		t.Fatal(err)
+	}
+	if err := db.Replace(b); !errors.Is(err, bookshop.ErrBookNotFound) {
+		t.Errorf("Replace() deleted book = %v, want: %v", err, bookshop.ErrBookNotFound)
+	}
+}
+
+func TestDBBookISBNs(t *testing.T) {
+	t.Parallel()
+
+	db, path := openTestDB(t)
+
+	b1 := bookshop.Book{ID: "1", Title: "Tytus", ISBN: "9780306406157"}
+	b2 := bookshop.Book{ID: "2", Title: "Zosia", ISBN: "9788324000166"}
+	if err := db.Put(b1); err != nil {
+		t.Fatal(err)
+	}
+	if err := db.Create(b2); err != nil {
+		t.Fatal(err)
+	}
+
+	dup := bookshop.Book{ID: "3", Title: "Kopia", ISBN: b1.ISBN}
+	if err := db.Put(dup); !errors.Is(err, bookshop.ErrDuplicateISBN) {
+		t.Errorf("Put() duplicate ISBN = %v, want: %v", err, bookshop.ErrDuplicateISBN)
+	}
+	if err := db.Create(dup); !errors.Is(err, bookshop.ErrDuplicateISBN) {
+		t.Errorf("Create() duplicate ISBN = %v, want: %v", err, bookshop.ErrDuplicateISBN)
+	}
+
+	// Changing the ISBN of a book frees its old ISBN.
+	b1.ISBN = "9791090636071"
+	if err := db.Put(b1); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := db.GetByISBN("9780306406157"); !errors.Is(err, bookshop.ErrBookNotFound) {
+		t.Errorf("GetByISBN() old ISBN = %v, want: %v", err, bookshop.ErrBookNotFound)
+	}
+	if err := db.Create(dup); err != nil {
+		t.Errorf("Create() with freed ISBN got error: %v", err)
+	}
+
+	// Deleting a book frees its ISBN.
+	if err := db.Delete(b1.ID); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := db.GetByISBN(b1.ISBN); !errors.Is(err, bookshop.ErrBookNotFound) {
+		t.Errorf("GetByISBN() after Delete() = %v, want: %v", err, bookshop.ErrBookNotFound)
+	}
+
+	if err := db.Close(); err != nil {
+		t.Fatal(err)
+	}
+	db, err := boltstore.Open(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer db.Close()
+
+	got, err := db.GetByISBN(b2.ISBN)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got.ID != b2.ID {
+		t.Errorf("GetByISBN() after reopening = book %s, want: %s", got.ID, b2.ID)
+	}
+}
+
+func TestDBUpdateAtomicity(t *testing.T) {
+	t.Parallel()
+
+	errAbort := errors.New("abort")
+
+	tt := []struct {
+		name       string
+		err        error
+		wantCommit bool
+	}{
+		{name: "Commit order with customer and book", err: nil, wantCommit: true},
+		{name: "Rollback order with customer and book", err: errAbort, wantCommit: false},
+	}
+
+	for _, tc := range tt {
+		tc := tc
+		t.Run(tc.name, func(t *testing.T) {
+			db, _ := openTestDB(t)
+
+			o, err := order.New("12282")
+			if err != nil {
+				t.Fatal(err)
+			}
+			if err := o.AddBook(testBook, 2); err != nil {
+				t.Fatal(err)
+			}
+			customer := bookshop.Customer{ID: "c1", Title: "Mrs", Name: "Monika White", Email: "monika@example.com"}
+
+			err = db.Update(func(tx *boltstore.Tx) error {
+				if err := tx.PutBook(testBook); err != nil {
+					return err
+				}
+				if err := tx.PutCustomer(customer); err != nil {
+					return err
+				}
+				if err := tx.PutOrder(o); err != nil {
+					return err
+				}
+				return tc.err
+			})
+			if !errors.Is(err, tc.err) {
+				t.Fatalf("%s Update() = %v, want: %v", tc.name, err, tc.err)
+			}
+
+			err = db.View(func(tx *boltstore.Tx) error {
+				_, errBook := tx.Book(testBook.ID)
+				_, errCustomer := tx.Customer(customer.ID)
+				gotOrder, errOrder := tx.Order(o.ID())
+
+				if !tc.wantCommit {
+					if !errors.Is(errBook, bookshop.ErrBookNotFound) ||
+						!errors.Is(errCustomer, boltstore.ErrCustomerNotFound) ||
+						!errors.Is(errOrder, boltstore.ErrOrderNotFound) {
+						t.Errorf("%s records visible after rollback: %v, %v, %v", tc.name, errBook, errCustomer, errOrder)
+					}
+					return nil
+				}
+
+				for _, err := range []error{errBook, errCustomer, errOrder} {
+					if err != nil {
+						return err
+					}
+				}
+				if !cmp.Equal(gotOrder, o, cmpopts.EquateEmpty()) {
+					t.Errorf("%s Order() \n%s", tc.name, cmp.Diff(o, gotOrder, cmpopts.EquateEmpty()))
+				}
+				return nil
+			})
+			if err != nil {
+				t.Fatal(err)
+			}
+		})
+	}
+}
+
+func TestDBPlaceOrder(t *testing.T) {
+	t.Parallel()
+
+	tt := []struct {
+		name        string
+		quantity    int
+		wantOnHand  int
+		wantStatus  order.Status
+		expectedErr error
+	}{
+		{name: "Place order in stock", quantity: 2, wantOnHand: 1, wantStatus: order.StatusPlaced, expectedErr: nil},
+		{name: "Place order out of stock", quantity: 4, wantOnHand: 3, wantStatus: order.StatusDraft, expectedErr: inventory.ErrOutOfStock},
+	}
+
+	for _, tc := range tt {
+		tc := tc
+		t.Run(tc.name, func(t *testing.T) {
+			db, _ := openTestDB(t)
+
+			err := db.Update(func(tx *boltstore.Tx) error {
+				if err := tx.PutBook(testBook); err != nil {
+					return err
+				}
+				return tx.Restock(testBook.ID, 3)
+			})
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			o, err := order.New("12282")
+			if err != nil {
+				t.Fatal(err)
+			}
+			if err := o.AddBook(testBook, tc.quantity); err != nil {
+				t.Fatal(err)
+			}
+
+			err = db.PlaceOrder(o)
+			if !errors.Is(err, tc.expectedErr) {
+				t.Fatalf("%s PlaceOrder() = %v, want: %v", tc.name, err, tc.expectedErr)
+			}
+			if s := o.CurrentStatus(); s != tc.wantStatus {
+				t.Errorf("%s order status = %s, want: %s", tc.name, s, tc.wantStatus)
+			}
+
+			err = db.View(func(tx *boltstore.Tx) error {
+				l, err := tx.Stock(testBook.ID)
+				if err != nil {
+					return err
+				}
+				if l.OnHand != tc.wantOnHand {
+					t.Errorf("%s stock on hand = %d, want: %d", tc.name, l.OnHand, tc.wantOnHand)
+				}
+
+				stored, err := tx.Order(o.ID())
+				if tc.expectedErr != nil {
+					if !errors.Is(err, boltstore.ErrOrderNotFound) {
+						t.Errorf("%s Order() = %v, want: %v", tc.name, err, boltstore.ErrOrderNotFound)
+					}
+					return nil
+				}
+				if err != nil {
+					return err
+				}
+				if stored.CurrentStatus() != order.StatusPlaced {
+					t.Errorf("%s stored order status = %s, want: %s", tc.name, stored.CurrentStatus(), order.StatusPlaced)
+				}
+				return nil
+			})
+			if err != nil {
+				t.Fatal(err)
+			}
+		})
+	}
+}
+
+var _ inventory.Store = (*boltstore.DB)(nil)
+
+func TestDBInventory(t *testing.T) {
+	t.Parallel()
+
+	db, _ := openTestDB(t)
+	if err := db.Restock(testBook.ID, 3); err != nil {
+		t.Fatal(err)
+	}
+	inv := inventory.New(db, time.Minute)
+	if err := inv.Reserve("12282", []order.Item{{BookID: testBook.ID, Quantity: 2}}); err != nil {
+		t.Fatal(err)
+	}
+
+	// An order placed directly takes the copy left, so the
+	// reservation cannot be committed.
+	o, err := order.New("12283")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := o.AddBook(testBook, 2); err != nil {
+		t.Fatal(err)
+	}
+	if err := db.PlaceOrder(o); err != nil {
+		t.Fatal(err)
+	}
+	if err := inv.Commit("12282"); !errors.Is(err, inventory.ErrOutOfStock) {
+		t.Errorf("Commit() after stock was sold = %v, want: %v", err, inventory.ErrOutOfStock)
+	}
+
+	if err := inv.Reserve("12282", []order.Item{{BookID: testBook.ID, Quantity: 1}}); err != nil {
+		t.Fatal(err)
+	}
+	if err := inv.Commit("12282"); err != nil {
+		t.Fatal(err)
+	}
+	want := []inventory.Level{{BookID: testBook.ID}}
+	got, err := db.Levels()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !cmp.Equal(want, got) {
+		t.Error(cmp.Diff(want, got))
+	}
+}
+
+var _ coupon.Store = (*boltstore.DB)(nil)
+
+func TestDBCoupons(t *testing.T) {
+	t.Parallel()
+
+	db, path := openTestDB(t)
+	if err := db.PutCoupon(coupon.Coupon{Code: "WELCOME", Percent: 10, MaxUses: 1}); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := db.Coupon("welcome"); err != nil {
+		t.Fatalf("Coupon() got error: %v", err)
+	}
+	if _, err := db.Coupon("MISSING"); !errors.Is(err, coupon.ErrNotFound) {
+		t.Errorf("Coupon() of missing code = %v, want: %v", err, coupon.ErrNotFound)
+	}
+
+	first := coupon.Redemption{Code: "WELCOME", OrderID: "12282", Amount: money.New(200, money.PLN)}
+	second := coupon.Redemption{Code: "WELCOME", OrderID: "12283", Amount: money.New(300, money.PLN)}
+	if err := db.Redeem(first); err != nil {
+		t.Fatal(err)
+	}
+	if err := db.Redeem(first); err != nil {
+		t.Errorf("Redeem() again with the same order got error: %v", err)
+	}
+	if err := db.Redeem(second); !errors.Is(err, coupon.ErrRejected) {
+		t.Errorf("Redeem() of used up coupon = %v, want: %v", err, coupon.ErrRejected)
+	}
+	if err := db.Cancel("WELCOME", first.OrderID); err != nil {
+		t.Fatal(err)
+	}
+	if err := db.Redeem(second); err != nil {
+		t.Errorf("Redeem() after cancel got error: %v", err)
+	}
+	if err := db.Close(); err != nil {
+		t.Fatal(err)
+	}
+
+	db, err := boltstore.Open(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer db.Close()
+	got, err := db.Redemptions("WELCOME")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want := []coupon.Redemption{second}; !cmp.Equal(want, got) {
+		t.Errorf("Redemptions() \n%s", cmp.Diff(want, got))
+	}
+}
+
+var _ invoice.Store = (*boltstore.DB)(nil)
+
+func TestDBInvoices(t *testing.T) {
+	t.Parallel()
+
+	db, path := openTestDB(t)
+	issued := time.Date(2021, time.June, 16, 9, 0, 0, 0, time.UTC)
+	newInvoice := func(kind invoice.Kind, orderID string, at time.Time) *invoice.Invoice {
+		inv := invoice.Invoice{
+			Kind:    kind,
+			OrderID: orderID,
+			Issued:  at,
+			Lines: []invoice.Line{
+				{BookID: testBook.ID, Title: testBook.Title, Quantity: 1, UnitPrice: testBook.Price, Rate: 500, Gross: testBook.Price},
+			},
+		}
+		if kind == invoice.KindCorrection {
+			inv.Corrects = "FV/2021/000001"
+			inv.Lines[0].Quantity = -1
+		}
+		return &inv
+	}
+
+	for _, tc := range []struct {
+		inv  *invoice.Invoice
+		want string
+		err  error
+	}{
+		{inv: newInvoice(invoice.KindInvoice, "12282", issued), want: "FV/2021/000001"},
+		{inv: newInvoice(invoice.KindInvoice, "12282", issued), err: invoice.ErrIssued},
+		{inv: newInvoice(invoice.KindInvoice, "12283", issued), want: "FV/2021/000002"},
+		{inv: newInvoice(invoice.KindCorrection, "12282", issued), want: "FK/2021/000001"},
+		{inv: newInvoice(invoice.KindCorrection, "12282", issued), err: invoice.ErrInvalidCorrection},
+		{inv: newInvoice(invoice.KindInvoice, "12284", issued.AddDate(1, 0, 0)), want: "FV/2022/000001"},
+	} {
+		err := db.Issue(tc.inv)
+		if tc.err != nil {
+			if !errors.Is(err, tc.err) {
+				t.Errorf("Issue() = %v, want: %v", err, tc.err)
+			}
+			continue
+		}
+		if err != nil {
+			t.Fatal(err)
+		}
+		if tc.inv.Number != tc.want {
+			t.Errorf("Issue() numbered invoice %s, want: %s", tc.inv.Number, tc.want)
+		}
+	}
+	if _, err := db.Invoice("FV/2021/000009"); !errors.Is(err, invoice.ErrNotFound) {
+		t.Errorf("Invoice() of missing number = %v, want: %v", err, invoice.ErrNotFound)
+	}
+	if err := db.Close(); err != nil {
+		t.Fatal(err)
+	}
+
+	db, err := boltstore.Open(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer db.Close()
+	invs, err := db.OrderInvoices("12282")
+	if err != nil {
+		t.Fatal(err)
+	}
+	var got []string
+	for _, inv := range invs {
+		got = append(got, inv.Number)
+	}
+	want := []string{"FV/2021/000001", "FK/2021/000001"}
+	if !cmp.Equal(want, got) {
+		t.Error(cmp.Diff(want, got))
+	}
+	inv, err := db.Invoice("FV/2021/000002")
+	if err != nil {
+		t.Fatal(err)
+	}
+	wantInv := newInvoice(invoice.KindInvoice, "12283", issued)
+	wantInv.SetNumber(2)
+	if !cmp.Equal(*wantInv, inv) {
+		t.Error(cmp.Diff(*wantInv, inv))
+	}
+}
+
+var _ bookshop.CustomerStore = (*boltstore.DB)(nil)
+
+func TestDBCustomers(t *testing.T) {
+	t.Parallel()
+
+	db, path := openTestDB(t)
+	monika := bookshop.Customer{
+		ID:    "c1",
+		Title: "Mrs",
+		Name:  "Monika White",
+		Email: "monika@example.com",
+		Billing: bookshop.Address{
+			Street:   "23 Avenue",
+			City:     "Dublin",
+			Postcode: "D02 XY45",
+			Country:  "IE",
+		},
+	}
+	if err := db.PutCustomer(monika); err != nil {
+		t.Fatal(err)
+	}
+	err := db.PutCustomer(bookshop.Customer{ID: "c2", Name: "James Brown", Email: "MONIKA@example.com"})
+	if !errors.Is(err, bookshop.ErrDuplicateEmail) {
+		t.Errorf("PutCustomer() with email of another customer = %v, want: %v", err, bookshop.ErrDuplicateEmail)
+	}
+
+	// Orders must name a stored customer.
+	if err := db.Update(func(tx *boltstore.Tx) error { return tx.Restock(testBook.ID, 5) }); err != nil {
+		t.Fatal(err)
+	}
+	for _, v := range []struct {
+		customerID string
+		wantErr    error
+	}{
+		{customerID: "c9", wantErr: bookshop.ErrCustomerNotFound},
+		{customerID: monika.ID},
+	} {
+		o, err := order.New("order-" + v.customerID)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if err := o.AddBook(testBook, 1); err != nil {
+			t.Fatal(err)
+		}
+		o.CustomerID = v.customerID
+		if err := db.PlaceOrder(o); !errors.Is(err, v.wantErr) {
+			t.Errorf("PlaceOrder() for customer %s = %v, want: %v", v.customerID, err, v.wantErr)
+		}
+	}
+	if err := db.Close(); err != nil {
+		t.Fatal(err)
+	}
+
+	db, err = boltstore.Open(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer db.Close()
+	got, err := db.CustomerByEmail("Monika@Example.com")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !cmp.Equal(monika, got) {
+		t.Error(cmp.Diff(monika, got))
+	}
+	err = db.View(func(tx *boltstore.Tx) error {
+		orders, err := tx.CustomerOrders(monika.ID)
+		if err != nil {
+			return err
+		}
+		if len(orders) != 1 || orders[0].ID() != "order-c1" {
+			t.Errorf("CustomerOrders() = %v, want order-c1", orders)
+		}
+		return nil
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if err := db.DeleteCustomer(monika.ID); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := db.CustomerByEmail(monika.Email); !errors.Is(err, bookshop.ErrCustomerNotFound) {
+		t.Errorf("CustomerByEmail() after delete = %v, want: %v", err, bookshop.ErrCustomerNotFound)
+	}
+	customers, err := db.Customers()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(customers) != 0 {
+		t.Errorf("Customers() after delete = %v, want none", customers)
+	}
+}
@@ -0,0 +1,481 @@
+// Package bookcsv imports and exports the book catalog as CSV,
+// the format buyers use for stock lists kept in spreadsheets.
+package bookcsv
+
+import (
+	"encoding/csv"
+	"errors"
+	"fmt"
+	"io"
+	"strconv"
+	"strings"
+
+	"github.com/qba73/bookshop/internal/bookshop"
+	"github.com/qba73/bookshop/internal/money"
+)
+
+// Columns known to Import and written by Export. Multiple authors
+// and categories in a single cell are separated by semicolons.
+// Prices are in currency units, for example 19.99.
+const (
+	ColID             = "id"
+	ColISBN           = "isbn"
+	ColTitle          = "title"
+	ColAuthors        = "authors"
+	ColDescription    = "description"
+	ColEdition        = "edition"
+	ColReleaseYear    = "release_year"
+	ColSeriesNumber   = "series_number"
+	ColPrice          = "price"
+	ColCurrency       = "currency"
+	ColDiscount       = "discount"
+	ColSalePrice      = "sale_price"
+	ColCategories     = "categories"
+	ColPickOfTheMonth = "pick_of_the_month"
+)
+
+// exportColumns lists columns in the order Export writes them.
+var exportColumns = []string{
+	ColID, ColISBN, ColTitle, ColAuthors, ColDescription, ColEdition,
+	ColReleaseYear, ColSeriesNumber, ColPrice, ColCurrency, ColDiscount, ColSalePrice,
+	ColCategories, ColPickOfTheMonth,
+}
+
+var (
+	// ErrInvalidRows is returned by Import when any row is invalid.
+	ErrInvalidRows = errors.New("invalid rows")
+	// ErrDuplicateID is reported for rows of a book
+	// already imported from an earlier row.
+	ErrDuplicateID = errors.New("duplicate book id")
+)
+
+// Options configures Import.
+type Options struct {
+	// Mapping maps CSV headers to column names, for example
+	// "Tytuł" to ColTitle. Headers equal to a column name,
+	// ignoring case, are mapped without an entry.
+	Mapping map[string]string
+	// DryRun validates rows without changing the catalog.
+	DryRun bool
+	// Comma is the field delimiter, ',' when zero.
+	Comma rune
+}
+
+// RowError describes an invalid value in a CSV row.
+type RowError struct {
+	// Line is the line of the CSV input the row starts on,
+	// the header is on line 1.
+	Line   int
+	Column string
+	Err    error
+}
+
+// Error implements the error interface.
+func (e RowError) Error() string {
+	if e.Column == "" {
+		return fmt.Sprintf("line %d: %v", e.Line, e.Err)
+	}
+	return fmt.Sprintf("line %d: %s: %v", e.Line, e.Column, e.Err)
+}
+
+// Unwrap returns the underlying error.
+func (e RowError) Unwrap() error {
+	return e.Err
+}
+
+// Report summarizes an import.
+type Report struct {
+	// Added and Updated count books added to the catalog and books
+	// replaced in it, or that would be in a dry run.
+	Added   int
+	Updated int
+	// Imported lists lines of rows written to the catalog,
+	// in the order they were written.
+	Imported []int
+	// Ignored lists CSV headers not mapped to any column.
+	Ignored []string
+	// Errors lists invalid values of all rows.
+	Errors []RowError
+}
+
+// Import knows how to read books from CSV and add them to the catalog.
+//
+// The first record is the header. Only the title column is required.
+// A row updates the book with the same id, or with the same ISBN when
+// the id is empty, and adds a new book otherwise. Updated books keep
+// values of columns missing from the header. Missing ids are generated.
+// A book may appear in one row only.
+//
+// All rows are validated before any book is written. When any row
+// is invalid the catalog is not changed, Report.Errors lists every
+// problem and the returned error wraps ErrInvalidRows. Books are then
+// written in the order of rows. When writing a book fails the import
+// stops, the error is a RowError of its row and Report.Imported lists
+// rows written before it.
+func Import(c *bookshop.Catalog, r io.Reader, opts Options) (Report, error) {
+	cr := csv.NewReader(r)
+	if opts.Comma != 0 {
+		cr.Comma = opts.Comma
+	}
+	cr.FieldsPerRecord = -1
+
+	header, err := cr.Read()
+	if err == io.EOF {
+		return Report{}, errors.New("missing CSV header")
+	}
+	if err != nil {
+		return Report{}, err
+	}
+
+	var report Report
+	columns, err := mapHeader(header, opts.Mapping, &report)
+	if err != nil {
+		return report, err
+	}
+
+	var rows []row
+	idLines := make(map[string]int)
+	isbnLines := make(map[string]int)
+	for {
+		record, err := cr.Read()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			// Parse errors name the line already.
+			return report, err
+		}
+		if blank(record) {
+			continue
+		}
+		// Blank lines are skipped and quoted values may span
+		// lines, so records are not numbered like lines.
+		line, _ := cr.FieldPos(0)
+
+		b, errs := parseRow(c, line, columns, record)
+		if b.ID != "" {
+			if first, ok := idLines[b.ID]; ok {
+				errs = append(errs, RowError{Line: line, Column: ColID, Err: fmt.Errorf("%w %s: already on line %d", ErrDuplicateID, b.ID, first)})
+			}
+			idLines[b.ID] = line
+		}
+		if b.ISBN != "" {
+			if first, ok := isbnLines[b.ISBN]; ok {
+				errs = append(errs, RowError{Line: line, Column: ColISBN, Err: fmt.Errorf("%w: already on line %d", bookshop.ErrDuplicateISBN, first)})
+			}
+			isbnLines[b.ISBN] = line
+		}
+		report.Errors = append(report.Errors, errs...)
+		if len(errs) == 0 {
+			rows = append(rows, row{line: line, book: b})
+		}
+	}
+	if len(report.Errors) > 0 {
+		return report, fmt.Errorf("%d errors: %w", len(report.Errors), ErrInvalidRows)
+	}
+
+	for _, r := range rows {
+		_, err := c.Store().Get(r.book.ID)
+		exists := err == nil
+		if !opts.DryRun {
+			if err := c.AddBook(r.book); err != nil {
+				return report, RowError{Line: r.line, Err: err}
+			}
+			report.Imported = append(report.Imported, r.line)
+		}
+		if exists {
+			report.Updated++
+		} else {
+			report.Added++
+		}
+	}
+	return report, nil
+}
+
+// row is a valid book read from the CSV line.
+type row struct {
+	line int
+	book bookshop.Book
+}
+
+// Export knows how to write all books in the catalog as CSV
+// with a header and a row per book sorted by ID.
+func Export(c *bookshop.Catalog, w io.Writer) error {
+	books, err := c.GetAllBooks()
+	if err != nil {
+		return err
+	}
+
+	cw := csv.NewWriter(w)
+	if err := cw.Write(exportColumns); err != nil {
+		return err
+	}
+	for _, b := range books {
+		var slugs []string
+		for _, id := range b.Categories() {
+			cat, err := c.Taxonomy().Get(id)
+			if err != nil {
+				return fmt.Errorf("book id %s: %w", b.ID, err)
+			}
+			slugs = append(slugs, cat.Slug)
+		}
+
+		record := []string{
+			b.ID,
+			b.ISBN,
+			b.Title,
+			strings.Join(b.Authors, "; "),
+			b.Description,
+			strconv.Itoa(b.Edition),
+			strconv.Itoa(b.ReleaseYear),
+			strconv.Itoa(b.SeriesNumber),
+			formatPrice(b.Price),
+			string(b.Price.Currency()),
+			strconv.Itoa(b.Discount()),
+			formatPrice(b.SalePrice()),
+			strings.Join(slugs, "; "),
+			strconv.FormatBool(b.PickOfTheMonth),
+		}
+		if err := cw.Write(record); err != nil {
+			return err
+		}
+	}
+	cw.Flush()
+	return cw.Error()
+}
+
+// mapHeader returns column names by position. Unmapped positions
+// hold empty strings and their headers are reported as ignored.
+func mapHeader(header []string, mapping map[string]string, report *Report) ([]string, error) {
+	known := make(map[string]bool, len(exportColumns))
+	for _, col := range exportColumns {
+		known[col] = true
+	}
+
+	columns := make([]string, len(header))
+	seen := make(map[string]bool)
+	for i, h := range header {
+		h = strings.TrimSpace(strings.TrimPrefix(h, "\ufeff"))
+		col, ok := mapping[h]
+		if !ok {
+			col = strings.ToLower(h)
+		}
+		if !known[col] || col == ColSalePrice {
+			// Sale price is derived from price and discount.
+			report.Ignored = append(report.Ignored, h)
+			continue
+		}
+		if seen[col] {
+			return nil, fmt.Errorf("line 1: column %s mapped twice", col)
+		}
+		seen[col] = true
+		columns[i] = col
+	}
+	if !seen[ColTitle] {
+		return nil, fmt.Errorf("line 1: missing %s column", ColTitle)
+	}
+	return columns, nil
+}
+
+// parseRow builds a book from the record, starting from the book
+// it updates, if any. Every invalid value is reported, not just the
+// first one, and the book is returned with errors so its id and
+// ISBN can still be checked for duplicates.
+func parseRow(c *bookshop.Catalog, line int, columns, record []string) (bookshop.Book, []RowError) {
+	var errs []RowError
+	fail := func(col string, err error) {
+		errs = append(errs, RowError{Line: line, Column: col, Err: err})
+	}
+	atoi := func(col, v string) int {
+		if v == "" {
+			return 0
+		}
+		n, err := strconv.Atoi(v)
+		if err != nil {
+			fail(col, fmt.Errorf("invalid number %q", v))
+		}
+		return n
+	}
+
+	// values holds cells of columns in the header,
+	// empty when the record is short.
+	values := make(map[string]string, len(columns))
+	for i, col := range columns {
+		if col == "" {
+			continue
+		}
+		values[col] = ""
+		if i < len(record) {
+			values[col] = strings.TrimSpace(record[i])
+		}
+	}
+
+	b, ok := existingBook(c, values[ColID], values[ColISBN])
+	if !ok {
+		b = bookshop.Book{ID: values[ColID]}
+	}
+	b.Title = values[ColTitle]
+	if b.Title == "" {
+		fail(ColTitle, errors.New("missing book title"))
+	}
+	if v, ok := values[ColAuthors]; ok {
+		b.Authors = splitList(v)
+	}
+	if v, ok := values[ColDescription]; ok {
+		b.Description = v
+	}
+	if v, ok := values[ColEdition]; ok {
+		b.Edition = atoi(ColEdition, v)
+	}
+	if v, ok := values[ColReleaseYear]; ok {
+		b.ReleaseYear = atoi(ColReleaseYear, v)
+	}
+	if v, ok := values[ColSeriesNumber]; ok {
+		b.SeriesNumber = atoi(ColSeriesNumber, v)
+	}
+	if v, ok := values[ColPickOfTheMonth]; ok {
+		b.PickOfTheMonth = false
+		if v != "" {
+			pick, err := parseBool(v)
+			if err != nil {
+				fail(ColPickOfTheMonth, err)
+			}
+			b.PickOfTheMonth = pick
+		}
+	}
+
+	if v, ok := values[ColISBN]; ok {
+		if err := b.SetISBN(v); err != nil {
+			fail(ColISBN, err)
+		}
+	}
+	currency := b.Price.Currency()
+	if currency == "" {
+		currency = bookshop.DefaultCurrency
+	}
+	if v := values[ColCurrency]; v != "" {
+		c, err := money.ParseCurrency(v)
+		if err != nil {
+			fail(ColCurrency, err)
+		}
+		currency = c
+	}
+	if v := values[ColPrice]; v != "" && currency != "" {
+		p, err := money.Parse(v, currency)
+		if err == nil {
+			err = b.SetPrice(p)
+		}
+		if err != nil {
+			fail(ColPrice, err)
+		}
+	}
+	if v, ok := values[ColDiscount]; ok {
+		var d int
+		if v = strings.TrimSpace(strings.TrimSuffix(v, "%")); v != "" {
+			n, err := strconv.Atoi(v)
+			if err != nil {
+				fail(ColDiscount, fmt.Errorf("invalid discount %q", values[ColDiscount]))
+			}
+			d = n
+		}
+		if err := b.SetDiscountPercent(d); err != nil {
+			fail(ColDiscount, err)
+		}
+	}
+	if v := values[ColCategories]; v != "" {
+		var ids []int
+		for _, s := range splitList(v) {
+			cat, err := findCategory(c.Taxonomy(), s)
+			if err != nil {
+				fail(ColCategories, err)
+				continue
+			}
+			ids = append(ids, cat.ID)
+		}
+		if len(ids) > 0 {
+			if err := b.SetCategories(ids...); err != nil {
+				fail(ColCategories, err)
+			}
+		}
+	}
+
+	if len(errs) > 0 {
+		return b, errs
+	}
+
+	if b.ISBN != "" {
+		existing, err := c.GetByISBN(b.ISBN)
+		switch {
+		case err != nil:
+		case b.ID == "":
+			b.ID = existing.ID
+		case b.ID != existing.ID:
+			fail(ColISBN, fmt.Errorf("%w: book id %s", bookshop.ErrDuplicateISBN, existing.ID))
+			return bookshop.Book{}, errs
+		}
+	}
+	if b.ID == "" {
+		b.ID = bookshop.NewID()
+	}
+	return b, nil
+}
+
+// existingBook returns the book a row updates, the book with
+// the id or, when the id is empty, with the ISBN.
+func existingBook(c *bookshop.Catalog, id, isbn string) (bookshop.Book, bool) {
+	if id != "" {
+		b, err := c.Store().Get(id)
+		return b, err == nil
+	}
+	if strings.TrimSpace(isbn) == "" {
+		return bookshop.Book{}, false
+	}
+	b, err := c.GetByISBN(isbn)
+	return b, err == nil
+}
+
+// formatPrice returns the amount without currency,
+// empty for books without a price.
+func formatPrice(m money.Money) string {
+	if m.Equal(money.Money{}) {
+		return ""
+	}
+	return m.Decimal()
+}
+
+func parseBool(s string) (bool, error) {
+	switch strings.ToLower(s) {
+	case "true", "yes", "y", "1", "tak":
+		return true, nil
+	case "false", "no", "n", "0", "nie":
+		return false, nil
+	}
+	return false, fmt.Errorf("invalid boolean %q", s)
+}
+
+// findCategory looks a category up by slug or ID.
+func findCategory(t *bookshop.Taxonomy, s string) (bookshop.Category, error) {
+	if id, err := strconv.Atoi(s); err == nil {
+		return t.Get(id)
+	}
+	return t.BySlug(s)
+}
+
+func splitList(s string) []string {
+	var items []string
+	for _, v := range strings.Split(s, ";") {
+		if v = strings.TrimSpace(v); v != "" {
+			items = append(items, v)
+		}
+	}
+	return items
+}
+
+func blank(record []string) bool {
+	for _, v := range record {
+		if strings.TrimSpace(v) != "" {
+			return false
+		}
+	}
+	return true
+}
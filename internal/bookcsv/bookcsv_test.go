@@ -0,0 +1,351 @@
+package bookcsv_test
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"strings"
+	"testing"
+
+	"github.com/google/go-cmp/cmp"
+	"github.com/qba73/bookshop/internal/bookcsv"
+	"github.com/qba73/bookshop/internal/bookshop"
+	"github.com/qba73/bookshop/internal/money"
+)
+
+func newTestCatalog(t *testing.T, books ...bookshop.Book) *bookshop.Catalog {
+	t.Helper()
+
+	var c bookshop.Catalog
+	for _, b := range books {
+		if err := c.AddBook(b); err != nil {
+			t.Fatal(err)
+		}
+	}
+	return &c
+}
+
+func TestImport(t *testing.T) {
+	t.Parallel()
+
+	existing := bookshop.Book{ID: "1", Title: "Tytus", ISBN: "9780306406157", Price: money.New(1000, money.PLN)}
+	c := newTestCatalog(t, existing)
+
+	input := `Tytuł,Autorzy,ISBN,Cena,Rabat,Kategorie,Uwagi
+Tytus i Romek,Papcio Chmiel,0-306-40615-2,"24,99",10%,tech; programming,reprint
+Zosia,Kornel Makuszyński;Jan Brzechwa,83-240-0016-X,20,,1,
+
+`
+	opts := bookcsv.Options{
+		Mapping: map[string]string{
+			"Tytuł":     bookcsv.ColTitle,
+			"Autorzy":   bookcsv.ColAuthors,
+			"Cena":      bookcsv.ColPrice,
+			"Rabat":     bookcsv.ColDiscount,
+			"Kategorie": bookcsv.ColCategories,
+		},
+	}
+	report, err := bookcsv.Import(c, strings.NewReader(input), opts)
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := bookcsv.Report{Added: 1, Updated: 1, Imported: []int{2, 3}, Ignored: []string{"Uwagi"}}
+	if !cmp.Equal(want, report) {
+		t.Errorf("Import() report:\n%s", cmp.Diff(want, report))
+	}
+
+	got, err := c.Store().Get("1")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got.Title != "Tytus i Romek" || got.Price != money.New(2499, money.PLN) || got.SalePrice() != money.New(2250, money.PLN) {
+		t.Errorf("updated book = %+v, want title Tytus i Romek, price 2499 and sale price 2250", got)
+	}
+	if !cmp.Equal([]int{bookshop.CategoryTech, bookshop.CategoryProgramming}, got.Categories()) {
+		t.Errorf("updated book categories = %v", got.Categories())
+	}
+
+	got, err = c.GetByISBN("832400016X")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got.ID == "" || got.Price != money.New(2000, money.PLN) || got.Category() != bookshop.CategoryTech {
+		t.Errorf("added book = %+v, want generated id, price 2000 and tech category", got)
+	}
+	if !cmp.Equal([]string{"Kornel Makuszyński", "Jan Brzechwa"}, got.Authors) {
+		t.Errorf("added book authors = %q", got.Authors)
+	}
+}
+
+func TestImportErrors(t *testing.T) {
+	t.Parallel()
+
+	c := newTestCatalog(t, bookshop.Book{ID: "1", Title: "Tytus", Price: money.New(1000, money.PLN)})
+
+	input := `id,title,price,discount,categories,isbn,currency
+1,Tytus,abc,10,tech,,
+,Zosia,-5,120,nonexistent,0306406152,
+,,10,,,,
+,Kopia,10,,,978-0-306-40615-7,
+,Grosze,10.999,,,,
+,Euro,10,,,,EURO
+`
+	report, err := bookcsv.Import(c, strings.NewReader(input), bookcsv.Options{})
+	if !errors.Is(err, bookcsv.ErrInvalidRows) {
+		t.Fatalf("Import() error = %v, want: %v", err, bookcsv.ErrInvalidRows)
+	}
+
+	var got []string
+	for _, e := range report.Errors {
+		got = append(got, fmt.Sprintf("line %d: %s", e.Line, e.Column))
+	}
+	want := []string{
+		"line 2: price",
+		"line 3: price",
+		"line 3: discount",
+		"line 3: categories",
+		"line 4: title",
+		"line 5: isbn",
+		"line 6: price",
+		"line 7: currency",
+	}
+	if !cmp.Equal(want, got) {
+		t.Error(cmp.Diff(want, got))
+	}
+	if !errors.Is(report.Errors[3], bookshop.ErrCategoryNotFound) {
+		t.Errorf("category error = %v, want: %v", report.Errors[3], bookshop.ErrCategoryNotFound)
+	}
+	if !errors.Is(report.Errors[5], bookshop.ErrDuplicateISBN) {
+		t.Errorf("isbn error = %v, want: %v", report.Errors[5], bookshop.ErrDuplicateISBN)
+	}
+
+	// No book is written when any row is invalid.
+	b, err := c.Store().Get("1")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if b.Price != money.New(1000, money.PLN) {
+		t.Errorf("price after failed import = %v, want: 10.00 PLN", b.Price)
+	}
+	if books, _ := c.GetAllBooks(); len(books) != 1 {
+		t.Errorf("catalog has %d books after failed import, want: 1", len(books))
+	}
+}
+
+// failingStore is a store failing to write the book with the ID.
+type failingStore struct {
+	bookshop.Store
+	id string
+}
+
+func (s failingStore) Put(b bookshop.Book) error {
+	if b.ID == s.id {
+		return errors.New("disk full")
+	}
+	return s.Store.Put(b)
+}
+
+func TestImportWriteFailure(t *testing.T) {
+	t.Parallel()
+
+	c := bookshop.NewCatalog(failingStore{Store: bookshop.NewMemoryStore(nil), id: "2"})
+
+	input := `id,title
+1,Tytus
+
+2,Zosia
+3,Koziołek Matołek
+`
+	report, err := bookcsv.Import(c, strings.NewReader(input), bookcsv.Options{})
+	var rowErr bookcsv.RowError
+	if !errors.As(err, &rowErr) || rowErr.Line != 4 {
+		t.Fatalf("Import() = %v, want error of line 4", err)
+	}
+	want := bookcsv.Report{Added: 1, Imported: []int{2}}
+	if !cmp.Equal(want, report) {
+		t.Errorf("Import() report:\n%s", cmp.Diff(want, report))
+	}
+
+	books, err := c.GetAllBooks()
+	if err != nil {
+		t.Fatal(err)
+	}
+	var ids []string
+	for _, b := range books {
+		ids = append(ids, b.ID)
+	}
+	if !cmp.Equal([]string{"1"}, ids) {
+		t.Errorf("imported books %v, want: [1]", ids)
+	}
+}
+
+func TestImportLineNumbers(t *testing.T) {
+	t.Parallel()
+
+	c := newTestCatalog(t)
+	input := "title,description,price\n" +
+		"Tytus,\"Part one,\nspanning\nthree lines\",10\n" +
+		"\n" +
+		"Zosia,,abc\n" +
+		",,10\n"
+
+	report, err := bookcsv.Import(c, strings.NewReader(input), bookcsv.Options{})
+	if !errors.Is(err, bookcsv.ErrInvalidRows) {
+		t.Fatalf("Import() error = %v, want: %v", err, bookcsv.ErrInvalidRows)
+	}
+	var got []string
+	for _, e := range report.Errors {
+		got = append(got, fmt.Sprintf("line %d: %s", e.Line, e.Column))
+	}
+	want := []string{"line 6: price", "line 7: title"}
+	if !cmp.Equal(want, got) {
+		t.Error(cmp.Diff(want, got))
+	}
+}
+
+func TestImportUpdateKeepsMissingColumns(t *testing.T) {
+	t.Parallel()
+
+	existing := bookshop.Book{
+		ID:          "1",
+		Title:       "Tytus",
+		Authors:     []string{"Papcio Chmiel"},
+		Description: "Comic book",
+		ReleaseYear: 1957,
+		Price:       money.New(1000, money.PLN),
+	}
+	if err := existing.SetDiscountPercent(10); err != nil {
+		t.Fatal(err)
+	}
+	c := newTestCatalog(t, existing)
+
+	input := "id,title,price\n1,Tytus i Romek,12\n"
+	if _, err := bookcsv.Import(c, strings.NewReader(input), bookcsv.Options{}); err != nil {
+		t.Fatal(err)
+	}
+	got, err := c.Store().Get("1")
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := existing
+	want.Title = "Tytus i Romek"
+	want.Price = money.New(1200, money.PLN)
+	if !cmp.Equal(want, got, cmp.AllowUnexported(bookshop.Book{})) {
+		t.Error(cmp.Diff(want, got, cmp.AllowUnexported(bookshop.Book{})))
+	}
+}
+
+func TestImportDuplicateIDs(t *testing.T) {
+	t.Parallel()
+
+	c := newTestCatalog(t, bookshop.Book{ID: "1", Title: "Tytus", ISBN: "9780306406157"})
+	input := "id,title,isbn\n1,Tytus,\n1,Tytus i Romek,\n,Tytus,0-306-40615-2\n"
+
+	report, err := bookcsv.Import(c, strings.NewReader(input), bookcsv.Options{})
+	if !errors.Is(err, bookcsv.ErrInvalidRows) {
+		t.Fatalf("Import() error = %v, want: %v", err, bookcsv.ErrInvalidRows)
+	}
+	var got []string
+	for _, e := range report.Errors {
+		if !errors.Is(e, bookcsv.ErrDuplicateID) {
+			t.Errorf("line %d: error = %v, want: %v", e.Line, e, bookcsv.ErrDuplicateID)
+		}
+		got = append(got, fmt.Sprintf("line %d: %s", e.Line, e.Column))
+	}
+	if want := []string{"line 3: id", "line 4: id"}; !cmp.Equal(want, got) {
+		t.Error(cmp.Diff(want, got))
+	}
+}
+
+func TestImportHeader(t *testing.T) {
+	t.Parallel()
+
+	tt := []struct {
+		name  string
+		input string
+	}{
+		{name: "Empty input", input: ""},
+		{name: "Missing title column", input: "id,price\n1,10\n"},
+		{name: "Column mapped twice", input: "title,Title\nTytus,Tytus\n"},
+	}
+
+	for _, tc := range tt {
+		c := newTestCatalog(t)
+		if _, err := bookcsv.Import(c, strings.NewReader(tc.input), bookcsv.Options{}); err == nil {
+			t.Errorf("%s: Import() got no error", tc.name)
+		}
+	}
+}
+
+func TestImportDryRun(t *testing.T) {
+	t.Parallel()
+
+	c := newTestCatalog(t)
+	input := "title;price\nTytus;12.50\nZosia;8\n"
+
+	report, err := bookcsv.Import(c, strings.NewReader(input), bookcsv.Options{DryRun: true, Comma: ';'})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if report.Added != 2 {
+		t.Errorf("dry run Added = %d, want: 2", report.Added)
+	}
+	books, err := c.GetAllBooks()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(books) != 0 {
+		t.Errorf("dry run added %d books", len(books))
+	}
+}
+
+func TestExportImportRoundTrip(t *testing.T) {
+	t.Parallel()
+
+	b := bookshop.Book{
+		ID:             "1",
+		ISBN:           "9780306406157",
+		Title:          "Tytus, Romek i A'Tomek",
+		Authors:        []string{"Papcio Chmiel"},
+		Description:    "Komiks \"kultowy\"",
+		Edition:        2,
+		ReleaseYear:    1970,
+		SeriesNumber:   3,
+		Price:          money.New(2999, money.PLN),
+		PickOfTheMonth: true,
+	}
+	if err := b.SetDiscountPercent(10); err != nil {
+		t.Fatal(err)
+	}
+	if err := b.SetCategories(bookshop.CategoryTech, bookshop.CategoryProgramming); err != nil {
+		t.Fatal(err)
+	}
+	c := newTestCatalog(t, b)
+
+	var buf bytes.Buffer
+	if err := bookcsv.Export(c, &buf); err != nil {
+		t.Fatal(err)
+	}
+	want := `id,isbn,title,authors,description,edition,release_year,series_number,price,currency,discount,sale_price,categories,pick_of_the_month
+1,9780306406157,"Tytus, Romek i A'Tomek",Papcio Chmiel,"Komiks ""kultowy""",2,1970,3,29.99,PLN,10,27.00,tech; programming,true
+`
+	if got := buf.String(); got != want {
+		t.Errorf("Export():\n%s", cmp.Diff(want, got))
+	}
+
+	imported := newTestCatalog(t)
+	report, err := bookcsv.Import(imported, &buf, bookcsv.Options{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !cmp.Equal([]string{bookcsv.ColSalePrice}, report.Ignored) {
+		t.Errorf("Import() ignored = %q, want: sale_price", report.Ignored)
+	}
+	got, err := imported.Store().Get("1")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !cmp.Equal(b, got, cmp.AllowUnexported(bookshop.Book{})) {
+		t.Error(cmp.Diff(b, got, cmp.AllowUnexported(bookshop.Book{})))
+	}
+}
@@ -1,34 +1,43 @@
 package bookshop
 
 import (
+	"encoding/json"
 	"errors"
 	"fmt"
 	"sort"
 	"strings"
+	"sync"
 
 	"github.com/google/uuid"
+	"github.com/qba73/bookshop/internal/money"
 )
 
-const (
-	CategoryAutobiography = iota
-	CategoryTech
-	CategoryRomance
-	CategoryProgramming
-)
+// DefaultCurrency is the currency of prices stored
+// before books had a price currency.
+const DefaultCurrency = money.PLN
 
 // Book represent a single book in the bookshop.
 type Book struct {
-	ID             string
-	Edition        int
-	Title          string
-	Authors        []string
-	Description    string
-	ReleaseYear    int
-	SeriesNumber   int
-	PriceCents     int
+	ID           string
+	ISBN         string // 13 digits without separators, see SetISBN
+	Edition      int
+	Title        string
+	Authors      []string
+	Description  string
+	ReleaseYear  int
+	SeriesNumber int
+	// Format is the form the book is published in,
+	// a printed book when empty.
+	Format         Format
+	Price          money.Money
 	PickOfTheMonth bool
 	discount       int
 	category       int
+	// extraCategories holds categories other than the primary one.
+	extraCategories []int
+	// prices holds list prices in currencies other than
+	// the currency of Price, see SetPriceIn.
+	prices map[money.Currency]money.Money
 }
 
 // String implements Stringer interface for the Book struct.
@@ -43,29 +52,209 @@ func (b *Book) String() string {
 	}
 }
 
-// SalePrice knows how to calculate price for the book with applied discount.
-func (b *Book) SalePrice() int {
-	return b.PriceCents - (b.PriceCents * b.discount / 100)
+// bookJSON is the on-disk representation of a Book. It carries
+// the discount and categories that are not exported from Book.
+// Category is the primary category, Categories lists all of them
+// and is present only when the book has more than one.
+type bookJSON struct {
+	ID             string           `json:"id"`
+	ISBN           string           `json:"isbn,omitempty"`
+	Edition        int              `json:"edition"`
+	Title          string           `json:"title"`
+	Authors        []string         `json:"authors"`
+	Description    string           `json:"description"`
+	ReleaseYear    int              `json:"release_year"`
+	SeriesNumber   int              `json:"series_number"`
+	Format         Format           `json:"format,omitempty"`
+	PriceCents     int64            `json:"price_cents"`
+	Currency       string           `json:"currency,omitempty"`
+	Prices         map[string]int64 `json:"prices,omitempty"`
+	PickOfTheMonth bool             `json:"pick_of_the_month"`
+	Discount       int              `json:"discount"`
+	Category       int              `json:"category"`
+	Categories     []int            `json:"categories,omitempty"`
+}
+
+// MarshalJSON implements json.Marshaler interface for the Book struct.
+func (b Book) MarshalJSON() ([]byte, error) {
+	return json.Marshal(bookJSON{
+		ID:             b.ID,
+		ISBN:           b.ISBN,
+		Edition:        b.Edition,
+		Title:          b.Title,
+		Authors:        b.Authors,
+		Description:    b.Description,
+		ReleaseYear:    b.ReleaseYear,
+		SeriesNumber:   b.SeriesNumber,
+		Format:         b.Format,
+		PriceCents:     b.Price.Amount(),
+		Currency:       string(b.Price.Currency()),
+		Prices:         b.jsonPrices(),
+		PickOfTheMonth: b.PickOfTheMonth,
+		Discount:       b.discount,
+		Category:       b.category,
+		Categories:     b.jsonCategories(),
+	})
 }
 
-// SetPriceCents ...
-func (b *Book) SetPriceCents(p int) (int, error) {
-	if p < 0 {
-		return 0, fmt.Errorf("Invalid book price: %d", p)
+// UnmarshalJSON implements json.Unmarshaler interface for the Book struct.
+func (b *Book) UnmarshalJSON(data []byte) error {
+	var bj bookJSON
+	if err := json.Unmarshal(data, &bj); err != nil {
+		return err
+	}
+	*b = Book{
+		ID:             bj.ID,
+		ISBN:           bj.ISBN,
+		Edition:        bj.Edition,
+		Title:          bj.Title,
+		Authors:        bj.Authors,
+		Description:    bj.Description,
+		ReleaseYear:    bj.ReleaseYear,
+		SeriesNumber:   bj.SeriesNumber,
+		Format:         bj.Format,
+		PickOfTheMonth: bj.PickOfTheMonth,
+		discount:       bj.Discount,
+		category:       bj.Category,
+	}
+	if bj.PriceCents != 0 || bj.Currency != "" {
+		c := DefaultCurrency
+		if bj.Currency != "" {
+			var err error
+			if c, err = money.ParseCurrency(bj.Currency); err != nil {
+				return fmt.Errorf("book id %s: %w", bj.ID, err)
+			}
+		}
+		b.Price = money.New(bj.PriceCents, c)
+	}
+	for code, amount := range bj.Prices {
+		c, err := money.ParseCurrency(code)
+		if err != nil {
+			return fmt.Errorf("book id %s: %w", bj.ID, err)
+		}
+		if err := b.SetPriceIn(money.New(amount, c)); err != nil {
+			return fmt.Errorf("book id %s: %w", bj.ID, err)
+		}
+	}
+	if len(bj.Categories) > 1 {
+		b.category = bj.Categories[0]
+		b.extraCategories = bj.Categories[1:]
 	}
-	b.PriceCents = p
-	return b.PriceCents, nil
+	return nil
+}
+
+func (b Book) jsonPrices() map[string]int64 {
+	if len(b.prices) == 0 {
+		return nil
+	}
+	prices := make(map[string]int64, len(b.prices))
+	for c, p := range b.prices {
+		prices[string(c)] = p.Amount()
+	}
+	return prices
 }
 
-// SetCategory ...
+func (b Book) jsonCategories() []int {
+	if len(b.extraCategories) == 0 {
+		return nil
+	}
+	return b.Categories()
+}
+
+// SalePrice knows how to calculate price for the book with applied
+// discount. The discount is rounded down to whole minor units.
+func (b *Book) SalePrice() money.Money {
+	// Rounding down a discount of at most the whole price
+	// cannot fail.
+	p, _ := b.SalePriceRounded(money.RoundDown)
+	return p
+}
+
+// SalePriceRounded knows how to calculate price for the book with
+// applied discount rounded to minor units with the mode.
+func (b *Book) SalePriceRounded(mode money.RoundingMode) (money.Money, error) {
+	return b.Price.Discount(int64(b.discount), mode)
+}
+
+// SetPrice knows how to change the book list price. A price in
+// the same currency on the price list is removed, see SetPriceIn.
+// It returns error if the price is negative or has no currency.
+func (b *Book) SetPrice(p money.Money) error {
+	if p.IsNegative() {
+		return fmt.Errorf("Invalid book price: %v", p)
+	}
+	if p.Currency() == "" && !p.IsZero() {
+		return fmt.Errorf("Invalid book price: %v: %w", p, money.ErrInvalidCurrency)
+	}
+	b.Price = p
+	b.RemovePriceIn(p.Currency())
+	return nil
+}
+
+// Discount returns the book discount percentage.
+func (b *Book) Discount() int {
+	return b.discount
+}
+
+// Category returns the primary book category.
+func (b *Book) Category() int {
+	return b.category
+}
+
+// Categories returns IDs of all book categories,
+// the primary category first.
+func (b *Book) Categories() []int {
+	return append([]int{b.category}, b.extraCategories...)
+}
+
+// SetCategory knows how to make c the only book category.
+// Whether the category exists is checked by the catalog
+// the book is added to, see Taxonomy.
 func (b *Book) SetCategory(c int) error {
-	if !validCategory(c) {
-		return fmt.Errorf("unknown category: %q", c)
+	return b.SetCategories(c)
+}
+
+// SetCategories knows how to replace book categories.
+// The first category becomes the primary one. Duplicates
+// are ignored.
+func (b *Book) SetCategories(ids ...int) error {
+	if len(ids) == 0 {
+		return errors.New("missing book category")
 	}
-	b.category = c
+
+	var extra []int
+	seen := make(map[int]bool, len(ids))
+	for _, id := range ids {
+		if id < 0 {
+			return fmt.Errorf("invalid category: %d", id)
+		}
+		if seen[id] {
+			continue
+		}
+		if len(seen) > 0 {
+			extra = append(extra, id)
+		}
+		seen[id] = true
+	}
+
+	b.category = ids[0]
+	b.extraCategories = extra
 	return nil
 }
 
+// InCategory reports whether the book belongs to any of
+// the categories.
+func (b *Book) InCategory(ids ...int) bool {
+	for _, c := range b.Categories() {
+		for _, id := range ids {
+			if c == id {
+				return true
+			}
+		}
+	}
+	return false
+}
+
 // SetDiscountPercent knows how to discount a book with
 // given discount percentage. Valid values  0 < discount < 100.
 // It returns error if the discount value is not in the allowed range.
@@ -87,7 +276,7 @@ var Books = map[string]Book{
 		Description:    "description",
 		ReleaseYear:    1997,
 		SeriesNumber:   1,
-		PriceCents:     2000,
+		Price:          money.New(2000, money.PLN),
 		PickOfTheMonth: true,
 		discount:       20,
 		category:       1,
@@ -100,7 +289,7 @@ var Books = map[string]Book{
 		Description:    "description",
 		ReleaseYear:    2017,
 		SeriesNumber:   2,
-		PriceCents:     3000,
+		Price:          money.New(3000, money.PLN),
 		PickOfTheMonth: false,
 		discount:       10,
 		category:       0,
@@ -113,7 +302,7 @@ var Books = map[string]Book{
 		Description:    "description",
 		ReleaseYear:    1967,
 		SeriesNumber:   2,
-		PriceCents:     2500,
+		Price:          money.New(2500, money.PLN),
 		PickOfTheMonth: false,
 		discount:       8,
 		category:       0,
@@ -126,7 +315,7 @@ var Books = map[string]Book{
 		Description:    "description",
 		ReleaseYear:    2011,
 		SeriesNumber:   1,
-		PriceCents:     1000,
+		Price:          money.New(1000, money.PLN),
 		PickOfTheMonth: true,
 		discount:       5,
 		category:       2,
@@ -139,7 +328,7 @@ var Books = map[string]Book{
 		Description:    "description",
 		ReleaseYear:    2011,
 		SeriesNumber:   1,
-		PriceCents:     1000,
+		Price:          money.New(1000, money.PLN),
 		PickOfTheMonth: true,
 		discount:       5,
 		category:       1,
@@ -147,35 +336,94 @@ var Books = map[string]Book{
 }
 
 // Catalog represents book catalog in a bookstore.
+// The zero value is an empty catalog that keeps books in memory.
+// Catalog is safe for concurrent use, except for SetTaxonomy.
 type Catalog struct {
-	Books []Book
+	once     sync.Once
+	store    Store
+	taxonomy *Taxonomy
+}
+
+// NewCatalog knows how to construct a catalog backed by the given store.
+func NewCatalog(s Store) *Catalog {
+	return &Catalog{store: s}
+}
+
+// SetTaxonomy knows how to replace categories books in the catalog
+// are checked against, nil restores the built-in categories. It
+// must not be called concurrently with other methods of the catalog.
+func (c *Catalog) SetTaxonomy(t *Taxonomy) {
+	c.init()
+	if t == nil {
+		t = NewTaxonomy()
+	}
+	c.taxonomy = t
+}
+
+// Taxonomy returns categories of the catalog. The zero value
+// catalog uses the built-in categories.
+func (c *Catalog) Taxonomy() *Taxonomy {
+	c.init()
+	return c.taxonomy
+}
+
+// Store returns the store backing the catalog.
+func (c *Catalog) Store() Store {
+	c.init()
+	return c.store
+}
+
+// init sets defaults of the zero value catalog once.
+func (c *Catalog) init() {
+	c.once.Do(func() {
+		if c.store == nil {
+			c.store = NewMemoryStore(nil)
+		}
+		if c.taxonomy == nil {
+			c.taxonomy = NewTaxonomy()
+		}
+	})
 }
 
 // GetAllBooks nows how to return all books in the bookstore's catalog.
-func (c *Catalog) GetAllBooks() []Book {
-	return c.Books
+func (c *Catalog) GetAllBooks() ([]Book, error) {
+	return c.Store().List()
 }
 
 // Len knows how to return a total number of books in the catalog.
-func (c *Catalog) Len() int {
-	return len(c.Books)
+func (c *Catalog) Len() (int, error) {
+	books, err := c.Store().List()
+	if err != nil {
+		return 0, err
+	}
+	return len(books), nil
 }
 
 // GetAllTitles returns a slice of book titles in the catalog.
-func (c *Catalog) GetAllTitles() []string {
+func (c *Catalog) GetAllTitles() ([]string, error) {
+	books, err := c.Store().List()
+	if err != nil {
+		return nil, err
+	}
+
 	var titles []string
-	for _, t := range c.Books {
+	for _, t := range books {
 		titles = append(titles, t.Title)
 	}
-	return titles
+	return titles, nil
 }
 
 // GetUniqueAuthors knows how to scan catalog and
 // return a slice of unque authors across the catalog.
-func (c *Catalog) GetUniqueAuthors() []string {
+func (c *Catalog) GetUniqueAuthors() ([]string, error) {
+	books, err := c.Store().List()
+	if err != nil {
+		return nil, err
+	}
+
 	authors := make(map[string]int)
 
-	for _, b := range c.Books {
+	for _, b := range books {
 		for _, v := range b.Authors {
 			_, ok := authors[v]
 			if !ok {
@@ -191,12 +439,48 @@ func (c *Catalog) GetUniqueAuthors() []string {
 	}
 	sort.Strings(uniqueAuthors)
 
-	return uniqueAuthors
+	return uniqueAuthors, nil
 }
 
-// AddBook adds a book to the catalog.
-func (c *Catalog) AddBook(b Book) {
-	c.Books = append(c.Books, b)
+// AddBook adds a book to the catalog, replacing a book with
+// the same ID. Book categories must exist in the catalog taxonomy
+// and no other book may have the same ISBN.
+func (c *Catalog) AddBook(b Book) error {
+	if err := c.check(&b); err != nil {
+		return err
+	}
+	return c.Store().Put(b)
+}
+
+// CreateBook knows how to add a new book to the catalog. It returns
+// ErrBookExists when the catalog has a book with the same ID.
+func (c *Catalog) CreateBook(b Book) error {
+	if err := c.check(&b); err != nil {
+		return err
+	}
+	return c.Store().Create(b)
+}
+
+// UpdateBook knows how to update a book in the catalog. It returns
+// ErrBookNotFound when the catalog has no book with the same ID,
+// so a book deleted in the meantime is not added back.
+func (c *Catalog) UpdateBook(b Book) error {
+	if err := c.check(&b); err != nil {
+		return err
+	}
+	return c.Store().Replace(b)
+}
+
+// check validates categories of the book and normalizes its ISBN.
+// Stores check that the ISBN is unique when the book is written.
+func (c *Catalog) check(b *Book) error {
+	if err := c.Taxonomy().Validate(b.Categories()...); err != nil {
+		return fmt.Errorf("book id %s: %w", b.ID, err)
+	}
+	if err := b.SetISBN(b.ISBN); err != nil {
+		return fmt.Errorf("book id %s: %w", b.ID, err)
+	}
+	return nil
 }
 
 // GetAllBooks ....com
@@ -210,23 +494,28 @@ func NewID() string {
 }
 
 // GetBookDetails ...
-func GetBookDetails(bookID string, books map[string]Book) (string, error) {
-	b, ok := books[bookID]
-	if !ok {
-		return "", fmt.Errorf("book id %s not found", bookID)
+func GetBookDetails(bookID string, store Store) (string, error) {
+	b, err := store.Get(bookID)
+	if err != nil {
+		return "", err
 	}
 
 	return fmt.Sprint(&b), nil
 }
 
 // GetAllByAuthor ...
-func GetAllByAuthor(author string, books map[string]Book) ([]string, error) {
+func GetAllByAuthor(author string, store Store) ([]string, error) {
+	books, err := store.List()
+	if err != nil {
+		return nil, err
+	}
+
 	var bookIds []string
 
-	for k, v := range books {
+	for _, v := range books {
 		for _, a := range v.Authors {
 			if a == author {
-				bookIds = append(bookIds, k)
+				bookIds = append(bookIds, v.ID)
 			}
 		}
 	}
@@ -235,23 +524,22 @@ func GetAllByAuthor(author string, books map[string]Book) ([]string, error) {
 }
 
 // NetPrice calculates the price with discount applied.
-func NetPrice(b Book, books map[string]Book) (int, error) {
-	book, ok := books[b.ID]
-	if !ok {
-		return 0, fmt.Errorf("book %s not found", b.ID)
+func NetPrice(b Book, store Store) (money.Money, error) {
+	book, err := store.Get(b.ID)
+	if err != nil {
+		return money.Money{}, err
 	}
-	price := book.PriceCents - (book.PriceCents * book.discount / 100)
-	return price, nil
+	return book.SalePrice(), nil
 }
 
 // GetAllBookDetails returns a list of book catalog in one string.
 // The list is sorted by title.
-func GetAllBookDetails(books map[string]Book) string {
+func GetAllBookDetails(store Store) (string, error) {
 	var bookDetails []string
-	var bks []Book
 
-	for _, b := range books {
-		bks = append(bks, b)
+	bks, err := store.List()
+	if err != nil {
+		return "", err
 	}
 
 	sort.Slice(bks, func(i, j int) bool {
@@ -262,26 +550,5 @@ func GetAllBookDetails(books map[string]Book) string {
 		bookDetails = append(bookDetails, fmt.Sprintf("%s\n", &b))
 	}
 
-	return strings.Join(bookDetails, "")
-}
-
-// BuyBook knows how to
-func BuyBook(bookID string, price int, processPayment func(bookID string, price int) (bool, error)) (bool, error) {
-	if bookID == "" {
-		return false, errors.New("Invalid bookID")
-	}
-	if price < 0 {
-		return false, fmt.Errorf("Invalid book price: %d", price)
-	}
-	return processPayment(bookID, price)
-}
-
-func validCategory(c int) bool {
-	validCategories := map[int]bool{
-		CategoryAutobiography: true,
-		CategoryRomance:       true,
-		CategoryProgramming:   true,
-		CategoryTech:          true,
-	}
-	return validCategories[c]
+	return strings.Join(bookDetails, ""), nil
 }
@@ -1,14 +1,16 @@
 package bookshop_test
 
 import (
-	"errors"
+	"encoding/json"
+	"strings"
+	"sync"
 	"testing"
 
 	"github.com/google/go-cmp/cmp"
 	"github.com/google/go-cmp/cmp/cmpopts"
 	"github.com/google/uuid"
 	"github.com/qba73/bookshop/internal/bookshop"
-	"github.com/qba73/bookshop/internal/payment"
+	"github.com/qba73/bookshop/internal/money"
 )
 
 var testBooks = map[string]bookshop.Book{
@@ -20,7 +22,7 @@ var testBooks = map[string]bookshop.Book{
 		Description:    "description",
 		ReleaseYear:    1997,
 		SeriesNumber:   1,
-		PriceCents:     2000,
+		Price:          money.New(2000, money.PLN),
 		PickOfTheMonth: true,
 	},
 	"Book2": {
@@ -31,7 +33,7 @@ var testBooks = map[string]bookshop.Book{
 		Description:    "description",
 		ReleaseYear:    1997,
 		SeriesNumber:   1,
-		PriceCents:     2000,
+		Price:          money.New(2000, money.PLN),
 		PickOfTheMonth: true,
 	},
 	"Book3": {
@@ -42,9 +44,33 @@ var testBooks = map[string]bookshop.Book{
 		Description:    "description",
 		ReleaseYear:    1997,
 		SeriesNumber:   1,
-		PriceCents:     -2,
+		Price:          money.New(-2, money.PLN),
 		PickOfTheMonth: true,
 	},
+	"Book4": {
+		ID:             "2a56f3c1-8d0e-4c43-9b7e-5a1de2f0c7aa",
+		Edition:        2,
+		Title:          "Bolek i Lolek i Matolek",
+		Authors:        []string{"Bolek", "Gizmo"},
+		Description:    "description",
+		ReleaseYear:    1999,
+		SeriesNumber:   2,
+		Price:          money.New(2500, money.PLN),
+		PickOfTheMonth: false,
+	},
+}
+
+// newTestCatalog returns an in-memory catalog holding given books.
+func newTestCatalog(t *testing.T, books ...bookshop.Book) *bookshop.Catalog {
+	t.Helper()
+
+	var c bookshop.Catalog
+	for _, b := range books {
+		if err := c.AddBook(b); err != nil {
+			t.Fatal(err)
+		}
+	}
+	return &c
 }
 
 func TestBook(t *testing.T) {
@@ -54,61 +80,88 @@ func TestBook(t *testing.T) {
 		Authors:        []string{"Gizmo", "Bolek"},
 		Description:    "Bolek i Lolek adventures",
 		SeriesNumber:   3,
-		PriceCents:     30000,
+		Price:          money.New(30000, money.PLN),
 		PickOfTheMonth: true,
 	}
 }
 
 func TestBook_SalePrice(t *testing.T) {
 	bk := bookshop.Book{
-		PriceCents: 2000,
+		Price: money.New(2000, money.PLN),
 	}
 
 	tt := []struct {
 		name          string
 		b             bookshop.Book
-		want          int
+		discount      int
+		want          money.Money
 		expectedError bool
 	}{
-		{name: "Calculate NetPrice", b: bk, want: 1600, expectedError: false},
+		{name: "Calculate NetPrice", b: bk, discount: 20, want: money.New(1600, money.PLN), expectedError: false},
+		{name: "Round discount down", b: bookshop.Book{Price: money.New(2499, money.PLN)}, discount: 10, want: money.New(2250, money.PLN), expectedError: false},
 	}
 
 	for _, tc := range tt {
-		tc.b.SetDiscountPercent(20)
+		tc.b.SetDiscountPercent(tc.discount)
 		got := tc.b.SalePrice()
 
 		if got != tc.want {
-			t.Errorf("%s, book.NetPrice() = %d, want: %d", tc.name, got, tc.want)
+			t.Errorf("%s, book.NetPrice() = %v, want: %v", tc.name, got, tc.want)
 		}
 
 	}
 }
 
+func TestBook_SalePriceRounded(t *testing.T) {
+	t.Parallel()
+
+	b := bookshop.Book{Price: money.New(2499, money.PLN)}
+	if err := b.SetDiscountPercent(10); err != nil {
+		t.Fatal(err)
+	}
+
+	tt := []struct {
+		name string
+		mode money.RoundingMode
+		want money.Money
+	}{
+		{name: "Round down", mode: money.RoundDown, want: money.New(2250, money.PLN)},
+		{name: "Round up", mode: money.RoundUp, want: money.New(2249, money.PLN)},
+		{name: "Round half even", mode: money.RoundHalfEven, want: money.New(2249, money.PLN)},
+	}
+
+	for _, tc := range tt {
+		got, err := b.SalePriceRounded(tc.mode)
+		if err != nil {
+			t.Fatalf("%s, SalePriceRounded(%v) got error: %v", tc.name, tc.mode, err)
+		}
+		if got != tc.want {
+			t.Errorf("%s, SalePriceRounded(%v) = %v, want: %v", tc.name, tc.mode, got, tc.want)
+		}
+	}
+}
+
 func TestBook_SetBookPrice(t *testing.T) {
 	tt := []struct {
 		name        string
 		b           bookshop.Book
-		newPrice    int
-		want        int
+		newPrice    money.Money
 		expectedErr bool
 	}{
-		{name: "Change price", b: bookshop.Book{Title: "Fox", Authors: []string{"Gizmo"}, PriceCents: 5000}, newPrice: 2000, want: 2000, expectedErr: false},
-		{name: "Change price", b: bookshop.Book{Title: "Fox", Authors: []string{"Gizmo"}, PriceCents: 5000}, newPrice: -1000, want: 0, expectedErr: true},
+		{name: "Change price", b: bookshop.Book{Title: "Fox", Authors: []string{"Gizmo"}, Price: money.New(5000, money.PLN)}, newPrice: money.New(2000, money.PLN), expectedErr: false},
+		{name: "Change price", b: bookshop.Book{Title: "Fox", Authors: []string{"Gizmo"}, Price: money.New(5000, money.PLN)}, newPrice: money.New(-1000, money.PLN), expectedErr: true},
+		{name: "Price without currency", b: bookshop.Book{Title: "Fox", Authors: []string{"Gizmo"}, Price: money.New(5000, money.PLN)}, newPrice: money.New(1000, ""), expectedErr: true},
 	}
 
 	for _, tc := range tt {
-		got, err := tc.b.SetPriceCents(tc.newPrice)
+		err := tc.b.SetPrice(tc.newPrice)
 		if (err != nil) != tc.expectedErr {
-			t.Fatalf("%s, SetPiceCents(%d) = %d, want: %d", tc.name, tc.newPrice, got, tc.want)
-		}
-
-		if !tc.expectedErr && (got != tc.want) {
-			t.Errorf("%s, SetPiceCents(%d) = %d, want: %d", tc.name, tc.newPrice, got, tc.want)
+			t.Fatalf("%s, SetPrice(%v) got error: %v", tc.name, tc.newPrice, err)
 		}
 
 		// Verify if the book struct has been modified.
-		if !tc.expectedErr && (tc.b.PriceCents != tc.newPrice) {
-			t.Errorf("got: %d, want: %d", tc.b.PriceCents, tc.newPrice)
+		if !tc.expectedErr && (tc.b.Price != tc.newPrice) {
+			t.Errorf("got: %v, want: %v", tc.b.Price, tc.newPrice)
 		}
 	}
 }
@@ -125,10 +178,10 @@ func TestBook_SetCategory(t *testing.T) {
 		category    int
 		expectedErr bool
 	}{
-		{name: "Set invalid category", book: b, category: 10, expectedErr: true},
+		{name: "Set invalid category", book: b, category: -1, expectedErr: true},
 		{name: "Set category", book: b, category: bookshop.CategoryTech, expectedErr: false},
 		{name: "Set invalid category", book: b, category: bookshop.CategoryRomance, expectedErr: false},
-		{name: "Set invalid category", book: b, category: 10, expectedErr: true},
+		{name: "Set invalid category", book: b, category: -1, expectedErr: true},
 	}
 
 	for _, tc := range tt {
@@ -144,9 +197,9 @@ func TestBook_SetCategory(t *testing.T) {
 
 func TestBook_SetDiscount(t *testing.T) {
 	b := bookshop.Book{
-		Title:      "Harry",
-		Authors:    []string{"Gizmo"},
-		PriceCents: 2000,
+		Title:   "Harry",
+		Authors: []string{"Gizmo"},
+		Price:   money.New(2000, money.PLN),
 	}
 
 	tt := []struct {
@@ -172,6 +225,28 @@ func TestBook_SetDiscount(t *testing.T) {
 	}
 }
 
+func TestBook_DiscountAndCategory(t *testing.T) {
+	b := bookshop.Book{
+		Title:   "Harry",
+		Authors: []string{"Gizmo"},
+		Price:   money.New(2000, money.PLN),
+	}
+
+	if err := b.SetDiscountPercent(15); err != nil {
+		t.Fatal(err)
+	}
+	if err := b.SetCategory(bookshop.CategoryProgramming); err != nil {
+		t.Fatal(err)
+	}
+
+	if got := b.Discount(); got != 15 {
+		t.Errorf("Discount() = %d, want: %d", got, 15)
+	}
+	if got := b.Category(); got != bookshop.CategoryProgramming {
+		t.Errorf("Category() = %d, want: %d", got, bookshop.CategoryProgramming)
+	}
+}
+
 func TestGetAllBooks(t *testing.T) {
 	want := bookshop.Books
 	got := bookshop.GetAllBooks()
@@ -210,11 +285,11 @@ func TestGetBookDetails(t *testing.T) {
 
 		// Expected errors
 		//{"Single author incorrect description", "1912bbf7-3f26-4196-b062-071b81b855e9", "Title: Bolek i Lolek, Authors: Bolek, Year: 1997, ID: 1912bbf7-3f26-4196-b062-071b81b855e9", true},
-		//{"Not existing book", "9992bbf7-3f26-4196-b062-071b81b855e9", "Title: Bolek i Lolek, Author: Bolek, Year: 1997, ID: 1912bbf7-3f26-4196-b062-071b81b855e9", true},
+		{"Not existing book", "9992bbf7-3f26-4196-b062-071b81b855e9", "", true},
 	}
 	for _, tc := range tt {
 		t.Run(tc.name, func(t *testing.T) {
-			got, err := bookshop.GetBookDetails(tc.bookID, bookshop.Books)
+			got, err := bookshop.GetBookDetails(tc.bookID, bookshop.NewMemoryStore(bookshop.Books))
 
 			if (err != nil) != tc.expectedErr {
 				t.Fatalf("%s GetBookDetails() = expected error", tc.name)
@@ -238,17 +313,17 @@ func TestGetAllByAuthor(t *testing.T) {
 	tt := []struct {
 		name        string
 		author      string
-		books       map[string]bookshop.Book
+		books       bookshop.Store
 		want        []string
 		expectedErr bool
 	}{
-		{"Single author", "Bolek", bookshop.Books, []string{"1912bbf7-3f26-4196-b062-071b81b855e9", "2922bbf7-3g26-4196-b062-071b81b855e9"}, false},
-		{"Single author", "Gienek", bookshop.Books, []string{"1912abf7-3f26-4196-b062-011b81b255e9"}, false},
-		{"Multiple authors", "Gizmo", bookshop.Books, []string{"1923bbf9-4f36-4196-b062-171b81b855e9"}, false},
+		{"Single author", "Bolek", bookshop.NewMemoryStore(bookshop.Books), []string{"1912bbf7-3f26-4196-b062-071b81b855e9", "2922bbf7-3g26-4196-b062-071b81b855e9"}, false},
+		{"Single author", "Gienek", bookshop.NewMemoryStore(bookshop.Books), []string{"1912abf7-3f26-4196-b062-011b81b255e9"}, false},
+		{"Multiple authors", "Gizmo", bookshop.NewMemoryStore(bookshop.Books), []string{"1923bbf9-4f36-4196-b062-171b81b855e9"}, false},
 	}
 
 	for _, tc := range tt {
-		got, err := bookshop.GetAllByAuthor(tc.author, bookshop.Books)
+		got, err := bookshop.GetAllByAuthor(tc.author, tc.books)
 
 		if (err != nil) != tc.expectedErr {
 			t.Fatalf("%s GetAllByAuthor(%s) should return error", tc.name, tc.author)
@@ -262,19 +337,25 @@ func TestGetAllByAuthor(t *testing.T) {
 
 func TestNetPrice(t *testing.T) {
 	tt := []struct {
-		name string
-		book bookshop.Book
-		want int
+		name        string
+		book        bookshop.Book
+		want        money.Money
+		expectedErr bool
 	}{
-		{"Calculate net price", bookshop.Book{ID: "1912bbf7-3f26-4196-b062-071b81b855e9", Title: "Bolek i Lolek", PriceCents: 2000}, 1600},
+		{"Calculate net price", bookshop.Book{ID: "1912bbf7-3f26-4196-b062-071b81b855e9", Title: "Bolek i Lolek", Price: money.New(2000, money.PLN)}, money.New(1600, money.PLN), false},
+		{"Book not in catalog", bookshop.Book{ID: "9992bbf7-3f26-4196-b062-071b81b855e9", Title: "Bolek i Lolek", Price: money.New(2000, money.PLN)}, money.Money{}, true},
 	}
 
 	for _, tc := range tt {
 
-		got, _ := bookshop.NetPrice(tc.book, bookshop.Books)
+		got, err := bookshop.NetPrice(tc.book, bookshop.NewMemoryStore(bookshop.Books))
+
+		if (err != nil) != tc.expectedErr {
+			t.Fatalf("%s; NetPrice() got error: %v", tc.name, err)
+		}
 
 		if got != tc.want {
-			t.Errorf("%s; NetPrice() = %d; want %d", tc.name, got, tc.want)
+			t.Errorf("%s; NetPrice() = %v; want %v", tc.name, got, tc.want)
 		}
 	}
 }
@@ -289,14 +370,17 @@ Title: Zosia Samosia, Authors: Papcio Chmiel, Zigmas Laurin, Year: 2011, ID: 192
 
 	tt := []struct {
 		name  string
-		books map[string]bookshop.Book
+		books bookshop.Store
 		want  string
 	}{
-		{"All books in catalog", bookshop.Books, allbooks},
+		{"All books in catalog", bookshop.NewMemoryStore(bookshop.Books), allbooks},
 	}
 
 	for _, tc := range tt {
-		got := bookshop.GetAllBookDetails(tc.books)
+		got, err := bookshop.GetAllBookDetails(tc.books)
+		if err != nil {
+			t.Fatal(err)
+		}
 
 		if !cmp.Equal(got, tc.want) {
 			t.Errorf("%s GetAllBookDetails() =\n%s", tc.name, cmp.Diff(tc.want, got))
@@ -304,72 +388,32 @@ Title: Zosia Samosia, Authors: Papcio Chmiel, Zigmas Laurin, Year: 2011, ID: 192
 	}
 }
 
-func TestBuyBook(t *testing.T) {
-	paymentOK := func(bookID string, price int) (bool, error) {
-		return true, nil
-	}
-
-	paymentFailed := func(bookID string, price int) (bool, error) {
-		return false, errors.New("Payment failed")
-	}
-
-	tt := []struct {
-		name        string
-		book        bookshop.Book
-		payer       payment.Processor
-		want        bool
-		expectedErr bool
-	}{
-		{name: "Succesful payment", book: testBooks["Book1"], payer: paymentOK, want: true, expectedErr: false},
-		{name: "Not successful payment", book: testBooks["Book1"], payer: paymentFailed, want: false, expectedErr: true},
-		{name: "Missing book id", book: testBooks["Book2"], payer: paymentOK, want: false, expectedErr: true},
-		{name: "Incorrect price", book: testBooks["Books3"], payer: paymentOK, want: false, expectedErr: true},
-	}
-
-	for _, tc := range tt {
-		got, err := bookshop.BuyBook(tc.book.ID, tc.book.PriceCents, tc.payer)
-
-		if (err != nil) != tc.expectedErr {
-			t.Fatalf("%s, BuyBook() = %v, expected unsuccesfull payment: %v, err: %s", tc.name, got, tc.want, err)
-		}
-
-		if !tc.expectedErr && got != tc.want {
-			t.Errorf("%s, BuyBook(%s, %d) = %v, want: %v", tc.name, tc.book.ID, tc.book.PriceCents, got, tc.want)
-		}
-	}
-}
-
 func TestCatalogGetAllBooks(t *testing.T) {
 	want := []bookshop.Book{
 		testBooks["Book1"],
-		testBooks["Book2"],
+		testBooks["Book4"],
 	}
 
-	c := bookshop.Catalog{
-		Books: []bookshop.Book{
-			testBooks["Book1"],
-			testBooks["Book2"],
-		},
-	}
+	c := newTestCatalog(t, testBooks["Book4"], testBooks["Book1"])
 
-	got := c.GetAllBooks()
+	got, err := c.GetAllBooks()
+	if err != nil {
+		t.Fatal(err)
+	}
 
 	if !cmp.Equal(got, want, cmpopts.IgnoreUnexported(bookshop.Book{})) {
-		t.Errorf(cmp.Diff(got, want))
+		t.Errorf(cmp.Diff(got, want, cmpopts.IgnoreUnexported(bookshop.Book{})))
 	}
 }
 
 func TestCatalogLen(t *testing.T) {
-	books := []bookshop.Book{
-		testBooks["Book1"],
-		testBooks["Book2"],
-	}
+	c := newTestCatalog(t, testBooks["Book1"], testBooks["Book4"])
 
-	c := bookshop.Catalog{
-		Books: books,
-	}
 	want := 2
-	got := c.Len()
+	got, err := c.Len()
+	if err != nil {
+		t.Fatal(err)
+	}
 
 	if got != want {
 		t.Errorf("Len() = %d, want: %d", got, want)
@@ -377,19 +421,15 @@ func TestCatalogLen(t *testing.T) {
 }
 
 func TestCatalogGetAllTitles(t *testing.T) {
-	books := []bookshop.Book{
-		testBooks["Book1"],
-		testBooks["Book2"],
-	}
+	c := newTestCatalog(t, testBooks["Book1"], testBooks["Book4"])
 
 	want := []string{"Bolek i Lolek", "Bolek i Lolek i Matolek"}
 
-	c := bookshop.Catalog{
-		Books: books,
+	got, err := c.GetAllTitles()
+	if err != nil {
+		t.Fatal(err)
 	}
 
-	got := c.GetAllTitles()
-
 	if !cmp.Equal(got, want) {
 		t.Errorf(cmp.Diff(got, want))
 	}
@@ -404,15 +444,20 @@ func TestCatalogAddBook(t *testing.T) {
 		Description:    "description",
 		ReleaseYear:    1993,
 		SeriesNumber:   1,
-		PriceCents:     2000,
+		Price:          money.New(2000, money.PLN),
 		PickOfTheMonth: true,
 	}
 
 	var ct bookshop.Catalog
 
-	ct.AddBook(b1)
+	if err := ct.AddBook(b1); err != nil {
+		t.Fatal(err)
+	}
 
-	books := ct.GetAllBooks()
+	books, err := ct.GetAllBooks()
+	if err != nil {
+		t.Fatal(err)
+	}
 
 	if len(books) != 1 {
 		t.Fatalf("Book not added to the catalog")
@@ -421,24 +466,90 @@ func TestCatalogAddBook(t *testing.T) {
 	want := books[0]
 
 	if !cmp.Equal(b1, want, cmpopts.IgnoreUnexported(bookshop.Book{})) {
-		t.Errorf(cmp.Diff(b1, want))
+		t.Errorf(cmp.Diff(b1, want, cmpopts.IgnoreUnexported(bookshop.Book{})))
 	}
 }
 
-func TestGetUniqueAuthors(t *testing.T) {
-	var books []bookshop.Book
+func TestCatalogAddBookMissingID(t *testing.T) {
+	var ct bookshop.Catalog
 
-	for _, v := range testBooks {
-		books = append(books, v)
+	if err := ct.AddBook(testBooks["Book2"]); err == nil {
+		t.Errorf("AddBook() with empty book id should return error")
 	}
+}
 
-	c := bookshop.Catalog{
-		Books: books,
+func TestCatalogConcurrentZeroValue(t *testing.T) {
+	t.Parallel()
+
+	var (
+		ct bookshop.Catalog
+		wg sync.WaitGroup
+	)
+	for i := 0; i < 10; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			if ct.Taxonomy() == nil {
+				t.Error("Taxonomy() = nil")
+			}
+			if _, err := ct.GetAllBooks(); err != nil {
+				t.Error(err)
+			}
+		}()
+	}
+	wg.Wait()
+
+	ct.SetTaxonomy(nil)
+	if ct.Taxonomy() == nil {
+		t.Error("Taxonomy() = nil after SetTaxonomy(nil)")
 	}
+}
+
+func TestGetUniqueAuthors(t *testing.T) {
+	c := newTestCatalog(t, testBooks["Book3"], testBooks["Book4"])
+
 	want := []string{"Bolek", "Gizmo", "Papcio"}
-	got := c.GetUniqueAuthors()
+	got, err := c.GetUniqueAuthors()
+	if err != nil {
+		t.Fatal(err)
+	}
 
 	if !cmp.Equal(want, got, cmpopts.IgnoreUnexported(bookshop.Book{})) {
 		t.Errorf(cmp.Diff(want, got))
 	}
 }
+
+func TestBook_JSONPrice(t *testing.T) {
+	t.Parallel()
+
+	tt := []struct {
+		name        string
+		data        string
+		want        money.Money
+		expectedErr bool
+	}{
+		{name: "Price with currency", data: `{"id":"1","price_cents":1999,"currency":"EUR"}`, want: money.New(1999, money.EUR)},
+		{name: "Price without currency", data: `{"id":"1","price_cents":1999}`, want: money.New(1999, bookshop.DefaultCurrency)},
+		{name: "No price", data: `{"id":"1"}`, want: money.Money{}},
+		{name: "Invalid currency", data: `{"id":"1","price_cents":1999,"currency":"złoty"}`, expectedErr: true},
+	}
+
+	for _, tc := range tt {
+		var b bookshop.Book
+		err := json.Unmarshal([]byte(tc.data), &b)
+		if (err != nil) != tc.expectedErr {
+			t.Fatalf("%s, Unmarshal(%s) got error: %v", tc.name, tc.data, err)
+		}
+		if !tc.expectedErr && b.Price != tc.want {
+			t.Errorf("%s, Unmarshal(%s) price = %v, want: %v", tc.name, tc.data, b.Price, tc.want)
+		}
+	}
+
+	data, err := json.Marshal(bookshop.Book{ID: "1", Price: money.New(1999, money.EUR)})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !strings.Contains(string(data), `"price_cents":1999,"currency":"EUR"`) {
+		t.Errorf("Marshal() = %s, want price in EUR", data)
+	}
+}
@@ -0,0 +1,371 @@
+package bookshop
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"sort"
+	"strings"
+	"sync"
+	"unicode"
+)
+
+// Built-in categories every taxonomy starts with.
+const (
+	CategoryAutobiography = iota
+	CategoryTech
+	CategoryRomance
+	CategoryProgramming
+)
+
+// NoParent is the ParentID of top level categories.
+const NoParent = -1
+
+var (
+	// ErrCategoryNotFound is returned when a category does not exist.
+	ErrCategoryNotFound = errors.New("category not found")
+	// ErrDuplicateCategory is returned when a category with
+	// the same slug already exists.
+	ErrDuplicateCategory = errors.New("duplicate category")
+	// ErrInvalidCategory is returned when a category name
+	// or parent is not valid.
+	ErrInvalidCategory = errors.New("invalid category")
+)
+
+// Category represents a node in the category hierarchy.
+type Category struct {
+	ID       int    `json:"id"`
+	Name     string `json:"name"`
+	Slug     string `json:"slug"`
+	ParentID int    `json:"parent_id"`
+}
+
+// Taxonomy is a registry of categories arranged in a hierarchy.
+// Categories can be added and renamed at runtime. It is safe
+// for concurrent use.
+type Taxonomy struct {
+	mu         sync.RWMutex
+	categories map[int]Category
+	next       int
+}
+
+// NewTaxonomy knows how to construct a taxonomy holding
+// the built-in categories.
+func NewTaxonomy() *Taxonomy {
+	t := Taxonomy{categories: make(map[int]Category)}
+	for _, c := range []Category{
+		{ID: CategoryAutobiography, Name: "Autobiography"},
+		{ID: CategoryTech, Name: "Tech"},
+		{ID: CategoryRomance, Name: "Romance"},
+		{ID: CategoryProgramming, Name: "Programming"},
+	} {
+		c.Slug = Slugify(c.Name)
+		c.ParentID = NoParent
+		t.categories[c.ID] = c
+	}
+	t.next = CategoryProgramming + 1
+	return &t
+}
+
+// OpenTaxonomy knows how to load a taxonomy saved in the JSON file
+// at path. A missing file yields the built-in categories.
+func OpenTaxonomy(path string) (*Taxonomy, error) {
+	data, err := os.ReadFile(path)
+	if errors.Is(err, os.ErrNotExist) {
+		return NewTaxonomy(), nil
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	var t Taxonomy
+	if err := json.Unmarshal(data, &t); err != nil {
+		return nil, fmt.Errorf("decoding %s: %w", path, err)
+	}
+	return &t, nil
+}
+
+// Save knows how to write the taxonomy to the JSON file at path.
+func (t *Taxonomy) Save(path string) error {
+	data, err := json.MarshalIndent(t, "", "  ")
+	if err != nil {
+		return err
+	}
+	return writeFileAtomic(path, data)
+}
+
+// MarshalJSON implements json.Marshaler interface for the Taxonomy.
+// Categories are written as a list sorted by ID.
+func (t *Taxonomy) MarshalJSON() ([]byte, error) {
+	return json.Marshal(t.List())
+}
+
+// UnmarshalJSON implements json.Unmarshaler interface for the Taxonomy.
+func (t *Taxonomy) UnmarshalJSON(data []byte) error {
+	var list []Category
+	if err := json.Unmarshal(data, &list); err != nil {
+		return err
+	}
+
+	categories := make(map[int]Category, len(list))
+	slugs := make(map[string]bool, len(list))
+	next := 0
+	for _, c := range list {
+		if _, ok := categories[c.ID]; ok || c.ID < 0 {
+			return fmt.Errorf("category id %d: %w", c.ID, ErrInvalidCategory)
+		}
+		if c.Slug == "" || slugs[c.Slug] {
+			return fmt.Errorf("category slug %q: %w", c.Slug, ErrDuplicateCategory)
+		}
+		categories[c.ID] = c
+		slugs[c.Slug] = true
+		if c.ID >= next {
+			next = c.ID + 1
+		}
+	}
+	for _, c := range categories {
+		if err := checkAncestors(categories, c); err != nil {
+			return err
+		}
+	}
+
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	t.categories = categories
+	t.next = next
+	return nil
+}
+
+// Add knows how to add a category with the given name under the
+// parent category, or at the top level when parentID is NoParent.
+// The slug is derived from the name and must be unique.
+func (t *Taxonomy) Add(name string, parentID int) (Category, error) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	c := Category{ID: t.next, Name: strings.TrimSpace(name), Slug: Slugify(name), ParentID: parentID}
+	if err := t.check(c); err != nil {
+		return Category{}, err
+	}
+	t.categories[c.ID] = c
+	t.next++
+	return c, nil
+}
+
+// Rename knows how to change the name and slug of a category.
+// Books keep referring to the category by ID, so they are
+// not affected.
+func (t *Taxonomy) Rename(id int, name string) (Category, error) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	c, ok := t.categories[id]
+	if !ok {
+		return Category{}, fmt.Errorf("category id %d: %w", id, ErrCategoryNotFound)
+	}
+	c.Name = strings.TrimSpace(name)
+	c.Slug = Slugify(name)
+	if err := t.check(c); err != nil {
+		return Category{}, err
+	}
+	t.categories[id] = c
+	return c, nil
+}
+
+// Get returns a category with the given ID.
+func (t *Taxonomy) Get(id int) (Category, error) {
+	t.mu.RLock()
+	defer t.mu.RUnlock()
+
+	c, ok := t.categories[id]
+	if !ok {
+		return Category{}, fmt.Errorf("category id %d: %w", id, ErrCategoryNotFound)
+	}
+	return c, nil
+}
+
+// BySlug returns a category with the given slug.
+func (t *Taxonomy) BySlug(slug string) (Category, error) {
+	t.mu.RLock()
+	defer t.mu.RUnlock()
+
+	for _, c := range t.categories {
+		if c.Slug == slug {
+			return c, nil
+		}
+	}
+	return Category{}, fmt.Errorf("category %s: %w", slug, ErrCategoryNotFound)
+}
+
+// List returns all categories sorted by ID.
+func (t *Taxonomy) List() []Category {
+	t.mu.RLock()
+	defer t.mu.RUnlock()
+
+	list := make([]Category, 0, len(t.categories))
+	for _, c := range t.categories {
+		list = append(list, c)
+	}
+	sort.Slice(list, func(i, j int) bool { return list[i].ID < list[j].ID })
+	return list
+}
+
+// Children returns direct subcategories of the category sorted by
+// ID, or top level categories when id is NoParent.
+func (t *Taxonomy) Children(id int) []Category {
+	var children []Category
+	for _, c := range t.List() {
+		if c.ParentID == id {
+			children = append(children, c)
+		}
+	}
+	return children
+}
+
+// Path returns the category and its ancestors, top level first.
+func (t *Taxonomy) Path(id int) ([]Category, error) {
+	t.mu.RLock()
+	defer t.mu.RUnlock()
+
+	var path []Category
+	for id != NoParent {
+		c, ok := t.categories[id]
+		if !ok {
+			return nil, fmt.Errorf("category id %d: %w", id, ErrCategoryNotFound)
+		}
+		path = append([]Category{c}, path...)
+		id = c.ParentID
+	}
+	return path, nil
+}
+
+// Subtree returns IDs of the category and all its descendants
+// sorted in ascending order.
+func (t *Taxonomy) Subtree(id int) ([]int, error) {
+	t.mu.RLock()
+	defer t.mu.RUnlock()
+
+	if _, ok := t.categories[id]; !ok {
+		return nil, fmt.Errorf("category id %d: %w", id, ErrCategoryNotFound)
+	}
+
+	ids := []int{id}
+	for i := 0; i < len(ids); i++ {
+		for _, c := range t.categories {
+			if c.ParentID == ids[i] {
+				ids = append(ids, c.ID)
+			}
+		}
+	}
+	sort.Ints(ids)
+	return ids, nil
+}
+
+// Expand returns IDs of the categories and all their descendants.
+// Categories not in the taxonomy are returned as they are, so books
+// still match them. A nil taxonomy returns the IDs unchanged.
+func (t *Taxonomy) Expand(ids ...int) []int {
+	if t == nil {
+		return ids
+	}
+	var expanded []int
+	for _, id := range ids {
+		sub, err := t.Subtree(id)
+		if err != nil {
+			sub = []int{id}
+		}
+		expanded = append(expanded, sub...)
+	}
+	return expanded
+}
+
+// Validate returns an error when any of the category IDs
+// is not in the taxonomy.
+func (t *Taxonomy) Validate(ids ...int) error {
+	t.mu.RLock()
+	defer t.mu.RUnlock()
+
+	for _, id := range ids {
+		if _, ok := t.categories[id]; !ok {
+			return fmt.Errorf("category id %d: %w", id, ErrCategoryNotFound)
+		}
+	}
+	return nil
+}
+
+// check validates the name, slug and parent of a new or
+// renamed category. It must be called with t.mu held.
+func (t *Taxonomy) check(c Category) error {
+	if c.Slug == "" {
+		return fmt.Errorf("category name %q: %w", c.Name, ErrInvalidCategory)
+	}
+	if c.ParentID != NoParent {
+		if _, ok := t.categories[c.ParentID]; !ok {
+			return fmt.Errorf("parent category id %d: %w", c.ParentID, ErrCategoryNotFound)
+		}
+	}
+	for _, other := range t.categories {
+		if other.ID != c.ID && other.Slug == c.Slug {
+			return fmt.Errorf("category %s: %w", c.Slug, ErrDuplicateCategory)
+		}
+	}
+	return nil
+}
+
+// checkAncestors returns an error when a parent of the category
+// is missing or the category is its own ancestor.
+func checkAncestors(categories map[int]Category, c Category) error {
+	seen := map[int]bool{c.ID: true}
+	for p := c.ParentID; p != NoParent; {
+		parent, ok := categories[p]
+		if !ok {
+			return fmt.Errorf("parent category id %d of %s: %w", p, c.Slug, ErrCategoryNotFound)
+		}
+		if seen[p] {
+			return fmt.Errorf("category %s is its own ancestor: %w", c.Slug, ErrInvalidCategory)
+		}
+		seen[p] = true
+		p = parent.ParentID
+	}
+	return nil
+}
+
+// foldPolish maps Polish letters with diacritics to their ASCII base.
+var foldPolish = map[rune]rune{
+	'ą': 'a', 'ć': 'c', 'ę': 'e', 'ł': 'l', 'ń': 'n',
+	'ó': 'o', 'ś': 's', 'ź': 'z', 'ż': 'z',
+	'Ą': 'A', 'Ć': 'C', 'Ę': 'E', 'Ł': 'L', 'Ń': 'N',
+	'Ó': 'O', 'Ś': 'S', 'Ź': 'Z', 'Ż': 'Z',
+}
+
+// Fold knows how to replace Polish letters with diacritics
+// with their ASCII base, for example "Łódź" becomes "Lodz".
+func Fold(s string) string {
+	return strings.Map(func(r rune) rune {
+		if f, ok := foldPolish[r]; ok {
+			return f
+		}
+		return r
+	}, s)
+}
+
+// Slugify knows how to turn a name into a lower case, URL friendly
+// identifier, for example "Książki dla dzieci" becomes
+// "ksiazki-dla-dzieci".
+func Slugify(name string) string {
+	var b strings.Builder
+	dash := false
+	for _, r := range strings.ToLower(Fold(name)) {
+		if r > unicode.MaxASCII || !(unicode.IsLetter(r) || unicode.IsDigit(r)) {
+			dash = b.Len() > 0
+			continue
+		}
+		if dash {
+			b.WriteByte('-')
+			dash = false
+		}
+		b.WriteRune(r)
+	}
+	return b.String()
+}
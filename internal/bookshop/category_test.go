@@ -0,0 +1,352 @@
+package bookshop_test
+
+import (
+	"encoding/json"
+	"errors"
+	"path/filepath"
+	"testing"
+
+	"github.com/google/go-cmp/cmp"
+	"github.com/google/go-cmp/cmp/cmpopts"
+	"github.com/qba73/bookshop/internal/bookshop"
+)
+
+// newTestTaxonomy returns built-in categories extended with:
+//
+//	Programming
+//	└── Go
+//	Literatura dziecięca
+//	└── Komiksy
+func newTestTaxonomy(t *testing.T) (*bookshop.Taxonomy, map[string]bookshop.Category) {
+	t.Helper()
+
+	tax := bookshop.NewTaxonomy()
+	programming, err := tax.Get(bookshop.CategoryProgramming)
+	if err != nil {
+		t.Fatal(err)
+	}
+	cats := map[string]bookshop.Category{"programming": programming}
+
+	for _, c := range []struct {
+		key, name, parent string
+	}{
+		{key: "go", name: "Go", parent: "programming"},
+		{key: "kids", name: "Literatura dziecięca"},
+		{key: "comics", name: "Komiksy", parent: "kids"},
+	} {
+		parent := bookshop.NoParent
+		if c.parent != "" {
+			parent = cats[c.parent].ID
+		}
+		cat, err := tax.Add(c.name, parent)
+		if err != nil {
+			t.Fatal(err)
+		}
+		cats[c.key] = cat
+	}
+	return tax, cats
+}
+
+func TestSlugify(t *testing.T) {
+	t.Parallel()
+
+	tt := []struct {
+		name string
+		want string
+	}{
+		{name: "Tech", want: "tech"},
+		{name: "Książki dla dzieci", want: "ksiazki-dla-dzieci"},
+		{name: "  Science & Fiction!  ", want: "science-fiction"},
+		{name: "C++ / Go 2", want: "c-go-2"},
+		{name: "ŻÓŁW", want: "zolw"},
+		{name: "***", want: ""},
+	}
+
+	for _, tc := range tt {
+		if got := bookshop.Slugify(tc.name); got != tc.want {
+			t.Errorf("Slugify(%q) = %q, want: %q", tc.name, got, tc.want)
+		}
+	}
+}
+
+func TestFold(t *testing.T) {
+	t.Parallel()
+
+	tt := []struct {
+		s    string
+		want string
+	}{
+		{s: "Łódź", want: "Lodz"},
+		{s: "zażółć gęślą jaźń", want: "zazolc gesla jazn"},
+		{s: "ŻÓŁW", want: "ZOLW"},
+		{s: "Müller", want: "Müller"},
+	}
+
+	for _, tc := range tt {
+		if got := bookshop.Fold(tc.s); got != tc.want {
+			t.Errorf("Fold(%q) = %q, want: %q", tc.s, got, tc.want)
+		}
+	}
+}
+
+func TestTaxonomyAdd(t *testing.T) {
+	t.Parallel()
+
+	tax, cats := newTestTaxonomy(t)
+
+	want := bookshop.Category{ID: 6, Name: "Komiksy", Slug: "komiksy", ParentID: cats["kids"].ID}
+	if !cmp.Equal(cats["comics"], want) {
+		t.Errorf("Add() \n%s", cmp.Diff(want, cats["comics"]))
+	}
+
+	tt := []struct {
+		name        string
+		category    string
+		parent      int
+		expectedErr error
+	}{
+		{name: "Duplicate slug", category: "go", parent: bookshop.NoParent, expectedErr: bookshop.ErrDuplicateCategory},
+		{name: "Duplicate slug after folding", category: "Literatura Dziecieca", parent: bookshop.NoParent, expectedErr: bookshop.ErrDuplicateCategory},
+		{name: "Missing parent", category: "Rust", parent: 42, expectedErr: bookshop.ErrCategoryNotFound},
+		{name: "Empty name", category: " ", parent: bookshop.NoParent, expectedErr: bookshop.ErrInvalidCategory},
+	}
+
+	for _, tc := range tt {
+		if _, err := tax.Add(tc.category, tc.parent); !errors.Is(err, tc.expectedErr) {
+			t.Errorf("%s Add(%q) = %v, want: %v", tc.name, tc.category, err, tc.expectedErr)
+		}
+	}
+}
+
+func TestTaxonomyRename(t *testing.T) {
+	t.Parallel()
+
+	tax, cats := newTestTaxonomy(t)
+
+	got, err := tax.Rename(cats["comics"].ID, "Komiksy i Ilustracje")
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := bookshop.Category{ID: cats["comics"].ID, Name: "Komiksy i Ilustracje", Slug: "komiksy-i-ilustracje", ParentID: cats["kids"].ID}
+	if !cmp.Equal(got, want) {
+		t.Errorf("Rename() \n%s", cmp.Diff(want, got))
+	}
+	if c, err := tax.BySlug("komiksy-i-ilustracje"); err != nil || c.ID != want.ID {
+		t.Errorf("BySlug() after Rename() = %v, %v", c, err)
+	}
+	if _, err := tax.BySlug("komiksy"); !errors.Is(err, bookshop.ErrCategoryNotFound) {
+		t.Errorf("BySlug() old slug = %v, want: %v", err, bookshop.ErrCategoryNotFound)
+	}
+
+	if _, err := tax.Rename(cats["comics"].ID, "Tech"); !errors.Is(err, bookshop.ErrDuplicateCategory) {
+		t.Errorf("Rename() to existing = %v, want: %v", err, bookshop.ErrDuplicateCategory)
+	}
+	if _, err := tax.Rename(42, "Nowa"); !errors.Is(err, bookshop.ErrCategoryNotFound) {
+		t.Errorf("Rename() missing = %v, want: %v", err, bookshop.ErrCategoryNotFound)
+	}
+}
+
+func TestTaxonomyHierarchy(t *testing.T) {
+	t.Parallel()
+
+	tax, cats := newTestTaxonomy(t)
+
+	got, err := tax.Subtree(bookshop.CategoryProgramming)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want := []int{bookshop.CategoryProgramming, cats["go"].ID}; !cmp.Equal(got, want) {
+		t.Errorf("Subtree() \n%s", cmp.Diff(want, got))
+	}
+
+	path, err := tax.Path(cats["go"].ID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var slugs []string
+	for _, c := range path {
+		slugs = append(slugs, c.Slug)
+	}
+	if want := []string{"programming", "go"}; !cmp.Equal(slugs, want) {
+		t.Errorf("Path() \n%s", cmp.Diff(want, slugs))
+	}
+
+	if got := tax.Children(cats["kids"].ID); !cmp.Equal(got, []bookshop.Category{cats["comics"]}) {
+		t.Errorf("Children() \n%s", cmp.Diff([]bookshop.Category{cats["comics"]}, got))
+	}
+	if n := len(tax.Children(bookshop.NoParent)); n != 5 {
+		t.Errorf("Children(NoParent) returned %d categories, want: 5", n)
+	}
+
+	if _, err := tax.Subtree(42); !errors.Is(err, bookshop.ErrCategoryNotFound) {
+		t.Errorf("Subtree() missing = %v, want: %v", err, bookshop.ErrCategoryNotFound)
+	}
+}
+
+func TestTaxonomyExpand(t *testing.T) {
+	t.Parallel()
+
+	tax, cats := newTestTaxonomy(t)
+
+	got := tax.Expand(bookshop.CategoryProgramming, 42)
+	want := []int{bookshop.CategoryProgramming, cats["go"].ID, 42}
+	if !cmp.Equal(got, want) {
+		t.Errorf("Expand() \n%s", cmp.Diff(want, got))
+	}
+
+	var none *bookshop.Taxonomy
+	if got := none.Expand(bookshop.CategoryProgramming, 42); !cmp.Equal(got, []int{bookshop.CategoryProgramming, 42}) {
+		t.Errorf("Expand() of nil taxonomy = %v, want: [%d 42]", got, bookshop.CategoryProgramming)
+	}
+}
+
+func TestTaxonomyPersistence(t *testing.T) {
+	t.Parallel()
+
+	path := filepath.Join(t.TempDir(), "categories.json")
+
+	tax, err := bookshop.OpenTaxonomy(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !cmp.Equal(tax.List(), bookshop.NewTaxonomy().List()) {
+		t.Errorf("OpenTaxonomy() missing file \n%s", cmp.Diff(bookshop.NewTaxonomy().List(), tax.List()))
+	}
+
+	tax, _ = newTestTaxonomy(t)
+	if err := tax.Save(path); err != nil {
+		t.Fatal(err)
+	}
+	reopened, err := bookshop.OpenTaxonomy(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !cmp.Equal(reopened.List(), tax.List()) {
+		t.Errorf("OpenTaxonomy() \n%s", cmp.Diff(tax.List(), reopened.List()))
+	}
+
+	// New categories continue numbering of the saved ones.
+	c, err := reopened.Add("Rust", bookshop.CategoryProgramming)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if c.ID != 7 {
+		t.Errorf("Add() after OpenTaxonomy() id = %d, want: 7", c.ID)
+	}
+}
+
+func TestTaxonomyUnmarshalInvalid(t *testing.T) {
+	t.Parallel()
+
+	tt := []struct {
+		name        string
+		data        string
+		expectedErr error
+	}{
+		{name: "Duplicate id", data: `[{"id":1,"slug":"a","parent_id":-1},{"id":1,"slug":"b","parent_id":-1}]`, expectedErr: bookshop.ErrInvalidCategory},
+		{name: "Duplicate slug", data: `[{"id":1,"slug":"a","parent_id":-1},{"id":2,"slug":"a","parent_id":-1}]`, expectedErr: bookshop.ErrDuplicateCategory},
+		{name: "Missing parent", data: `[{"id":1,"slug":"a","parent_id":7}]`, expectedErr: bookshop.ErrCategoryNotFound},
+		{name: "Cycle", data: `[{"id":1,"slug":"a","parent_id":2},{"id":2,"slug":"b","parent_id":1}]`, expectedErr: bookshop.ErrInvalidCategory},
+	}
+
+	for _, tc := range tt {
+		var tax bookshop.Taxonomy
+		if err := json.Unmarshal([]byte(tc.data), &tax); !errors.Is(err, tc.expectedErr) {
+			t.Errorf("%s Unmarshal() = %v, want: %v", tc.name, err, tc.expectedErr)
+		}
+	}
+}
+
+func TestBookCategories(t *testing.T) {
+	t.Parallel()
+
+	var b bookshop.Book
+	if got := b.Categories(); !cmp.Equal(got, []int{bookshop.CategoryAutobiography}) {
+		t.Errorf("Categories() of zero book = %v", got)
+	}
+
+	b.ID = "1"
+	if err := b.SetCategories(bookshop.CategoryProgramming, bookshop.CategoryTech, bookshop.CategoryProgramming); err != nil {
+		t.Fatal(err)
+	}
+	if got, want := b.Categories(), []int{bookshop.CategoryProgramming, bookshop.CategoryTech}; !cmp.Equal(got, want) {
+		t.Errorf("Categories() \n%s", cmp.Diff(want, got))
+	}
+	if b.Category() != bookshop.CategoryProgramming {
+		t.Errorf("Category() = %d, want: %d", b.Category(), bookshop.CategoryProgramming)
+	}
+	if !b.InCategory(bookshop.CategoryTech) || b.InCategory(bookshop.CategoryRomance) {
+		t.Errorf("InCategory() of %v", b.Categories())
+	}
+	if err := b.SetCategories(); err == nil {
+		t.Error("SetCategories() without categories should return error")
+	}
+
+	data, err := json.Marshal(b)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var got bookshop.Book
+	if err := json.Unmarshal(data, &got); err != nil {
+		t.Fatal(err)
+	}
+	if !cmp.Equal(got, b, cmp.AllowUnexported(bookshop.Book{})) {
+		t.Errorf("JSON round trip \n%s", cmp.Diff(b, got, cmp.AllowUnexported(bookshop.Book{})))
+	}
+}
+
+func TestCatalogCategories(t *testing.T) {
+	t.Parallel()
+
+	tax, cats := newTestTaxonomy(t)
+	var c bookshop.Catalog
+	c.SetTaxonomy(tax)
+
+	books := []struct {
+		id         string
+		categories []int
+	}{
+		{id: "a", categories: []int{cats["go"].ID}},
+		{id: "b", categories: []int{bookshop.CategoryProgramming}},
+		{id: "c", categories: []int{cats["comics"].ID, bookshop.CategoryRomance}},
+		{id: "d", categories: []int{bookshop.CategoryTech}},
+	}
+	for _, tc := range books {
+		b := bookshop.Book{ID: tc.id, Title: tc.id}
+		if err := b.SetCategories(tc.categories...); err != nil {
+			t.Fatal(err)
+		}
+		if err := c.AddBook(b); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	unknown := bookshop.Book{ID: "e"}
+	if err := unknown.SetCategory(42); err != nil {
+		t.Fatal(err)
+	}
+	if err := c.AddBook(unknown); !errors.Is(err, bookshop.ErrCategoryNotFound) {
+		t.Errorf("AddBook() with unknown category = %v, want: %v", err, bookshop.ErrCategoryNotFound)
+	}
+
+	tt := []struct {
+		name       string
+		categories []int
+		want       []string
+	}{
+		{name: "Subtree", categories: []int{bookshop.CategoryProgramming}, want: []string{"a", "b"}},
+		{name: "Leaf", categories: []int{cats["go"].ID}, want: []string{"a"}},
+		{name: "Secondary category", categories: []int{bookshop.CategoryRomance}, want: []string{"c"}},
+		{name: "Parent of secondary category", categories: []int{cats["kids"].ID, bookshop.CategoryTech}, want: []string{"c", "d"}},
+	}
+
+	for _, tc := range tt {
+		page, err := c.Query(bookshop.Query{Categories: tc.categories})
+		if err != nil {
+			t.Fatalf("%s Query() got error: %v", tc.name, err)
+		}
+		if got := bookIDs(page.Books); !cmp.Equal(got, tc.want, cmpopts.EquateEmpty()) {
+			t.Errorf("%s Query() \n%s", tc.name, cmp.Diff(tc.want, got))
+		}
+	}
+}
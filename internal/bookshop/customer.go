@@ -1,17 +1,179 @@
 package bookshop
 
-import "fmt"
+import (
+	"errors"
+	"fmt"
+	"net/mail"
+	"strings"
+)
 
-// Customer represent a bookshop customer.
+var (
+	// ErrCustomerNotFound is returned by a CustomerStore when
+	// a customer with the requested ID or email does not exist.
+	ErrCustomerNotFound = errors.New("customer not found")
+	// ErrDuplicateEmail is returned when a customer is stored
+	// with the email of another customer.
+	ErrDuplicateEmail = errors.New("duplicate customer email")
+	// ErrInvalidCustomer is returned when customer data
+	// is not valid.
+	ErrInvalidCustomer = errors.New("invalid customer")
+)
+
+// Address represents a postal address.
+type Address struct {
+	// Street is the street, building and flat number. It may
+	// have several lines separated with new lines.
+	Street   string
+	City     string
+	Postcode string
+	// Region is the state, province or county, required
+	// in some countries, for example US states.
+	Region string
+	// Country is the ISO 3166-1 alpha-2 code of the
+	// country, for example PL.
+	Country string
+}
+
+// IsZero reports whether the address is empty.
+func (a Address) IsZero() bool {
+	return a == Address{}
+}
+
+// Lines returns the address as lines, the street lines
+// followed by the postcode and city, the region and the country.
+func (a Address) Lines() []string {
+	var lines []string
+	for _, l := range strings.Split(a.Street, "\n") {
+		if l = strings.TrimSpace(l); l != "" {
+			lines = append(lines, l)
+		}
+	}
+	for _, l := range []string{strings.TrimSpace(a.Postcode + " " + a.City), a.Region, a.Country} {
+		if l != "" {
+			lines = append(lines, l)
+		}
+	}
+	return lines
+}
+
+// Validate returns an error when the address is not complete.
+func (a Address) Validate() error {
+	for _, f := range []struct {
+		name, value string
+	}{{"street", a.Street}, {"city", a.City}, {"postcode", a.Postcode}} {
+		if strings.TrimSpace(f.value) == "" {
+			return fmt.Errorf("missing %s", f.name)
+		}
+	}
+	if !isCountryCode(a.Country) {
+		return fmt.Errorf("invalid country %q", a.Country)
+	}
+	return nil
+}
+
+// Customer represent a bookshop customer account.
 type Customer struct {
-	Title   string
-	Name    string
-	Address string
+	ID    string
+	Title string
+	Name  string
+	// Email identifies the customer when they sign in, no two
+	// customers in a CustomerStore have the same email.
+	Email string
+	Phone string
+	// Billing is the address invoices are issued to.
+	Billing Address
+	// Shipping is the address orders are sent to, the
+	// billing address when empty.
+	Shipping Address
+}
+
+// ShippingAddress returns the address orders of the customer
+// are sent to.
+func (c Customer) ShippingAddress() Address {
+	if c.Shipping.IsZero() {
+		return c.Billing
+	}
+	return c.Shipping
+}
+
+// Validate returns an error matching ErrInvalidCustomer when
+// the customer data is not valid. Addresses are optional,
+// but must be complete when given.
+func (c Customer) Validate() error {
+	if c.ID == "" {
+		return fmt.Errorf("%w: missing id", ErrInvalidCustomer)
+	}
+	if strings.TrimSpace(c.Name) == "" {
+		return fmt.Errorf("%w: missing name", ErrInvalidCustomer)
+	}
+	if !validEmail(c.Email) {
+		return fmt.Errorf("%w: invalid email %q", ErrInvalidCustomer, c.Email)
+	}
+	if c.Phone != "" && !validPhone(c.Phone) {
+		return fmt.Errorf("%w: invalid phone %q", ErrInvalidCustomer, c.Phone)
+	}
+	for _, a := range []struct {
+		name string
+		addr Address
+	}{{"billing", c.Billing}, {"shipping", c.Shipping}} {
+		if a.addr.IsZero() {
+			continue
+		}
+		if err := a.addr.Validate(); err != nil {
+			return fmt.Errorf("%w: %s address: %v", ErrInvalidCustomer, a.name, err)
+		}
+	}
+	return nil
+}
+
+// NormalizeEmail returns the email in the form customers
+// are looked up by, trimmed and in lower case.
+func NormalizeEmail(email string) string {
+	return strings.ToLower(strings.TrimSpace(email))
+}
+
+// NormalizeCountry returns the ISO 3166-1 code of the country,
+// trimmed and in capitals, with GB for the United Kingdom code UK
+// used by some carriers.
+func NormalizeCountry(code string) string {
+	code = strings.ToUpper(strings.TrimSpace(code))
+	if code == "UK" {
+		return "GB"
+	}
+	return code
+}
+
+func validEmail(email string) bool {
+	a, err := mail.ParseAddress(email)
+	return err == nil && a.Name == "" && a.Address == strings.TrimSpace(email)
+}
+
+// validPhone reports whether the phone number has 6 to 15
+// digits, optionally grouped with spaces, dashes and brackets
+// and preceded with a plus sign.
+func validPhone(phone string) bool {
+	var digits int
+	for i, r := range strings.TrimSpace(phone) {
+		switch {
+		case r >= '0' && r <= '9':
+			digits++
+		case r == '+' && i == 0:
+		case r == ' ' || r == '-' || r == '(' || r == ')':
+		default:
+			return false
+		}
+	}
+	return digits >= 6 && digits <= 15
 }
 
-// MailingLabel knows how to construct and present
-// customer data required to print mailing labels.
-func (c Customer) MailingLabel() string {
-	label := fmt.Sprintf("%s %s\n%s", c.Title, c.Name, c.Address)
-	return label
+func isCountryCode(s string) bool {
+	if len(s) != 2 {
+		return false
+	}
+	for _, r := range s {
+		if r < 'A' || r > 'Z' {
+			return false
+		}
+	}
+	return true
 }
@@ -1,6 +1,7 @@
 package bookshop_test
 
 import (
+	"errors"
 	"testing"
 
 	"github.com/google/go-cmp/cmp"
@@ -9,22 +10,50 @@ import (
 
 var customers = map[string]bookshop.Customer{
 	"Customer1": {
-		Title:   "Mrs",
-		Name:    "Monika White",
-		Address: "23 Avenue, Dublin, Ireland",
+		ID:    "c1",
+		Title: "Mrs",
+		Name:  "Monika White",
+		Email: "monika@example.com",
+		Phone: "+353 1 234 5678",
+		Billing: bookshop.Address{
+			Street:   "23 Avenue",
+			City:     "Dublin",
+			Postcode: "D02 XY45",
+			Country:  "IE",
+		},
 	},
 }
 
 func TestCustomerMailingLabel(t *testing.T) {
 
 	customer := bookshop.Customer{
-		Title:   "Mr",
-		Name:    "James Brown",
-		Address: "43 Temple Gardens, Dublin9, Ireland",
+		Title: "Mr",
+		Name:  "James Brown",
+		Billing: bookshop.Address{
+			Street:   "43 Temple Gardens",
+			City:     "Dublin 9",
+			Postcode: "D09 F2X3",
+			Country:  "IE",
+		},
+	}
+	shipped := customer
+	shipped.Shipping = bookshop.Address{
+		Street:   "Unit 4\n12 Harbour Road",
+		City:     "Cork",
+		Postcode: "T12 AB34",
+		Country:  "IE",
 	}
 
 	wantLabel := `Mr James Brown
-43 Temple Gardens, Dublin9, Ireland`
+43 Temple Gardens
+D09 F2X3 DUBLIN 9
+IRELAND`
+
+	wantShipped := `Mr James Brown
+Unit 4
+12 Harbour Road
+T12 AB34 CORK
+IRELAND`
 
 	tt := []struct {
 		name string
@@ -32,11 +61,12 @@ func TestCustomerMailingLabel(t *testing.T) {
 		want string
 	}{
 		{name: "Full mailing label", c: customer, want: wantLabel},
+		{name: "Shipping address", c: shipped, want: wantShipped},
 	}
 
 	for _, tc := range tt {
 
-		got := customer.MailingLabel()
+		got := tc.c.MailingLabel()
 
 		if !cmp.Equal(got, tc.want) {
 			t.Errorf(cmp.Diff(got, tc.want))
@@ -44,3 +74,124 @@ func TestCustomerMailingLabel(t *testing.T) {
 	}
 
 }
+
+func TestCustomerValidate(t *testing.T) {
+	t.Parallel()
+
+	valid := customers["Customer1"]
+	tt := []struct {
+		name   string
+		modify func(c *bookshop.Customer)
+		valid  bool
+	}{
+		{name: "Valid customer", modify: func(c *bookshop.Customer) {}, valid: true},
+		{name: "Without phone and addresses", modify: func(c *bookshop.Customer) { c.Phone, c.Billing = "", bookshop.Address{} }, valid: true},
+		{name: "Missing id", modify: func(c *bookshop.Customer) { c.ID = "" }},
+		{name: "Missing name", modify: func(c *bookshop.Customer) { c.Name = " " }},
+		{name: "Missing email", modify: func(c *bookshop.Customer) { c.Email = "" }},
+		{name: "Invalid email", modify: func(c *bookshop.Customer) { c.Email = "monika.example.com" }},
+		{name: "Email with name", modify: func(c *bookshop.Customer) { c.Email = "Monika <monika@example.com>" }},
+		{name: "Invalid phone", modify: func(c *bookshop.Customer) { c.Phone = "call me" }},
+		{name: "Too short phone", modify: func(c *bookshop.Customer) { c.Phone = "123" }},
+		{name: "Incomplete billing address", modify: func(c *bookshop.Customer) { c.Billing.City = "" }},
+		{name: "Invalid shipping country", modify: func(c *bookshop.Customer) {
+			c.Shipping = c.Billing
+			c.Shipping.Country = "Ireland"
+		}},
+	}
+	for _, tc := range tt {
+		tc := tc
+		t.Run(tc.name, func(t *testing.T) {
+			t.Parallel()
+			c := valid
+			tc.modify(&c)
+			err := c.Validate()
+			if tc.valid && err != nil {
+				t.Errorf("Validate() = %v, want: nil", err)
+			}
+			if !tc.valid && !errors.Is(err, bookshop.ErrInvalidCustomer) {
+				t.Errorf("Validate() = %v, want: %v", err, bookshop.ErrInvalidCustomer)
+			}
+		})
+	}
+}
+
+func TestNormalizeCountry(t *testing.T) {
+	t.Parallel()
+
+	tt := []struct {
+		code string
+		want string
+	}{
+		{code: "PL", want: "PL"},
+		{code: " de ", want: "DE"},
+		{code: "GB", want: "GB"},
+		{code: "UK", want: "GB"},
+		{code: "uk", want: "GB"},
+		{code: "", want: ""},
+	}
+	for _, tc := range tt {
+		if got := bookshop.NormalizeCountry(tc.code); got != tc.want {
+			t.Errorf("NormalizeCountry(%q) = %q, want: %q", tc.code, got, tc.want)
+		}
+	}
+}
+
+func TestMemoryCustomerStore(t *testing.T) {
+	t.Parallel()
+
+	monika := customers["Customer1"]
+	s, err := bookshop.NewMemoryCustomerStore(monika)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	got, err := s.CustomerByEmail(" MONIKA@example.com")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !cmp.Equal(monika, got) {
+		t.Error(cmp.Diff(monika, got))
+	}
+
+	james := bookshop.Customer{ID: "c2", Name: "James Brown", Email: "Monika@Example.com"}
+	if err := s.PutCustomer(james); !errors.Is(err, bookshop.ErrDuplicateEmail) {
+		t.Errorf("PutCustomer() with email of another customer = %v, want: %v", err, bookshop.ErrDuplicateEmail)
+	}
+	if err := s.PutCustomer(bookshop.Customer{ID: "c3"}); !errors.Is(err, bookshop.ErrInvalidCustomer) {
+		t.Errorf("PutCustomer() of invalid customer = %v, want: %v", err, bookshop.ErrInvalidCustomer)
+	}
+
+	// Changing the email frees the old one.
+	monika.Email = "white@example.com"
+	if err := s.PutCustomer(monika); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := s.CustomerByEmail("monika@example.com"); !errors.Is(err, bookshop.ErrCustomerNotFound) {
+		t.Errorf("CustomerByEmail() of old email = %v, want: %v", err, bookshop.ErrCustomerNotFound)
+	}
+	if err := s.PutCustomer(james); err != nil {
+		t.Fatal(err)
+	}
+
+	all, err := s.Customers()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want := []bookshop.Customer{monika, james}; !cmp.Equal(want, all) {
+		t.Error(cmp.Diff(want, all))
+	}
+
+	if err := s.DeleteCustomer("c1"); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := s.Customer("c1"); !errors.Is(err, bookshop.ErrCustomerNotFound) {
+		t.Errorf("Customer() after delete = %v, want: %v", err, bookshop.ErrCustomerNotFound)
+	}
+	if _, err := s.CustomerByEmail("white@example.com"); !errors.Is(err, bookshop.ErrCustomerNotFound) {
+		t.Errorf("CustomerByEmail() after delete = %v, want: %v", err, bookshop.ErrCustomerNotFound)
+	}
+	if err := s.DeleteCustomer("c1"); !errors.Is(err, bookshop.ErrCustomerNotFound) {
+		t.Errorf("DeleteCustomer() of missing customer = %v, want: %v", err, bookshop.ErrCustomerNotFound)
+	}
+}
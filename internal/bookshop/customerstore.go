@@ -0,0 +1,121 @@
+package bookshop
+
+import (
+	"fmt"
+	"sort"
+	"sync"
+)
+
+// CustomerStore represents a storage for customer accounts.
+type CustomerStore interface {
+	// Customer returns a customer with the given ID.
+	Customer(id string) (Customer, error)
+	// CustomerByEmail returns a customer with the given email,
+	// ignoring case.
+	CustomerByEmail(email string) (Customer, error)
+	// PutCustomer adds a new customer or replaces an existing one
+	// with the same ID. It returns an error matching ErrDuplicateEmail
+	// when another customer has the same email.
+	PutCustomer(c Customer) error
+	// DeleteCustomer removes a customer with the given ID.
+	DeleteCustomer(id string) error
+	// Customers returns all customers sorted by ID.
+	Customers() ([]Customer, error)
+}
+
+// MemoryCustomerStore is a CustomerStore that keeps customers
+// in memory. It is safe for concurrent use.
+type MemoryCustomerStore struct {
+	mu        sync.RWMutex
+	customers map[string]Customer
+	// emails maps normalized emails to customer IDs.
+	emails map[string]string
+}
+
+// NewMemoryCustomerStore knows how to construct a MemoryCustomerStore
+// holding the given customers.
+func NewMemoryCustomerStore(customers ...Customer) (*MemoryCustomerStore, error) {
+	s := MemoryCustomerStore{
+		customers: make(map[string]Customer),
+		emails:    make(map[string]string),
+	}
+	for _, c := range customers {
+		if err := s.PutCustomer(c); err != nil {
+			return nil, err
+		}
+	}
+	return &s, nil
+}
+
+// Customer returns a customer with the given ID.
+func (s *MemoryCustomerStore) Customer(id string) (Customer, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	c, ok := s.customers[id]
+	if !ok {
+		return Customer{}, fmt.Errorf("customer id %s: %w", id, ErrCustomerNotFound)
+	}
+	return c, nil
+}
+
+// CustomerByEmail returns a customer with the given email, ignoring case.
+func (s *MemoryCustomerStore) CustomerByEmail(email string) (Customer, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	id, ok := s.emails[NormalizeEmail(email)]
+	if !ok {
+		return Customer{}, fmt.Errorf("customer email %s: %w", email, ErrCustomerNotFound)
+	}
+	return s.customers[id], nil
+}
+
+// PutCustomer adds a new customer or replaces an existing one
+// with the same ID.
+func (s *MemoryCustomerStore) PutCustomer(c Customer) error {
+	if err := c.Validate(); err != nil {
+		return err
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	email := NormalizeEmail(c.Email)
+	if id, ok := s.emails[email]; ok && id != c.ID {
+		return fmt.Errorf("customer email %s: %w", c.Email, ErrDuplicateEmail)
+	}
+	if old, ok := s.customers[c.ID]; ok {
+		delete(s.emails, NormalizeEmail(old.Email))
+	}
+	s.customers[c.ID] = c
+	s.emails[email] = c.ID
+	return nil
+}
+
+// DeleteCustomer removes a customer with the given ID.
+func (s *MemoryCustomerStore) DeleteCustomer(id string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	c, ok := s.customers[id]
+	if !ok {
+		return fmt.Errorf("customer id %s: %w", id, ErrCustomerNotFound)
+	}
+	delete(s.emails, NormalizeEmail(c.Email))
+	delete(s.customers, id)
+	return nil
+}
+
+// Customers returns all customers sorted by ID.
+func (s *MemoryCustomerStore) Customers() ([]Customer, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	cs := make([]Customer, 0, len(s.customers))
+	for _, c := range s.customers {
+		cs = append(cs, c)
+	}
+	sort.Slice(cs, func(i, j int) bool { return cs[i].ID < cs[j].ID })
+	return cs, nil
+}
@@ -0,0 +1,34 @@
+package bookshop
+
+import (
+	"fmt"
+	"strings"
+)
+
+// Format is the form a book is published in.
+type Format string
+
+// Book formats. Books without a format are printed books.
+const (
+	FormatPrint     Format = "print"
+	FormatEbook     Format = "ebook"
+	FormatAudiobook Format = "audiobook"
+)
+
+// ParseFormat knows how to parse a book format name.
+// An empty name is a printed book.
+func ParseFormat(s string) (Format, error) {
+	switch f := Format(strings.ToLower(strings.TrimSpace(s))); f {
+	case "":
+		return FormatPrint, nil
+	case FormatPrint, FormatEbook, FormatAudiobook:
+		return f, nil
+	default:
+		return "", fmt.Errorf("invalid book format: %q", s)
+	}
+}
+
+// Digital reports whether the format is delivered electronically.
+func (f Format) Digital() bool {
+	return f == FormatEbook || f == FormatAudiobook
+}
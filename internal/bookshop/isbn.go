@@ -0,0 +1,182 @@
+package bookshop
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+)
+
+var (
+	// ErrInvalidISBN is returned when an ISBN is malformed
+	// or its check digit does not match.
+	ErrInvalidISBN = errors.New("invalid ISBN")
+	// ErrDuplicateISBN is returned when another book in
+	// the catalog has the same ISBN.
+	ErrDuplicateISBN = errors.New("duplicate ISBN")
+)
+
+// ParseISBN knows how to parse an ISBN-10 or ISBN-13 and return it
+// as 13 digits without separators. An optional "ISBN", "ISBN-10:"
+// or "ISBN-13:" prefix is accepted and digit groups may be separated
+// by single hyphens or spaces, as in "ISBN 978-83-240-1234-5".
+func ParseISBN(s string) (string, error) {
+	digits, err := isbnDigits(s)
+	if err != nil {
+		return "", err
+	}
+
+	switch len(digits) {
+	case 10:
+		if !ValidISBN10(digits) {
+			return "", fmt.Errorf("%w: %s: wrong check digit", ErrInvalidISBN, s)
+		}
+		return ISBN10To13(digits)
+	case 13:
+		if !ValidISBN13(digits) {
+			return "", fmt.Errorf("%w: %s: wrong check digit", ErrInvalidISBN, s)
+		}
+		return digits, nil
+	default:
+		return "", fmt.Errorf("%w: %s: want 10 or 13 digits, got %d", ErrInvalidISBN, s, len(digits))
+	}
+}
+
+// ValidISBN10 reports whether s is 10 characters, nine digits
+// followed by a digit or X, with a matching check digit.
+func ValidISBN10(s string) bool {
+	if len(s) != 10 {
+		return false
+	}
+	for i := 0; i < 9; i++ {
+		if !isDigit(s[i]) {
+			return false
+		}
+	}
+	return isbn10CheckDigit(s[:9]) == s[9]
+}
+
+// ValidISBN13 reports whether s is 13 digits starting with
+// 978 or 979 with a matching check digit.
+func ValidISBN13(s string) bool {
+	if len(s) != 13 || !(strings.HasPrefix(s, "978") || strings.HasPrefix(s, "979")) {
+		return false
+	}
+	for i := 0; i < 13; i++ {
+		if !isDigit(s[i]) {
+			return false
+		}
+	}
+	return isbn13CheckDigit(s[:12]) == s[12]
+}
+
+// ISBN10To13 knows how to convert a valid ISBN-10 to ISBN-13.
+func ISBN10To13(s string) (string, error) {
+	if !ValidISBN10(s) {
+		return "", fmt.Errorf("%w: %s", ErrInvalidISBN, s)
+	}
+	isbn := "978" + s[:9]
+	return isbn + string(isbn13CheckDigit(isbn)), nil
+}
+
+// ISBN13To10 knows how to convert a valid ISBN-13 to ISBN-10.
+// Only ISBNs with the 978 prefix have an ISBN-10 form.
+func ISBN13To10(s string) (string, error) {
+	if !ValidISBN13(s) {
+		return "", fmt.Errorf("%w: %s", ErrInvalidISBN, s)
+	}
+	if !strings.HasPrefix(s, "978") {
+		return "", fmt.Errorf("%w: %s has no ISBN-10 form", ErrInvalidISBN, s)
+	}
+	isbn := s[3:12]
+	return isbn + string(isbn10CheckDigit(isbn)), nil
+}
+
+// SetISBN knows how to set the book ISBN from an ISBN-10 or
+// ISBN-13 in any format accepted by ParseISBN. The ISBN is
+// stored as 13 digits. An empty string clears the ISBN.
+func (b *Book) SetISBN(s string) error {
+	if strings.TrimSpace(s) == "" {
+		b.ISBN = ""
+		return nil
+	}
+	isbn, err := ParseISBN(s)
+	if err != nil {
+		return err
+	}
+	b.ISBN = isbn
+	return nil
+}
+
+// GetByISBN knows how to find a book by its ISBN-10 or ISBN-13.
+func (c *Catalog) GetByISBN(isbn string) (Book, error) {
+	isbn, err := ParseISBN(isbn)
+	if err != nil {
+		return Book{}, err
+	}
+	return c.Store().GetByISBN(isbn)
+}
+
+// isbnDigits strips the optional prefix and separators from s.
+func isbnDigits(s string) (string, error) {
+	v := strings.TrimSpace(s)
+	for _, prefix := range []string{"ISBN-13:", "ISBN-10:", "ISBN-13", "ISBN-10", "ISBN:", "ISBN"} {
+		if len(v) >= len(prefix) && strings.EqualFold(v[:len(prefix)], prefix) {
+			v = strings.TrimSpace(v[len(prefix):])
+			break
+		}
+	}
+
+	var b strings.Builder
+	for i := 0; i < len(v); i++ {
+		ch := v[i]
+		switch {
+		case isDigit(ch):
+			b.WriteByte(ch)
+		case ch == 'X' || ch == 'x':
+			// X is only valid as the last ISBN-10 check digit.
+			if i != len(v)-1 {
+				return "", fmt.Errorf("%w: %s: unexpected X", ErrInvalidISBN, s)
+			}
+			b.WriteByte('X')
+		case ch == '-' || ch == ' ':
+			if i == 0 || i == len(v)-1 || !isDigit(v[i-1]) {
+				return "", fmt.Errorf("%w: %s: misplaced separator", ErrInvalidISBN, s)
+			}
+		default:
+			return "", fmt.Errorf("%w: %s: unexpected character %q", ErrInvalidISBN, s, ch)
+		}
+	}
+	return b.String(), nil
+}
+
+// isbn10CheckDigit returns the check digit for the first
+// nine digits of an ISBN-10.
+func isbn10CheckDigit(s string) byte {
+	sum := 0
+	for i := 0; i < 9; i++ {
+		sum += (10 - i) * int(s[i]-'0')
+	}
+	check := (11 - sum%11) % 11
+	if check == 10 {
+		return 'X'
+	}
+	return byte('0' + check)
+}
+
+// isbn13CheckDigit returns the check digit for the first
+// twelve digits of an ISBN-13.
+func isbn13CheckDigit(s string) byte {
+	sum := 0
+	for i := 0; i < 12; i++ {
+		w := 1
+		if i%2 == 1 {
+			w = 3
+		}
+		sum += w * int(s[i]-'0')
+	}
+	return byte('0' + (10-sum%10)%10)
+}
+
+func isDigit(ch byte) bool {
+	return ch >= '0' && ch <= '9'
+}
@@ -0,0 +1,172 @@
+package bookshop_test
+
+import (
+	"errors"
+	"strconv"
+	"sync"
+	"sync/atomic"
+	"testing"
+
+	"github.com/qba73/bookshop/internal/bookshop"
+)
+
+func TestParseISBN(t *testing.T) {
+	t.Parallel()
+
+	tt := []struct {
+		name        string
+		input       string
+		want        string
+		expectedErr bool
+	}{
+		{name: "ISBN-13", input: "9780306406157", want: "9780306406157", expectedErr: false},
+		{name: "Hyphenated ISBN-13", input: "978-0-306-40615-7", want: "9780306406157", expectedErr: false},
+		{name: "ISBN-13 with prefix", input: "ISBN-13: 978-0-306-40615-7", want: "9780306406157", expectedErr: false},
+		{name: "ISBN-10", input: "0306406152", want: "9780306406157", expectedErr: false},
+		{name: "ISBN-10 with spaces and prefix", input: "ISBN 0 306 40615 2", want: "9780306406157", expectedErr: false},
+		{name: "ISBN-10 with X check digit", input: "83-240-0016-X", want: "9788324000166", expectedErr: false},
+		{name: "ISBN-10 with lower case x", input: "832400016x", want: "9788324000166", expectedErr: false},
+		{name: "979 prefix", input: "979-10-90636-07-1", want: "9791090636071", expectedErr: false},
+		{name: "Wrong ISBN-13 check digit", input: "978-0-306-40615-8", expectedErr: true},
+		{name: "Wrong ISBN-10 check digit", input: "0-306-40615-3", expectedErr: true},
+		{name: "Unknown ISBN-13 prefix", input: "9770306406150", expectedErr: true},
+		{name: "Too short", input: "030640615", expectedErr: true},
+		{name: "X not last", input: "03064X6152", expectedErr: true},
+		{name: "Double hyphen", input: "0-306--40615-2", expectedErr: true},
+		{name: "Leading hyphen", input: "-0306406152", expectedErr: true},
+		{name: "Trailing hyphen", input: "0306406152-", expectedErr: true},
+		{name: "Letters", input: "978O306406157", expectedErr: true},
+		{name: "Empty", input: "", expectedErr: true},
+	}
+
+	for _, tc := range tt {
+		got, err := bookshop.ParseISBN(tc.input)
+		if (err != nil) != tc.expectedErr {
+			t.Fatalf("%s ParseISBN(%q) got error: %v", tc.name, tc.input, err)
+		}
+		if err != nil && !errors.Is(err, bookshop.ErrInvalidISBN) {
+			t.Errorf("%s ParseISBN(%q) = %v, want: %v", tc.name, tc.input, err, bookshop.ErrInvalidISBN)
+		}
+		if got != tc.want {
+			t.Errorf("%s ParseISBN(%q) = %q, want: %q", tc.name, tc.input, got, tc.want)
+		}
+	}
+}
+
+func TestISBNConversion(t *testing.T) {
+	t.Parallel()
+
+	tt := []struct {
+		isbn10 string
+		isbn13 string
+	}{
+		{isbn10: "0306406152", isbn13: "9780306406157"},
+		{isbn10: "832400016X", isbn13: "9788324000166"},
+		{isbn10: "0198534531", isbn13: "9780198534532"},
+	}
+
+	for _, tc := range tt {
+		got, err := bookshop.ISBN10To13(tc.isbn10)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if got != tc.isbn13 {
+			t.Errorf("ISBN10To13(%s) = %s, want: %s", tc.isbn10, got, tc.isbn13)
+		}
+
+		got, err = bookshop.ISBN13To10(tc.isbn13)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if got != tc.isbn10 {
+			t.Errorf("ISBN13To10(%s) = %s, want: %s", tc.isbn13, got, tc.isbn10)
+		}
+	}
+
+	if _, err := bookshop.ISBN13To10("9791090636071"); !errors.Is(err, bookshop.ErrInvalidISBN) {
+		t.Errorf("ISBN13To10() of 979 ISBN = %v, want: %v", err, bookshop.ErrInvalidISBN)
+	}
+	if _, err := bookshop.ISBN10To13("0306406153"); !errors.Is(err, bookshop.ErrInvalidISBN) {
+		t.Errorf("ISBN10To13() with wrong check digit = %v, want: %v", err, bookshop.ErrInvalidISBN)
+	}
+}
+
+func TestCatalogISBN(t *testing.T) {
+	t.Parallel()
+
+	b1 := bookshop.Book{ID: "1", Title: "Tytus"}
+	if err := b1.SetISBN("0-306-40615-2"); err != nil {
+		t.Fatal(err)
+	}
+	b2 := bookshop.Book{ID: "2", Title: "Zosia", ISBN: "978-83-240-0016-6"}
+
+	c := newTestCatalog(t, b1, b2)
+
+	for _, isbn := range []string{"9780306406157", "0306406152", "ISBN 978-0-306-40615-7"} {
+		got, err := c.GetByISBN(isbn)
+		if err != nil {
+			t.Fatalf("GetByISBN(%q) got error: %v", isbn, err)
+		}
+		if got.ID != "1" {
+			t.Errorf("GetByISBN(%q) = book %s, want: 1", isbn, got.ID)
+		}
+	}
+
+	// AddBook normalizes ISBNs set directly on the field.
+	got, err := c.GetByISBN("832400016X")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got.ISBN != "9788324000166" {
+		t.Errorf("stored ISBN = %q, want: 9788324000166", got.ISBN)
+	}
+
+	if _, err := c.GetByISBN("9791090636071"); !errors.Is(err, bookshop.ErrBookNotFound) {
+		t.Errorf("GetByISBN() missing = %v, want: %v", err, bookshop.ErrBookNotFound)
+	}
+
+	dup := bookshop.Book{ID: "3", Title: "Kopia", ISBN: "0306406152"}
+	if err := c.AddBook(dup); !errors.Is(err, bookshop.ErrDuplicateISBN) {
+		t.Errorf("AddBook() duplicate ISBN = %v, want: %v", err, bookshop.ErrDuplicateISBN)
+	}
+	invalid := bookshop.Book{ID: "3", Title: "Kopia", ISBN: "0306406153"}
+	if err := c.AddBook(invalid); !errors.Is(err, bookshop.ErrInvalidISBN) {
+		t.Errorf("AddBook() invalid ISBN = %v, want: %v", err, bookshop.ErrInvalidISBN)
+	}
+
+	// Updating a book keeps its own ISBN.
+	b1.Title = "Tytus, Romek i A'Tomek"
+	if err := c.AddBook(b1); err != nil {
+		t.Errorf("AddBook() update got error: %v", err)
+	}
+}
+
+func TestCatalogConcurrentISBN(t *testing.T) {
+	t.Parallel()
+
+	c := bookshop.NewCatalog(bookshop.NewMemoryStore(nil))
+
+	var (
+		wg      sync.WaitGroup
+		created int32
+	)
+	for i := 0; i < 10; i++ {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			b := bookshop.Book{ID: strconv.Itoa(i), Title: "Tytus", ISBN: "0306406152"}
+			err := c.CreateBook(b)
+			switch {
+			case err == nil:
+				atomic.AddInt32(&created, 1)
+			case !errors.Is(err, bookshop.ErrDuplicateISBN):
+				t.Errorf("CreateBook() = %v, want: %v", err, bookshop.ErrDuplicateISBN)
+			}
+		}(i)
+	}
+	wg.Wait()
+
+	if created != 1 {
+		t.Errorf("created %d books with the same ISBN, want: 1", created)
+	}
+}
@@ -0,0 +1,202 @@
+package bookshop
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sync"
+)
+
+// JSONStore is a Store that persists books in a JSON file.
+// Every change is written to the file before it returns,
+// so books survive process restarts. It is safe for concurrent use.
+type JSONStore struct {
+	mu    sync.RWMutex
+	path  string
+	books bookMap
+}
+
+// OpenJSONStore knows how to open a JSON file backed store.
+// A missing file is treated as an empty catalog and it is
+// created on the first write. It returns an error matching
+// ErrDuplicateISBN when books in the file share an ISBN.
+func OpenJSONStore(path string) (*JSONStore, error) {
+	s := JSONStore{path: path}
+
+	data, err := os.ReadFile(path)
+	if errors.Is(err, os.ErrNotExist) {
+		return &s, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	if len(data) == 0 {
+		return &s, nil
+	}
+
+	var books []Book
+	if err := json.Unmarshal(data, &books); err != nil {
+		return nil, fmt.Errorf("decoding %s: %w", path, err)
+	}
+	for _, b := range books {
+		if err := s.books.checkISBN(b); err != nil {
+			return nil, fmt.Errorf("decoding %s: %w", path, err)
+		}
+		s.books.set(b)
+	}
+	return &s, nil
+}
+
+// Path returns the location of the underlying JSON file.
+func (s *JSONStore) Path() string {
+	return s.path
+}
+
+// Get returns a book with the given ID.
+func (s *JSONStore) Get(id string) (Book, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	return s.books.get(id)
+}
+
+// GetByISBN returns a book with the given ISBN-13.
+func (s *JSONStore) GetByISBN(isbn string) (Book, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	return s.books.getByISBN(isbn)
+}
+
+// Put adds a new book or replaces an existing one with the same ID
+// and writes the catalog to the file.
+func (s *JSONStore) Put(b Book) error {
+	if b.ID == "" {
+		return errors.New("invalid book id")
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if err := s.books.checkISBN(b); err != nil {
+		return err
+	}
+	old, existed := s.books.books[b.ID]
+	s.books.set(b)
+	if err := s.flush(); err != nil {
+		if existed {
+			s.books.set(old)
+		} else {
+			s.books.remove(b.ID)
+		}
+		return err
+	}
+	return nil
+}
+
+// Create adds a new book and writes the catalog to the file.
+// It returns ErrBookExists when a book with the same ID
+// already exists.
+func (s *JSONStore) Create(b Book) error {
+	if b.ID == "" {
+		return errors.New("invalid book id")
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if _, ok := s.books.books[b.ID]; ok {
+		return fmt.Errorf("book id %s: %w", b.ID, ErrBookExists)
+	}
+	if err := s.books.checkISBN(b); err != nil {
+		return err
+	}
+	s.books.set(b)
+	if err := s.flush(); err != nil {
+		s.books.remove(b.ID)
+		return err
+	}
+	return nil
+}
+
+// Replace replaces an existing book with the same ID and writes
+// the catalog to the file. It returns ErrBookNotFound when the book
+// does not exist.
+func (s *JSONStore) Replace(b Book) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	old, err := s.books.get(b.ID)
+	if err != nil {
+		return err
+	}
+	if err := s.books.checkISBN(b); err != nil {
+		return err
+	}
+	s.books.set(b)
+	if err := s.flush(); err != nil {
+		s.books.set(old)
+		return err
+	}
+	return nil
+}
+
+// Delete removes a book with the given ID
+// and writes the catalog to the file.
+func (s *JSONStore) Delete(id string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	old, err := s.books.get(id)
+	if err != nil {
+		return err
+	}
+	s.books.remove(id)
+	if err := s.flush(); err != nil {
+		s.books.set(old)
+		return err
+	}
+	return nil
+}
+
+// List returns all books sorted by ID.
+func (s *JSONStore) List() ([]Book, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	return sortedBooks(s.books.books), nil
+}
+
+// flush writes books to the store file.
+func (s *JSONStore) flush() error {
+	data, err := json.MarshalIndent(sortedBooks(s.books.books), "", "  ")
+	if err != nil {
+		return err
+	}
+	return writeFileAtomic(s.path, data)
+}
+
+// writeFileAtomic writes data to a temporary file and renames it
+// over path, so a crash never leaves a half written file.
+func writeFileAtomic(path string, data []byte) error {
+	f, err := os.CreateTemp(filepath.Dir(path), filepath.Base(path)+".*.tmp")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(f.Name())
+
+	if _, err := f.Write(data); err != nil {
+		f.Close()
+		return err
+	}
+	if err := f.Sync(); err != nil {
+		f.Close()
+		return err
+	}
+	if err := f.Close(); err != nil {
+		return err
+	}
+	return os.Rename(f.Name(), path)
+}
@@ -0,0 +1,169 @@
+package bookshop
+
+import (
+	"strings"
+	"unicode/utf8"
+)
+
+// DefaultCountry is the country the bookshop sends parcels from.
+const DefaultCountry = "PL"
+
+// LabelOptions configures mailing labels.
+type LabelOptions struct {
+	// From is the country parcels are sent from, DefaultCountry
+	// when empty. Labels of parcels sent to other countries end
+	// with the destination country.
+	From string
+	// Width is the maximum number of characters in a line,
+	// longer lines are truncated. Zero means no limit.
+	Width int
+	// Lines is the maximum number of lines of a label. Street
+	// lines of longer labels are merged, separated by commas.
+	// Zero means no limit.
+	Lines int
+}
+
+// countryNames are destination countries printed on labels of
+// international parcels, in English and in capitals as the
+// Universal Postal Union recommends. Other countries are
+// printed with their ISO 3166-1 code.
+var countryNames = map[string]string{
+	"AT": "AUSTRIA",
+	"BE": "BELGIUM",
+	"CZ": "CZECHIA",
+	"DE": "GERMANY",
+	"DK": "DENMARK",
+	"ES": "SPAIN",
+	"FR": "FRANCE",
+	"GB": "UNITED KINGDOM",
+	"IE": "IRELAND",
+	"IT": "ITALY",
+	"LT": "LITHUANIA",
+	"NL": "NETHERLANDS",
+	"PL": "POLAND",
+	"SE": "SWEDEN",
+	"SK": "SLOVAKIA",
+	"UA": "UKRAINE",
+	"US": "UNITED STATES",
+}
+
+// Label knows how to lay out the customer name and shipping address
+// for a mailing label, following postal conventions of the
+// destination country:
+//
+//	PL, DE and others  postcode before the city
+//	GB (or UK)         post town in capitals, postcode on its own line
+//	US                 all capitals, city, state and ZIP code on one line
+//
+// Postcodes are written in capitals. International parcels have the
+// destination town and country in capitals.
+func (c Customer) Label(opts LabelOptions) []string {
+	a := c.ShippingAddress()
+	to := NormalizeCountry(a.Country)
+	from := NormalizeCountry(opts.From)
+	if from == "" {
+		from = DefaultCountry
+	}
+	abroad := to != "" && to != from
+
+	var street []string
+	for _, l := range strings.Split(a.Street, "\n") {
+		if l = strings.TrimSpace(l); l != "" {
+			street = append(street, l)
+		}
+	}
+	postcode := strings.ToUpper(strings.TrimSpace(a.Postcode))
+	city := strings.TrimSpace(a.City)
+	if abroad {
+		city = strings.ToUpper(city)
+	}
+	var town []string
+	switch to {
+	case "US":
+		town = append(town, join(city, strings.TrimSpace(a.Region), postcode))
+	case "GB":
+		town = append(town, strings.ToUpper(city), postcode)
+	default:
+		town = append(town, join(postcode, city))
+		if r := strings.TrimSpace(a.Region); r != "" {
+			town = append(town, r)
+		}
+	}
+	if abroad {
+		name, ok := countryNames[to]
+		if !ok {
+			name = to
+		}
+		town = append(town, name)
+	}
+
+	name := strings.TrimSpace(c.Title + " " + c.Name)
+	town = nonEmpty(town)
+	if opts.Lines > 0 {
+		street = mergeLines(street, opts.Lines-len(town)-1)
+	}
+	lines := append(append([]string{name}, street...), town...)
+	if to == "US" {
+		for i := range lines {
+			lines[i] = strings.ToUpper(lines[i])
+		}
+	}
+
+	label := lines[:0]
+	for _, l := range lines {
+		if l == "" {
+			continue
+		}
+		label = append(label, truncateLine(l, opts.Width))
+	}
+	return label
+}
+
+// MailingLabel knows how to construct and present
+// customer data required to print mailing labels.
+func (c Customer) MailingLabel() string {
+	return strings.Join(c.Label(LabelOptions{}), "\n")
+}
+
+// join joins the non-empty parts with spaces.
+func join(parts ...string) string {
+	var ps []string
+	for _, p := range parts {
+		if p != "" {
+			ps = append(ps, p)
+		}
+	}
+	return strings.Join(ps, " ")
+}
+
+// nonEmpty returns the lines that are not empty.
+func nonEmpty(lines []string) []string {
+	var ls []string
+	for _, l := range lines {
+		if l != "" {
+			ls = append(ls, l)
+		}
+	}
+	return ls
+}
+
+// mergeLines joins the last lines with commas, so that there
+// are at most n of them, but always at least one.
+func mergeLines(lines []string, n int) []string {
+	if n < 1 {
+		n = 1
+	}
+	if len(lines) <= n {
+		return lines
+	}
+	return append(lines[:n-1:n-1], strings.Join(lines[n-1:], ", "))
+}
+
+// truncateLine shortens the line to width characters,
+// when width is positive.
+func truncateLine(l string, width int) string {
+	if width <= 0 || utf8.RuneCountInString(l) <= width {
+		return l
+	}
+	return strings.TrimRight(string([]rune(l)[:width]), " ")
+}
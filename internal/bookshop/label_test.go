@@ -0,0 +1,86 @@
+package bookshop_test
+
+import (
+	"testing"
+
+	"github.com/google/go-cmp/cmp"
+	"github.com/qba73/bookshop/internal/bookshop"
+)
+
+func TestCustomerLabel(t *testing.T) {
+	t.Parallel()
+
+	tt := []struct {
+		name string
+		addr bookshop.Address
+		opts bookshop.LabelOptions
+		want []string
+	}{
+		{
+			name: "Poland domestic",
+			addr: bookshop.Address{Street: "ul. Długa 12/4", City: "Warszawa", Postcode: "00-238", Country: "PL"},
+			want: []string{"Mrs Anna Nowak", "ul. Długa 12/4", "00-238 Warszawa"},
+		},
+		{
+			name: "Poland from Germany",
+			addr: bookshop.Address{Street: "ul. Długa 12/4", City: "Warszawa", Postcode: "00-238", Country: "PL"},
+			opts: bookshop.LabelOptions{From: "DE"},
+			want: []string{"Mrs Anna Nowak", "ul. Długa 12/4", "00-238 WARSZAWA", "POLAND"},
+		},
+		{
+			name: "Germany",
+			addr: bookshop.Address{Street: "Hauptstraße 5", City: "München", Postcode: "80331", Country: "DE"},
+			want: []string{"Mrs Anna Nowak", "Hauptstraße 5", "80331 MÜNCHEN", "GERMANY"},
+		},
+		{
+			name: "United Kingdom",
+			addr: bookshop.Address{Street: "Flat 2\n10 Downing Street", City: "London", Postcode: "sw1a 2aa", Region: "Greater London", Country: "GB"},
+			want: []string{"Mrs Anna Nowak", "Flat 2", "10 Downing Street", "LONDON", "SW1A 2AA", "UNITED KINGDOM"},
+		},
+		{
+			name: "United Kingdom domestic with UK code",
+			addr: bookshop.Address{Street: "10 Downing Street", City: "London", Postcode: "SW1A 2AA", Country: "UK"},
+			opts: bookshop.LabelOptions{From: "GB"},
+			want: []string{"Mrs Anna Nowak", "10 Downing Street", "LONDON", "SW1A 2AA"},
+		},
+		{
+			name: "United States",
+			addr: bookshop.Address{Street: "1600 Pennsylvania Ave NW", City: "Washington", Postcode: "20500", Region: "DC", Country: "US"},
+			want: []string{"MRS ANNA NOWAK", "1600 PENNSYLVANIA AVE NW", "WASHINGTON DC 20500", "UNITED STATES"},
+		},
+		{
+			name: "Region and unknown country",
+			addr: bookshop.Address{Street: "Av. Paulista 1000", City: "São Paulo", Postcode: "01310-100", Region: "SP", Country: "BR"},
+			want: []string{"Mrs Anna Nowak", "Av. Paulista 1000", "01310-100 SÃO PAULO", "SP", "BR"},
+		},
+		{
+			name: "Truncated lines",
+			addr: bookshop.Address{Street: "ul. Marszałkowska 140 lok. 12", City: "Warszawa", Postcode: "00-061", Country: "PL"},
+			opts: bookshop.LabelOptions{Width: 18},
+			want: []string{"Mrs Anna Nowak", "ul. Marszałkowska", "00-061 Warszawa"},
+		},
+		{
+			name: "Merged street lines",
+			addr: bookshop.Address{Street: "Flat 2\nRiverside House\n10 Downing Street", City: "London", Postcode: "SW1A 2AA", Country: "GB"},
+			opts: bookshop.LabelOptions{Lines: 6},
+			want: []string{"Mrs Anna Nowak", "Flat 2", "Riverside House, 10 Downing Street", "LONDON", "SW1A 2AA", "UNITED KINGDOM"},
+		},
+		{
+			name: "Street lines merged into one",
+			addr: bookshop.Address{Street: "Flat 2\nRiverside House\n10 Downing Street", City: "London", Postcode: "SW1A 2AA", Country: "GB"},
+			opts: bookshop.LabelOptions{Lines: 3},
+			want: []string{"Mrs Anna Nowak", "Flat 2, Riverside House, 10 Downing Street", "LONDON", "SW1A 2AA", "UNITED KINGDOM"},
+		},
+	}
+	for _, tc := range tt {
+		tc := tc
+		t.Run(tc.name, func(t *testing.T) {
+			t.Parallel()
+			c := bookshop.Customer{Title: "Mrs", Name: "Anna Nowak", Billing: tc.addr}
+			got := c.Label(tc.opts)
+			if !cmp.Equal(tc.want, got) {
+				t.Error(cmp.Diff(tc.want, got))
+			}
+		})
+	}
+}
@@ -0,0 +1,70 @@
+package order
+
+import (
+	"fmt"
+
+	"github.com/qba73/bookshop/internal/money"
+)
+
+// Adjustment is an amount taken off an order line on top of the
+// book discount, for example by a promotion. Source identifies
+// what granted it, Description is shown to the customer.
+type Adjustment struct {
+	BookID      string
+	Source      string
+	Description string
+	Amount      money.Money
+}
+
+// SetAdjustments knows how to replace adjustments of the order.
+// Adjustments must be for books in the order, in the order
+// currency, and cannot take more than the line total off a line.
+// Changing order items removes adjustments, as they no longer
+// apply to the new items.
+func (o *Order) SetAdjustments(adj []Adjustment) error {
+	if o.CurrentStatus() != StatusDraft {
+		return fmt.Errorf("order %s: %w", o.OrderID, ErrNotDraft)
+	}
+
+	left := make(map[string]money.Money, len(o.Items))
+	for _, it := range o.Items {
+		total, err := it.Total()
+		if err != nil {
+			return fmt.Errorf("order %s: book %s: %w", o.OrderID, it.BookID, err)
+		}
+		left[it.BookID] = total
+	}
+	for _, a := range adj {
+		total, ok := left[a.BookID]
+		if !ok {
+			return fmt.Errorf("order %s: adjustment %s: book id %s not in order", o.OrderID, a.Source, a.BookID)
+		}
+		if a.Amount.IsNegative() {
+			return fmt.Errorf("order %s: adjustment %s: invalid amount %v", o.OrderID, a.Source, a.Amount)
+		}
+		total, err := total.Sub(a.Amount)
+		if err != nil {
+			return fmt.Errorf("order %s: adjustment %s: %w", o.OrderID, a.Source, err)
+		}
+		if total.IsNegative() {
+			return fmt.Errorf("order %s: adjustments take more than the total off book %s", o.OrderID, a.BookID)
+		}
+		left[a.BookID] = total
+	}
+
+	o.Adjustments = append([]Adjustment(nil), adj...)
+	return nil
+}
+
+// AdjustmentTotal returns the amount taken off the order
+// by adjustments.
+func (o *Order) AdjustmentTotal() (money.Money, error) {
+	var total money.Money
+	for _, a := range o.Adjustments {
+		var err error
+		if total, err = total.Add(a.Amount); err != nil {
+			return money.Money{}, fmt.Errorf("adjustment %s: %w", a.Source, err)
+		}
+	}
+	return total, nil
+}
@@ -0,0 +1,56 @@
+package order
+
+import (
+	"errors"
+	"fmt"
+
+	"github.com/qba73/bookshop/internal/money"
+)
+
+// Item represents a single order line. Prices are a snapshot
+// taken when the book was added to the order.
+type Item struct {
+	BookID          string
+	Quantity        int
+	ListPrice       money.Money
+	DiscountPercent int
+	UnitPrice       money.Money
+}
+
+// Total returns the amount to pay for the line.
+func (it Item) Total() (money.Money, error) {
+	return it.UnitPrice.Mul(int64(it.Quantity))
+}
+
+// Subtotal returns the line value at the list price.
+func (it Item) Subtotal() (money.Money, error) {
+	return it.ListPrice.Mul(int64(it.Quantity))
+}
+
+// Discount returns the amount saved on the line.
+func (it Item) Discount() (money.Money, error) {
+	d, err := it.ListPrice.Sub(it.UnitPrice)
+	if err != nil {
+		return money.Money{}, err
+	}
+	return d.Mul(int64(it.Quantity))
+}
+
+func (it Item) validate() error {
+	if it.BookID == "" {
+		return errors.New("invalid book id")
+	}
+	if it.Quantity <= 0 {
+		return fmt.Errorf("invalid quantity: %d", it.Quantity)
+	}
+	if it.ListPrice.IsNegative() || it.UnitPrice.IsNegative() {
+		return fmt.Errorf("invalid price for book %s", it.BookID)
+	}
+	if _, err := it.ListPrice.Add(it.UnitPrice); err != nil {
+		return fmt.Errorf("book %s: %w", it.BookID, err)
+	}
+	if it.DiscountPercent < 0 || it.DiscountPercent > 100 {
+		return fmt.Errorf("invalid discount value: %d", it.DiscountPercent)
+	}
+	return nil
+}
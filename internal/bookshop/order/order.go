@@ -3,50 +3,224 @@ package order
 import (
 	"errors"
 	"fmt"
+	"time"
+
+	"github.com/qba73/bookshop/internal/bookshop"
+	"github.com/qba73/bookshop/internal/money"
 )
 
-type order struct {
+// ErrNotDraft is returned when an order that is no longer
+// a draft is modified.
+var ErrNotDraft = errors.New("order is not a draft")
+
+// Order represents a customer order in the bookshop.
+type Order struct {
 	OrderID string
-	Books   []string
+	// CustomerID identifies the customer placing the order,
+	// empty for guest orders.
+	CustomerID string
+	// CouponCode is the promo code the customer wants
+	// to redeem with the order.
+	CouponCode string
+	Items      []Item
+	Status     Status
+	CreatedAt  time.Time
+	History    []Transition
+	// Rounding is how discounts of books added to the order
+	// are rounded, money.RoundDown by default.
+	Rounding money.RoundingMode
+	// Adjustments are amounts taken off order lines on top
+	// of book discounts, see SetAdjustments.
+	Adjustments []Adjustment
+	// Tax is how the order is taxed, nil until
+	// it is recorded, see SetTax.
+	Tax *Tax
+	// Paid is the amount the customer was charged for the order.
+	Paid money.Money
 }
 
 // New knows how to construct a valid order.
-func New(orderID string) (*order, error) {
+func New(orderID string) (*Order, error) {
 	if orderID == "" {
 		return nil, errors.New("invalid order id")
 	}
 
-	o := order{
-		OrderID: orderID,
+	o := Order{
+		OrderID:   orderID,
+		Status:    StatusDraft,
+		CreatedAt: time.Now(),
 	}
 
 	return &o, nil
 }
 
 // Id returns the order ID.
-func (o *order) ID() string {
+func (o *Order) ID() string {
 	return o.OrderID
 }
 
-// AddBook knows how to add a book identifued by id to the order.
-func (o *order) AddBook(ids ...string) error {
-	var correctIDS []string
-	var incorrectIDS []string
+// SetCustomer knows how to assign the draft order to the customer.
+func (o *Order) SetCustomer(c bookshop.Customer) error {
+	if o.CurrentStatus() != StatusDraft {
+		return fmt.Errorf("order %s: %w", o.OrderID, ErrNotDraft)
+	}
+	if c.ID == "" {
+		return errors.New("invalid customer id")
+	}
+	o.CustomerID = c.ID
+	return nil
+}
+
+// AddBook knows how to add quantity copies of the book to the order.
+// The book sale price and discount are captured at the time of
+// ordering, so later catalog price changes do not affect the order.
+// Adding a book already in the order increases its quantity.
+func (o *Order) AddBook(b bookshop.Book, quantity int) error {
+	if b.ID == "" {
+		return errors.New("invalid book id")
+	}
+	price, err := b.SalePriceRounded(o.Rounding)
+	if err != nil {
+		return fmt.Errorf("book id %s: %w", b.ID, err)
+	}
+	return o.AddItem(Item{
+		BookID:          b.ID,
+		Quantity:        quantity,
+		ListPrice:       b.Price,
+		DiscountPercent: b.Discount(),
+		UnitPrice:       price,
+	})
+}
 
-	for _, b := range ids {
-		if b == "" {
-			incorrectIDS = append(incorrectIDS, b)
+// AddItem knows how to add a line item to the order.
+// Items for a book already in the order are merged
+// keeping the price captured first. All items must be
+// priced in the same currency.
+func (o *Order) AddItem(it Item) error {
+	if o.CurrentStatus() != StatusDraft {
+		return fmt.Errorf("order %s: %w", o.OrderID, ErrNotDraft)
+	}
+	if err := it.validate(); err != nil {
+		return err
+	}
+
+	items := append([]Item(nil), o.Items...)
+	merged := false
+	for i := range items {
+		if items[i].BookID == it.BookID {
+			items[i].Quantity += it.Quantity
+			merged = true
+			break
 		}
-		correctIDS = append(correctIDS, b)
 	}
-	o.Books = append(o.Books, correctIDS...)
-	if len(incorrectIDS) > 0 {
-		return fmt.Errorf("Incorrect book ids in order: %v", incorrectIDS)
+	if !merged {
+		items = append(items, it)
+	}
+	return o.setItems(items)
+}
+
+// SetQuantity knows how to change the quantity of the book in the order.
+// Setting the quantity to zero removes the book from the order.
+func (o *Order) SetQuantity(bookID string, quantity int) error {
+	if o.CurrentStatus() != StatusDraft {
+		return fmt.Errorf("order %s: %w", o.OrderID, ErrNotDraft)
+	}
+	if quantity < 0 {
+		return fmt.Errorf("invalid quantity: %d", quantity)
 	}
+
+	items := append([]Item(nil), o.Items...)
+	for i := range items {
+		if items[i].BookID != bookID {
+			continue
+		}
+		if quantity == 0 {
+			return o.setItems(append(items[:i], items[i+1:]...))
+		}
+		items[i].Quantity = quantity
+		return o.setItems(items)
+	}
+	return fmt.Errorf("book id %s not in order %s", bookID, o.OrderID)
+}
+
+// setItems knows how to replace order items, provided
+// totals of the new items can be calculated. Adjustments
+// and tax of the old items are removed.
+func (o *Order) setItems(items []Item) error {
+	for _, fn := range []func(Item) (money.Money, error){Item.Subtotal, Item.Total} {
+		if _, err := sum(items, fn); err != nil {
+			return fmt.Errorf("order %s: %w", o.OrderID, err)
+		}
+	}
+	o.Items = items
+	o.Adjustments = nil
+	o.Tax = nil
 	return nil
 }
 
 // BookIDs returns current list of books added to the order.
-func (o *order) BookIDs() []string {
-	return o.Books
+func (o *Order) BookIDs() []string {
+	var ids []string
+	for _, it := range o.Items {
+		ids = append(ids, it.BookID)
+	}
+	return ids
+}
+
+// Currency returns the currency of order items, empty
+// when the order has no priced items.
+func (o *Order) Currency() money.Currency {
+	for _, it := range o.Items {
+		if c := it.ListPrice.Currency(); c != "" {
+			return c
+		}
+	}
+	return ""
+}
+
+// Subtotal returns the order value at list prices, before discounts.
+func (o *Order) Subtotal() (money.Money, error) {
+	return sum(o.Items, Item.Subtotal)
+}
+
+// DiscountTotal returns the amount saved on all order lines,
+// by book discounts and adjustments.
+func (o *Order) DiscountTotal() (money.Money, error) {
+	d, err := sum(o.Items, Item.Discount)
+	if err != nil {
+		return money.Money{}, err
+	}
+	adj, err := o.AdjustmentTotal()
+	if err != nil {
+		return money.Money{}, err
+	}
+	return d.Add(adj)
+}
+
+// Total returns the amount to pay for the order.
+func (o *Order) Total() (money.Money, error) {
+	total, err := sum(o.Items, Item.Total)
+	if err != nil {
+		return money.Money{}, err
+	}
+	adj, err := o.AdjustmentTotal()
+	if err != nil {
+		return money.Money{}, err
+	}
+	return total.Sub(adj)
+}
+
+// sum adds up amounts of items returned by fn.
+func sum(items []Item, fn func(Item) (money.Money, error)) (money.Money, error) {
+	var total money.Money
+	for _, it := range items {
+		m, err := fn(it)
+		if err != nil {
+			return money.Money{}, fmt.Errorf("book %s: %w", it.BookID, err)
+		}
+		if total, err = total.Add(m); err != nil {
+			return money.Money{}, fmt.Errorf("book %s: %w", it.BookID, err)
+		}
+	}
+	return total, nil
 }
@@ -1,10 +1,15 @@
 package order_test
 
 import (
+	"encoding/json"
+	"errors"
+	"math"
 	"testing"
 
 	"github.com/google/go-cmp/cmp"
+	"github.com/qba73/bookshop/internal/bookshop"
 	"github.com/qba73/bookshop/internal/bookshop/order"
+	"github.com/qba73/bookshop/internal/money"
 )
 
 func TestNew(t *testing.T) {
@@ -65,41 +70,80 @@ func TestNewOrder(t *testing.T) {
 	}
 }
 
+func newBook(t *testing.T, id string, price int64, discount int) bookshop.Book {
+	t.Helper()
+
+	b := bookshop.Book{ID: id, Price: money.New(price, money.PLN)}
+	if err := b.SetDiscountPercent(discount); err != nil {
+		t.Fatal(err)
+	}
+	return b
+}
+
 func TestAddBook(t *testing.T) {
 	t.Parallel()
 
+	type add struct {
+		id       string
+		price    int64
+		discount int
+		quantity int
+	}
+
 	tt := []struct {
 		name        string
 		orderID     string
-		books       []string
-		want        []string
+		books       []add
+		want        []order.Item
 		expectedErr bool
 	}{
-		{name: "Correct book", orderID: "123", books: []string{"123"}, want: []string{"123"}, expectedErr: false},
-		{name: "Correct multiple books", orderID: "234", books: []string{"123", "456", "789"}, want: []string{"123", "456", "789"}, expectedErr: false},
-		{name: "Incorrect book ID", orderID: "345", books: []string{""}, want: []string{}, expectedErr: true},
-		{name: "Incorrect book ID among correct", orderID: "456", books: []string{"123", "456", "", "789"}, want: []string{"123", "456", "789"}, expectedErr: true},
+		{
+			name: "Correct book", orderID: "123",
+			books:       []add{{"123", 2000, 20, 1}},
+			want:        []order.Item{{BookID: "123", Quantity: 1, ListPrice: money.New(2000, money.PLN), DiscountPercent: 20, UnitPrice: money.New(1600, money.PLN)}},
+			expectedErr: false,
+		},
+		{
+			name: "Correct multiple books", orderID: "234",
+			books: []add{{"123", 2000, 0, 1}, {"456", 1000, 5, 3}},
+			want: []order.Item{
+				{BookID: "123", Quantity: 1, ListPrice: money.New(2000, money.PLN), DiscountPercent: 0, UnitPrice: money.New(2000, money.PLN)},
+				{BookID: "456", Quantity: 3, ListPrice: money.New(1000, money.PLN), DiscountPercent: 5, UnitPrice: money.New(950, money.PLN)},
+			},
+			expectedErr: false,
+		},
+		{
+			name: "Same book twice", orderID: "345",
+			books:       []add{{"123", 2000, 10, 1}, {"123", 2500, 10, 2}},
+			want:        []order.Item{{BookID: "123", Quantity: 3, ListPrice: money.New(2000, money.PLN), DiscountPercent: 10, UnitPrice: money.New(1800, money.PLN)}},
+			expectedErr: false,
+		},
+		{name: "Incorrect book ID", orderID: "456", books: []add{{"", 2000, 0, 1}}, expectedErr: true},
+		{name: "Zero quantity", orderID: "567", books: []add{{"123", 2000, 0, 0}}, expectedErr: true},
+		{name: "Negative quantity", orderID: "678", books: []add{{"123", 2000, 0, -2}}, expectedErr: true},
 	}
 
 	for _, tc := range tt {
+		tc := tc
 		t.Run(tc.name, func(t *testing.T) {
-			var err error
-
 			o, err := order.New(tc.orderID)
 			if err != nil {
 				t.Fatal(err)
 			}
 
-			err = o.AddBook(tc.books...)
+			for _, a := range tc.books {
+				if err = o.AddBook(newBook(t, a.id, a.price, a.discount), a.quantity); err != nil {
+					break
+				}
+			}
 
 			if (err != nil) != tc.expectedErr {
 				t.Fatalf("%s, AddBook(%v) got error: %v", tc.name, tc.books, err)
 			}
 
-			if !tc.expectedErr && (!cmp.Equal(o.Books, tc.want)) {
-				t.Errorf("%s, order.AddBook(%v) got:\n%s", tc.name, tc.books, cmp.Diff(o.Books, tc.want))
+			if !tc.expectedErr && (!cmp.Equal(o.Items, tc.want)) {
+				t.Errorf("%s, order.AddBook(%v) got:\n%s", tc.name, tc.books, cmp.Diff(tc.want, o.Items))
 			}
-
 		})
 	}
 }
@@ -116,9 +160,11 @@ func TestOrderBookIDs(t *testing.T) {
 	}{
 		{name: "Single book order", orderID: "123", books: []string{"123"}, want: []string{"123"}, expectedErr: false},
 		{name: "Multiple books order", orderID: "234", books: []string{"123", "456", "789"}, want: []string{"123", "456", "789"}, expectedErr: false},
+		{name: "Repeated books order", orderID: "345", books: []string{"123", "456", "123"}, want: []string{"123", "456"}, expectedErr: false},
 	}
 
 	for _, tc := range tt {
+		tc := tc
 		t.Run(tc.name, func(t *testing.T) {
 			var err error
 
@@ -127,20 +173,331 @@ func TestOrderBookIDs(t *testing.T) {
 				t.Fatal(err)
 			}
 
-			err = o.AddBook(tc.books...)
-			if err != nil {
-				t.Fatal(err)
+			for _, id := range tc.books {
+				if err := o.AddBook(newBook(t, id, 1000, 0), 1); err != nil {
+					t.Fatal(err)
+				}
 			}
 
 			got := o.BookIDs()
 
+			if !cmp.Equal(got, tc.want) {
+				t.Errorf("%s, order.BookIDs(%v) got:\n%s", tc.name, tc.books, cmp.Diff(got, tc.want))
+			}
+		})
+	}
+}
+
+func TestOrderTotals(t *testing.T) {
+	t.Parallel()
+
+	o, err := order.New("12282")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	bolek := newBook(t, "123", 2000, 20)
+	zosia := newBook(t, "456", 1000, 5)
+
+	if err := o.AddBook(bolek, 2); err != nil {
+		t.Fatal(err)
+	}
+	if err := o.AddBook(zosia, 1); err != nil {
+		t.Fatal(err)
+	}
+
+	// Catalog price changes must not affect the order.
+	if err := bolek.SetPrice(money.New(5000, money.PLN)); err != nil {
+		t.Fatal(err)
+	}
+	if err := zosia.SetDiscountPercent(50); err != nil {
+		t.Fatal(err)
+	}
+
+	tt := []struct {
+		name string
+		fn   func() (money.Money, error)
+		want money.Money
+	}{
+		{name: "Subtotal", fn: o.Subtotal, want: money.New(5000, money.PLN)},
+		{name: "DiscountTotal", fn: o.DiscountTotal, want: money.New(850, money.PLN)},
+		{name: "Total", fn: o.Total, want: money.New(4150, money.PLN)},
+	}
+
+	for _, tc := range tt {
+		got, err := tc.fn()
+		if err != nil {
+			t.Fatalf("%s() got error: %v", tc.name, err)
+		}
+		if got != tc.want {
+			t.Errorf("%s() = %v, want: %v", tc.name, got, tc.want)
+		}
+	}
+}
+
+func TestOrderSetQuantity(t *testing.T) {
+	t.Parallel()
+
+	tt := []struct {
+		name        string
+		bookID      string
+		quantity    int
+		want        []string
+		wantTotal   int64
+		expectedErr bool
+	}{
+		{name: "Increase quantity", bookID: "123", quantity: 3, want: []string{"123", "456"}, wantTotal: 4000, expectedErr: false},
+		{name: "Remove book", bookID: "123", quantity: 0, want: []string{"456"}, wantTotal: 1000, expectedErr: false},
+		{name: "Negative quantity", bookID: "123", quantity: -1, want: []string{"123", "456"}, wantTotal: 2000, expectedErr: true},
+		{name: "Book not in order", bookID: "789", quantity: 1, want: []string{"123", "456"}, wantTotal: 2000, expectedErr: true},
+	}
+
+	for _, tc := range tt {
+		tc := tc
+		t.Run(tc.name, func(t *testing.T) {
+			o, err := order.New("12282")
+			if err != nil {
+				t.Fatal(err)
+			}
+			for _, id := range []string{"123", "456"} {
+				if err := o.AddBook(newBook(t, id, 1000, 0), 1); err != nil {
+					t.Fatal(err)
+				}
+			}
+
+			err = o.SetQuantity(tc.bookID, tc.quantity)
 			if (err != nil) != tc.expectedErr {
-				t.Fatalf("%s, order.BookIDs(%v) got error: %v", tc.name, tc.books, err)
+				t.Fatalf("%s, SetQuantity(%s, %d) got error: %v", tc.name, tc.bookID, tc.quantity, err)
 			}
 
-			if !tc.expectedErr && (!cmp.Equal(got, tc.want)) {
-				t.Errorf("%s, order.BookIDs(%v) got:\n%s", tc.name, tc.books, cmp.Diff(got, tc.want))
+			if got := o.BookIDs(); !cmp.Equal(got, tc.want) {
+				t.Errorf("%s, BookIDs() got:\n%s", tc.name, cmp.Diff(tc.want, got))
+			}
+			if got, err := o.Total(); err != nil || got != money.New(tc.wantTotal, money.PLN) {
+				t.Errorf("%s, Total() = %v, %v, want: %d", tc.name, got, err, tc.wantTotal)
 			}
 		})
 	}
 }
+
+func TestOrderPriceChecks(t *testing.T) {
+	t.Parallel()
+
+	pln := order.Item{BookID: "123", Quantity: 1, ListPrice: money.New(1000, money.PLN), UnitPrice: money.New(1000, money.PLN)}
+	eur := order.Item{BookID: "456", Quantity: 1, ListPrice: money.New(1000, money.EUR), UnitPrice: money.New(1000, money.EUR)}
+	huge := order.Item{BookID: "789", Quantity: 2, ListPrice: money.New(math.MaxInt64/2+1, money.PLN), UnitPrice: money.New(1, money.PLN)}
+
+	tt := []struct {
+		name        string
+		items       []order.Item
+		expectedErr error
+	}{
+		{name: "Same currency", items: []order.Item{pln, {BookID: "456", Quantity: 2, ListPrice: money.New(500, money.PLN), UnitPrice: money.New(500, money.PLN)}}},
+		{name: "Different currencies", items: []order.Item{pln, eur}, expectedErr: money.ErrCurrencyMismatch},
+		{name: "Total overflows", items: []order.Item{huge}, expectedErr: money.ErrOverflow},
+	}
+
+	for _, tc := range tt {
+		o, err := order.New("12282")
+		if err != nil {
+			t.Fatal(err)
+		}
+		for _, it := range tc.items {
+			err = o.AddItem(it)
+			if err != nil {
+				break
+			}
+		}
+		if !errors.Is(err, tc.expectedErr) {
+			t.Errorf("%s, AddItem() got error: %v, want: %v", tc.name, err, tc.expectedErr)
+		}
+		if tc.expectedErr != nil && len(o.Items) != len(tc.items)-1 {
+			t.Errorf("%s, rejected item was added to the order: %v", tc.name, o.Items)
+		}
+	}
+}
+
+func TestOrderRounding(t *testing.T) {
+	t.Parallel()
+
+	tt := []struct {
+		name     string
+		rounding money.RoundingMode
+		want     money.Money
+	}{
+		{name: "Round down discount", rounding: money.RoundDown, want: money.New(2250, money.PLN)},
+		{name: "Round half up discount", rounding: money.RoundHalfUp, want: money.New(2249, money.PLN)},
+	}
+
+	for _, tc := range tt {
+		o, err := order.New("12282")
+		if err != nil {
+			t.Fatal(err)
+		}
+		o.Rounding = tc.rounding
+		if err := o.AddBook(newBook(t, "123", 2499, 10), 1); err != nil {
+			t.Fatal(err)
+		}
+		if got := o.Items[0].UnitPrice; got != tc.want {
+			t.Errorf("%s, unit price = %v, want: %v", tc.name, got, tc.want)
+		}
+	}
+}
+
+func TestItemJSON(t *testing.T) {
+	t.Parallel()
+
+	tt := []struct {
+		name string
+		data string
+		want order.Item
+	}{
+		{
+			name: "Prices with currency",
+			data: `{"BookID":"123","Quantity":2,"ListPrice":{"amount":2000,"currency":"EUR"},"DiscountPercent":10,"UnitPrice":{"amount":1800,"currency":"EUR"}}`,
+			want: order.Item{BookID: "123", Quantity: 2, ListPrice: money.New(2000, money.EUR), DiscountPercent: 10, UnitPrice: money.New(1800, money.EUR)},
+		},
+	}
+
+	for _, tc := range tt {
+		var got order.Item
+		if err := json.Unmarshal([]byte(tc.data), &got); err != nil {
+			t.Fatalf("%s, Unmarshal() got error: %v", tc.name, err)
+		}
+		if !cmp.Equal(tc.want, got) {
+			t.Errorf("%s, Unmarshal() \n%s", tc.name, cmp.Diff(tc.want, got))
+		}
+	}
+}
+
+func TestOrderSetTax(t *testing.T) {
+	t.Parallel()
+
+	o, err := order.New("12282")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := o.AddBook(newBook(t, "123", 2000, 0), 1); err != nil {
+		t.Fatal(err)
+	}
+	if err := o.AddBook(newBook(t, "456", 1000, 0), 1); err != nil {
+		t.Fatal(err)
+	}
+
+	for _, tax := range []order.Tax{
+		{Rates: map[string]int{"123": 500, "456": 2300}},
+		{Country: "PL", Rates: map[string]int{"123": 500}},
+		{Country: "PL", Rates: map[string]int{"123": 500, "456": -1}},
+	} {
+		if err := o.SetTax(tax); err == nil {
+			t.Errorf("SetTax(%+v) should return error", tax)
+		}
+	}
+
+	if err := o.SetTax(order.Tax{Country: "PL", Rates: map[string]int{"123": 500, "456": 2300, "789": 500}}); err != nil {
+		t.Fatal(err)
+	}
+	want := &order.Tax{Country: "PL", Rates: map[string]int{"123": 500, "456": 2300}}
+	if !cmp.Equal(want, o.Tax) {
+		t.Error(cmp.Diff(want, o.Tax))
+	}
+
+	if err := o.SetQuantity("456", 2); err != nil {
+		t.Fatal(err)
+	}
+	if o.Tax != nil {
+		t.Errorf("tax of changed items = %+v, want: nil", o.Tax)
+	}
+}
+
+func TestOrderSetAdjustments(t *testing.T) {
+	t.Parallel()
+
+	tt := []struct {
+		name        string
+		adj         []order.Adjustment
+		wantTotal   money.Money
+		expectedErr bool
+	}{
+		{
+			name:      "Adjustments of lines",
+			adj:       []order.Adjustment{{BookID: "123", Source: "spring", Amount: money.New(500, money.PLN)}, {BookID: "456", Source: "spring", Amount: money.New(100, money.PLN)}},
+			wantTotal: money.New(2400, money.PLN),
+		},
+		{
+			name:      "Whole line",
+			adj:       []order.Adjustment{{BookID: "123", Source: "spring", Amount: money.New(1000, money.PLN)}, {BookID: "123", Source: "3for2", Amount: money.New(1000, money.PLN)}},
+			wantTotal: money.New(1000, money.PLN),
+		},
+		{
+			name:        "More than the line total",
+			adj:         []order.Adjustment{{BookID: "456", Source: "spring", Amount: money.New(600, money.PLN)}, {BookID: "456", Source: "3for2", Amount: money.New(600, money.PLN)}},
+			expectedErr: true,
+		},
+		{name: "Book not in order", adj: []order.Adjustment{{BookID: "789", Source: "spring", Amount: money.New(100, money.PLN)}}, expectedErr: true},
+		{name: "Negative amount", adj: []order.Adjustment{{BookID: "123", Source: "spring", Amount: money.New(-100, money.PLN)}}, expectedErr: true},
+		{name: "Other currency", adj: []order.Adjustment{{BookID: "123", Source: "spring", Amount: money.New(100, money.EUR)}}, expectedErr: true},
+	}
+
+	for _, tc := range tt {
+		o, err := order.New("12282")
+		if err != nil {
+			t.Fatal(err)
+		}
+		if err := o.AddBook(newBook(t, "123", 1000, 0), 2); err != nil {
+			t.Fatal(err)
+		}
+		if err := o.AddBook(newBook(t, "456", 1000, 0), 1); err != nil {
+			t.Fatal(err)
+		}
+
+		err = o.SetAdjustments(tc.adj)
+		if (err != nil) != tc.expectedErr {
+			t.Fatalf("%s, SetAdjustments() got error: %v", tc.name, err)
+		}
+		if tc.expectedErr {
+			if len(o.Adjustments) != 0 {
+				t.Errorf("%s, rejected adjustments were set: %v", tc.name, o.Adjustments)
+			}
+			continue
+		}
+		if got, err := o.Total(); err != nil || got != tc.wantTotal {
+			t.Errorf("%s, Total() = %v, %v, want: %v", tc.name, got, err, tc.wantTotal)
+		}
+
+		if err := o.SetQuantity("456", 2); err != nil {
+			t.Fatal(err)
+		}
+		if len(o.Adjustments) != 0 {
+			t.Errorf("%s, adjustments kept after items changed: %v", tc.name, o.Adjustments)
+		}
+	}
+}
+
+func TestOrderSetCustomer(t *testing.T) {
+	t.Parallel()
+
+	o, err := order.New("12282")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := o.SetCustomer(bookshop.Customer{Name: "Guest"}); err == nil {
+		t.Error("SetCustomer() without customer id: want error")
+	}
+	if err := o.SetCustomer(bookshop.Customer{ID: "c1", Name: "Anna"}); err != nil {
+		t.Fatal(err)
+	}
+	if o.CustomerID != "c1" {
+		t.Errorf("CustomerID = %q, want: c1", o.CustomerID)
+	}
+
+	if err := o.AddBook(bookshop.Book{ID: "123", Price: money.New(1000, money.PLN)}, 1); err != nil {
+		t.Fatal(err)
+	}
+	if err := o.Place(); err != nil {
+		t.Fatal(err)
+	}
+	if err := o.SetCustomer(bookshop.Customer{ID: "c2"}); !errors.Is(err, order.ErrNotDraft) {
+		t.Errorf("SetCustomer() on placed order = %v, want: %v", err, order.ErrNotDraft)
+	}
+}
@@ -0,0 +1,138 @@
+package order
+
+import (
+	"errors"
+	"fmt"
+	"time"
+)
+
+// Status represents a stage in the order lifecycle.
+type Status string
+
+// Order lifecycle statuses.
+const (
+	StatusDraft     Status = "draft"
+	StatusPlaced    Status = "placed"
+	StatusPaid      Status = "paid"
+	StatusShipped   Status = "shipped"
+	StatusDelivered Status = "delivered"
+	StatusCancelled Status = "cancelled"
+	StatusRefunded  Status = "refunded"
+)
+
+// transitions lists statuses an order can move to from a given status.
+// Cancelled and refunded orders are final.
+var transitions = map[Status][]Status{
+	StatusDraft:     {StatusPlaced, StatusCancelled},
+	StatusPlaced:    {StatusPaid, StatusCancelled},
+	StatusPaid:      {StatusShipped, StatusRefunded},
+	StatusShipped:   {StatusDelivered, StatusRefunded},
+	StatusDelivered: {StatusRefunded},
+}
+
+// ErrIllegalTransition is matched by errors returned when
+// an order cannot move to the requested status.
+var ErrIllegalTransition = errors.New("illegal order status transition")
+
+// TransitionError is returned when an order cannot move
+// from its current status to the requested one.
+type TransitionError struct {
+	OrderID string
+	From    Status
+	To      Status
+}
+
+// Error implements error interface for the TransitionError.
+func (e *TransitionError) Error() string {
+	return fmt.Sprintf("order %s: cannot change status from %s to %s", e.OrderID, e.From, e.To)
+}
+
+// Is reports whether the error matches ErrIllegalTransition.
+func (e *TransitionError) Is(target error) bool {
+	return target == ErrIllegalTransition
+}
+
+// Transition records a single status change of an order.
+type Transition struct {
+	From Status
+	To   Status
+	At   time.Time
+}
+
+// CanTransition reports whether an order in status from
+// is allowed to move to status to.
+func CanTransition(from, to Status) bool {
+	for _, s := range transitions[from] {
+		if s == to {
+			return true
+		}
+	}
+	return false
+}
+
+// CurrentStatus returns the order status. Orders created
+// before statuses were tracked are treated as drafts.
+func (o *Order) CurrentStatus() Status {
+	if o.Status == "" {
+		return StatusDraft
+	}
+	return o.Status
+}
+
+// TransitionTo knows how to move the order to the given status
+// and record when it happened. It returns a *TransitionError
+// if the lifecycle does not allow the change.
+func (o *Order) TransitionTo(s Status, at time.Time) error {
+	from := o.CurrentStatus()
+	if !CanTransition(from, s) {
+		return &TransitionError{OrderID: o.OrderID, From: from, To: s}
+	}
+	o.Status = s
+	o.History = append(o.History, Transition{From: from, To: s, At: at})
+	return nil
+}
+
+// StatusTime returns the time the order entered the given status.
+// It returns false if the order has never been in that status.
+// Drafts report the order creation time.
+func (o *Order) StatusTime(s Status) (time.Time, bool) {
+	if s == StatusDraft {
+		return o.CreatedAt, !o.CreatedAt.IsZero()
+	}
+	for _, t := range o.History {
+		if t.To == s {
+			return t.At, true
+		}
+	}
+	return time.Time{}, false
+}
+
+// Place moves a draft order to placed.
+func (o *Order) Place() error {
+	return o.TransitionTo(StatusPlaced, time.Now())
+}
+
+// Pay marks a placed order as paid.
+func (o *Order) Pay() error {
+	return o.TransitionTo(StatusPaid, time.Now())
+}
+
+// Ship marks a paid order as shipped.
+func (o *Order) Ship() error {
+	return o.TransitionTo(StatusShipped, time.Now())
+}
+
+// Deliver marks a shipped order as delivered.
+func (o *Order) Deliver() error {
+	return o.TransitionTo(StatusDelivered, time.Now())
+}
+
+// Cancel cancels an order that has not been paid yet.
+func (o *Order) Cancel() error {
+	return o.TransitionTo(StatusCancelled, time.Now())
+}
+
+// Refund marks a paid, shipped or delivered order as refunded.
+func (o *Order) Refund() error {
+	return o.TransitionTo(StatusRefunded, time.Now())
+}
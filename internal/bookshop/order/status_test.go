@@ -0,0 +1,152 @@
+package order_test
+
+import (
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/google/go-cmp/cmp"
+	"github.com/qba73/bookshop/internal/bookshop"
+	"github.com/qba73/bookshop/internal/bookshop/order"
+	"github.com/qba73/bookshop/internal/money"
+)
+
+func TestOrderNewIsDraft(t *testing.T) {
+	t.Parallel()
+
+	o, err := order.New("12282")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if got := o.CurrentStatus(); got != order.StatusDraft {
+		t.Errorf("CurrentStatus() = %s, want: %s", got, order.StatusDraft)
+	}
+	if _, ok := o.StatusTime(order.StatusDraft); !ok {
+		t.Errorf("StatusTime(%s) should report creation time", order.StatusDraft)
+	}
+}
+
+func TestOrderTransitionTo(t *testing.T) {
+	t.Parallel()
+
+	tt := []struct {
+		name        string
+		path        []order.Status
+		expectedErr bool
+	}{
+		{name: "Full lifecycle", path: []order.Status{order.StatusPlaced, order.StatusPaid, order.StatusShipped, order.StatusDelivered}, expectedErr: false},
+		{name: "Cancel draft", path: []order.Status{order.StatusCancelled}, expectedErr: false},
+		{name: "Cancel placed", path: []order.Status{order.StatusPlaced, order.StatusCancelled}, expectedErr: false},
+		{name: "Refund paid", path: []order.Status{order.StatusPlaced, order.StatusPaid, order.StatusRefunded}, expectedErr: false},
+		{name: "Refund delivered", path: []order.Status{order.StatusPlaced, order.StatusPaid, order.StatusShipped, order.StatusDelivered, order.StatusRefunded}, expectedErr: false},
+		{name: "Pay draft", path: []order.Status{order.StatusPaid}, expectedErr: true},
+		{name: "Ship unpaid", path: []order.Status{order.StatusPlaced, order.StatusShipped}, expectedErr: true},
+		{name: "Cancel paid", path: []order.Status{order.StatusPlaced, order.StatusPaid, order.StatusCancelled}, expectedErr: true},
+		{name: "Reopen cancelled", path: []order.Status{order.StatusCancelled, order.StatusPlaced}, expectedErr: true},
+		{name: "Refund twice", path: []order.Status{order.StatusPlaced, order.StatusPaid, order.StatusRefunded, order.StatusRefunded}, expectedErr: true},
+	}
+
+	start := time.Date(2021, time.January, 10, 12, 0, 0, 0, time.UTC)
+
+	for _, tc := range tt {
+		tc := tc
+		t.Run(tc.name, func(t *testing.T) {
+			o, err := order.New("12282")
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			var want []order.Transition
+			from := order.StatusDraft
+			for i, s := range tc.path {
+				at := start.Add(time.Duration(i) * time.Hour)
+				err = o.TransitionTo(s, at)
+				if err != nil {
+					break
+				}
+				want = append(want, order.Transition{From: from, To: s, At: at})
+				from = s
+			}
+
+			if (err != nil) != tc.expectedErr {
+				t.Fatalf("%s TransitionTo() got error: %v", tc.name, err)
+			}
+
+			if tc.expectedErr {
+				if !errors.Is(err, order.ErrIllegalTransition) {
+					t.Errorf("%s TransitionTo() = %v, want: %v", tc.name, err, order.ErrIllegalTransition)
+				}
+				var terr *order.TransitionError
+				if !errors.As(err, &terr) || terr.From != from {
+					t.Errorf("%s TransitionTo() = %#v, want TransitionError from %s", tc.name, err, from)
+				}
+			}
+
+			if got := o.CurrentStatus(); got != from {
+				t.Errorf("%s CurrentStatus() = %s, want: %s", tc.name, got, from)
+			}
+
+			if !cmp.Equal(o.History, want) {
+				t.Errorf("%s History \n%s", tc.name, cmp.Diff(want, o.History))
+			}
+
+			for _, tr := range want {
+				got, ok := o.StatusTime(tr.To)
+				if !ok || !got.Equal(tr.At) {
+					t.Errorf("%s StatusTime(%s) = %v, %v, want: %v", tc.name, tr.To, got, ok, tr.At)
+				}
+			}
+		})
+	}
+}
+
+func TestOrderLifecycleMethods(t *testing.T) {
+	t.Parallel()
+
+	o, err := order.New("12282")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	steps := []struct {
+		name string
+		fn   func() error
+		want order.Status
+	}{
+		{name: "Place", fn: o.Place, want: order.StatusPlaced},
+		{name: "Pay", fn: o.Pay, want: order.StatusPaid},
+		{name: "Ship", fn: o.Ship, want: order.StatusShipped},
+		{name: "Deliver", fn: o.Deliver, want: order.StatusDelivered},
+		{name: "Refund", fn: o.Refund, want: order.StatusRefunded},
+	}
+
+	for _, s := range steps {
+		if err := s.fn(); err != nil {
+			t.Fatalf("%s() got error: %v", s.name, err)
+		}
+		if got := o.CurrentStatus(); got != s.want {
+			t.Errorf("%s() status = %s, want: %s", s.name, got, s.want)
+		}
+	}
+
+	if err := o.Cancel(); !errors.Is(err, order.ErrIllegalTransition) {
+		t.Errorf("Cancel() refunded order = %v, want: %v", err, order.ErrIllegalTransition)
+	}
+}
+
+func TestOrderAddBookAfterPlace(t *testing.T) {
+	t.Parallel()
+
+	o, err := order.New("12282")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := o.Place(); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := o.AddBook(bookshop.Book{ID: "123", Price: money.New(1000, money.PLN)}, 1); !errors.Is(err, order.ErrNotDraft) {
+		t.Errorf("AddBook() on placed order = %v, want: %v", err, order.ErrNotDraft)
+	}
+}
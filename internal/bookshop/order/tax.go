@@ -0,0 +1,45 @@
+package order
+
+import (
+	"fmt"
+)
+
+// Tax records how an order is taxed. It is set when the order is
+// placed, so the tax of the sale does not change when books or the
+// customer address are edited later.
+type Tax struct {
+	// Country is the ISO 3166-1 code of the country
+	// the order is taxed in.
+	Country string
+	// PricesIncludeTax tells whether item prices include tax.
+	PricesIncludeTax bool
+	// Rates are tax rates of ordered books in basis points,
+	// 500 is 5%, by book ID.
+	Rates map[string]int
+}
+
+// SetTax knows how to record tax of the draft order. There must be
+// a rate for each book in the order. Changing order items removes
+// the tax, as it no longer applies to the new items.
+func (o *Order) SetTax(t Tax) error {
+	if o.CurrentStatus() != StatusDraft {
+		return fmt.Errorf("order %s: %w", o.OrderID, ErrNotDraft)
+	}
+	if t.Country == "" {
+		return fmt.Errorf("order %s: invalid tax country", o.OrderID)
+	}
+	rates := make(map[string]int, len(o.Items))
+	for _, it := range o.Items {
+		r, ok := t.Rates[it.BookID]
+		if !ok {
+			return fmt.Errorf("order %s: no tax rate of book %s", o.OrderID, it.BookID)
+		}
+		if r < 0 || r > 10000 {
+			return fmt.Errorf("order %s: book %s: invalid tax rate %d", o.OrderID, it.BookID, r)
+		}
+		rates[it.BookID] = r
+	}
+	t.Rates = rates
+	o.Tax = &t
+	return nil
+}
@@ -0,0 +1,107 @@
+package bookshop
+
+import (
+	"errors"
+	"fmt"
+	"sort"
+
+	"github.com/qba73/bookshop/internal/money"
+)
+
+// ErrNoPrice is returned when a book has no price in
+// the requested currency and it cannot be converted.
+var ErrNoPrice = errors.New("no price in currency")
+
+// ConversionRounding is how prices converted from another
+// currency are rounded.
+const ConversionRounding = money.RoundHalfUp
+
+// Converter converts amounts between currencies,
+// for example money.Rates of a given date.
+type Converter interface {
+	Convert(m money.Money, to money.Currency, mode money.RoundingMode) (money.Money, error)
+}
+
+// SetPriceIn knows how to set the book list price in the currency
+// of p. Setting a price in the currency of Price changes Price,
+// other currencies are added to the book price list.
+func (b *Book) SetPriceIn(p money.Money) error {
+	if p.Currency() == "" {
+		return fmt.Errorf("Invalid book price: %v: %w", p, money.ErrInvalidCurrency)
+	}
+	if p.Currency() == b.Price.Currency() {
+		return b.SetPrice(p)
+	}
+	if p.IsNegative() {
+		return fmt.Errorf("Invalid book price: %v", p)
+	}
+	prices := b.copyPrices()
+	prices[p.Currency()] = p
+	b.prices = prices
+	return nil
+}
+
+// RemovePriceIn knows how to remove the price in the currency
+// from the book price list. Price cannot be removed.
+func (b *Book) RemovePriceIn(c money.Currency) {
+	if _, ok := b.prices[c]; !ok {
+		return
+	}
+	prices := b.copyPrices()
+	delete(prices, c)
+	b.prices = prices
+}
+
+// PriceIn returns the book list price in the currency, either
+// Price or a price from the price list. It returns false when
+// the book has no price in the currency.
+func (b *Book) PriceIn(c money.Currency) (money.Money, bool) {
+	if b.Price.Currency() == c && c != "" {
+		return b.Price, true
+	}
+	p, ok := b.prices[c]
+	return p, ok
+}
+
+// Prices returns the book list prices, Price first
+// and the price list sorted by currency.
+func (b *Book) Prices() []money.Money {
+	var prices []money.Money
+	if b.Price.Currency() != "" {
+		prices = append(prices, b.Price)
+	}
+	var list []money.Money
+	for _, p := range b.prices {
+		list = append(list, p)
+	}
+	sort.Slice(list, func(i, j int) bool { return list[i].Currency() < list[j].Currency() })
+	return append(prices, list...)
+}
+
+// SalePriceIn knows how to calculate price for the book in the
+// currency with applied discount. A price from the price list is
+// used when there is one, otherwise Price is converted with conv,
+// which may be nil when prices should not be converted.
+func (b *Book) SalePriceIn(c money.Currency, conv Converter) (money.Money, error) {
+	list, ok := b.PriceIn(c)
+	if !ok {
+		if conv == nil || b.Price.Currency() == "" {
+			return money.Money{}, fmt.Errorf("book id %s: %w %s", b.ID, ErrNoPrice, c)
+		}
+		var err error
+		if list, err = conv.Convert(b.Price, c, ConversionRounding); err != nil {
+			return money.Money{}, fmt.Errorf("book id %s: %w %s: %v", b.ID, ErrNoPrice, c, err)
+		}
+	}
+	return list.Discount(int64(b.discount), money.RoundDown)
+}
+
+// copyPrices returns a copy of the price list, so copies
+// of a book do not share it.
+func (b *Book) copyPrices() map[money.Currency]money.Money {
+	prices := make(map[money.Currency]money.Money, len(b.prices)+1)
+	for c, p := range b.prices {
+		prices[c] = p
+	}
+	return prices
+}
@@ -0,0 +1,143 @@
+package bookshop_test
+
+import (
+	"encoding/json"
+	"errors"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/google/go-cmp/cmp"
+	"github.com/qba73/bookshop/internal/bookshop"
+	"github.com/qba73/bookshop/internal/money"
+)
+
+const testRates = `date,from,to,rate
+2021-03-01,EUR,PLN,4.5000
+2021-03-01,GBP,PLN,5.2000
+`
+
+func newPricedBook(t *testing.T) bookshop.Book {
+	t.Helper()
+
+	b := bookshop.Book{ID: "1", Title: "Tytus", Price: money.New(4500, money.PLN)}
+	if err := b.SetPriceIn(money.New(999, money.EUR)); err != nil {
+		t.Fatal(err)
+	}
+	if err := b.SetDiscountPercent(10); err != nil {
+		t.Fatal(err)
+	}
+	return b
+}
+
+func TestBook_SetPriceIn(t *testing.T) {
+	t.Parallel()
+
+	tt := []struct {
+		name        string
+		price       money.Money
+		want        []money.Money
+		expectedErr bool
+	}{
+		{name: "Add price in new currency", price: money.New(899, money.GBP), want: []money.Money{money.New(4500, money.PLN), money.New(999, money.EUR), money.New(899, money.GBP)}},
+		{name: "Replace price on the list", price: money.New(1099, money.EUR), want: []money.Money{money.New(4500, money.PLN), money.New(1099, money.EUR)}},
+		{name: "Change price", price: money.New(5000, money.PLN), want: []money.Money{money.New(5000, money.PLN), money.New(999, money.EUR)}},
+		{name: "Negative price", price: money.New(-1, money.GBP), expectedErr: true},
+		{name: "Price without currency", price: money.New(100, ""), expectedErr: true},
+	}
+
+	for _, tc := range tt {
+		b := newPricedBook(t)
+		orig := b
+		err := b.SetPriceIn(tc.price)
+		if (err != nil) != tc.expectedErr {
+			t.Fatalf("%s, SetPriceIn(%v) got error: %v", tc.name, tc.price, err)
+		}
+		if tc.expectedErr {
+			continue
+		}
+		if got := b.Prices(); !cmp.Equal(tc.want, got) {
+			t.Errorf("%s, Prices() \n%s", tc.name, cmp.Diff(tc.want, got))
+		}
+		if got, ok := orig.PriceIn(money.EUR); !ok || got != money.New(999, money.EUR) {
+			t.Errorf("%s, copy of the book price in EUR changed to %v", tc.name, got)
+		}
+	}
+}
+
+func TestBook_SetPriceMovesListPrice(t *testing.T) {
+	t.Parallel()
+
+	b := newPricedBook(t)
+	if err := b.SetPrice(money.New(1299, money.EUR)); err != nil {
+		t.Fatal(err)
+	}
+	want := []money.Money{money.New(1299, money.EUR)}
+	if got := b.Prices(); !cmp.Equal(want, got) {
+		t.Errorf("Prices() \n%s", cmp.Diff(want, got))
+	}
+}
+
+func TestBook_SalePriceIn(t *testing.T) {
+	t.Parallel()
+
+	table, err := money.ParseRates(strings.NewReader(testRates))
+	if err != nil {
+		t.Fatal(err)
+	}
+	rates, err := table.At(time.Date(2021, time.March, 2, 0, 0, 0, 0, time.UTC))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	tt := []struct {
+		name        string
+		currency    money.Currency
+		conv        bookshop.Converter
+		want        money.Money
+		expectedErr error
+	}{
+		{name: "Price", currency: money.PLN, want: money.New(4050, money.PLN)},
+		{name: "Price list", currency: money.EUR, conv: rates, want: money.New(900, money.EUR)},
+		// 45.00 PLN is 8.6538 GBP, 8.65 GBP less 10% discount.
+		{name: "Converted price", currency: money.GBP, conv: rates, want: money.New(779, money.GBP)},
+		{name: "No rates", currency: money.GBP, expectedErr: bookshop.ErrNoPrice},
+		{name: "No rate for currency", currency: money.USD, conv: rates, expectedErr: bookshop.ErrNoPrice},
+	}
+
+	b := newPricedBook(t)
+	for _, tc := range tt {
+		got, err := b.SalePriceIn(tc.currency, tc.conv)
+		if !errors.Is(err, tc.expectedErr) {
+			t.Fatalf("%s, SalePriceIn(%s) got error: %v, want: %v", tc.name, tc.currency, err, tc.expectedErr)
+		}
+		if got != tc.want {
+			t.Errorf("%s, SalePriceIn(%s) = %v, want: %v", tc.name, tc.currency, got, tc.want)
+		}
+	}
+}
+
+func TestBook_JSONPriceList(t *testing.T) {
+	t.Parallel()
+
+	b := newPricedBook(t)
+	data, err := json.Marshal(b)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !strings.Contains(string(data), `"prices":{"EUR":999}`) {
+		t.Errorf("Marshal() = %s, want EUR price list", data)
+	}
+
+	var got bookshop.Book
+	if err := json.Unmarshal(data, &got); err != nil {
+		t.Fatal(err)
+	}
+	if !cmp.Equal(b.Prices(), got.Prices()) {
+		t.Errorf("Unmarshal() prices \n%s", cmp.Diff(b.Prices(), got.Prices()))
+	}
+
+	if err := json.Unmarshal([]byte(`{"id":"1","prices":{"euro":100}}`), &got); !errors.Is(err, money.ErrInvalidCurrency) {
+		t.Errorf("Unmarshal() with invalid currency got error: %v, want: %v", err, money.ErrInvalidCurrency)
+	}
+}
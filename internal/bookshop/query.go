@@ -0,0 +1,324 @@
+package bookshop
+
+import (
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"sort"
+	"strings"
+
+	"github.com/qba73/bookshop/internal/money"
+)
+
+// Fields books can be sorted by.
+const (
+	SortByID             = "id"
+	SortByTitle          = "title"
+	SortByAuthor         = "author"
+	SortByEdition        = "edition"
+	SortByReleaseYear    = "release_year"
+	SortBySeriesNumber   = "series_number"
+	SortByPrice          = "price"
+	SortBySalePrice      = "sale_price"
+	SortByDiscount       = "discount"
+	SortByCategory       = "category"
+	SortByPickOfTheMonth = "pick_of_the_month"
+)
+
+// Page size limits used by Catalog.Query.
+const (
+	DefaultPageSize = 20
+	MaxPageSize     = 100
+)
+
+var (
+	// ErrInvalidQuery is returned when a query has invalid parameters.
+	ErrInvalidQuery = errors.New("invalid query")
+	// ErrInvalidCursor is returned when a cursor is malformed or
+	// was issued for a query sorted differently.
+	ErrInvalidCursor = errors.New("invalid cursor")
+)
+
+// Query describes which books to return, in what order and which page.
+// Zero values of the filter fields match all books.
+type Query struct {
+	// Categories limits results to books in any of the categories
+	// or their subcategories.
+	Categories []int
+	// Author limits results to books written by the author.
+	// It is compared case insensitively.
+	Author string
+	// MinYear and MaxYear limit release years, both inclusive.
+	MinYear int
+	MaxYear int
+	// MinPrice and MaxPrice limit sale prices, both inclusive.
+	// Books priced in other currencies than the limits do not match.
+	MinPrice money.Money
+	MaxPrice money.Money
+	// Edition limits results to the given edition.
+	Edition int
+	// PickOfTheMonth limits results to picks of the month.
+	PickOfTheMonth bool
+	// SeriesNumber limits results to the given series number.
+	SeriesNumber int
+
+	// SortBy is one of the SortBy constants, SortByID when empty.
+	// Books with equal sort values are ordered by ID.
+	SortBy     string
+	Descending bool
+
+	// Limit is the page size, DefaultPageSize when zero.
+	Limit int
+	// Cursor is Page.NextCursor of the previous page,
+	// empty for the first page.
+	Cursor string
+}
+
+// Page represents a single page of query results.
+type Page struct {
+	Books []Book
+	// Total is the number of books matching the query filters.
+	Total int
+	// NextCursor points to the next page, it is empty on the last page.
+	NextCursor string
+}
+
+// Query knows how to return a page of books matching the query.
+// Cursors point at the last book of a page rather than an offset,
+// so paging stays consistent when books are added or removed
+// between requests.
+func (c *Catalog) Query(q Query) (Page, error) {
+	if err := q.validate(); err != nil {
+		return Page{}, err
+	}
+	categories, err := c.subtrees(q.Categories)
+	if err != nil {
+		return Page{}, err
+	}
+	if q.SortBy == "" {
+		q.SortBy = SortByID
+	}
+	if q.Limit == 0 {
+		q.Limit = DefaultPageSize
+	}
+
+	var after *cursor
+	if q.Cursor != "" {
+		cur, err := decodeCursor(q.Cursor)
+		if err != nil {
+			return Page{}, err
+		}
+		if cur.SortBy != q.SortBy || cur.Descending != q.Descending {
+			return Page{}, fmt.Errorf("cursor sorted by %s: %w", cur.SortBy, ErrInvalidCursor)
+		}
+		after = &cur
+	}
+
+	books, err := c.Store().List()
+	if err != nil {
+		return Page{}, err
+	}
+
+	var matched []Book
+	for _, b := range books {
+		if len(categories) > 0 && !b.InCategory(categories...) {
+			continue
+		}
+		if q.matches(b) {
+			matched = append(matched, b)
+		}
+	}
+	sort.Slice(matched, func(i, j int) bool {
+		return keyOf(matched[i], q.SortBy).less(keyOf(matched[j], q.SortBy), q.Descending)
+	})
+
+	start := 0
+	if after != nil {
+		start = sort.Search(len(matched), func(i int) bool {
+			return after.sortKey.less(keyOf(matched[i], q.SortBy), q.Descending)
+		})
+	}
+	end := start + q.Limit
+	if end > len(matched) {
+		end = len(matched)
+	}
+
+	page := Page{
+		Books: matched[start:end],
+		Total: len(matched),
+	}
+	if end < len(matched) {
+		page.NextCursor = cursor{
+			SortBy:     q.SortBy,
+			Descending: q.Descending,
+			sortKey:    keyOf(matched[end-1], q.SortBy),
+		}.encode()
+	}
+	return page, nil
+}
+
+func (q Query) validate() error {
+	switch q.SortBy {
+	case "", SortByID, SortByTitle, SortByAuthor, SortByEdition, SortByReleaseYear,
+		SortBySeriesNumber, SortByPrice, SortBySalePrice, SortByDiscount,
+		SortByCategory, SortByPickOfTheMonth:
+	default:
+		return fmt.Errorf("unknown sort field %q: %w", q.SortBy, ErrInvalidQuery)
+	}
+	if q.Limit < 0 || q.Limit > MaxPageSize {
+		return fmt.Errorf("page size %d out of range 1-%d: %w", q.Limit, MaxPageSize, ErrInvalidQuery)
+	}
+	if q.MaxYear != 0 && q.MinYear > q.MaxYear {
+		return fmt.Errorf("year range %d-%d: %w", q.MinYear, q.MaxYear, ErrInvalidQuery)
+	}
+	if q.hasMinPrice() && q.hasMaxPrice() {
+		if cmp, err := q.MinPrice.Cmp(q.MaxPrice); err != nil || cmp > 0 {
+			return fmt.Errorf("price range %v-%v: %w", q.MinPrice, q.MaxPrice, ErrInvalidQuery)
+		}
+	}
+	return nil
+}
+
+// subtrees returns IDs of the categories and all their descendants.
+func (c *Catalog) subtrees(categories []int) ([]int, error) {
+	var ids []int
+	for _, id := range categories {
+		sub, err := c.Taxonomy().Subtree(id)
+		if err != nil {
+			return nil, err
+		}
+		ids = append(ids, sub...)
+	}
+	return ids, nil
+}
+
+func (q Query) matches(b Book) bool {
+	if q.Author != "" {
+		found := false
+		for _, a := range b.Authors {
+			if strings.EqualFold(a, q.Author) {
+				found = true
+				break
+			}
+		}
+		if !found {
+			return false
+		}
+	}
+	if q.MinYear != 0 && b.ReleaseYear < q.MinYear {
+		return false
+	}
+	if q.MaxYear != 0 && b.ReleaseYear > q.MaxYear {
+		return false
+	}
+	if q.hasMinPrice() {
+		if cmp, err := b.SalePrice().Cmp(q.MinPrice); err != nil || cmp < 0 {
+			return false
+		}
+	}
+	if q.hasMaxPrice() {
+		if cmp, err := b.SalePrice().Cmp(q.MaxPrice); err != nil || cmp > 0 {
+			return false
+		}
+	}
+	if q.Edition != 0 && b.Edition != q.Edition {
+		return false
+	}
+	if q.PickOfTheMonth && !b.PickOfTheMonth {
+		return false
+	}
+	if q.SeriesNumber != 0 && b.SeriesNumber != q.SeriesNumber {
+		return false
+	}
+	return true
+}
+
+func (q Query) hasMinPrice() bool {
+	return !q.MinPrice.Equal(money.Money{})
+}
+
+func (q Query) hasMaxPrice() bool {
+	return !q.MaxPrice.Equal(money.Money{})
+}
+
+// sortKey holds the value a book is sorted by.
+// Only one of Str and Int is used for a given field,
+// except prices that are sorted by currency, then amount.
+type sortKey struct {
+	Str string `json:"s,omitempty"`
+	Int int    `json:"i,omitempty"`
+	ID  string `json:"id"`
+}
+
+func keyOf(b Book, field string) sortKey {
+	k := sortKey{ID: b.ID}
+	switch field {
+	case SortByTitle:
+		k.Str = strings.ToLower(b.Title)
+	case SortByAuthor:
+		if len(b.Authors) > 0 {
+			k.Str = strings.ToLower(b.Authors[0])
+		}
+	case SortByEdition:
+		k.Int = b.Edition
+	case SortByReleaseYear:
+		k.Int = b.ReleaseYear
+	case SortBySeriesNumber:
+		k.Int = b.SeriesNumber
+	case SortByPrice:
+		k.Str, k.Int = string(b.Price.Currency()), int(b.Price.Amount())
+	case SortBySalePrice:
+		p := b.SalePrice()
+		k.Str, k.Int = string(p.Currency()), int(p.Amount())
+	case SortByDiscount:
+		k.Int = b.discount
+	case SortByCategory:
+		k.Int = b.Category()
+	case SortByPickOfTheMonth:
+		if b.PickOfTheMonth {
+			k.Int = 1
+		}
+	}
+	return k
+}
+
+// less reports whether k sorts before other. Ties are
+// broken by ID, which is always ascending.
+func (k sortKey) less(other sortKey, desc bool) bool {
+	if k.Str != other.Str {
+		return (k.Str < other.Str) != desc
+	}
+	if k.Int != other.Int {
+		return (k.Int < other.Int) != desc
+	}
+	return k.ID < other.ID
+}
+
+// cursor identifies the last book of a page.
+type cursor struct {
+	SortBy     string `json:"sort"`
+	Descending bool   `json:"desc,omitempty"`
+	sortKey
+}
+
+func (c cursor) encode() string {
+	data, err := json.Marshal(c)
+	if err != nil {
+		// cursor holds only strings, ints and bools.
+		panic(err)
+	}
+	return base64.RawURLEncoding.EncodeToString(data)
+}
+
+func decodeCursor(s string) (cursor, error) {
+	data, err := base64.RawURLEncoding.DecodeString(s)
+	if err != nil {
+		return cursor{}, fmt.Errorf("%w: %v", ErrInvalidCursor, err)
+	}
+	var c cursor
+	if err := json.Unmarshal(data, &c); err != nil {
+		return cursor{}, fmt.Errorf("%w: %v", ErrInvalidCursor, err)
+	}
+	return c, nil
+}
@@ -0,0 +1,163 @@
+package bookshop_test
+
+import (
+	"errors"
+	"testing"
+
+	"github.com/google/go-cmp/cmp"
+	"github.com/qba73/bookshop/internal/bookshop"
+	"github.com/qba73/bookshop/internal/money"
+)
+
+func newQueryCatalog(t *testing.T) *bookshop.Catalog {
+	t.Helper()
+
+	books := []struct {
+		book     bookshop.Book
+		category int
+		discount int
+	}{
+		{book: bookshop.Book{ID: "a", Title: "Tytus", Authors: []string{"Papcio Chmiel"}, Edition: 1, ReleaseYear: 1957, SeriesNumber: 1, Price: money.New(3000, money.PLN)}, category: bookshop.CategoryRomance, discount: 10},
+		{book: bookshop.Book{ID: "b", Title: "Bolek i Lolek", Authors: []string{"Bolek"}, Edition: 2, ReleaseYear: 1997, SeriesNumber: 1, Price: money.New(2000, money.PLN), PickOfTheMonth: true}, category: bookshop.CategoryTech},
+		{book: bookshop.Book{ID: "c", Title: "Zosia Samosia", Authors: []string{"Papcio Chmiel", "Zigmas Laurin"}, Edition: 1, ReleaseYear: 2011, SeriesNumber: 2, Price: money.New(1000, money.PLN)}, category: bookshop.CategoryRomance},
+		{book: bookshop.Book{ID: "d", Title: "Go in Action", Authors: []string{"Bill Kennedy"}, Edition: 1, ReleaseYear: 2015, Price: money.New(4000, money.PLN), PickOfTheMonth: true}, category: bookshop.CategoryProgramming, discount: 50},
+		{book: bookshop.Book{ID: "e", Title: "Pan Samochodzik", Authors: []string{"Zbigniew Nienacki"}, Edition: 3, ReleaseYear: 1997, SeriesNumber: 2, Price: money.New(2000, money.PLN)}, category: bookshop.CategoryAutobiography},
+	}
+
+	var c bookshop.Catalog
+	for _, tc := range books {
+		b := tc.book
+		if err := b.SetCategory(tc.category); err != nil {
+			t.Fatal(err)
+		}
+		if err := b.SetDiscountPercent(tc.discount); err != nil {
+			t.Fatal(err)
+		}
+		if err := c.AddBook(b); err != nil {
+			t.Fatal(err)
+		}
+	}
+	return &c
+}
+
+func bookIDs(books []bookshop.Book) []string {
+	ids := make([]string, 0, len(books))
+	for _, b := range books {
+		ids = append(ids, b.ID)
+	}
+	return ids
+}
+
+func TestCatalogQuery(t *testing.T) {
+	t.Parallel()
+
+	c := newQueryCatalog(t)
+
+	tt := []struct {
+		name  string
+		query bookshop.Query
+		want  []string
+	}{
+		{name: "All books", query: bookshop.Query{}, want: []string{"a", "b", "c", "d", "e"}},
+		{name: "Category", query: bookshop.Query{Categories: []int{bookshop.CategoryRomance}}, want: []string{"a", "c"}},
+		{name: "Many categories", query: bookshop.Query{Categories: []int{bookshop.CategoryTech, bookshop.CategoryProgramming}}, want: []string{"b", "d"}},
+		{name: "Author", query: bookshop.Query{Author: "papcio chmiel"}, want: []string{"a", "c"}},
+		{name: "Year range", query: bookshop.Query{MinYear: 1990, MaxYear: 2011}, want: []string{"b", "c", "e"}},
+		{name: "Min year", query: bookshop.Query{MinYear: 2000}, want: []string{"c", "d"}},
+		{name: "Sale price range", query: bookshop.Query{MinPrice: money.New(2000, money.PLN), MaxPrice: money.New(2700, money.PLN)}, want: []string{"a", "b", "d", "e"}},
+		{name: "Max sale price", query: bookshop.Query{MaxPrice: money.New(1999, money.PLN)}, want: []string{"c"}},
+		{name: "Edition", query: bookshop.Query{Edition: 1}, want: []string{"a", "c", "d"}},
+		{name: "Pick of the month", query: bookshop.Query{PickOfTheMonth: true}, want: []string{"b", "d"}},
+		{name: "Series", query: bookshop.Query{SeriesNumber: 2}, want: []string{"c", "e"}},
+		{name: "Combined filters", query: bookshop.Query{Author: "Papcio Chmiel", SeriesNumber: 1}, want: []string{"a"}},
+		{name: "No match", query: bookshop.Query{Author: "Nobody"}, want: []string{}},
+		{name: "Sort by title", query: bookshop.Query{SortBy: bookshop.SortByTitle}, want: []string{"b", "d", "e", "a", "c"}},
+		{name: "Sort by author", query: bookshop.Query{SortBy: bookshop.SortByAuthor}, want: []string{"d", "b", "a", "c", "e"}},
+		{name: "Sort by year descending, ties by id", query: bookshop.Query{SortBy: bookshop.SortByReleaseYear, Descending: true}, want: []string{"d", "c", "b", "e", "a"}},
+		{name: "Sort by sale price", query: bookshop.Query{SortBy: bookshop.SortBySalePrice}, want: []string{"c", "b", "d", "e", "a"}},
+		{name: "Sort by list price", query: bookshop.Query{SortBy: bookshop.SortByPrice}, want: []string{"c", "b", "e", "a", "d"}},
+		{name: "Sort by pick of the month", query: bookshop.Query{SortBy: bookshop.SortByPickOfTheMonth, Descending: true}, want: []string{"b", "d", "a", "c", "e"}},
+		{name: "Sort by category", query: bookshop.Query{SortBy: bookshop.SortByCategory}, want: []string{"e", "b", "a", "c", "d"}},
+	}
+
+	for _, tc := range tt {
+		got, err := c.Query(tc.query)
+		if err != nil {
+			t.Fatalf("%s Query() got error: %v", tc.name, err)
+		}
+		if !cmp.Equal(bookIDs(got.Books), tc.want) {
+			t.Errorf("%s Query() \n%s", tc.name, cmp.Diff(tc.want, bookIDs(got.Books)))
+		}
+		if got.Total != len(tc.want) {
+			t.Errorf("%s Query() total = %d, want: %d", tc.name, got.Total, len(tc.want))
+		}
+		if got.NextCursor != "" {
+			t.Errorf("%s Query() single page has next cursor %q", tc.name, got.NextCursor)
+		}
+	}
+}
+
+func TestCatalogQueryPagination(t *testing.T) {
+	t.Parallel()
+
+	c := newQueryCatalog(t)
+	q := bookshop.Query{SortBy: bookshop.SortByReleaseYear, Limit: 2}
+
+	var pages [][]string
+	for {
+		page, err := c.Query(q)
+		if err != nil {
+			t.Fatal(err)
+		}
+		pages = append(pages, bookIDs(page.Books))
+		if page.NextCursor == "" {
+			break
+		}
+		q.Cursor = page.NextCursor
+
+		// A book added before the cursor does not shift later pages.
+		if len(pages) == 1 {
+			if err := c.AddBook(bookshop.Book{ID: "0", Title: "Stary", ReleaseYear: 1900}); err != nil {
+				t.Fatal(err)
+			}
+		}
+	}
+
+	want := [][]string{{"a", "b"}, {"e", "c"}, {"d"}}
+	if !cmp.Equal(pages, want) {
+		t.Errorf("Query() pages \n%s", cmp.Diff(want, pages))
+	}
+}
+
+func TestCatalogQueryInvalid(t *testing.T) {
+	t.Parallel()
+
+	c := newQueryCatalog(t)
+
+	first, err := c.Query(bookshop.Query{SortBy: bookshop.SortByTitle, Limit: 1})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	tt := []struct {
+		name        string
+		query       bookshop.Query
+		expectedErr error
+	}{
+		{name: "Unknown sort field", query: bookshop.Query{SortBy: "description"}, expectedErr: bookshop.ErrInvalidQuery},
+		{name: "Page too large", query: bookshop.Query{Limit: bookshop.MaxPageSize + 1}, expectedErr: bookshop.ErrInvalidQuery},
+		{name: "Negative page size", query: bookshop.Query{Limit: -1}, expectedErr: bookshop.ErrInvalidQuery},
+		{name: "Inverted year range", query: bookshop.Query{MinYear: 2000, MaxYear: 1990}, expectedErr: bookshop.ErrInvalidQuery},
+		{name: "Inverted price range", query: bookshop.Query{MinPrice: money.New(2000, money.PLN), MaxPrice: money.New(100, money.PLN)}, expectedErr: bookshop.ErrInvalidQuery},
+		{name: "Price range in two currencies", query: bookshop.Query{MinPrice: money.New(100, money.PLN), MaxPrice: money.New(2000, money.EUR)}, expectedErr: bookshop.ErrInvalidQuery},
+		{name: "Unknown category", query: bookshop.Query{Categories: []int{42}}, expectedErr: bookshop.ErrCategoryNotFound},
+		{name: "Malformed cursor", query: bookshop.Query{Cursor: "not a cursor"}, expectedErr: bookshop.ErrInvalidCursor},
+		{name: "Cursor for other sort", query: bookshop.Query{SortBy: bookshop.SortByPrice, Cursor: first.NextCursor}, expectedErr: bookshop.ErrInvalidCursor},
+	}
+
+	for _, tc := range tt {
+		if _, err := c.Query(tc.query); !errors.Is(err, tc.expectedErr) {
+			t.Errorf("%s Query() = %v, want: %v", tc.name, err, tc.expectedErr)
+		}
+	}
+}
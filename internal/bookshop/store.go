@@ -0,0 +1,213 @@
+package bookshop
+
+import (
+	"errors"
+	"fmt"
+	"sort"
+	"sync"
+)
+
+var (
+	// ErrBookNotFound is returned by a Store when a book
+	// with the requested ID does not exist.
+	ErrBookNotFound = errors.New("book not found")
+	// ErrBookExists is returned by a Store when a book
+	// with the same ID already exists.
+	ErrBookExists = errors.New("book already exists")
+)
+
+// Store represents a storage for books in the catalog. Books
+// have unique ISBNs, stores return an error matching
+// ErrDuplicateISBN when another book has the ISBN of a book
+// being written.
+type Store interface {
+	// Get returns a book with the given ID.
+	Get(id string) (Book, error)
+	// GetByISBN returns a book with the given ISBN-13.
+	GetByISBN(isbn string) (Book, error)
+	// Put adds a new book or replaces an existing one with the same ID.
+	Put(b Book) error
+	// Create adds a new book. It returns ErrBookExists when
+	// a book with the same ID already exists.
+	Create(b Book) error
+	// Replace replaces an existing book with the same ID. It returns
+	// ErrBookNotFound when the book does not exist.
+	Replace(b Book) error
+	// Delete removes a book with the given ID.
+	Delete(id string) error
+	// List returns all books sorted by ID.
+	List() ([]Book, error)
+}
+
+// MemoryStore is a Store that keeps books in memory.
+// It is safe for concurrent use.
+type MemoryStore struct {
+	mu    sync.RWMutex
+	books bookMap
+}
+
+// NewMemoryStore knows how to construct a MemoryStore
+// seeded with the given books.
+func NewMemoryStore(books map[string]Book) *MemoryStore {
+	var s MemoryStore
+	for _, b := range books {
+		s.books.set(b)
+	}
+	return &s
+}
+
+// Get returns a book with the given ID.
+func (s *MemoryStore) Get(id string) (Book, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	return s.books.get(id)
+}
+
+// GetByISBN returns a book with the given ISBN-13.
+func (s *MemoryStore) GetByISBN(isbn string) (Book, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	return s.books.getByISBN(isbn)
+}
+
+// Put adds a new book or replaces an existing one with the same ID.
+func (s *MemoryStore) Put(b Book) error {
+	if b.ID == "" {
+		return errors.New("invalid book id")
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if err := s.books.checkISBN(b); err != nil {
+		return err
+	}
+	s.books.set(b)
+	return nil
+}
+
+// Create adds a new book. It returns ErrBookExists when
+// a book with the same ID already exists.
+func (s *MemoryStore) Create(b Book) error {
+	if b.ID == "" {
+		return errors.New("invalid book id")
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if _, ok := s.books.books[b.ID]; ok {
+		return fmt.Errorf("book id %s: %w", b.ID, ErrBookExists)
+	}
+	if err := s.books.checkISBN(b); err != nil {
+		return err
+	}
+	s.books.set(b)
+	return nil
+}
+
+// Replace replaces an existing book with the same ID. It returns
+// ErrBookNotFound when the book does not exist.
+func (s *MemoryStore) Replace(b Book) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if _, err := s.books.get(b.ID); err != nil {
+		return err
+	}
+	if err := s.books.checkISBN(b); err != nil {
+		return err
+	}
+	s.books.set(b)
+	return nil
+}
+
+// Delete removes a book with the given ID.
+func (s *MemoryStore) Delete(id string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if _, err := s.books.get(id); err != nil {
+		return err
+	}
+	s.books.remove(id)
+	return nil
+}
+
+// List returns all books sorted by ID.
+func (s *MemoryStore) List() ([]Book, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	return sortedBooks(s.books.books), nil
+}
+
+// bookMap holds books by ID with an index of their ISBNs.
+// The zero value is an empty map ready to use.
+type bookMap struct {
+	books map[string]Book
+	// isbns maps ISBNs to book IDs.
+	isbns map[string]string
+}
+
+func (m *bookMap) get(id string) (Book, error) {
+	b, ok := m.books[id]
+	if !ok {
+		return Book{}, fmt.Errorf("book id %s: %w", id, ErrBookNotFound)
+	}
+	return b, nil
+}
+
+func (m *bookMap) getByISBN(isbn string) (Book, error) {
+	id, ok := m.isbns[isbn]
+	if !ok {
+		return Book{}, fmt.Errorf("isbn %s: %w", isbn, ErrBookNotFound)
+	}
+	return m.books[id], nil
+}
+
+// checkISBN returns an error when another book has the ISBN of b.
+func (m *bookMap) checkISBN(b Book) error {
+	if id, ok := m.isbns[b.ISBN]; ok && b.ISBN != "" && id != b.ID {
+		return fmt.Errorf("isbn %s of book id %s: %w", b.ISBN, id, ErrDuplicateISBN)
+	}
+	return nil
+}
+
+// set adds the book or replaces the book with the same ID.
+func (m *bookMap) set(b Book) {
+	if m.books == nil {
+		m.books = make(map[string]Book)
+		m.isbns = make(map[string]string)
+	}
+	m.remove(b.ID)
+	m.books[b.ID] = b
+	if b.ISBN != "" {
+		m.isbns[b.ISBN] = b.ID
+	}
+}
+
+// remove deletes the book with the ID, if there is one.
+func (m *bookMap) remove(id string) {
+	old, ok := m.books[id]
+	if !ok {
+		return
+	}
+	if m.isbns[old.ISBN] == id {
+		delete(m.isbns, old.ISBN)
+	}
+	delete(m.books, id)
+}
+
+func sortedBooks(books map[string]Book) []Book {
+	bks := make([]Book, 0, len(books))
+	for _, b := range books {
+		bks = append(bks, b)
+	}
+	sort.Slice(bks, func(i, j int) bool {
+		return bks[i].ID < bks[j].ID
+	})
+	return bks
+}
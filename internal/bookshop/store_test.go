@@ -0,0 +1,272 @@
+package bookshop_test
+
+import (
+	"errors"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/google/go-cmp/cmp"
+	"github.com/google/go-cmp/cmp/cmpopts"
+	"github.com/qba73/bookshop/internal/bookshop"
+	"github.com/qba73/bookshop/internal/money"
+)
+
+func TestStores(t *testing.T) {
+	t.Parallel()
+
+	tt := []struct {
+		name     string
+		newStore func(t *testing.T) bookshop.Store
+	}{
+		{name: "Memory store", newStore: func(t *testing.T) bookshop.Store {
+			return bookshop.NewMemoryStore(nil)
+		}},
+		{name: "JSON store", newStore: func(t *testing.T) bookshop.Store {
+			s, err := bookshop.OpenJSONStore(filepath.Join(t.TempDir(), "books.json"))
+			if err != nil {
+				t.Fatal(err)
+			}
+			return s
+		}},
+	}
+
+	for _, tc := range tt {
+		tc := tc
+		t.Run(tc.name, func(t *testing.T) {
+			s := tc.newStore(t)
+
+			if err := s.Put(testBooks["Book4"]); err != nil {
+				t.Fatal(err)
+			}
+			if err := s.Put(testBooks["Book1"]); err != nil {
+				t.Fatal(err)
+			}
+			if err := s.Put(testBooks["Book2"]); err == nil {
+				t.Errorf("%s Put() with empty book id should return error", tc.name)
+			}
+
+			got, err := s.Get(testBooks["Book1"].ID)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if !cmp.Equal(got, testBooks["Book1"], cmpopts.IgnoreUnexported(bookshop.Book{})) {
+				t.Errorf("%s Get() \n%s", tc.name, cmp.Diff(testBooks["Book1"], got, cmpopts.IgnoreUnexported(bookshop.Book{})))
+			}
+
+			books, err := s.List()
+			if err != nil {
+				t.Fatal(err)
+			}
+			want := []bookshop.Book{testBooks["Book1"], testBooks["Book4"]}
+			if !cmp.Equal(books, want, cmpopts.IgnoreUnexported(bookshop.Book{})) {
+				t.Errorf("%s List() \n%s", tc.name, cmp.Diff(want, books, cmpopts.IgnoreUnexported(bookshop.Book{})))
+			}
+
+			if err := s.Delete(testBooks["Book1"].ID); err != nil {
+				t.Fatal(err)
+			}
+			if _, err := s.Get(testBooks["Book1"].ID); !errors.Is(err, bookshop.ErrBookNotFound) {
+				t.Errorf("%s Get() after Delete() = %v, want: %v", tc.name, err, bookshop.ErrBookNotFound)
+			}
+			if err := s.Delete(testBooks["Book1"].ID); !errors.Is(err, bookshop.ErrBookNotFound) {
+				t.Errorf("%s Delete() missing book = %v, want: %v", tc.name, err, bookshop.ErrBookNotFound)
+			}
+
+			if err := s.Create(testBooks["Book1"]); err != nil {
+				t.Fatal(err)
+			}
+			if err := s.Create(testBooks["Book1"]); !errors.Is(err, bookshop.ErrBookExists) {
+				t.Errorf("%s Create() existing book = %v, want: %v", tc.name, err, bookshop.ErrBookExists)
+			}
+			if err := s.Create(testBooks["Book2"]); err == nil {
+				t.Errorf("%s Create() with empty book id should return error", tc.name)
+			}
+
+			b := testBooks["Book1"]
+			b.Title = "Tytus, Romek i A'Tomek"
+			if err := s.Replace(b); err != nil {
+				t.Fatal(err)
+			}
+			if got, err := s.Get(b.ID); err != nil || got.Title != b.Title {
+				t.Errorf("%s Get() after Replace() = %q, %v, want: %q", tc.name, got.Title, err, b.Title)
+			}
+			if err := s.Delete(b.ID); err != nil {
+				t.Fatal(err)
+			}
+			if err := s.Replace(b); !errors.Is(err, bookshop.ErrBookNotFound) {
+				t.Errorf("%s Replace() deleted book = %v, want: %v", tc.name, err, bookshop.ErrBookNotFound)
+			}
+			if _, err := s.Get(b.ID); !errors.Is(err, bookshop.ErrBookNotFound) {
+				t.Errorf("%s Get() after Replace() of deleted book = %v, want: %v", tc.name, err, bookshop.ErrBookNotFound)
+			}
+		})
+	}
+}
+
+func TestStoresISBN(t *testing.T) {
+	t.Parallel()
+
+	tt := []struct {
+		name     string
+		newStore func(t *testing.T) bookshop.Store
+	}{
+		{name: "Memory store", newStore: func(t *testing.T) bookshop.Store {
+			return bookshop.NewMemoryStore(nil)
+		}},
+		{name: "JSON store", newStore: func(t *testing.T) bookshop.Store {
+			s, err := bookshop.OpenJSONStore(filepath.Join(t.TempDir(), "books.json"))
+			if err != nil {
+				t.Fatal(err)
+			}
+			return s
+		}},
+	}
+
+	for _, tc := range tt {
+		tc := tc
+		t.Run(tc.name, func(t *testing.T) {
+			t.Parallel()
+
+			s := tc.newStore(t)
+			b1 := bookshop.Book{ID: "1", Title: "Tytus", ISBN: "9780306406157"}
+			b2 := bookshop.Book{ID: "2", Title: "Zosia", ISBN: "9788324000166"}
+			if err := s.Put(b1); err != nil {
+				t.Fatal(err)
+			}
+			if err := s.Create(b2); err != nil {
+				t.Fatal(err)
+			}
+
+			dup := bookshop.Book{ID: "3", Title: "Kopia", ISBN: b1.ISBN}
+			if err := s.Put(dup); !errors.Is(err, bookshop.ErrDuplicateISBN) {
+				t.Errorf("%s Put() duplicate ISBN = %v, want: %v", tc.name, err, bookshop.ErrDuplicateISBN)
+			}
+			if err := s.Create(dup); !errors.Is(err, bookshop.ErrDuplicateISBN) {
+				t.Errorf("%s Create() duplicate ISBN = %v, want: %v", tc.name, err, bookshop.ErrDuplicateISBN)
+			}
+			b2.ISBN = b1.ISBN
+			if err := s.Put(b2); !errors.Is(err, bookshop.ErrDuplicateISBN) {
+				t.Errorf("%s Put() ISBN of another book = %v, want: %v", tc.name, err, bookshop.ErrDuplicateISBN)
+			}
+
+			// Changing the ISBN of a book frees its old ISBN.
+			b1.ISBN = "9791090636071"
+			if err := s.Put(b1); err != nil {
+				t.Fatal(err)
+			}
+			if _, err := s.GetByISBN("9780306406157"); !errors.Is(err, bookshop.ErrBookNotFound) {
+				t.Errorf("%s GetByISBN() old ISBN = %v, want: %v", tc.name, err, bookshop.ErrBookNotFound)
+			}
+			got, err := s.GetByISBN("9791090636071")
+			if err != nil {
+				t.Fatal(err)
+			}
+			if got.ID != b1.ID {
+				t.Errorf("%s GetByISBN() = book %s, want: %s", tc.name, got.ID, b1.ID)
+			}
+			if err := s.Create(dup); err != nil {
+				t.Errorf("%s Create() with freed ISBN got error: %v", tc.name, err)
+			}
+
+			// Deleting a book frees its ISBN.
+			if err := s.Delete(b1.ID); err != nil {
+				t.Fatal(err)
+			}
+			if _, err := s.GetByISBN(b1.ISBN); !errors.Is(err, bookshop.ErrBookNotFound) {
+				t.Errorf("%s GetByISBN() after Delete() = %v, want: %v", tc.name, err, bookshop.ErrBookNotFound)
+			}
+			b2.ISBN = b1.ISBN
+			if err := s.Put(b2); err != nil {
+				t.Errorf("%s Put() with freed ISBN got error: %v", tc.name, err)
+			}
+		})
+	}
+}
+
+func TestOpenJSONStoreDuplicateISBN(t *testing.T) {
+	t.Parallel()
+
+	path := filepath.Join(t.TempDir(), "books.json")
+	data := `[
+  {"id": "1", "title": "Tytus", "isbn": "9780306406157"},
+  {"id": "2", "title": "Kopia", "isbn": "9780306406157"}
+]`
+	if err := os.WriteFile(path, []byte(data), 0600); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := bookshop.OpenJSONStore(path); !errors.Is(err, bookshop.ErrDuplicateISBN) {
+		t.Errorf("OpenJSONStore() = %v, want: %v", err, bookshop.ErrDuplicateISBN)
+	}
+}
+
+func TestJSONStorePersistence(t *testing.T) {
+	t.Parallel()
+
+	path := filepath.Join(t.TempDir(), "books.json")
+
+	s, err := bookshop.OpenJSONStore(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	b := testBooks["Book1"]
+	if err := b.SetDiscountPercent(25); err != nil {
+		t.Fatal(err)
+	}
+	if err := b.SetCategory(bookshop.CategoryProgramming); err != nil {
+		t.Fatal(err)
+	}
+	if err := s.Put(b); err != nil {
+		t.Fatal(err)
+	}
+
+	reopened, err := bookshop.OpenJSONStore(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	got, err := reopened.Get(b.ID)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if !cmp.Equal(got, b, cmp.AllowUnexported(bookshop.Book{})) {
+		t.Errorf("reopened store Get() \n%s", cmp.Diff(b, got, cmp.AllowUnexported(bookshop.Book{})))
+	}
+
+	if want := money.New(1500, money.PLN); got.SalePrice() != want {
+		t.Errorf("SalePrice() = %v, want: %v", got.SalePrice(), want)
+	}
+}
+
+func TestNewCatalogWithJSONStore(t *testing.T) {
+	t.Parallel()
+
+	path := filepath.Join(t.TempDir(), "books.json")
+
+	s, err := bookshop.OpenJSONStore(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	c := bookshop.NewCatalog(s)
+	if err := c.AddBook(testBooks["Book4"]); err != nil {
+		t.Fatal(err)
+	}
+
+	reopened, err := bookshop.OpenJSONStore(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	got, err := bookshop.GetAllByAuthor("Gizmo", reopened)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	want := []string{testBooks["Book4"].ID}
+	if !cmp.Equal(got, want) {
+		t.Errorf("GetAllByAuthor() \n%s", cmp.Diff(want, got))
+	}
+}
@@ -0,0 +1,377 @@
+// Package checkout turns a draft order into a paid one.
+package checkout
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sync"
+	"time"
+
+	"github.com/qba73/bookshop/internal/bookshop"
+	"github.com/qba73/bookshop/internal/bookshop/order"
+	"github.com/qba73/bookshop/internal/coupon"
+	"github.com/qba73/bookshop/internal/money"
+	"github.com/qba73/bookshop/internal/payment"
+	"github.com/qba73/bookshop/internal/promo"
+	"github.com/qba73/bookshop/internal/tax"
+)
+
+var (
+	// ErrEmptyOrder is returned when an order has no items.
+	ErrEmptyOrder = errors.New("order has no items")
+	// ErrMissingIdempotencyKey is returned when checkout is
+	// requested without an idempotency key.
+	ErrMissingIdempotencyKey = errors.New("missing idempotency key")
+	// ErrNoCoupons is returned when an order with a coupon is
+	// checked out by a service that does not redeem coupons.
+	ErrNoCoupons = errors.New("coupons are not accepted")
+	// ErrReconcile is returned when it is not known whether the
+	// customer was charged, for example when a capture times out
+	// and the payment can be neither voided nor refunded. The order
+	// stays placed with its stock reserved until it is reconciled
+	// with the payment provider.
+	ErrReconcile = errors.New("payment needs reconciliation")
+)
+
+// Reserver holds stock for an order while it is being paid.
+type Reserver interface {
+	// Reserve holds stock for all items of the order.
+	// It reserves either all items or none of them.
+	Reserve(orderID string, items []order.Item) error
+	// Release returns stock held for the order.
+	Release(orderID string) error
+	// Commit turns stock held for the order into a sale.
+	Commit(orderID string) error
+}
+
+// Customers is the interface that wraps the Customer method
+// of bookshop.CustomerStore.
+type Customers interface {
+	Customer(id string) (bookshop.Customer, error)
+}
+
+// Receipt describes a completed checkout.
+type Receipt struct {
+	OrderID       string
+	TransactionID string
+	Total         money.Money
+}
+
+// Service knows how to check out orders. Repeated calls with
+// the same idempotency key return the outcome of the first call
+// without charging the customer again. It is safe for concurrent use.
+type Service struct {
+	store    bookshop.Store
+	stock    Reserver
+	payments payment.Gateway
+
+	promotions *promo.Engine
+	coupons    *coupon.Service
+	taxes      *tax.Calculator
+	customers  Customers
+
+	mu      sync.Mutex
+	results map[string]*result
+}
+
+// result is the outcome of a checkout shared by calls with
+// the same idempotency key. done is closed once it is known.
+type result struct {
+	done    chan struct{}
+	orderID string
+	receipt Receipt
+	err     error
+}
+
+// NewService knows how to construct a checkout service using
+// the catalog store for prices, the reserver for stock and the
+// gateway for payments.
+func NewService(store bookshop.Store, stock Reserver, payments payment.Gateway) *Service {
+	return &Service{
+		store:    store,
+		stock:    stock,
+		payments: payments,
+		results:  make(map[string]*result),
+	}
+}
+
+// SetPromotions sets the engine applying promotions to orders
+// at checkout. Without it orders are charged catalog sale prices.
+func (s *Service) SetPromotions(e *promo.Engine) {
+	s.promotions = e
+}
+
+// SetCoupons sets the service redeeming coupons of orders.
+// Without it orders with a coupon code cannot be checked out.
+func (s *Service) SetCoupons(c *coupon.Service) {
+	s.coupons = c
+}
+
+// SetTaxes sets the calculator recording tax of orders when they are
+// placed, for customers looked up in customers. Guest orders are
+// taxed in the home country. Without it orders are placed untaxed.
+func (s *Service) SetTaxes(taxes *tax.Calculator, customers Customers) {
+	s.taxes = taxes
+	s.customers = customers
+}
+
+// Checkout knows how to place and pay for a draft order.
+//
+// Item prices are recomputed from the catalog, so prices supplied
+// by the caller are never charged. Promotions running at checkout
+// and the order coupon are recorded as order adjustments. An order
+// with a coupon that cannot be redeemed stays a draft and the error
+// matches coupon.ErrRejected, explaining the reason. Tax of the order
+// is recorded before it is placed, see SetTaxes, and added to the
+// amount charged when prices do not include it. The order is placed only when
+// stock for all items is reserved, otherwise it stays a draft.
+// When payment fails the reservation is released, the
+// authorization voided and the order cancelled. An authorization
+// that failed other than by a decline is looked up by the
+// idempotency key and voided, as it may have gone through. A capture that
+// may have gone through is refunded before the order is cancelled,
+// and so is a payment for stock that can no longer be committed,
+// for example because the reservation expired. When the payment
+// cannot be reversed the order stays placed and the error matches
+// ErrReconcile. On success the order is marked as paid.
+func (s *Service) Checkout(ctx context.Context, o *order.Order, idempotencyKey string) (Receipt, error) {
+	if idempotencyKey == "" {
+		return Receipt{}, ErrMissingIdempotencyKey
+	}
+
+	s.mu.Lock()
+	r, ok := s.results[idempotencyKey]
+	if !ok {
+		r = &result{done: make(chan struct{}), orderID: o.ID()}
+		s.results[idempotencyKey] = r
+	}
+	s.mu.Unlock()
+
+	if ok {
+		select {
+		case <-r.done:
+		case <-ctx.Done():
+			return Receipt{}, ctx.Err()
+		}
+		if r.orderID != o.ID() {
+			return Receipt{}, fmt.Errorf("key %s: %w", idempotencyKey, payment.ErrIdempotencyMismatch)
+		}
+		return r.receipt, r.err
+	}
+
+	r.receipt, r.err = s.checkout(ctx, o, idempotencyKey)
+	close(r.done)
+
+	// An order that could not be placed is still a draft. Forget
+	// the outcome so it can be checked out again once fixed.
+	if r.err != nil && o.CurrentStatus() == order.StatusDraft {
+		s.mu.Lock()
+		delete(s.results, idempotencyKey)
+		s.mu.Unlock()
+	}
+	return r.receipt, r.err
+}
+
+func (s *Service) checkout(ctx context.Context, o *order.Order, key string) (Receipt, error) {
+	if len(o.Items) == 0 {
+		return Receipt{}, fmt.Errorf("order %s: %w", o.ID(), ErrEmptyOrder)
+	}
+	if err := s.reprice(o); err != nil {
+		return Receipt{}, err
+	}
+	now := time.Now()
+	if s.promotions != nil {
+		if _, err := s.promotions.Apply(o, now); err != nil {
+			return Receipt{}, err
+		}
+	}
+	if o.CouponCode != "" {
+		if s.coupons == nil {
+			return Receipt{}, fmt.Errorf("order %s: coupon %s: %w", o.ID(), o.CouponCode, ErrNoCoupons)
+		}
+		if _, err := s.coupons.Apply(o, o.CouponCode, now); err != nil {
+			return Receipt{}, fmt.Errorf("order %s: %w", o.ID(), err)
+		}
+	}
+	if err := s.assess(o); err != nil {
+		return Receipt{}, err
+	}
+	total, err := s.total(o)
+	if err != nil {
+		return Receipt{}, err
+	}
+
+	if err := s.stock.Reserve(o.ID(), o.Items); err != nil {
+		return Receipt{}, fmt.Errorf("order %s: reserving stock: %w", o.ID(), err)
+	}
+	if s.coupons != nil {
+		if err := s.coupons.Redeem(o, now); err != nil {
+			if rerr := s.release(o); rerr != nil {
+				err = fmt.Errorf("%w (rollback: %v)", err, rerr)
+			}
+			return Receipt{}, fmt.Errorf("order %s: %w", o.ID(), err)
+		}
+	}
+	if err := o.Place(); err != nil {
+		for _, rerr := range []error{s.release(o), s.cancelCoupon(o)} {
+			if rerr != nil {
+				err = fmt.Errorf("%w (rollback: %v)", err, rerr)
+			}
+		}
+		return Receipt{}, err
+	}
+
+	tx, err := s.payments.Authorize(ctx, payment.AuthorizeRequest{
+		OrderID:        o.ID(),
+		Amount:         total,
+		IdempotencyKey: key,
+	})
+	if err != nil {
+		err = fmt.Errorf("authorizing payment: %w", err)
+		// Unless the payment was declined, the gateway may have
+		// authorized it with the response lost.
+		if !errors.Is(err, payment.ErrDeclined) {
+			if verr := s.voidAuthorization(ctx, key); verr != nil {
+				return Receipt{}, fmt.Errorf("order %s: key %s: %w: %v (void: %v)", o.ID(), key, ErrReconcile, err, verr)
+			}
+		}
+		return Receipt{}, s.abort(o, err, s.release(o), s.cancelCoupon(o))
+	}
+
+	if _, err := s.payments.Capture(ctx, tx.ID, tx.Authorized); err != nil {
+		err = fmt.Errorf("capturing payment: %w", err)
+		// The capture may have gone through with its response lost,
+		// in which case the authorization can no longer be voided.
+		if _, verr := s.payments.Void(ctx, tx.ID); verr != nil {
+			if rerr := s.refund(ctx, tx); rerr != nil {
+				return Receipt{}, fmt.Errorf("order %s: transaction %s: %w: %v (void: %v, refund: %v)", o.ID(), tx.ID, ErrReconcile, err, verr, rerr)
+			}
+		}
+		return Receipt{}, s.abort(o, err, s.release(o), s.cancelCoupon(o))
+	}
+
+	if err := s.stock.Commit(o.ID()); err != nil {
+		err = fmt.Errorf("committing stock: %w", err)
+		if rerr := s.refund(ctx, tx); rerr != nil {
+			return Receipt{}, fmt.Errorf("order %s: transaction %s: %w: %v (refund: %v)", o.ID(), tx.ID, ErrReconcile, err, rerr)
+		}
+		return Receipt{}, s.abort(o, err, s.release(o), s.cancelCoupon(o))
+	}
+	o.Paid = tx.Authorized
+	if err := o.Pay(); err != nil {
+		return Receipt{}, err
+	}
+
+	return Receipt{
+		OrderID:       o.ID(),
+		TransactionID: tx.ID,
+		Total:         tx.Authorized,
+	}, nil
+}
+
+// reprice replaces order items with prices taken from the catalog.
+func (s *Service) reprice(o *order.Order) error {
+	items, adj := o.Items, o.Adjustments
+	o.Items = nil
+	for _, it := range items {
+		b, err := s.store.Get(it.BookID)
+		if err == nil {
+			err = o.AddBook(b, it.Quantity)
+		}
+		if err != nil {
+			o.Items, o.Adjustments = items, adj
+			return err
+		}
+	}
+	return nil
+}
+
+// assess records tax of the order sold to its customer.
+func (s *Service) assess(o *order.Order) error {
+	if s.taxes == nil {
+		return nil
+	}
+	var c bookshop.Customer
+	if o.CustomerID != "" {
+		var err error
+		if c, err = s.customers.Customer(o.CustomerID); err != nil {
+			return fmt.Errorf("order %s: %w", o.ID(), err)
+		}
+	}
+	return s.taxes.Assess(o, c)
+}
+
+// total returns the amount to charge for the order, including
+// tax recorded on the order when prices do not include it.
+func (s *Service) total(o *order.Order) (money.Money, error) {
+	if o.Tax == nil {
+		total, err := o.Total()
+		if err != nil {
+			return money.Money{}, fmt.Errorf("order %s: %w", o.ID(), err)
+		}
+		return total, nil
+	}
+	bd, err := tax.Order(o)
+	if err != nil {
+		return money.Money{}, err
+	}
+	return bd.Gross, nil
+}
+
+// refund returns the whole authorized amount of the transaction.
+func (s *Service) refund(ctx context.Context, tx payment.Transaction) error {
+	if _, err := s.payments.Refund(ctx, tx.ID, tx.Authorized); err != nil {
+		return fmt.Errorf("refunding payment: %w", err)
+	}
+	return nil
+}
+
+func (s *Service) release(o *order.Order) error {
+	if err := s.stock.Release(o.ID()); err != nil {
+		return fmt.Errorf("releasing stock: %w", err)
+	}
+	return nil
+}
+
+// cancelCoupon cancels redemption of the order coupon.
+func (s *Service) cancelCoupon(o *order.Order) error {
+	if s.coupons == nil {
+		return nil
+	}
+	if err := s.coupons.Cancel(o); err != nil {
+		return fmt.Errorf("cancelling coupon: %w", err)
+	}
+	return nil
+}
+
+// voidAuthorization voids the payment authorized with the
+// idempotency key, if there is one.
+func (s *Service) voidAuthorization(ctx context.Context, key string) error {
+	tx, err := s.payments.Lookup(ctx, key)
+	if errors.Is(err, payment.ErrTransactionNotFound) {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+	if tx.Status != payment.StatusAuthorized {
+		return nil
+	}
+	_, err = s.payments.Void(ctx, tx.ID)
+	return err
+}
+
+// abort cancels the order and returns err annotated with
+// errors from the rollback steps.
+func (s *Service) abort(o *order.Order, err error, rollback ...error) error {
+	if cerr := o.Cancel(); cerr != nil {
+		rollback = append(rollback, cerr)
+	}
+	for _, rerr := range rollback {
+		if rerr != nil {
+			err = fmt.Errorf("%w (rollback: %v)", err, rerr)
+		}
+	}
+	return fmt.Errorf("order %s: %w", o.ID(), err)
+}
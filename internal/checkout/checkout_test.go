@@ -0,0 +1,495 @@
+package checkout_test
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/google/go-cmp/cmp"
+	"github.com/qba73/bookshop/internal/bookshop"
+	"github.com/qba73/bookshop/internal/bookshop/order"
+	"github.com/qba73/bookshop/internal/checkout"
+	"github.com/qba73/bookshop/internal/coupon"
+	"github.com/qba73/bookshop/internal/inventory"
+	"github.com/qba73/bookshop/internal/money"
+	"github.com/qba73/bookshop/internal/payment"
+	"github.com/qba73/bookshop/internal/promo"
+	"github.com/qba73/bookshop/internal/tax"
+)
+
+const (
+	bolekID = "1912bbf7-3f26-4196-b062-071b81b855e9"
+	tytusID = "1912abf7-3f26-4196-b062-011b81b255e9"
+)
+
+// stubStock is a Reserver holding stock counts per book id.
+type stubStock struct {
+	mu       sync.Mutex
+	onHand   map[string]int
+	reserved map[string][]order.Item
+	sold     map[string]int
+}
+
+func newStubStock(onHand map[string]int) *stubStock {
+	return &stubStock{
+		onHand:   onHand,
+		reserved: make(map[string][]order.Item),
+		sold:     make(map[string]int),
+	}
+}
+
+func (s *stubStock) Reserve(orderID string, items []order.Item) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	for _, it := range items {
+		if s.onHand[it.BookID] < it.Quantity {
+			return fmt.Errorf("book %s out of stock", it.BookID)
+		}
+	}
+	for _, it := range items {
+		s.onHand[it.BookID] -= it.Quantity
+	}
+	s.reserved[orderID] = items
+	return nil
+}
+
+func (s *stubStock) Release(orderID string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	for _, it := range s.reserved[orderID] {
+		s.onHand[it.BookID] += it.Quantity
+	}
+	delete(s.reserved, orderID)
+	return nil
+}
+
+func (s *stubStock) Commit(orderID string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	for _, it := range s.reserved[orderID] {
+		s.sold[it.BookID] += it.Quantity
+	}
+	delete(s.reserved, orderID)
+	return nil
+}
+
+func newOrder(t *testing.T, id string, items ...order.Item) *order.Order {
+	t.Helper()
+
+	o, err := order.New(id)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, it := range items {
+		if err := o.AddItem(it); err != nil {
+			t.Fatal(err)
+		}
+	}
+	return o
+}
+
+func TestCheckout(t *testing.T) {
+	t.Parallel()
+
+	tt := []struct {
+		name        string
+		items       []order.Item
+		faults      []payment.Fault
+		want        checkout.Receipt
+		wantStatus  order.Status
+		wantOnHand  map[string]int
+		wantSold    map[string]int
+		wantTx      payment.Status
+		expectedErr bool
+		wantErr     error
+	}{
+		{
+			// Caller supplied prices are ignored, catalog sale prices are charged:
+			// 2 x 1600 for Bolek i Lolek and 1 x 2700 for Tytus.
+			name:       "Successful checkout",
+			items:      []order.Item{{BookID: bolekID, Quantity: 2, ListPrice: money.New(1, money.PLN), UnitPrice: money.New(1, money.PLN)}, {BookID: tytusID, Quantity: 1}},
+			want:       checkout.Receipt{OrderID: "12282", TransactionID: "tx-1", Total: money.New(5900, money.PLN)},
+			wantStatus: order.StatusPaid,
+			wantOnHand: map[string]int{bolekID: 1, tytusID: 0},
+			wantSold:   map[string]int{bolekID: 2, tytusID: 1},
+			wantTx:     payment.StatusCaptured,
+		},
+		{
+			name:        "Out of stock",
+			items:       []order.Item{{BookID: bolekID, Quantity: 4}},
+			wantStatus:  order.StatusDraft,
+			wantOnHand:  map[string]int{bolekID: 3, tytusID: 1},
+			wantSold:    map[string]int{},
+			expectedErr: true,
+		},
+		{
+			name:        "Unknown book",
+			items:       []order.Item{{BookID: "missing", Quantity: 1}},
+			wantStatus:  order.StatusDraft,
+			wantOnHand:  map[string]int{bolekID: 3, tytusID: 1},
+			wantSold:    map[string]int{},
+			expectedErr: true,
+		},
+		{
+			name:        "Payment declined",
+			items:       []order.Item{{BookID: bolekID, Quantity: 1}},
+			faults:      []payment.Fault{{Op: payment.OpAuthorize, Err: payment.ErrDeclined}},
+			wantStatus:  order.StatusCancelled,
+			wantOnHand:  map[string]int{bolekID: 3, tytusID: 1},
+			wantSold:    map[string]int{},
+			expectedErr: true,
+			wantErr:     payment.ErrDeclined,
+		},
+		{
+			name:        "Authorize timeout",
+			items:       []order.Item{{BookID: bolekID, Quantity: 1}},
+			faults:      []payment.Fault{{Op: payment.OpAuthorize, Err: payment.ErrTimeout}},
+			wantStatus:  order.StatusCancelled,
+			wantOnHand:  map[string]int{bolekID: 3, tytusID: 1},
+			wantSold:    map[string]int{},
+			expectedErr: true,
+			wantErr:     payment.ErrTimeout,
+		},
+		{
+			// The payment was authorized but the response was lost,
+			// so the authorization is found by the key and voided.
+			name:        "Authorize timeout after authorization",
+			items:       []order.Item{{BookID: bolekID, Quantity: 1}},
+			faults:      []payment.Fault{{Op: payment.OpAuthorize, Err: payment.ErrTimeout, Applied: true}},
+			wantStatus:  order.StatusCancelled,
+			wantOnHand:  map[string]int{bolekID: 3, tytusID: 1},
+			wantSold:    map[string]int{},
+			wantTx:      payment.StatusVoided,
+			expectedErr: true,
+			wantErr:     payment.ErrTimeout,
+		},
+		{
+			name:  "Authorize timeout after authorization, void failed",
+			items: []order.Item{{BookID: bolekID, Quantity: 1}},
+			faults: []payment.Fault{
+				{Op: payment.OpAuthorize, Err: payment.ErrTimeout, Applied: true},
+				{Op: payment.OpVoid, Err: payment.ErrTimeout},
+			},
+			wantStatus:  order.StatusPlaced,
+			wantOnHand:  map[string]int{bolekID: 2, tytusID: 1},
+			wantSold:    map[string]int{},
+			wantTx:      payment.StatusAuthorized,
+			expectedErr: true,
+			wantErr:     checkout.ErrReconcile,
+		},
+		{
+			name:        "Capture timeout",
+			items:       []order.Item{{BookID: bolekID, Quantity: 1}},
+			faults:      []payment.Fault{{Op: payment.OpCapture, Err: payment.ErrTimeout}},
+			wantStatus:  order.StatusCancelled,
+			wantOnHand:  map[string]int{bolekID: 3, tytusID: 1},
+			wantSold:    map[string]int{},
+			wantTx:      payment.StatusVoided,
+			expectedErr: true,
+			wantErr:     payment.ErrTimeout,
+		},
+		{
+			// The capture went through but its response was lost,
+			// so the authorization cannot be voided and is refunded.
+			name:        "Capture timeout after charge",
+			items:       []order.Item{{BookID: bolekID, Quantity: 1}},
+			faults:      []payment.Fault{{Op: payment.OpCapture, Err: payment.ErrTimeout, Applied: true}},
+			wantStatus:  order.StatusCancelled,
+			wantOnHand:  map[string]int{bolekID: 3, tytusID: 1},
+			wantSold:    map[string]int{},
+			wantTx:      payment.StatusRefunded,
+			expectedErr: true,
+			wantErr:     payment.ErrTimeout,
+		},
+		{
+			name:  "Capture timeout after charge, refund failed",
+			items: []order.Item{{BookID: bolekID, Quantity: 1}},
+			faults: []payment.Fault{
+				{Op: payment.OpCapture, Err: payment.ErrTimeout, Applied: true},
+				{Op: payment.OpRefund, Err: payment.ErrTimeout},
+			},
+			wantStatus:  order.StatusPlaced,
+			wantOnHand:  map[string]int{bolekID: 2, tytusID: 1},
+			wantSold:    map[string]int{},
+			wantTx:      payment.StatusCaptured,
+			expectedErr: true,
+			wantErr:     checkout.ErrReconcile,
+		},
+	}
+
+	for _, tc := range tt {
+		tc := tc
+		t.Run(tc.name, func(t *testing.T) {
+			stock := newStubStock(map[string]int{bolekID: 3, tytusID: 1})
+			gw := payment.NewFakeGateway()
+			gw.Inject(tc.faults...)
+			svc := checkout.NewService(bookshop.NewMemoryStore(bookshop.Books), stock, gw)
+
+			o := newOrder(t, "12282", tc.items...)
+
+			got, err := svc.Checkout(context.Background(), o, "key-1")
+			if (err != nil) != tc.expectedErr {
+				t.Fatalf("%s Checkout() got error: %v", tc.name, err)
+			}
+			if tc.wantErr != nil && !errors.Is(err, tc.wantErr) {
+				t.Errorf("%s Checkout() = %v, want: %v", tc.name, err, tc.wantErr)
+			}
+
+			if !cmp.Equal(got, tc.want) {
+				t.Errorf("%s Checkout() \n%s", tc.name, cmp.Diff(tc.want, got))
+			}
+			if s := o.CurrentStatus(); s != tc.wantStatus {
+				t.Errorf("%s order status = %s, want: %s", tc.name, s, tc.wantStatus)
+			}
+			if !cmp.Equal(stock.onHand, tc.wantOnHand) {
+				t.Errorf("%s stock on hand \n%s", tc.name, cmp.Diff(tc.wantOnHand, stock.onHand))
+			}
+			if !cmp.Equal(stock.sold, tc.wantSold) {
+				t.Errorf("%s stock sold \n%s", tc.name, cmp.Diff(tc.wantSold, stock.sold))
+			}
+
+			if tx, ok := gw.Transaction("tx-1"); ok && tx.Status != tc.wantTx {
+				t.Errorf("%s transaction status = %s, want: %s", tc.name, tx.Status, tc.wantTx)
+			}
+		})
+	}
+}
+
+func TestCheckoutIdempotent(t *testing.T) {
+	t.Parallel()
+
+	stock := newStubStock(map[string]int{bolekID: 10})
+	gw := payment.NewFakeGateway()
+	svc := checkout.NewService(bookshop.NewMemoryStore(bookshop.Books), stock, gw)
+
+	o := newOrder(t, "12282", order.Item{BookID: bolekID, Quantity: 1})
+
+	// Simulate a double click: concurrent checkouts of the same order.
+	const clicks = 5
+	receipts := make([]checkout.Receipt, clicks)
+	errs := make([]error, clicks)
+
+	var wg sync.WaitGroup
+	for i := 0; i < clicks; i++ {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			receipts[i], errs[i] = svc.Checkout(context.Background(), o, "key-1")
+		}(i)
+	}
+	wg.Wait()
+
+	for i := range receipts {
+		if errs[i] != nil {
+			t.Fatalf("Checkout() click %d got error: %v", i, errs[i])
+		}
+		if !cmp.Equal(receipts[i], receipts[0]) {
+			t.Errorf("Checkout() click %d \n%s", i, cmp.Diff(receipts[0], receipts[i]))
+		}
+	}
+
+	if n := gw.Calls(payment.OpAuthorize); n != 1 {
+		t.Errorf("Authorize() called %d times, want: 1", n)
+	}
+	if n := gw.Calls(payment.OpCapture); n != 1 {
+		t.Errorf("Capture() called %d times, want: 1", n)
+	}
+	if stock.sold[bolekID] != 1 {
+		t.Errorf("sold %d copies, want: 1", stock.sold[bolekID])
+	}
+
+	other := newOrder(t, "12283", order.Item{BookID: bolekID, Quantity: 1})
+	if _, err := svc.Checkout(context.Background(), other, "key-1"); !errors.Is(err, payment.ErrIdempotencyMismatch) {
+		t.Errorf("Checkout() other order with used key = %v, want: %v", err, payment.ErrIdempotencyMismatch)
+	}
+}
+
+func TestCheckoutPromotions(t *testing.T) {
+	t.Parallel()
+
+	store := bookshop.NewMemoryStore(bookshop.Books)
+	svc := checkout.NewService(store, newStubStock(map[string]int{bolekID: 3, tytusID: 1}), payment.NewFakeGateway())
+	e, err := promo.NewEngine(store, promo.Rule{ID: "tytus", Name: "Tytus week", Kind: promo.KindPercent, Percent: 10, BookIDs: []string{tytusID}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	svc.SetPromotions(e)
+
+	o := newOrder(t, "12282", order.Item{BookID: bolekID, Quantity: 2}, order.Item{BookID: tytusID, Quantity: 1})
+	got, err := svc.Checkout(context.Background(), o, "key-1")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want := money.New(5630, money.PLN); got.Total != want {
+		t.Errorf("Checkout() total = %v, want: %v", got.Total, want)
+	}
+	want := []order.Adjustment{{BookID: tytusID, Source: "tytus", Description: "Tytus week", Amount: money.New(270, money.PLN)}}
+	if !cmp.Equal(want, o.Adjustments) {
+		t.Errorf("order adjustments \n%s", cmp.Diff(want, o.Adjustments))
+	}
+}
+
+func TestCheckoutTaxes(t *testing.T) {
+	t.Parallel()
+
+	customers, err := bookshop.NewMemoryCustomerStore(bookshop.Customer{
+		ID: "hans", Name: "Hans Müller", Email: "hans@example.com",
+		Billing: bookshop.Address{Street: "Hauptstraße 5", City: "München", Postcode: "80331", Country: "DE"},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	tt := []struct {
+		name       string
+		customerID string
+		want       order.Tax
+	}{
+		{name: "Guest", want: order.Tax{Country: "PL", PricesIncludeTax: true, Rates: map[string]int{bolekID: 500}}},
+		{name: "Export", customerID: "hans", want: order.Tax{Country: "DE", PricesIncludeTax: true, Rates: map[string]int{bolekID: 0}}},
+	}
+	for _, tc := range tt {
+		tc := tc
+		t.Run(tc.name, func(t *testing.T) {
+			t.Parallel()
+
+			store := bookshop.NewMemoryStore(bookshop.Books)
+			taxes, err := tax.NewCalculator(tax.PL, store)
+			if err != nil {
+				t.Fatal(err)
+			}
+			svc := checkout.NewService(store, newStubStock(map[string]int{bolekID: 1}), payment.NewFakeGateway())
+			svc.SetTaxes(taxes, customers)
+
+			o := newOrder(t, "12282", order.Item{BookID: bolekID, Quantity: 1})
+			o.CustomerID = tc.customerID
+			if _, err := svc.Checkout(context.Background(), o, "key-1"); err != nil {
+				t.Fatal(err)
+			}
+			if o.Tax == nil {
+				t.Fatal("order tax not recorded")
+			}
+			if !cmp.Equal(tc.want, *o.Tax) {
+				t.Error(cmp.Diff(tc.want, *o.Tax))
+			}
+		})
+	}
+}
+
+func TestCheckoutCoupons(t *testing.T) {
+	t.Parallel()
+
+	books := bookshop.NewMemoryStore(bookshop.Books)
+	coupons, err := coupon.NewMemoryStore(coupon.Coupon{Code: "ONCE", Description: "10% off", Percent: 10, MaxUses: 1})
+	if err != nil {
+		t.Fatal(err)
+	}
+	gw := payment.NewFakeGateway()
+	svc := checkout.NewService(books, newStubStock(map[string]int{bolekID: 10}), gw)
+
+	o := newOrder(t, "12282", order.Item{BookID: bolekID, Quantity: 1})
+	o.CouponCode = "ONCE"
+	if _, err := svc.Checkout(context.Background(), o, "key-1"); !errors.Is(err, checkout.ErrNoCoupons) {
+		t.Errorf("Checkout() without coupon service = %v, want: %v", err, checkout.ErrNoCoupons)
+	}
+	svc.SetCoupons(coupon.NewService(coupons, books))
+
+	// A declined payment cancels the redemption.
+	gw.Inject(payment.Fault{Op: payment.OpAuthorize, Err: payment.ErrDeclined})
+	if _, err := svc.Checkout(context.Background(), o, "key-1"); !errors.Is(err, payment.ErrDeclined) {
+		t.Fatalf("Checkout() = %v, want: %v", err, payment.ErrDeclined)
+	}
+	if rs, err := coupons.Redemptions("ONCE"); err != nil || len(rs) != 0 {
+		t.Errorf("Redemptions() after declined payment = %v, %v", rs, err)
+	}
+
+	paid := newOrder(t, "12283", order.Item{BookID: bolekID, Quantity: 1})
+	paid.CouponCode = "once"
+	got, err := svc.Checkout(context.Background(), paid, "key-2")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want := money.New(1440, money.PLN); got.Total != want {
+		t.Errorf("Checkout() total = %v, want: %v", got.Total, want)
+	}
+
+	again := newOrder(t, "12284", order.Item{BookID: bolekID, Quantity: 1})
+	again.CouponCode = "ONCE"
+	_, err = svc.Checkout(context.Background(), again, "key-3")
+	var rejected *coupon.RejectedError
+	if !errors.As(err, &rejected) || rejected.Reason != coupon.ReasonUsedUp {
+		t.Errorf("Checkout() with used coupon = %v, want reason: %q", err, coupon.ReasonUsedUp)
+	}
+	if s := again.CurrentStatus(); s != order.StatusDraft {
+		t.Errorf("order with rejected coupon status = %s, want: %s", s, order.StatusDraft)
+	}
+}
+
+func TestCheckoutInvalidRequest(t *testing.T) {
+	t.Parallel()
+
+	svc := checkout.NewService(bookshop.NewMemoryStore(bookshop.Books), newStubStock(map[string]int{}), payment.NewFakeGateway())
+
+	tt := []struct {
+		name        string
+		order       *order.Order
+		key         string
+		expectedErr error
+	}{
+		{name: "Missing key", order: newOrder(t, "1", order.Item{BookID: bolekID, Quantity: 1}), key: "", expectedErr: checkout.ErrMissingIdempotencyKey},
+		{name: "Empty order", order: newOrder(t, "2"), key: "key-2", expectedErr: checkout.ErrEmptyOrder},
+	}
+
+	for _, tc := range tt {
+		if _, err := svc.Checkout(context.Background(), tc.order, tc.key); !errors.Is(err, tc.expectedErr) {
+			t.Errorf("%s Checkout() = %v, want: %v", tc.name, err, tc.expectedErr)
+		}
+	}
+}
+
+// expiringGateway runs expire before capturing payments,
+// like a customer taking too long to pay.
+type expiringGateway struct {
+	payment.Gateway
+	expire func()
+}
+
+func (g expiringGateway) Capture(ctx context.Context, txID string, amount money.Money) (payment.Transaction, error) {
+	g.expire()
+	return g.Gateway.Capture(ctx, txID, amount)
+}
+
+func TestCheckoutReservationExpired(t *testing.T) {
+	t.Parallel()
+
+	now := time.Date(2021, time.January, 10, 12, 0, 0, 0, time.UTC)
+	stock := inventory.New(inventory.NewMemoryStore(), 10*time.Minute)
+	stock.Now = func() time.Time { return now }
+	if err := stock.Restock(bolekID, 1); err != nil {
+		t.Fatal(err)
+	}
+	fake := payment.NewFakeGateway()
+	gw := expiringGateway{Gateway: fake, expire: func() { now = now.Add(time.Hour) }}
+	svc := checkout.NewService(bookshop.NewMemoryStore(bookshop.Books), stock, gw)
+
+	o := newOrder(t, "12282", order.Item{BookID: bolekID, Quantity: 1})
+	_, err := svc.Checkout(context.Background(), o, "key-1")
+	if !errors.Is(err, inventory.ErrReservationNotFound) {
+		t.Fatalf("Checkout() = %v, want: %v", err, inventory.ErrReservationNotFound)
+	}
+	if s := o.CurrentStatus(); s != order.StatusCancelled {
+		t.Errorf("order status = %s, want: %s", s, order.StatusCancelled)
+	}
+	if tx, _ := fake.Transaction("tx-1"); tx.Status != payment.StatusRefunded {
+		t.Errorf("transaction status = %s, want: %s", tx.Status, payment.StatusRefunded)
+	}
+	if l, err := stock.Level(bolekID); err != nil || l.OnHand != 1 || l.Reserved != 0 {
+		t.Errorf("stock level = %+v, want 1 on hand and none reserved", l)
+	}
+}
@@ -0,0 +1,177 @@
+// Package coupon handles promo codes customers redeem with orders.
+package coupon
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/qba73/bookshop/internal/money"
+)
+
+var (
+	// ErrNotFound is returned by a Store when a coupon
+	// with the requested code does not exist.
+	ErrNotFound = errors.New("coupon not found")
+	// ErrInvalidCoupon is returned when a coupon definition is not valid.
+	ErrInvalidCoupon = errors.New("invalid coupon")
+	// ErrRejected is matched by errors returned when a coupon
+	// cannot be redeemed with an order.
+	ErrRejected = errors.New("coupon rejected")
+)
+
+// Reason explains why a coupon was rejected.
+type Reason string
+
+// Reasons of rejecting coupons.
+const (
+	ReasonUnknown         Reason = "unknown code"
+	ReasonNotStarted      Reason = "not valid yet"
+	ReasonExpired         Reason = "expired"
+	ReasonUsedUp          Reason = "no uses left"
+	ReasonCustomerLimit   Reason = "customer limit reached"
+	ReasonMissingCustomer Reason = "customer required"
+	ReasonMinimumBasket   Reason = "basket below minimum"
+	ReasonCurrency        Reason = "different currency"
+	ReasonNoEligibleItems Reason = "no eligible items"
+)
+
+// RejectedError is returned when a coupon cannot
+// be redeemed with an order.
+type RejectedError struct {
+	Code   string
+	Reason Reason
+	// Detail adds information to the reason, for
+	// example the minimum basket value.
+	Detail string
+}
+
+// Error implements error interface for the RejectedError.
+func (e *RejectedError) Error() string {
+	msg := fmt.Sprintf("coupon %s rejected: %s", e.Code, e.Reason)
+	if e.Detail != "" {
+		msg += ": " + e.Detail
+	}
+	return msg
+}
+
+// Is reports whether the error matches ErrRejected.
+func (e *RejectedError) Is(target error) bool {
+	return target == ErrRejected
+}
+
+// Coupon describes a promo code. A coupon takes either Percent
+// percent or Amount off the value of eligible books in the order.
+type Coupon struct {
+	Code        string `json:"code"`
+	Description string `json:"description"`
+
+	Percent int         `json:"percent,omitempty"`
+	Amount  money.Money `json:"amount"`
+
+	// MaxUses limits how many times the coupon can be redeemed,
+	// 1 for single use coupons. Zero means no limit.
+	MaxUses int `json:"max_uses,omitempty"`
+	// PerCustomer limits how many times a customer can redeem the
+	// coupon. Zero means no limit, otherwise guest orders cannot
+	// redeem the coupon.
+	PerCustomer int `json:"per_customer,omitempty"`
+
+	// Starts and Expires bound the time the coupon can be redeemed,
+	// from Starts until, but not including, Expires. Zero times
+	// leave it open.
+	Starts  time.Time `json:"starts"`
+	Expires time.Time `json:"expires"`
+
+	// MinBasket is the minimum order total, after promotions,
+	// the coupon can be redeemed with.
+	MinBasket money.Money `json:"min_basket"`
+	// Categories restrict the coupon to books in any of the
+	// categories or their subcategories. Empty means all books.
+	Categories []int `json:"categories,omitempty"`
+}
+
+// Redemption records a coupon redeemed with an order.
+type Redemption struct {
+	Code       string      `json:"code"`
+	OrderID    string      `json:"order_id"`
+	CustomerID string      `json:"customer_id,omitempty"`
+	Amount     money.Money `json:"amount"`
+	At         time.Time   `json:"at"`
+}
+
+// Normalize returns the code as stored, promo codes
+// are not case sensitive.
+func Normalize(code string) string {
+	return strings.ToUpper(strings.TrimSpace(code))
+}
+
+// Validate returns an error when the coupon is not valid.
+func (c Coupon) Validate() error {
+	if c.Code == "" || c.Code != Normalize(c.Code) || strings.ContainsAny(c.Code, " \t\n") {
+		return fmt.Errorf("%w: invalid code %q", ErrInvalidCoupon, c.Code)
+	}
+	switch {
+	case c.Percent != 0 && !c.Amount.IsZero():
+		return fmt.Errorf("%w %s: both percent and amount off", ErrInvalidCoupon, c.Code)
+	case c.Percent != 0:
+		if c.Percent < 0 || c.Percent > 100 {
+			return fmt.Errorf("%w %s: invalid percent: %d", ErrInvalidCoupon, c.Code, c.Percent)
+		}
+	case !c.Amount.IsPositive() || c.Amount.Currency() == "":
+		return fmt.Errorf("%w %s: invalid amount: %v", ErrInvalidCoupon, c.Code, c.Amount)
+	}
+	if c.MaxUses < 0 || c.PerCustomer < 0 {
+		return fmt.Errorf("%w %s: negative limit", ErrInvalidCoupon, c.Code)
+	}
+	if c.MinBasket.IsNegative() || (!c.MinBasket.IsZero() && c.MinBasket.Currency() == "") {
+		return fmt.Errorf("%w %s: invalid minimum basket: %v", ErrInvalidCoupon, c.Code, c.MinBasket)
+	}
+	if !c.Starts.IsZero() && !c.Expires.IsZero() && !c.Expires.After(c.Starts) {
+		return fmt.Errorf("%w %s: expires before it starts", ErrInvalidCoupon, c.Code)
+	}
+	return nil
+}
+
+// Active returns an error when the coupon cannot be redeemed at the time.
+func (c Coupon) Active(at time.Time) error {
+	if !c.Starts.IsZero() && at.Before(c.Starts) {
+		return c.reject(ReasonNotStarted, "starts "+c.Starts.Format(time.RFC3339))
+	}
+	if !c.Expires.IsZero() && !at.Before(c.Expires) {
+		return c.reject(ReasonExpired, "expired "+c.Expires.Format(time.RFC3339))
+	}
+	return nil
+}
+
+// CanRedeem returns an error when redeeming the coupon with r would
+// go over its limits, given past redemptions of the coupon.
+// Past redemptions with the same order are not counted, so
+// redeeming a coupon with an order again is allowed.
+func (c Coupon) CanRedeem(past []Redemption, r Redemption) error {
+	if c.PerCustomer > 0 && r.CustomerID == "" {
+		return c.reject(ReasonMissingCustomer, "")
+	}
+	var uses, customerUses int
+	for _, p := range past {
+		if p.OrderID == r.OrderID {
+			continue
+		}
+		uses++
+		if p.CustomerID != "" && p.CustomerID == r.CustomerID {
+			customerUses++
+		}
+	}
+	if c.MaxUses > 0 && uses >= c.MaxUses {
+		return c.reject(ReasonUsedUp, "")
+	}
+	if c.PerCustomer > 0 && customerUses >= c.PerCustomer {
+		return c.reject(ReasonCustomerLimit, fmt.Sprintf("redeemed %d times", customerUses))
+	}
+	return nil
+}
+
+func (c Coupon) reject(reason Reason, detail string) error {
+	return &RejectedError{Code: c.Code, Reason: reason, Detail: detail}
+}
@@ -0,0 +1,273 @@
+package coupon_test
+
+import (
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/google/go-cmp/cmp"
+	"github.com/qba73/bookshop/internal/bookshop"
+	"github.com/qba73/bookshop/internal/bookshop/order"
+	"github.com/qba73/bookshop/internal/coupon"
+	"github.com/qba73/bookshop/internal/money"
+)
+
+var now = time.Date(2021, time.June, 15, 12, 0, 0, 0, time.UTC)
+
+func pln(minor int64) money.Money {
+	return money.New(minor, money.PLN)
+}
+
+// newOrder returns an order of a tech book for 40.00 PLN and
+// two copies of a romance for 20.00 PLN, and the catalog of both.
+func newOrder(t *testing.T, customerID string) (*order.Order, *bookshop.MemoryStore) {
+	t.Helper()
+
+	books := bookshop.NewMemoryStore(nil)
+	o, err := order.New("12282")
+	if err != nil {
+		t.Fatal(err)
+	}
+	o.CustomerID = customerID
+	for _, v := range []struct {
+		id       string
+		price    int64
+		category int
+		quantity int
+	}{
+		{id: "tech", price: 4000, category: bookshop.CategoryTech, quantity: 1},
+		{id: "romance", price: 2000, category: bookshop.CategoryRomance, quantity: 2},
+	} {
+		b := bookshop.Book{ID: v.id, Title: v.id, Price: pln(v.price)}
+		if err := b.SetCategory(v.category); err != nil {
+			t.Fatal(err)
+		}
+		if err := books.Put(b); err != nil {
+			t.Fatal(err)
+		}
+		if err := o.AddBook(b, v.quantity); err != nil {
+			t.Fatal(err)
+		}
+	}
+	return o, books
+}
+
+func TestService_Apply(t *testing.T) {
+	t.Parallel()
+
+	tt := []struct {
+		name      string
+		coupon    coupon.Coupon
+		code      string
+		customer  string
+		past      []coupon.Redemption
+		want      money.Money
+		wantTotal money.Money
+		reason    coupon.Reason
+	}{
+		{name: "Percent off", coupon: coupon.Coupon{Code: "SAVE", Percent: 10}, want: pln(800), wantTotal: pln(7200)},
+		{name: "Code in lower case", coupon: coupon.Coupon{Code: "SAVE", Percent: 10}, code: " save ", want: pln(800), wantTotal: pln(7200)},
+		{name: "Amount off", coupon: coupon.Coupon{Code: "SAVE", Amount: pln(1000)}, want: pln(1000), wantTotal: pln(7000)},
+		{name: "Amount larger than the order", coupon: coupon.Coupon{Code: "SAVE", Amount: pln(10000)}, want: pln(8000), wantTotal: pln(0)},
+		{name: "Category restriction", coupon: coupon.Coupon{Code: "SAVE", Percent: 50, Categories: []int{bookshop.CategoryTech}}, want: pln(2000), wantTotal: pln(6000)},
+		{name: "Minimum basket met", coupon: coupon.Coupon{Code: "SAVE", Percent: 10, MinBasket: pln(8000)}, want: pln(800), wantTotal: pln(7200)},
+		{name: "Unknown code", coupon: coupon.Coupon{Code: "SAVE", Percent: 10}, code: "FREE", reason: coupon.ReasonUnknown},
+		{name: "Expired", coupon: coupon.Coupon{Code: "SAVE", Percent: 10, Expires: now}, reason: coupon.ReasonExpired},
+		{name: "Not started", coupon: coupon.Coupon{Code: "SAVE", Percent: 10, Starts: now.Add(time.Hour)}, reason: coupon.ReasonNotStarted},
+		{name: "Below minimum basket", coupon: coupon.Coupon{Code: "SAVE", Percent: 10, MinBasket: pln(8001)}, reason: coupon.ReasonMinimumBasket},
+		{name: "Minimum basket in other currency", coupon: coupon.Coupon{Code: "SAVE", Percent: 10, MinBasket: money.New(1000, money.EUR)}, reason: coupon.ReasonCurrency},
+		{name: "Amount in other currency", coupon: coupon.Coupon{Code: "SAVE", Amount: money.New(1000, money.EUR)}, reason: coupon.ReasonCurrency},
+		{name: "No eligible items", coupon: coupon.Coupon{Code: "SAVE", Percent: 10, Categories: []int{bookshop.CategoryProgramming}}, reason: coupon.ReasonNoEligibleItems},
+		{
+			name:   "Single use coupon used",
+			coupon: coupon.Coupon{Code: "SAVE", Percent: 10, MaxUses: 1},
+			past:   []coupon.Redemption{{Code: "SAVE", OrderID: "1", CustomerID: "anna"}},
+			reason: coupon.ReasonUsedUp,
+		},
+		{
+			name:      "Multi use coupon",
+			coupon:    coupon.Coupon{Code: "SAVE", Percent: 10, MaxUses: 2},
+			past:      []coupon.Redemption{{Code: "SAVE", OrderID: "1", CustomerID: "anna"}},
+			want:      pln(800),
+			wantTotal: pln(7200),
+		},
+		{
+			name:     "Customer limit reached",
+			coupon:   coupon.Coupon{Code: "SAVE", Percent: 10, PerCustomer: 1},
+			customer: "anna",
+			past:     []coupon.Redemption{{Code: "SAVE", OrderID: "1", CustomerID: "anna"}, {Code: "SAVE", OrderID: "2", CustomerID: "jan"}},
+			reason:   coupon.ReasonCustomerLimit,
+		},
+		{
+			name:      "Customer limit of other customer",
+			coupon:    coupon.Coupon{Code: "SAVE", Percent: 10, PerCustomer: 1},
+			customer:  "jan",
+			past:      []coupon.Redemption{{Code: "SAVE", OrderID: "1", CustomerID: "anna"}},
+			want:      pln(800),
+			wantTotal: pln(7200),
+		},
+		{name: "Guest order with customer limit", coupon: coupon.Coupon{Code: "SAVE", Percent: 10, PerCustomer: 1}, reason: coupon.ReasonMissingCustomer},
+	}
+
+	for _, tc := range tt {
+		o, books := newOrder(t, tc.customer)
+		store, err := coupon.NewMemoryStore(tc.coupon)
+		if err != nil {
+			t.Fatalf("%s, NewMemoryStore() got error: %v", tc.name, err)
+		}
+		for _, r := range tc.past {
+			if err := store.Redeem(r); err != nil {
+				t.Fatal(err)
+			}
+		}
+		code := tc.code
+		if code == "" {
+			code = tc.coupon.Code
+		}
+
+		got, err := coupon.NewService(store, books).Apply(o, code, now)
+		var rejected *coupon.RejectedError
+		if errors.As(err, &rejected) {
+			if rejected.Reason != tc.reason {
+				t.Errorf("%s, Apply() rejected for %q, want: %q", tc.name, rejected.Reason, tc.reason)
+			}
+			if !errors.Is(err, coupon.ErrRejected) {
+				t.Errorf("%s, Apply() error %v should match %v", tc.name, err, coupon.ErrRejected)
+			}
+			if o.CouponCode != "" || len(o.Adjustments) != 0 {
+				t.Errorf("%s, rejected coupon changed the order", tc.name)
+			}
+			continue
+		}
+		if err != nil || tc.reason != "" {
+			t.Fatalf("%s, Apply() got error: %v, want reason: %q", tc.name, err, tc.reason)
+		}
+		if got != tc.want {
+			t.Errorf("%s, Apply() = %v, want: %v", tc.name, got, tc.want)
+		}
+		if total, err := o.Total(); err != nil || total != tc.wantTotal {
+			t.Errorf("%s, order Total() = %v, %v, want: %v", tc.name, total, err, tc.wantTotal)
+		}
+		if o.CouponCode != "SAVE" {
+			t.Errorf("%s, order coupon code = %q, want: SAVE", tc.name, o.CouponCode)
+		}
+	}
+}
+
+func TestService_ApplyAfterPromotions(t *testing.T) {
+	t.Parallel()
+
+	o, books := newOrder(t, "")
+	store, err := coupon.NewMemoryStore(
+		coupon.Coupon{Code: "TEN", Description: "10% off", Percent: 10},
+		coupon.Coupon{Code: "FIVE", Description: "5 PLN off", Amount: pln(500)},
+	)
+	if err != nil {
+		t.Fatal(err)
+	}
+	s := coupon.NewService(store, books)
+
+	promotion := order.Adjustment{BookID: "tech", Source: "spring", Amount: pln(1000)}
+	if err := o.SetAdjustments([]order.Adjustment{promotion}); err != nil {
+		t.Fatal(err)
+	}
+	if got, err := s.Apply(o, "TEN", now); err != nil || got != pln(700) {
+		t.Errorf("Apply(TEN) = %v, %v, want: %v", got, err, pln(700))
+	}
+
+	// Applying another coupon replaces the first one.
+	if _, err := s.Apply(o, "FIVE", now); err != nil {
+		t.Fatal(err)
+	}
+	want := []order.Adjustment{
+		promotion,
+		{BookID: "tech", Source: "coupon:FIVE", Description: "5 PLN off", Amount: pln(215)},
+		{BookID: "romance", Source: "coupon:FIVE", Description: "5 PLN off", Amount: pln(285)},
+	}
+	if !cmp.Equal(want, o.Adjustments) {
+		t.Errorf("order adjustments \n%s", cmp.Diff(want, o.Adjustments))
+	}
+	if d, err := coupon.Discount(o); err != nil || d != pln(500) {
+		t.Errorf("Discount() = %v, %v, want: %v", d, err, pln(500))
+	}
+
+	if err := s.Remove(o); err != nil {
+		t.Fatal(err)
+	}
+	if want := []order.Adjustment{promotion}; !cmp.Equal(want, o.Adjustments) || o.CouponCode != "" {
+		t.Errorf("Remove() left adjustments %v and code %q", o.Adjustments, o.CouponCode)
+	}
+}
+
+func TestService_Redeem(t *testing.T) {
+	t.Parallel()
+
+	store, err := coupon.NewMemoryStore(coupon.Coupon{Code: "ONCE", Percent: 10, MaxUses: 1})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	first, books := newOrder(t, "anna")
+	s := coupon.NewService(store, books)
+	if _, err := s.Apply(first, "once", now); err != nil {
+		t.Fatal(err)
+	}
+
+	// The coupon is redeemed by another order after it was applied.
+	second, _ := newOrder(t, "jan")
+	second.OrderID = "12283"
+	if _, err := s.Apply(second, "ONCE", now); err != nil {
+		t.Fatal(err)
+	}
+	if err := s.Redeem(second, now); err != nil {
+		t.Fatal(err)
+	}
+	if err := s.Redeem(first, now); !errors.Is(err, coupon.ErrRejected) {
+		t.Errorf("Redeem() of used coupon = %v, want: %v", err, coupon.ErrRejected)
+	}
+
+	if err := s.Cancel(second); err != nil {
+		t.Fatal(err)
+	}
+	if err := s.Redeem(first, now); err != nil {
+		t.Errorf("Redeem() after cancel got error: %v", err)
+	}
+	got, err := store.Redemptions("ONCE")
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := []coupon.Redemption{{Code: "ONCE", OrderID: "12282", CustomerID: "anna", Amount: pln(800), At: now}}
+	if !cmp.Equal(want, got) {
+		t.Errorf("Redemptions() \n%s", cmp.Diff(want, got))
+	}
+}
+
+func TestCoupon_Validate(t *testing.T) {
+	t.Parallel()
+
+	tt := []struct {
+		name        string
+		coupon      coupon.Coupon
+		expectedErr bool
+	}{
+		{name: "Percent off", coupon: coupon.Coupon{Code: "SAVE10", Percent: 10}},
+		{name: "Amount off", coupon: coupon.Coupon{Code: "SAVE10", Amount: pln(1000)}},
+		{name: "Lower case code", coupon: coupon.Coupon{Code: "save10", Percent: 10}, expectedErr: true},
+		{name: "Code with spaces", coupon: coupon.Coupon{Code: "SAVE 10", Percent: 10}, expectedErr: true},
+		{name: "No discount", coupon: coupon.Coupon{Code: "SAVE10"}, expectedErr: true},
+		{name: "Percent and amount", coupon: coupon.Coupon{Code: "SAVE10", Percent: 10, Amount: pln(1000)}, expectedErr: true},
+		{name: "Percent over 100", coupon: coupon.Coupon{Code: "SAVE10", Percent: 110}, expectedErr: true},
+		{name: "Negative limit", coupon: coupon.Coupon{Code: "SAVE10", Percent: 10, MaxUses: -1}, expectedErr: true},
+		{name: "Expires before it starts", coupon: coupon.Coupon{Code: "SAVE10", Percent: 10, Starts: now, Expires: now.Add(-time.Hour)}, expectedErr: true},
+	}
+
+	for _, tc := range tt {
+		err := tc.coupon.Validate()
+		if (err != nil) != tc.expectedErr {
+			t.Errorf("%s, Validate() got error: %v", tc.name, err)
+		}
+		if err != nil && !errors.Is(err, coupon.ErrInvalidCoupon) {
+			t.Errorf("%s, Validate() = %v, want: %v", tc.name, err, coupon.ErrInvalidCoupon)
+		}
+	}
+}
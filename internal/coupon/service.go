@@ -0,0 +1,276 @@
+package coupon
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/qba73/bookshop/internal/bookshop"
+	"github.com/qba73/bookshop/internal/bookshop/order"
+	"github.com/qba73/bookshop/internal/money"
+)
+
+// SourcePrefix starts the source of order adjustments made by
+// coupons, followed by the coupon code, for example coupon:SPRING.
+const SourcePrefix = "coupon:"
+
+// Books looks up books ordered by customers,
+// for example a bookshop.Store.
+type Books interface {
+	Get(id string) (bookshop.Book, error)
+}
+
+// Service knows how to apply coupons to orders and track
+// their redemptions.
+type Service struct {
+	store    Store
+	books    Books
+	taxonomy *bookshop.Taxonomy
+}
+
+// NewService knows how to construct a service keeping coupons
+// in the store and looking up ordered books in books.
+func NewService(store Store, books Books) *Service {
+	return &Service{store: store, books: books}
+}
+
+// SetTaxonomy sets the taxonomy used to match books in
+// subcategories of coupon categories.
+func (s *Service) SetTaxonomy(t *bookshop.Taxonomy) {
+	s.taxonomy = t
+}
+
+// Apply knows how to apply the coupon to the order at the given time.
+// The discount is added to order adjustments and the order remembers
+// the code, replacing a coupon applied before. Coupons discount what
+// is left after promotions, so they must be applied after them.
+//
+// Apply returns the discount, or an error matching ErrRejected,
+// a *RejectedError, when the coupon cannot be used with the order.
+// Limits of uses are checked again when the coupon is redeemed.
+func (s *Service) Apply(o *order.Order, code string, at time.Time) (money.Money, error) {
+	code = Normalize(code)
+	c, err := s.store.Coupon(code)
+	if errors.Is(err, ErrNotFound) {
+		return money.Money{}, &RejectedError{Code: code, Reason: ReasonUnknown}
+	}
+	if err != nil {
+		return money.Money{}, err
+	}
+	if err := c.Active(at); err != nil {
+		return money.Money{}, err
+	}
+	past, err := s.store.Redemptions(code)
+	if err != nil {
+		return money.Money{}, err
+	}
+	if err := c.CanRedeem(past, Redemption{Code: code, OrderID: o.ID(), CustomerID: o.CustomerID}); err != nil {
+		return money.Money{}, err
+	}
+
+	// Adjustments of the order without a coupon applied before.
+	var adj []order.Adjustment
+	for _, a := range o.Adjustments {
+		if !strings.HasPrefix(a.Source, SourcePrefix) {
+			adj = append(adj, a)
+		}
+	}
+	discounts, err := s.discounts(c, o, adj)
+	if err != nil {
+		return money.Money{}, err
+	}
+
+	var total money.Money
+	for _, it := range o.Items {
+		d := discounts[it.BookID]
+		if !d.IsPositive() {
+			continue
+		}
+		adj = append(adj, order.Adjustment{
+			BookID:      it.BookID,
+			Source:      SourcePrefix + c.Code,
+			Description: c.Description,
+			Amount:      d,
+		})
+		if total, err = total.Add(d); err != nil {
+			return money.Money{}, err
+		}
+	}
+	if err := o.SetAdjustments(adj); err != nil {
+		return money.Money{}, err
+	}
+	o.CouponCode = c.Code
+	return total, nil
+}
+
+// Remove knows how to remove the coupon from the order.
+func (s *Service) Remove(o *order.Order) error {
+	var adj []order.Adjustment
+	for _, a := range o.Adjustments {
+		if !strings.HasPrefix(a.Source, SourcePrefix) {
+			adj = append(adj, a)
+		}
+	}
+	if err := o.SetAdjustments(adj); err != nil {
+		return err
+	}
+	o.CouponCode = ""
+	return nil
+}
+
+// Discount returns the amount the coupon applied to the order
+// takes off its total.
+func Discount(o *order.Order) (money.Money, error) {
+	var total money.Money
+	for _, a := range o.Adjustments {
+		if !strings.HasPrefix(a.Source, SourcePrefix) {
+			continue
+		}
+		var err error
+		if total, err = total.Add(a.Amount); err != nil {
+			return money.Money{}, err
+		}
+	}
+	return total, nil
+}
+
+// Redeem knows how to record redemption of the coupon applied to
+// the order. It returns an error matching ErrRejected when the
+// coupon has no uses left, for example when it was redeemed by
+// another order since it was applied. Orders without a coupon
+// are not recorded.
+func (s *Service) Redeem(o *order.Order, at time.Time) error {
+	if o.CouponCode == "" {
+		return nil
+	}
+	amount, err := Discount(o)
+	if err != nil {
+		return err
+	}
+	return s.store.Redeem(Redemption{
+		Code:       o.CouponCode,
+		OrderID:    o.ID(),
+		CustomerID: o.CustomerID,
+		Amount:     amount,
+		At:         at,
+	})
+}
+
+// Cancel knows how to cancel redemption of the coupon with the
+// order, for example when the order could not be paid, so the
+// coupon can be used again.
+func (s *Service) Cancel(o *order.Order) error {
+	if o.CouponCode == "" {
+		return nil
+	}
+	return s.store.Cancel(o.CouponCode, o.ID())
+}
+
+// discounts returns amounts the coupon takes off order lines,
+// keyed by book ID, given adjustments made by promotions.
+func (s *Service) discounts(c Coupon, o *order.Order, adj []order.Adjustment) (map[string]money.Money, error) {
+	left := make(map[string]money.Money, len(o.Items))
+	var basket money.Money
+	for _, it := range o.Items {
+		total, err := it.Total()
+		if err != nil {
+			return nil, err
+		}
+		for _, a := range adj {
+			if a.BookID != it.BookID {
+				continue
+			}
+			if total, err = total.Sub(a.Amount); err != nil {
+				return nil, err
+			}
+		}
+		left[it.BookID] = total
+		if basket, err = basket.Add(total); err != nil {
+			return nil, err
+		}
+	}
+
+	if !c.MinBasket.IsZero() {
+		cmp, err := basket.Cmp(c.MinBasket)
+		if errors.Is(err, money.ErrCurrencyMismatch) {
+			return nil, c.reject(ReasonCurrency, fmt.Sprintf("minimum basket in %s", c.MinBasket.Currency()))
+		}
+		if err != nil {
+			return nil, err
+		}
+		if cmp < 0 {
+			return nil, c.reject(ReasonMinimumBasket, fmt.Sprintf("order total %v, minimum %v", basket, c.MinBasket))
+		}
+	}
+
+	var eligible []order.Item
+	var value money.Money
+	for _, it := range o.Items {
+		if !left[it.BookID].IsPositive() {
+			continue
+		}
+		ok, err := s.eligible(c, it.BookID)
+		if err != nil {
+			return nil, err
+		}
+		if !ok {
+			continue
+		}
+		eligible = append(eligible, it)
+		if value, err = value.Add(left[it.BookID]); err != nil {
+			return nil, err
+		}
+	}
+	if len(eligible) == 0 {
+		return nil, c.reject(ReasonNoEligibleItems, "")
+	}
+
+	discounts := make(map[string]money.Money, len(eligible))
+	if c.Percent > 0 {
+		for _, it := range eligible {
+			d, err := left[it.BookID].Percent(int64(c.Percent), money.RoundDown)
+			if err != nil {
+				return nil, err
+			}
+			discounts[it.BookID] = d
+		}
+		return discounts, nil
+	}
+
+	amount := c.Amount
+	cmp, err := amount.Cmp(value)
+	if errors.Is(err, money.ErrCurrencyMismatch) {
+		return nil, c.reject(ReasonCurrency, fmt.Sprintf("coupon in %s", c.Amount.Currency()))
+	}
+	if err != nil {
+		return nil, err
+	}
+	if cmp > 0 {
+		amount = value
+	}
+	weights := make([]int64, len(eligible))
+	for i, it := range eligible {
+		weights[i] = left[it.BookID].Amount()
+	}
+	parts, err := amount.Allocate(weights...)
+	if err != nil {
+		return nil, err
+	}
+	for i, it := range eligible {
+		discounts[it.BookID] = parts[i]
+	}
+	return discounts, nil
+}
+
+// eligible reports whether the coupon applies to the book.
+func (s *Service) eligible(c Coupon, bookID string) (bool, error) {
+	if len(c.Categories) == 0 {
+		return true, nil
+	}
+	b, err := s.books.Get(bookID)
+	if err != nil {
+		return false, err
+	}
+	return b.InCategory(s.taxonomy.Expand(c.Categories...)...), nil
+}
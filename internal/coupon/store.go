@@ -0,0 +1,129 @@
+package coupon
+
+import (
+	"fmt"
+	"sort"
+	"sync"
+)
+
+// Store represents a storage for coupons and their redemptions.
+type Store interface {
+	// Coupon returns a coupon with the given code.
+	Coupon(code string) (Coupon, error)
+	// PutCoupon adds a new coupon or replaces an existing one
+	// with the same code.
+	PutCoupon(c Coupon) error
+	// Redemptions returns redemptions of the coupon, oldest first.
+	Redemptions(code string) ([]Redemption, error)
+	// Redeem records the redemption, provided the coupon
+	// limits allow it, see Coupon.CanRedeem. It replaces
+	// a redemption of the coupon with the same order.
+	Redeem(r Redemption) error
+	// Cancel removes the redemption of the coupon with the order.
+	Cancel(code, orderID string) error
+}
+
+// MemoryStore is a Store that keeps coupons in memory.
+// It is safe for concurrent use.
+type MemoryStore struct {
+	mu          sync.Mutex
+	coupons     map[string]Coupon
+	redemptions map[string][]Redemption
+}
+
+// NewMemoryStore knows how to construct a MemoryStore
+// holding the given coupons.
+func NewMemoryStore(coupons ...Coupon) (*MemoryStore, error) {
+	s := MemoryStore{
+		coupons:     make(map[string]Coupon),
+		redemptions: make(map[string][]Redemption),
+	}
+	for _, c := range coupons {
+		if err := s.PutCoupon(c); err != nil {
+			return nil, err
+		}
+	}
+	return &s, nil
+}
+
+// Coupon returns a coupon with the given code.
+func (s *MemoryStore) Coupon(code string) (Coupon, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	c, ok := s.coupons[Normalize(code)]
+	if !ok {
+		return Coupon{}, fmt.Errorf("coupon %s: %w", code, ErrNotFound)
+	}
+	return c, nil
+}
+
+// PutCoupon adds a new coupon or replaces an existing one
+// with the same code.
+func (s *MemoryStore) PutCoupon(c Coupon) error {
+	if err := c.Validate(); err != nil {
+		return err
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.coupons[c.Code] = c
+	return nil
+}
+
+// Redemptions returns redemptions of the coupon, oldest first.
+func (s *MemoryStore) Redemptions(code string) ([]Redemption, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	return append([]Redemption(nil), s.redemptions[Normalize(code)]...), nil
+}
+
+// Redeem records the redemption, provided the coupon limits allow it.
+func (s *MemoryStore) Redeem(r Redemption) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	c, ok := s.coupons[r.Code]
+	if !ok {
+		return fmt.Errorf("coupon %s: %w", r.Code, ErrNotFound)
+	}
+	past := s.redemptions[r.Code]
+	if err := c.CanRedeem(past, r); err != nil {
+		return err
+	}
+	s.redemptions[r.Code] = Record(past, r)
+	return nil
+}
+
+// Cancel removes the redemption of the coupon with the order.
+func (s *MemoryStore) Cancel(code, orderID string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	code = Normalize(code)
+	s.redemptions[code] = Remove(s.redemptions[code], orderID)
+	return nil
+}
+
+// Record returns redemptions with r added, replacing a redemption
+// with the same order, sorted oldest first. It helps implementing
+// Store.Redeem.
+func Record(past []Redemption, r Redemption) []Redemption {
+	rs := append(Remove(past, r.OrderID), r)
+	sort.SliceStable(rs, func(i, j int) bool { return rs[i].At.Before(rs[j].At) })
+	return rs
+}
+
+// Remove returns redemptions without the redemption with the order.
+// It helps implementing Store.Cancel.
+func Remove(past []Redemption, orderID string) []Redemption {
+	rs := make([]Redemption, 0, len(past)+1)
+	for _, p := range past {
+		if p.OrderID != orderID {
+			rs = append(rs, p)
+		}
+	}
+	return rs
+}
@@ -0,0 +1,326 @@
+// Package inventory tracks how many copies of each book the bookshop has.
+package inventory
+
+import (
+	"errors"
+	"fmt"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/qba73/bookshop/internal/bookshop"
+	"github.com/qba73/bookshop/internal/bookshop/order"
+)
+
+// DefaultReservationTTL is how long stock stays reserved
+// for an order that is neither committed nor released.
+const DefaultReservationTTL = 15 * time.Minute
+
+var (
+	// ErrOutOfStock is matched by errors returned when there are
+	// not enough available copies of a book.
+	ErrOutOfStock = errors.New("out of stock")
+	// ErrReservationNotFound is returned when an order has
+	// no active reservation.
+	ErrReservationNotFound = errors.New("reservation not found")
+)
+
+// OutOfStockError is returned when an order asks for more
+// copies of a book than are available.
+type OutOfStockError struct {
+	BookID    string
+	Requested int
+	Available int
+}
+
+// Error implements error interface for the OutOfStockError.
+func (e *OutOfStockError) Error() string {
+	return fmt.Sprintf("book %s: requested %d, available %d", e.BookID, e.Requested, e.Available)
+}
+
+// Is reports whether the error matches ErrOutOfStock.
+func (e *OutOfStockError) Is(target error) bool {
+	return target == ErrOutOfStock
+}
+
+// Level represents stock of a single book.
+type Level struct {
+	BookID   string
+	OnHand   int
+	Reserved int
+}
+
+// Available returns how many copies can still be ordered.
+func (l Level) Available() int {
+	return l.OnHand - l.Reserved
+}
+
+// Take knows how to remove quantity sold copies from stock.
+// It returns *OutOfStockError if not enough copies are available.
+func (l *Level) Take(quantity int) error {
+	if quantity <= 0 {
+		return fmt.Errorf("book %s: invalid quantity: %d", l.BookID, quantity)
+	}
+	if quantity > l.Available() {
+		return &OutOfStockError{BookID: l.BookID, Requested: quantity, Available: l.Available()}
+	}
+	l.OnHand -= quantity
+	return nil
+}
+
+// Reservation represents stock held for an order.
+type Reservation struct {
+	OrderID   string
+	Quantity  map[string]int
+	ExpiresAt time.Time
+}
+
+// Store keeps copies on hand of each book. It is the source of
+// truth for stock, shared by everything that sells books, so levels
+// it returns have no copies reserved.
+type Store interface {
+	// Stock returns stock of the book, an empty level
+	// for books never restocked.
+	Stock(bookID string) (Level, error)
+	// Restock adds quantity copies of the book.
+	Restock(bookID string, quantity int) error
+	// Take removes sold copies of the books, either all of them
+	// or none. It returns *OutOfStockError if there are not
+	// enough copies on hand.
+	Take(quantity map[string]int) error
+	// Levels returns stock of all books ever restocked.
+	Levels() ([]Level, error)
+}
+
+// Books is the interface that wraps the List method
+// of bookshop.Store.
+type Books interface {
+	List() ([]bookshop.Book, error)
+}
+
+// Inventory reserves stock kept in a Store for orders being paid.
+// Reservations are kept in memory, copies are taken from the store
+// when a reservation is committed. Inventory implements
+// checkout.Reserver. It is safe for concurrent use.
+type Inventory struct {
+	// Now returns the current time. It defaults to time.Now.
+	Now func() time.Time
+
+	mu           sync.Mutex
+	ttl          time.Duration
+	store        Store
+	reserved     map[string]int
+	reservations map[string]*Reservation
+}
+
+// New knows how to construct an inventory of stock kept in the
+// store. Reservations expire after ttl, DefaultReservationTTL is
+// used when ttl is zero.
+func New(store Store, ttl time.Duration) *Inventory {
+	if ttl <= 0 {
+		ttl = DefaultReservationTTL
+	}
+	return &Inventory{
+		Now:          time.Now,
+		ttl:          ttl,
+		store:        store,
+		reserved:     make(map[string]int),
+		reservations: make(map[string]*Reservation),
+	}
+}
+
+// Restock knows how to add quantity copies of the book.
+func (inv *Inventory) Restock(bookID string, quantity int) error {
+	return inv.store.Restock(bookID, quantity)
+}
+
+// Level returns current stock of the book.
+func (inv *Inventory) Level(bookID string) (Level, error) {
+	inv.mu.Lock()
+	defer inv.mu.Unlock()
+
+	inv.expire()
+	return inv.level(bookID)
+}
+
+// LowStock returns books with at most threshold available copies,
+// the scarcest first. Books of the catalog never restocked are
+// reported with no copies.
+func (inv *Inventory) LowStock(books Books, threshold int) ([]Level, error) {
+	levels, err := inv.store.Levels()
+	if err != nil {
+		return nil, err
+	}
+	catalog, err := books.List()
+	if err != nil {
+		return nil, err
+	}
+	stocked := make(map[string]bool, len(levels))
+	for _, l := range levels {
+		stocked[l.BookID] = true
+	}
+	for _, b := range catalog {
+		if !stocked[b.ID] {
+			levels = append(levels, Level{BookID: b.ID})
+		}
+	}
+
+	inv.mu.Lock()
+	defer inv.mu.Unlock()
+
+	inv.expire()
+
+	var low []Level
+	for _, l := range levels {
+		l.Reserved = inv.reserved[l.BookID]
+		if l.Available() <= threshold {
+			low = append(low, l)
+		}
+	}
+	sort.Slice(low, func(i, j int) bool {
+		if low[i].Available() != low[j].Available() {
+			return low[i].Available() < low[j].Available()
+		}
+		return low[i].BookID < low[j].BookID
+	})
+	return low, nil
+}
+
+// Reserve holds stock for all items of the order until the
+// reservation is committed, released or expires. Either all
+// items are reserved or none of them. Reserving again for the
+// same order replaces the previous reservation.
+func (inv *Inventory) Reserve(orderID string, items []order.Item) error {
+	if orderID == "" {
+		return errors.New("invalid order id")
+	}
+
+	want := make(map[string]int)
+	for _, it := range items {
+		if it.BookID == "" {
+			return errors.New("invalid book id")
+		}
+		if it.Quantity <= 0 {
+			return fmt.Errorf("book %s: invalid quantity: %d", it.BookID, it.Quantity)
+		}
+		want[it.BookID] += it.Quantity
+	}
+
+	inv.mu.Lock()
+	defer inv.mu.Unlock()
+
+	inv.expire()
+	prev, hadPrev := inv.reservations[orderID]
+	inv.release(orderID)
+
+	for _, id := range sortedIDs(want) {
+		l, err := inv.level(id)
+		if err == nil && want[id] > l.Available() {
+			err = &OutOfStockError{BookID: id, Requested: want[id], Available: l.Available()}
+		}
+		if err != nil {
+			if hadPrev {
+				inv.hold(prev)
+			}
+			return err
+		}
+	}
+	inv.hold(&Reservation{
+		OrderID:   orderID,
+		Quantity:  want,
+		ExpiresAt: inv.Now().Add(inv.ttl),
+	})
+	return nil
+}
+
+// Release returns stock held for the order.
+func (inv *Inventory) Release(orderID string) error {
+	inv.mu.Lock()
+	defer inv.mu.Unlock()
+
+	inv.expire()
+	if !inv.release(orderID) {
+		return fmt.Errorf("order %s: %w", orderID, ErrReservationNotFound)
+	}
+	return nil
+}
+
+// Commit turns stock held for the order into a sale, taking
+// the copies from the store. The reservation is kept when the
+// copies cannot be taken, for example because they were sold
+// by someone else using the same store.
+func (inv *Inventory) Commit(orderID string) error {
+	inv.mu.Lock()
+	defer inv.mu.Unlock()
+
+	inv.expire()
+	r, ok := inv.reservations[orderID]
+	if !ok {
+		return fmt.Errorf("order %s: %w", orderID, ErrReservationNotFound)
+	}
+	if err := inv.store.Take(r.Quantity); err != nil {
+		return fmt.Errorf("order %s: %w", orderID, err)
+	}
+	inv.release(orderID)
+	return nil
+}
+
+// Reservation returns the active reservation for the order.
+func (inv *Inventory) Reservation(orderID string) (Reservation, bool) {
+	inv.mu.Lock()
+	defer inv.mu.Unlock()
+
+	inv.expire()
+	r, ok := inv.reservations[orderID]
+	if !ok {
+		return Reservation{}, false
+	}
+	res := *r
+	res.Quantity = make(map[string]int, len(r.Quantity))
+	for id, q := range r.Quantity {
+		res.Quantity[id] = q
+	}
+	return res, true
+}
+
+// level returns stock of the book in the store
+// with copies reserved in the inventory.
+func (inv *Inventory) level(bookID string) (Level, error) {
+	l, err := inv.store.Stock(bookID)
+	if err != nil {
+		return Level{}, err
+	}
+	l.Reserved = inv.reserved[bookID]
+	return l, nil
+}
+
+func (inv *Inventory) hold(r *Reservation) {
+	for id, q := range r.Quantity {
+		inv.reserved[id] += q
+	}
+	inv.reservations[r.OrderID] = r
+}
+
+func (inv *Inventory) release(orderID string) bool {
+	r, ok := inv.reservations[orderID]
+	if !ok {
+		return false
+	}
+	for id, q := range r.Quantity {
+		if inv.reserved[id] -= q; inv.reserved[id] == 0 {
+			delete(inv.reserved, id)
+		}
+	}
+	delete(inv.reservations, orderID)
+	return true
+}
+
+// expire releases reservations past their expiry time.
+func (inv *Inventory) expire() {
+	now := inv.Now()
+	for id, r := range inv.reservations {
+		if !now.Before(r.ExpiresAt) {
+			inv.release(id)
+		}
+	}
+}
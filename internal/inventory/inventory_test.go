@@ -0,0 +1,278 @@
+package inventory_test
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/google/go-cmp/cmp"
+	"github.com/qba73/bookshop/internal/bookshop"
+	"github.com/qba73/bookshop/internal/bookshop/order"
+	"github.com/qba73/bookshop/internal/checkout"
+	"github.com/qba73/bookshop/internal/inventory"
+	"github.com/qba73/bookshop/internal/payment"
+)
+
+var _ checkout.Reserver = (*inventory.Inventory)(nil)
+
+const (
+	bolekID = "1912bbf7-3f26-4196-b062-071b81b855e9"
+	tytusID = "1912abf7-3f26-4196-b062-011b81b255e9"
+	zosiaID = "1923bbf9-3f36-4196-b062-171b81b855e9"
+)
+
+// clock is a manually advanced time source.
+type clock struct {
+	now time.Time
+}
+
+func (c *clock) Now() time.Time { return c.now }
+
+func newInventory(t *testing.T, stock map[string]int) (*inventory.Inventory, *clock) {
+	t.Helper()
+
+	c := clock{now: time.Date(2021, time.January, 10, 12, 0, 0, 0, time.UTC)}
+	inv := inventory.New(inventory.NewMemoryStore(), 10*time.Minute)
+	inv.Now = c.Now
+	for id, q := range stock {
+		if err := inv.Restock(id, q); err != nil {
+			t.Fatal(err)
+		}
+	}
+	return inv, &c
+}
+
+// level returns stock of the book in the inventory.
+func level(t *testing.T, inv *inventory.Inventory, bookID string) inventory.Level {
+	t.Helper()
+
+	l, err := inv.Level(bookID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return l
+}
+
+func TestRestock(t *testing.T) {
+	t.Parallel()
+
+	tt := []struct {
+		name        string
+		bookID      string
+		quantity    int
+		want        inventory.Level
+		expectedErr bool
+	}{
+		{name: "Restock", bookID: bolekID, quantity: 5, want: inventory.Level{BookID: bolekID, OnHand: 7}, expectedErr: false},
+		{name: "Restock new book", bookID: zosiaID, quantity: 1, want: inventory.Level{BookID: zosiaID, OnHand: 1}, expectedErr: false},
+		{name: "Zero quantity", bookID: bolekID, quantity: 0, want: inventory.Level{BookID: bolekID, OnHand: 2}, expectedErr: true},
+		{name: "Missing book id", bookID: "", quantity: 1, want: inventory.Level{}, expectedErr: true},
+	}
+
+	for _, tc := range tt {
+		inv, _ := newInventory(t, map[string]int{bolekID: 2})
+
+		err := inv.Restock(tc.bookID, tc.quantity)
+		if (err != nil) != tc.expectedErr {
+			t.Fatalf("%s Restock(%s, %d) got error: %v", tc.name, tc.bookID, tc.quantity, err)
+		}
+
+		if got := level(t, inv, tc.bookID); !cmp.Equal(got, tc.want) {
+			t.Errorf("%s Level() \n%s", tc.name, cmp.Diff(tc.want, got))
+		}
+	}
+}
+
+func TestReserve(t *testing.T) {
+	t.Parallel()
+
+	inv, _ := newInventory(t, map[string]int{bolekID: 3, tytusID: 1})
+
+	err := inv.Reserve("order-1", []order.Item{{BookID: bolekID, Quantity: 2}, {BookID: tytusID, Quantity: 1}})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// Not enough copies left, nothing is reserved.
+	err = inv.Reserve("order-2", []order.Item{{BookID: bolekID, Quantity: 1}, {BookID: tytusID, Quantity: 1}})
+	if !errors.Is(err, inventory.ErrOutOfStock) {
+		t.Fatalf("Reserve() = %v, want: %v", err, inventory.ErrOutOfStock)
+	}
+	var serr *inventory.OutOfStockError
+	if !errors.As(err, &serr) || serr.BookID != tytusID || serr.Available != 0 {
+		t.Errorf("Reserve() = %#v, want out of stock for %s", err, tytusID)
+	}
+	if got := level(t, inv, bolekID); got.Available() != 1 {
+		t.Errorf("Available() after failed Reserve() = %d, want: 1", got.Available())
+	}
+
+	if err := inv.Release("order-1"); err != nil {
+		t.Fatal(err)
+	}
+	if err := inv.Release("order-1"); !errors.Is(err, inventory.ErrReservationNotFound) {
+		t.Errorf("Release() twice = %v, want: %v", err, inventory.ErrReservationNotFound)
+	}
+
+	if err := inv.Reserve("order-2", []order.Item{{BookID: bolekID, Quantity: 1}, {BookID: tytusID, Quantity: 1}}); err != nil {
+		t.Fatal(err)
+	}
+	if err := inv.Commit("order-2"); err != nil {
+		t.Fatal(err)
+	}
+
+	// Zosia is in the catalog, but was never stocked.
+	catalog := bookshop.NewMemoryStore(map[string]bookshop.Book{
+		bolekID: bookshop.Books[bolekID],
+		tytusID: bookshop.Books[tytusID],
+		zosiaID: bookshop.Books[zosiaID],
+	})
+	want := []inventory.Level{
+		{BookID: tytusID, OnHand: 0, Reserved: 0},
+		{BookID: zosiaID, OnHand: 0, Reserved: 0},
+		{BookID: bolekID, OnHand: 2, Reserved: 0},
+	}
+	got, err := inv.LowStock(catalog, 5)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !cmp.Equal(got, want) {
+		t.Errorf("LowStock() \n%s", cmp.Diff(want, got))
+	}
+}
+
+func TestReserveReplacesPrevious(t *testing.T) {
+	t.Parallel()
+
+	inv, _ := newInventory(t, map[string]int{bolekID: 3})
+
+	if err := inv.Reserve("order-1", []order.Item{{BookID: bolekID, Quantity: 2}}); err != nil {
+		t.Fatal(err)
+	}
+	if err := inv.Reserve("order-1", []order.Item{{BookID: bolekID, Quantity: 3}}); err != nil {
+		t.Fatal(err)
+	}
+	if err := inv.Reserve("order-1", []order.Item{{BookID: bolekID, Quantity: 4}}); !errors.Is(err, inventory.ErrOutOfStock) {
+		t.Fatalf("Reserve() = %v, want: %v", err, inventory.ErrOutOfStock)
+	}
+
+	r, ok := inv.Reservation("order-1")
+	if !ok {
+		t.Fatal("Reservation() lost after failed Reserve()")
+	}
+	if r.Quantity[bolekID] != 3 {
+		t.Errorf("Reservation() quantity = %d, want: 3", r.Quantity[bolekID])
+	}
+	if got := level(t, inv, bolekID); got.Reserved != 3 {
+		t.Errorf("Level() reserved = %d, want: 3", got.Reserved)
+	}
+}
+
+func TestReserveInvalidItems(t *testing.T) {
+	t.Parallel()
+
+	tt := []struct {
+		name  string
+		items []order.Item
+	}{
+		{name: "Zero quantity of book never stocked", items: []order.Item{{BookID: zosiaID, Quantity: 0}}},
+		{name: "Zero quantity", items: []order.Item{{BookID: bolekID, Quantity: 0}}},
+		{name: "Negative quantity", items: []order.Item{{BookID: bolekID, Quantity: 2}, {BookID: bolekID, Quantity: -1}}},
+		{name: "Missing book id", items: []order.Item{{BookID: "", Quantity: 1}}},
+	}
+
+	for _, tc := range tt {
+		inv, _ := newInventory(t, map[string]int{bolekID: 1})
+
+		if err := inv.Reserve("order-1", tc.items); err == nil {
+			t.Errorf("%s Reserve() got no error", tc.name)
+		}
+		if _, ok := inv.Reservation("order-1"); ok {
+			t.Errorf("%s Reserve() held stock for invalid items", tc.name)
+		}
+		if got := level(t, inv, bolekID); got.Available() != 1 {
+			t.Errorf("%s Available() = %d, want: 1", tc.name, got.Available())
+		}
+	}
+}
+
+func TestReservationExpiry(t *testing.T) {
+	t.Parallel()
+
+	inv, c := newInventory(t, map[string]int{bolekID: 1})
+
+	if err := inv.Reserve("order-1", []order.Item{{BookID: bolekID, Quantity: 1}}); err != nil {
+		t.Fatal(err)
+	}
+	if err := inv.Reserve("order-2", []order.Item{{BookID: bolekID, Quantity: 1}}); !errors.Is(err, inventory.ErrOutOfStock) {
+		t.Fatalf("Reserve() = %v, want: %v", err, inventory.ErrOutOfStock)
+	}
+
+	c.now = c.now.Add(10 * time.Minute)
+
+	if err := inv.Reserve("order-2", []order.Item{{BookID: bolekID, Quantity: 1}}); err != nil {
+		t.Fatalf("Reserve() after expiry got error: %v", err)
+	}
+	if err := inv.Commit("order-1"); !errors.Is(err, inventory.ErrReservationNotFound) {
+		t.Errorf("Commit() expired reservation = %v, want: %v", err, inventory.ErrReservationNotFound)
+	}
+}
+
+func TestLevelTake(t *testing.T) {
+	t.Parallel()
+
+	tt := []struct {
+		name        string
+		level       inventory.Level
+		quantity    int
+		want        inventory.Level
+		expectedErr bool
+	}{
+		{name: "Take available", level: inventory.Level{BookID: bolekID, OnHand: 3, Reserved: 1}, quantity: 2, want: inventory.Level{BookID: bolekID, OnHand: 1, Reserved: 1}, expectedErr: false},
+		{name: "Take reserved", level: inventory.Level{BookID: bolekID, OnHand: 3, Reserved: 2}, quantity: 2, want: inventory.Level{BookID: bolekID, OnHand: 3, Reserved: 2}, expectedErr: true},
+	}
+
+	for _, tc := range tt {
+		l := tc.level
+		err := l.Take(tc.quantity)
+		if (err != nil) != tc.expectedErr {
+			t.Fatalf("%s Take(%d) got error: %v", tc.name, tc.quantity, err)
+		}
+		if !cmp.Equal(l, tc.want) {
+			t.Errorf("%s Take(%d) \n%s", tc.name, tc.quantity, cmp.Diff(tc.want, l))
+		}
+	}
+}
+
+func TestCheckoutOutOfStock(t *testing.T) {
+	t.Parallel()
+
+	inv, _ := newInventory(t, map[string]int{bolekID: 1})
+	svc := checkout.NewService(bookshop.NewMemoryStore(bookshop.Books), inv, payment.NewFakeGateway())
+
+	o, err := order.New("12282")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := o.AddItem(order.Item{BookID: bolekID, Quantity: 2}); err != nil {
+		t.Fatal(err)
+	}
+
+	if _, err := svc.Checkout(context.Background(), o, "key-1"); !errors.Is(err, inventory.ErrOutOfStock) {
+		t.Fatalf("Checkout() = %v, want: %v", err, inventory.ErrOutOfStock)
+	}
+	if s := o.CurrentStatus(); s != order.StatusDraft {
+		t.Errorf("order status = %s, want: %s", s, order.StatusDraft)
+	}
+
+	// The customer lowers the quantity and tries again with the same key.
+	if err := o.SetQuantity(bolekID, 1); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := svc.Checkout(context.Background(), o, "key-1"); err != nil {
+		t.Fatal(err)
+	}
+	if got := level(t, inv, bolekID); !cmp.Equal(got, inventory.Level{BookID: bolekID}) {
+		t.Errorf("Level() after checkout \n%s", cmp.Diff(inventory.Level{BookID: bolekID}, got))
+	}
+}
@@ -0,0 +1,83 @@
+package inventory
+
+import (
+	"errors"
+	"fmt"
+	"sort"
+	"sync"
+)
+
+// MemoryStore keeps stock in memory. It is safe for concurrent use.
+type MemoryStore struct {
+	mu     sync.Mutex
+	onHand map[string]int
+}
+
+// NewMemoryStore knows how to construct an empty stock store.
+func NewMemoryStore() *MemoryStore {
+	return &MemoryStore{onHand: make(map[string]int)}
+}
+
+// Stock returns stock of the book, an empty level
+// for books never restocked.
+func (s *MemoryStore) Stock(bookID string) (Level, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	return Level{BookID: bookID, OnHand: s.onHand[bookID]}, nil
+}
+
+// Restock knows how to add quantity copies of the book.
+func (s *MemoryStore) Restock(bookID string, quantity int) error {
+	if bookID == "" {
+		return errors.New("invalid book id")
+	}
+	if quantity <= 0 {
+		return fmt.Errorf("invalid quantity: %d", quantity)
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.onHand[bookID] += quantity
+	return nil
+}
+
+// Take removes sold copies of the books, either all of them or none.
+func (s *MemoryStore) Take(quantity map[string]int) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	for _, id := range sortedIDs(quantity) {
+		l := Level{BookID: id, OnHand: s.onHand[id]}
+		if err := l.Take(quantity[id]); err != nil {
+			return err
+		}
+	}
+	for id, q := range quantity {
+		s.onHand[id] -= q
+	}
+	return nil
+}
+
+// Levels returns stock of all books ever restocked, sorted by book ID.
+func (s *MemoryStore) Levels() ([]Level, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	levels := make([]Level, 0, len(s.onHand))
+	for _, id := range sortedIDs(s.onHand) {
+		levels = append(levels, Level{BookID: id, OnHand: s.onHand[id]})
+	}
+	return levels, nil
+}
+
+// sortedIDs returns book IDs of the quantities in order.
+func sortedIDs(quantity map[string]int) []string {
+	ids := make([]string, 0, len(quantity))
+	for id := range quantity {
+		ids = append(ids, id)
+	}
+	sort.Strings(ids)
+	return ids
+}
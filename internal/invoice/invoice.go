@@ -0,0 +1,180 @@
+// Package invoice issues invoices for paid orders and correction
+// invoices for refunds, and renders them as text, HTML and PDF.
+//
+// Invoices are numbered in series per kind and year, like
+// FV/2021/000001 for invoices and FK/2021/000001 for corrections.
+// Numbers are assigned by the Store when an invoice is saved, so
+// there are no gaps in a series.
+package invoice
+
+import (
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/qba73/bookshop/internal/money"
+	"github.com/qba73/bookshop/internal/tax"
+)
+
+var (
+	// ErrNotFound is returned when an invoice does not exist.
+	ErrNotFound = errors.New("invoice not found")
+	// ErrNotPaid is returned when an invoice is requested
+	// for an order that has not been paid.
+	ErrNotPaid = errors.New("order is not paid")
+	// ErrIssued is returned when an invoice for the
+	// order has already been issued.
+	ErrIssued = errors.New("invoice already issued")
+	// ErrInvalidCorrection is returned when a correction
+	// does not match the corrected invoice.
+	ErrInvalidCorrection = errors.New("invalid correction")
+	// ErrAmountMismatch is returned when the invoiced amount
+	// differs from the amount paid for the order.
+	ErrAmountMismatch = errors.New("invoiced amount differs from amount paid")
+)
+
+// Kind is a kind of invoice.
+type Kind string
+
+// Kinds of invoices.
+const (
+	KindInvoice    Kind = "invoice"
+	KindCorrection Kind = "correction"
+)
+
+// prefixes are the number prefixes of each kind of invoice.
+var prefixes = map[Kind]string{
+	KindInvoice:    "FV",
+	KindCorrection: "FK",
+}
+
+// Party is the seller or the buyer named on an invoice.
+type Party struct {
+	Name    string
+	Address string
+	Country string
+	// TaxID is the VAT identification number, if any.
+	TaxID string
+}
+
+// Line is an invoiced order line. Amounts of correction
+// lines and their quantities are negative.
+type Line struct {
+	BookID    string
+	Title     string
+	Quantity  int
+	UnitPrice money.Money
+	// Discount is the amount taken off the line by book
+	// discounts, promotions and coupons.
+	Discount money.Money
+	Rate     tax.Rate
+	Net      money.Money
+	Tax      money.Money
+	Gross    money.Money
+}
+
+// Invoice represents an invoice or a correction invoice.
+type Invoice struct {
+	Number string
+	Kind   Kind
+	// Seq is the position of the invoice in its series.
+	Seq     int
+	OrderID string
+	// Corrects is the number of the invoice corrected
+	// by a correction invoice.
+	Corrects string
+	// Reason tells why a correction invoice was issued.
+	Reason   string
+	Issued   time.Time
+	SaleDate time.Time
+	Seller   Party
+	Buyer    Party
+	Currency money.Currency
+	// PricesIncludeTax tells whether unit prices and discounts
+	// include tax.
+	PricesIncludeTax bool
+	Lines            []Line
+	// Summary lists totals per tax rate, highest rate first.
+	Summary  []tax.Summary
+	Discount money.Money
+	Net      money.Money
+	Tax      money.Money
+	Gross    money.Money
+}
+
+// Series returns the series the invoice is numbered in,
+// like FV/2021.
+func (inv Invoice) Series() string {
+	return fmt.Sprintf("%s/%d", prefixes[inv.Kind], inv.Issued.Year())
+}
+
+// SetNumber knows how to number the invoice as the seq-th
+// invoice of its series. It helps implementing Store.Issue.
+func (inv *Invoice) SetNumber(seq int) {
+	inv.Seq = seq
+	inv.Number = fmt.Sprintf("%s/%06d", inv.Series(), seq)
+}
+
+// Validate returns an error when the invoice cannot be issued.
+func (inv Invoice) Validate() error {
+	if _, ok := prefixes[inv.Kind]; !ok {
+		return fmt.Errorf("invalid invoice kind %q", inv.Kind)
+	}
+	if inv.OrderID == "" {
+		return errors.New("invalid order id")
+	}
+	if inv.Issued.IsZero() {
+		return errors.New("invalid issue date")
+	}
+	if inv.Kind == KindCorrection && inv.Corrects == "" {
+		return fmt.Errorf("%w: missing corrected invoice", ErrInvalidCorrection)
+	}
+	if len(inv.Lines) == 0 {
+		return errors.New("invoice has no lines")
+	}
+	return nil
+}
+
+// ValidateIssue returns an error when the invoice cannot be issued
+// after the invoices of its order issued so far. An order has one
+// invoice and corrections may not refund more copies than are left
+// of the corrected invoice. Stores call it in the transaction the
+// invoice is issued in, so concurrent corrections cannot refund the
+// same copies twice.
+func (inv Invoice) ValidateIssue(issued []Invoice) error {
+	if inv.Kind == KindInvoice {
+		for _, v := range issued {
+			if v.Kind == KindInvoice {
+				return fmt.Errorf("order %s: %w: %s", inv.OrderID, ErrIssued, v.Number)
+			}
+		}
+		return nil
+	}
+
+	// Copies left to refund, by book ID.
+	left := make(map[string]int)
+	var found bool
+	for _, v := range issued {
+		switch {
+		case v.Number == inv.Corrects:
+			found = true
+			for _, l := range v.Lines {
+				left[l.BookID] += l.Quantity
+			}
+		case v.Corrects == inv.Corrects:
+			for _, l := range v.Lines {
+				left[l.BookID] += l.Quantity
+			}
+		}
+	}
+	if !found {
+		return fmt.Errorf("invoice %s: %w: not an invoice of order %s", inv.Corrects, ErrInvalidCorrection, inv.OrderID)
+	}
+	for _, l := range inv.Lines {
+		if l.Quantity >= 0 || -l.Quantity > left[l.BookID] {
+			return fmt.Errorf("invoice %s: book %s: %w: refund of %d copies, %d left", inv.Corrects, l.BookID, ErrInvalidCorrection, -l.Quantity, left[l.BookID])
+		}
+		left[l.BookID] += l.Quantity
+	}
+	return nil
+}
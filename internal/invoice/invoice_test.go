@@ -0,0 +1,499 @@
+package invoice_test
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/google/go-cmp/cmp"
+	"github.com/qba73/bookshop/internal/bookshop"
+	"github.com/qba73/bookshop/internal/bookshop/order"
+	"github.com/qba73/bookshop/internal/checkout"
+	"github.com/qba73/bookshop/internal/inventory"
+	"github.com/qba73/bookshop/internal/invoice"
+	"github.com/qba73/bookshop/internal/money"
+	"github.com/qba73/bookshop/internal/payment"
+	"github.com/qba73/bookshop/internal/tax"
+)
+
+var (
+	paidAt   = time.Date(2021, time.June, 15, 12, 0, 0, 0, time.UTC)
+	issuedAt = time.Date(2021, time.June, 16, 9, 0, 0, 0, time.UTC)
+)
+
+var seller = invoice.Party{
+	Name:    "Bookshop Sp. z o.o.",
+	Address: "ul. Długa 1\n00-001 Warszawa",
+	Country: "PL",
+	TaxID:   "PL5260000000",
+}
+
+var customer = bookshop.Customer{
+	ID:    "jan",
+	Title: "Mr",
+	Name:  "Jan Kowalski",
+	Email: "jan@example.com",
+	Billing: bookshop.Address{
+		Street:   "ul. Krótka 2",
+		City:     "Kraków",
+		Postcode: "30-001",
+		Country:  "PL",
+	},
+}
+
+func pln(minor int64) money.Money {
+	return money.New(minor, money.PLN)
+}
+
+// newService returns an invoice service with a catalog of a printed
+// book for 39.90 PLN and an e-book for 24.60 PLN.
+func newService(t *testing.T) (*invoice.Service, *invoice.MemoryStore, *bookshop.MemoryStore) {
+	t.Helper()
+
+	books := bookshop.NewMemoryStore(nil)
+	for _, b := range []bookshop.Book{
+		{ID: "print", Title: "Learn Go", Price: pln(3990), Format: bookshop.FormatPrint},
+		{ID: "ebook", Title: "Learn Go <Digital>", Price: pln(2460), Format: bookshop.FormatEbook},
+	} {
+		if err := b.SetCategory(bookshop.CategoryTech); err != nil {
+			t.Fatal(err)
+		}
+		if err := books.Put(b); err != nil {
+			t.Fatal(err)
+		}
+	}
+	store := invoice.NewMemoryStore()
+	return invoice.NewService(store, books, seller), store, books
+}
+
+// newOrder returns a paid order of two printed books and an
+// e-book with 4.60 PLN off, taxed with the PL table.
+func newOrder(t *testing.T, books bookshop.Store, id string) *order.Order {
+	t.Helper()
+
+	o, err := order.New(id)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, v := range []struct {
+		id       string
+		quantity int
+	}{{"print", 2}, {"ebook", 1}} {
+		b, err := books.Get(v.id)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if err := o.AddBook(b, v.quantity); err != nil {
+			t.Fatal(err)
+		}
+	}
+	err = o.SetAdjustments([]order.Adjustment{
+		{BookID: "ebook", Source: "coupon:SPRING", Amount: pln(460)},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	taxes, err := tax.NewCalculator(tax.PL, books)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := taxes.Assess(o, customer); err != nil {
+		t.Fatal(err)
+	}
+	if o.Paid, err = o.Total(); err != nil {
+		t.Fatal(err)
+	}
+	if err := o.TransitionTo(order.StatusPlaced, paidAt); err != nil {
+		t.Fatal(err)
+	}
+	if err := o.TransitionTo(order.StatusPaid, paidAt); err != nil {
+		t.Fatal(err)
+	}
+	return o
+}
+
+func TestService_Issue(t *testing.T) {
+	t.Parallel()
+
+	s, _, books := newService(t)
+	got, err := s.Issue(newOrder(t, books, "12282"), customer, issuedAt)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	want := invoice.Invoice{
+		Number:   "FV/2021/000001",
+		Kind:     invoice.KindInvoice,
+		Seq:      1,
+		OrderID:  "12282",
+		Issued:   issuedAt,
+		SaleDate: paidAt,
+		Seller:   seller,
+		Buyer: invoice.Party{
+			Name:    "Mr Jan Kowalski",
+			Address: "ul. Krótka 2\n30-001 Kraków",
+			Country: "PL",
+		},
+		Currency:         money.PLN,
+		PricesIncludeTax: true,
+		Lines: []invoice.Line{
+			{BookID: "print", Title: "Learn Go", Quantity: 2, UnitPrice: pln(3990), Discount: pln(0), Rate: 500, Net: pln(7600), Tax: pln(380), Gross: pln(7980)},
+			{BookID: "ebook", Title: "Learn Go <Digital>", Quantity: 1, UnitPrice: pln(2460), Discount: pln(460), Rate: 2300, Net: pln(1626), Tax: pln(374), Gross: pln(2000)},
+		},
+		Summary: []tax.Summary{
+			{Rate: 2300, Net: pln(1626), Tax: pln(374), Gross: pln(2000)},
+			{Rate: 500, Net: pln(7600), Tax: pln(380), Gross: pln(7980)},
+		},
+		Discount: pln(460),
+		Net:      pln(9226),
+		Tax:      pln(754),
+		Gross:    pln(9980),
+	}
+	if !cmp.Equal(want, got) {
+		t.Error(cmp.Diff(want, got))
+	}
+}
+
+func TestService_IssueTaxOfSale(t *testing.T) {
+	t.Parallel()
+
+	s, _, books := newService(t)
+	o := newOrder(t, books, "12282")
+
+	// The printed book becomes an e-book after it was sold.
+	b, err := books.Get("print")
+	if err != nil {
+		t.Fatal(err)
+	}
+	b.Format = bookshop.FormatEbook
+	if err := books.Put(b); err != nil {
+		t.Fatal(err)
+	}
+
+	inv, err := s.Issue(o, customer, issuedAt)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got := inv.Lines[0].Rate; got != 500 {
+		t.Errorf("rate of the printed book = %v, want: 5%%", got)
+	}
+
+	o.Tax = nil
+	o.OrderID = "12283"
+	if _, err := s.Issue(o, customer, issuedAt); !errors.Is(err, tax.ErrNotAssessed) {
+		t.Errorf("Issue() of order without tax = %v, want: %v", err, tax.ErrNotAssessed)
+	}
+}
+
+func TestService_IssueTaxExclusiveCheckout(t *testing.T) {
+	t.Parallel()
+
+	s, _, books := newService(t)
+	exclusive := tax.PL
+	exclusive.PricesIncludeTax = false
+	taxes, err := tax.NewCalculator(exclusive, books)
+	if err != nil {
+		t.Fatal(err)
+	}
+	customers, err := bookshop.NewMemoryCustomerStore(customer)
+	if err != nil {
+		t.Fatal(err)
+	}
+	stock := inventory.New(inventory.NewMemoryStore(), 0)
+	if err := stock.Restock("print", 2); err != nil {
+		t.Fatal(err)
+	}
+	gw := payment.NewFakeGateway()
+	svc := checkout.NewService(books, stock, gw)
+	svc.SetTaxes(taxes, customers)
+
+	o, err := order.New("12282")
+	if err != nil {
+		t.Fatal(err)
+	}
+	o.CustomerID = customer.ID
+	if err := o.AddItem(order.Item{BookID: "print", Quantity: 2}); err != nil {
+		t.Fatal(err)
+	}
+	receipt, err := svc.Checkout(context.Background(), o, "key-1")
+	if err != nil {
+		t.Fatal(err)
+	}
+	// 2 x 39.90 PLN net and 5% VAT.
+	if want := pln(8379); receipt.Total != want {
+		t.Errorf("charged %v, want: %v", receipt.Total, want)
+	}
+	tx, ok := gw.Transaction(receipt.TransactionID)
+	if !ok {
+		t.Fatalf("transaction %s not found", receipt.TransactionID)
+	}
+
+	inv, err := s.Issue(o, customer, issuedAt)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if inv.Net != pln(7980) || inv.Tax != pln(399) || inv.Gross != tx.Captured {
+		t.Errorf("invoice net %v, tax %v, gross %v, want: 79.80, 3.99 and captured %v", inv.Net, inv.Tax, inv.Gross, tx.Captured)
+	}
+}
+
+func TestService_IssueAmountMismatch(t *testing.T) {
+	t.Parallel()
+
+	s, _, books := newService(t)
+	o := newOrder(t, books, "12282")
+	o.Paid = pln(100)
+	if _, err := s.Issue(o, customer, issuedAt); !errors.Is(err, invoice.ErrAmountMismatch) {
+		t.Errorf("Issue() = %v, want: %v", err, invoice.ErrAmountMismatch)
+	}
+}
+
+func TestService_IssueNumbering(t *testing.T) {
+	t.Parallel()
+
+	s, store, books := newService(t)
+	next := issuedAt.AddDate(1, 0, 0)
+	tt := []struct {
+		orderID string
+		at      time.Time
+		want    string
+	}{
+		{orderID: "1", at: issuedAt, want: "FV/2021/000001"},
+		{orderID: "2", at: issuedAt, want: "FV/2021/000002"},
+		{orderID: "3", at: next, want: "FV/2022/000001"},
+		{orderID: "4", at: next, want: "FV/2022/000002"},
+	}
+	for _, tc := range tt {
+		inv, err := s.Issue(newOrder(t, books, tc.orderID), customer, tc.at)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if inv.Number != tc.want {
+			t.Errorf("order %s: want invoice %s, got %s", tc.orderID, tc.want, inv.Number)
+		}
+		stored, err := store.Invoice(tc.want)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if stored.OrderID != tc.orderID {
+			t.Errorf("invoice %s: want order %s, got %s", tc.want, tc.orderID, stored.OrderID)
+		}
+	}
+
+	// Failed issues do not use up numbers.
+	if _, err := s.Issue(newOrder(t, books, "1"), customer, issuedAt); !errors.Is(err, invoice.ErrIssued) {
+		t.Errorf("want ErrIssued, got %v", err)
+	}
+	unpaid, err := order.New("5")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := s.Issue(unpaid, customer, issuedAt); !errors.Is(err, invoice.ErrNotPaid) {
+		t.Errorf("want ErrNotPaid, got %v", err)
+	}
+	inv, err := s.Issue(newOrder(t, books, "6"), customer, issuedAt)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if inv.Number != "FV/2021/000003" {
+		t.Errorf("want invoice FV/2021/000003, got %s", inv.Number)
+	}
+}
+
+func TestService_Correct(t *testing.T) {
+	t.Parallel()
+
+	s, _, books := newService(t)
+	inv, err := s.Issue(newOrder(t, books, "12282"), customer, issuedAt)
+	if err != nil {
+		t.Fatal(err)
+	}
+	refundedAt := issuedAt.Add(24 * time.Hour)
+
+	got, err := s.Correct(inv.Number, nil, "Order returned", refundedAt)
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := invoice.Invoice{
+		Number:           "FK/2021/000001",
+		Kind:             invoice.KindCorrection,
+		Seq:              1,
+		OrderID:          "12282",
+		Corrects:         "FV/2021/000001",
+		Reason:           "Order returned",
+		Issued:           refundedAt,
+		SaleDate:         paidAt,
+		Seller:           inv.Seller,
+		Buyer:            inv.Buyer,
+		Currency:         money.PLN,
+		PricesIncludeTax: true,
+		Lines: []invoice.Line{
+			{BookID: "print", Title: "Learn Go", Quantity: -2, UnitPrice: pln(3990), Discount: pln(0), Rate: 500, Net: pln(-7600), Tax: pln(-380), Gross: pln(-7980)},
+			{BookID: "ebook", Title: "Learn Go <Digital>", Quantity: -1, UnitPrice: pln(2460), Discount: pln(-460), Rate: 2300, Net: pln(-1626), Tax: pln(-374), Gross: pln(-2000)},
+		},
+		Summary: []tax.Summary{
+			{Rate: 2300, Net: pln(-1626), Tax: pln(-374), Gross: pln(-2000)},
+			{Rate: 500, Net: pln(-7600), Tax: pln(-380), Gross: pln(-7980)},
+		},
+		Discount: pln(-460),
+		Net:      pln(-9226),
+		Tax:      pln(-754),
+		Gross:    pln(-9980),
+	}
+	if !cmp.Equal(want, got) {
+		t.Error(cmp.Diff(want, got))
+	}
+
+	if _, err := s.Correct(inv.Number, nil, "", refundedAt); !errors.Is(err, invoice.ErrInvalidCorrection) {
+		t.Errorf("correcting a refunded invoice: want ErrInvalidCorrection, got %v", err)
+	}
+	if _, err := s.Correct(got.Number, nil, "", refundedAt); !errors.Is(err, invoice.ErrInvalidCorrection) {
+		t.Errorf("correcting a correction: want ErrInvalidCorrection, got %v", err)
+	}
+}
+
+func TestService_CorrectPartialRefunds(t *testing.T) {
+	t.Parallel()
+
+	s, _, books := newService(t)
+	inv, err := s.Issue(newOrder(t, books, "12282"), customer, issuedAt)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	tt := []struct {
+		name       string
+		quantities map[string]int
+		wantNumber string
+		wantLines  []invoice.Line
+		wantGross  money.Money
+		wantErr    error
+	}{
+		{
+			name:       "One of two copies",
+			quantities: map[string]int{"print": 1},
+			wantNumber: "FK/2021/000001",
+			wantLines: []invoice.Line{
+				{BookID: "print", Title: "Learn Go", Quantity: -1, UnitPrice: pln(3990), Discount: pln(0), Rate: 500, Net: pln(-3800), Tax: pln(-190), Gross: pln(-3990)},
+			},
+			wantGross: pln(-3990),
+		},
+		{name: "More copies than left", quantities: map[string]int{"print": 2}, wantErr: invoice.ErrInvalidCorrection},
+		{name: "Book not invoiced", quantities: map[string]int{"other": 1}, wantErr: invoice.ErrInvalidCorrection},
+		{name: "Negative quantity", quantities: map[string]int{"ebook": -1}, wantErr: invoice.ErrInvalidCorrection},
+		{name: "Nothing refunded", quantities: map[string]int{}, wantErr: invoice.ErrInvalidCorrection},
+		{
+			name:       "All copies left",
+			wantNumber: "FK/2021/000002",
+			wantLines: []invoice.Line{
+				{BookID: "print", Title: "Learn Go", Quantity: -1, UnitPrice: pln(3990), Discount: pln(0), Rate: 500, Net: pln(-3800), Tax: pln(-190), Gross: pln(-3990)},
+				{BookID: "ebook", Title: "Learn Go <Digital>", Quantity: -1, UnitPrice: pln(2460), Discount: pln(-460), Rate: 2300, Net: pln(-1626), Tax: pln(-374), Gross: pln(-2000)},
+			},
+			wantGross: pln(-5990),
+		},
+		{name: "Everything refunded", wantErr: invoice.ErrInvalidCorrection},
+	}
+	// Cases run in order, each correcting what is left of the invoice.
+	for _, tc := range tt {
+		got, err := s.Correct(inv.Number, tc.quantities, "Returned", issuedAt)
+		if tc.wantErr != nil {
+			if !errors.Is(err, tc.wantErr) {
+				t.Errorf("%s: want %v, got %v", tc.name, tc.wantErr, err)
+			}
+			continue
+		}
+		if err != nil {
+			t.Fatalf("%s: %v", tc.name, err)
+		}
+		if got.Number != tc.wantNumber {
+			t.Errorf("%s: want number %s, got %s", tc.name, tc.wantNumber, got.Number)
+		}
+		if !cmp.Equal(tc.wantLines, got.Lines) {
+			t.Errorf("%s: %s", tc.name, cmp.Diff(tc.wantLines, got.Lines))
+		}
+		if !cmp.Equal(tc.wantGross, got.Gross) {
+			t.Errorf("%s: want gross %v, got %v", tc.name, tc.wantGross, got.Gross)
+		}
+	}
+}
+
+func TestService_CorrectConcurrent(t *testing.T) {
+	t.Parallel()
+
+	s, store, books := newService(t)
+	inv, err := s.Issue(newOrder(t, books, "12282"), customer, issuedAt)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// Customer service refunds the order twice at the same time.
+	const clerks = 5
+	errs := make([]error, clerks)
+	var wg sync.WaitGroup
+	for i := 0; i < clerks; i++ {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			_, errs[i] = s.Correct(inv.Number, nil, "Order returned", issuedAt)
+		}(i)
+	}
+	wg.Wait()
+
+	var corrected int
+	for _, err := range errs {
+		switch {
+		case err == nil:
+			corrected++
+		case !errors.Is(err, invoice.ErrInvalidCorrection):
+			t.Errorf("want ErrInvalidCorrection, got %v", err)
+		}
+	}
+	if corrected != 1 {
+		t.Errorf("want 1 correction, got %d", corrected)
+	}
+	invs, err := store.OrderInvoices("12282")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(invs) != 2 {
+		t.Errorf("want invoice and 1 correction stored, got %d invoices", len(invs))
+	}
+}
+
+func TestInvoice_ValidateIssue(t *testing.T) {
+	t.Parallel()
+
+	original := invoice.Invoice{
+		Number: "FV/2021/000001", Kind: invoice.KindInvoice, OrderID: "12282",
+		Lines: []invoice.Line{{BookID: "print", Quantity: 2}, {BookID: "ebook", Quantity: 1}},
+	}
+	refund := func(bookID string, quantity int) invoice.Invoice {
+		return invoice.Invoice{
+			Number: "FK/2021/000001", Kind: invoice.KindCorrection, OrderID: "12282", Corrects: original.Number,
+			Lines: []invoice.Line{{BookID: bookID, Quantity: -quantity}},
+		}
+	}
+
+	tt := []struct {
+		name    string
+		inv     invoice.Invoice
+		issued  []invoice.Invoice
+		wantErr error
+	}{
+		{name: "First invoice", inv: original},
+		{name: "Second invoice", inv: original, issued: []invoice.Invoice{original}, wantErr: invoice.ErrIssued},
+		{name: "Correction", inv: refund("print", 2), issued: []invoice.Invoice{original}},
+		{name: "Correction of copies left", inv: refund("print", 1), issued: []invoice.Invoice{original, refund("print", 1)}},
+		{name: "Correction of refunded copies", inv: refund("print", 1), issued: []invoice.Invoice{original, refund("print", 2)}, wantErr: invoice.ErrInvalidCorrection},
+		{name: "Correction of more copies than invoiced", inv: refund("ebook", 2), issued: []invoice.Invoice{original}, wantErr: invoice.ErrInvalidCorrection},
+		{name: "Correction of book not invoiced", inv: refund("other", 1), issued: []invoice.Invoice{original}, wantErr: invoice.ErrInvalidCorrection},
+		{name: "Correction of missing invoice", inv: refund("print", 1), wantErr: invoice.ErrInvalidCorrection},
+	}
+	for _, tc := range tt {
+		if err := tc.inv.ValidateIssue(tc.issued); !errors.Is(err, tc.wantErr) {
+			t.Errorf("%s: want %v, got %v", tc.name, tc.wantErr, err)
+		}
+	}
+}
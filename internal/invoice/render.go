@@ -0,0 +1,250 @@
+package invoice
+
+import (
+	"bufio"
+	"bytes"
+	"fmt"
+	"html/template"
+	"io"
+	"strings"
+	"text/tabwriter"
+	"unicode/utf8"
+
+	"github.com/qba73/bookshop/internal/money"
+	"github.com/qba73/bookshop/internal/pdf"
+)
+
+// maxTitle is the number of characters of book titles
+// shown in text and PDF invoices.
+const maxTitle = 40
+
+// Title returns the document title, like "Invoice FV/2021/000001".
+func (inv Invoice) Title() string {
+	if inv.Kind == KindCorrection {
+		return "Correction invoice " + inv.Number
+	}
+	return "Invoice " + inv.Number
+}
+
+// Text knows how to write the invoice as plain text.
+func Text(w io.Writer, inv Invoice) error {
+	bw := bufio.NewWriter(w)
+	fmt.Fprintln(bw, inv.Title())
+	if inv.Kind == KindCorrection {
+		fmt.Fprintf(bw, "Corrects invoice: %s\n", inv.Corrects)
+		if inv.Reason != "" {
+			fmt.Fprintf(bw, "Reason: %s\n", inv.Reason)
+		}
+	}
+	fmt.Fprintf(bw, "Order: %s\n", inv.OrderID)
+	fmt.Fprintf(bw, "Issue date: %s\n", inv.Issued.Format("2006-01-02"))
+	fmt.Fprintf(bw, "Sale date: %s\n", inv.SaleDate.Format("2006-01-02"))
+	for _, p := range []struct {
+		label string
+		party Party
+	}{{"Seller", inv.Seller}, {"Buyer", inv.Buyer}} {
+		fmt.Fprintf(bw, "\n%s:\n", p.label)
+		for _, l := range p.party.lines() {
+			fmt.Fprintf(bw, "  %s\n", l)
+		}
+	}
+	fmt.Fprintln(bw)
+
+	// Cells are aligned right, titles are padded to look aligned left.
+	width := utf8.RuneCountInString("Title")
+	for _, l := range inv.Lines {
+		if n := utf8.RuneCountInString(truncate(l.Title, maxTitle)); n > width {
+			width = n
+		}
+	}
+	var table bytes.Buffer
+	tw := tabwriter.NewWriter(&table, 0, 0, 2, ' ', tabwriter.AlignRight)
+	fmt.Fprintf(tw, "#\t%-*s\tQty\tUnit price\tDiscount\tNet\tVAT\tTax\tGross\t\n", width, "Title")
+	for i, l := range inv.Lines {
+		fmt.Fprintf(tw, "%d\t%-*s\t%d\t%s\t%s\t%s\t%s\t%s\t%s\t\n", i+1, width, truncate(l.Title, maxTitle), l.Quantity,
+			l.UnitPrice.Decimal(), l.Discount.Decimal(), l.Net.Decimal(), l.Rate, l.Tax.Decimal(), l.Gross.Decimal())
+	}
+	fmt.Fprintln(tw, "\t\t\t\t\t\t\t\t\t")
+	fmt.Fprintln(tw, "\t\t\t\t\tNet\tVAT\tTax\tGross\t")
+	for _, s := range inv.Summary {
+		fmt.Fprintf(tw, "\t\t\t\t\t%s\t%s\t%s\t%s\t\n", s.Net.Decimal(), s.Rate, s.Tax.Decimal(), s.Gross.Decimal())
+	}
+	fmt.Fprintf(tw, "\t\t\t\tTotal\t%s\t\t%s\t%s\t\n", inv.Net.Decimal(), inv.Tax.Decimal(), inv.Gross.Decimal())
+	if err := tw.Flush(); err != nil {
+		return err
+	}
+	for _, l := range strings.Split(strings.TrimSuffix(table.String(), "\n"), "\n") {
+		fmt.Fprintln(bw, strings.TrimRight(l, " "))
+	}
+
+	fmt.Fprintln(bw)
+	for _, l := range inv.notes() {
+		fmt.Fprintln(bw, l)
+	}
+	return bw.Flush()
+}
+
+var htmlInvoice = template.Must(template.New("invoice").Funcs(template.FuncMap{
+	"inc": func(i int) int { return i + 1 },
+}).Parse(`<!DOCTYPE html>
+<html>
+<head>
+<meta charset="utf-8">
+<title>{{.Title}}</title>
+<style>
+body { font-family: sans-serif; font-size: 10pt; }
+table { border-collapse: collapse; }
+th, td { padding: 2px 6px; }
+td.num, th.num { text-align: right; }
+tbody td { border-top: 1px solid #ccc; }
+</style>
+</head>
+<body>
+<h1>{{.Title}}</h1>
+<dl>
+{{- if .Corrects}}
+<dt>Corrects invoice</dt><dd>{{.Corrects}}</dd>
+{{- if .Reason}}
+<dt>Reason</dt><dd>{{.Reason}}</dd>
+{{- end}}
+{{- end}}
+<dt>Order</dt><dd>{{.OrderID}}</dd>
+<dt>Issue date</dt><dd>{{.Issued.Format "2006-01-02"}}</dd>
+<dt>Sale date</dt><dd>{{.SaleDate.Format "2006-01-02"}}</dd>
+</dl>
+<h2>Seller</h2>
+<p>{{range .SellerLines}}{{.}}<br>{{end}}</p>
+<h2>Buyer</h2>
+<p>{{range .BuyerLines}}{{.}}<br>{{end}}</p>
+<table>
+<thead>
+<tr><th>#</th><th>Title</th><th class="num">Qty</th><th class="num">Unit price</th><th class="num">Discount</th><th class="num">Net</th><th class="num">VAT</th><th class="num">Tax</th><th class="num">Gross</th></tr>
+</thead>
+<tbody>
+{{- range $i, $l := .Lines}}
+<tr><td>{{inc $i}}</td><td>{{.Title}}</td><td class="num">{{.Quantity}}</td><td class="num">{{.UnitPrice.Decimal}}</td><td class="num">{{.Discount.Decimal}}</td><td class="num">{{.Net.Decimal}}</td><td class="num">{{.Rate}}</td><td class="num">{{.Tax.Decimal}}</td><td class="num">{{.Gross.Decimal}}</td></tr>
+{{- end}}
+</tbody>
+</table>
+<h2>VAT summary</h2>
+<table>
+<thead>
+<tr><th class="num">VAT</th><th class="num">Net</th><th class="num">Tax</th><th class="num">Gross</th></tr>
+</thead>
+<tbody>
+{{- range .Summary}}
+<tr><td class="num">{{.Rate}}</td><td class="num">{{.Net.Decimal}}</td><td class="num">{{.Tax.Decimal}}</td><td class="num">{{.Gross.Decimal}}</td></tr>
+{{- end}}
+<tr><th class="num">Total</th><th class="num">{{.Net.Decimal}}</th><th class="num">{{.Tax.Decimal}}</th><th class="num">{{.Gross.Decimal}}</th></tr>
+</tbody>
+</table>
+{{- range .Notes}}
+<p>{{.}}</p>
+{{- end}}
+</body>
+</html>
+`))
+
+// HTML knows how to write the invoice as an HTML page.
+func HTML(w io.Writer, inv Invoice) error {
+	return htmlInvoice.Execute(w, htmlView{
+		Invoice:     inv,
+		SellerLines: inv.Seller.lines(),
+		BuyerLines:  inv.Buyer.lines(),
+		Notes:       inv.notes(),
+	})
+}
+
+// htmlView is the data of the HTML template.
+type htmlView struct {
+	Invoice
+	SellerLines []string
+	BuyerLines  []string
+	Notes       []string
+}
+
+// PDF layout of the text invoice, in points.
+const (
+	pdfMargin   = 40
+	pdfFontSize = 8
+	pdfLeading  = 11
+)
+
+// PDF knows how to write the invoice as an A4 PDF document. The
+// document shows the text invoice, see Text, in a monospaced font
+// so columns stay aligned. Names and addresses keep their Polish
+// and other Central European letters; characters the standard PDF
+// fonts lack, like Cyrillic, are replaced with question marks, so
+// use HTML invoices for buyers writing in other scripts.
+func PDF(w io.Writer, inv Invoice) error {
+	var buf bytes.Buffer
+	if err := Text(&buf, inv); err != nil {
+		return err
+	}
+	lines := strings.Split(strings.TrimRight(buf.String(), "\n"), "\n")
+
+	doc := pdf.New(pdf.A4)
+	perPage := int((doc.Size().Height - 2*pdfMargin) / pdfLeading)
+	var page *pdf.Page
+	for i, l := range lines {
+		if i%perPage == 0 {
+			page = doc.AddPage()
+		}
+		font := pdf.Courier
+		if i == 0 {
+			font = pdf.CourierBold
+		}
+		y := doc.Size().Height - pdfMargin - float64(i%perPage+1)*pdfLeading
+		page.Text(pdfMargin, y, font, pdfFontSize, l)
+	}
+	_, err := doc.WriteTo(w)
+	return err
+}
+
+// lines returns the party name, address and VAT ID as lines.
+func (p Party) lines() []string {
+	var lines []string
+	if p.Name != "" {
+		lines = append(lines, p.Name)
+	}
+	for _, l := range strings.Split(p.Address, "\n") {
+		if l = strings.TrimSpace(l); l != "" {
+			lines = append(lines, l)
+		}
+	}
+	if p.Country != "" {
+		lines = append(lines, p.Country)
+	}
+	if p.TaxID != "" {
+		lines = append(lines, "VAT ID: "+p.TaxID)
+	}
+	return lines
+}
+
+// notes returns notes printed below invoice totals.
+func (inv Invoice) notes() []string {
+	prices := "Unit prices and discounts exclude VAT."
+	if inv.PricesIncludeTax {
+		prices = "Unit prices and discounts include VAT."
+	}
+	notes := []string{
+		fmt.Sprintf("Amounts in %s. %s", inv.Currency, prices),
+		fmt.Sprintf("Total discount: %s", inv.Discount),
+	}
+	if inv.Gross.IsNegative() {
+		refund, _ := money.New(0, inv.Gross.Currency()).Sub(inv.Gross)
+		notes = append(notes, fmt.Sprintf("Amount refunded: %s", refund))
+	} else {
+		notes = append(notes, fmt.Sprintf("Amount paid: %s", inv.Gross))
+	}
+	return notes
+}
+
+// truncate shortens s to n characters.
+func truncate(s string, n int) string {
+	if utf8.RuneCountInString(s) <= n {
+		return s
+	}
+	r := []rune(s)
+	return string(r[:n-3]) + "..."
+}
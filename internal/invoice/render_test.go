@@ -0,0 +1,142 @@
+package invoice_test
+
+import (
+	"bytes"
+	"strings"
+	"testing"
+
+	"github.com/google/go-cmp/cmp"
+	"github.com/qba73/bookshop/internal/invoice"
+)
+
+func issue(t *testing.T) (*invoice.Service, invoice.Invoice) {
+	t.Helper()
+
+	s, _, books := newService(t)
+	inv, err := s.Issue(newOrder(t, books, "12282"), customer, issuedAt)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return s, inv
+}
+
+func TestText(t *testing.T) {
+	t.Parallel()
+
+	_, inv := issue(t)
+	var buf bytes.Buffer
+	if err := invoice.Text(&buf, inv); err != nil {
+		t.Fatal(err)
+	}
+
+	want := `Invoice FV/2021/000001
+Order: 12282
+Issue date: 2021-06-16
+Sale date: 2021-06-15
+
+Seller:
+  Bookshop Sp. z o.o.
+  ul. Długa 1
+  00-001 Warszawa
+  PL
+  VAT ID: PL5260000000
+
+Buyer:
+  Mr Jan Kowalski
+  ul. Krótka 2
+  30-001 Kraków
+  PL
+
+  #  Title               Qty  Unit price  Discount    Net  VAT   Tax  Gross
+  1  Learn Go              2       39.90      0.00  76.00   5%  3.80  79.80
+  2  Learn Go <Digital>    1       24.60      4.60  16.26  23%  3.74  20.00
+
+                                                      Net  VAT   Tax  Gross
+                                                    16.26  23%  3.74  20.00
+                                                    76.00   5%  3.80  79.80
+                                             Total  92.26       7.54  99.80
+
+Amounts in PLN. Unit prices and discounts include VAT.
+Total discount: 4.60 PLN
+Amount paid: 99.80 PLN
+`
+	if got := buf.String(); want != got {
+		t.Error(cmp.Diff(want, got))
+	}
+}
+
+func TestText_Correction(t *testing.T) {
+	t.Parallel()
+
+	s, inv := issue(t)
+	corr, err := s.Correct(inv.Number, map[string]int{"print": 1}, "Damaged copy", issuedAt)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var buf bytes.Buffer
+	if err := invoice.Text(&buf, corr); err != nil {
+		t.Fatal(err)
+	}
+
+	got := buf.String()
+	for _, want := range []string{
+		"Correction invoice FK/2021/000001\nCorrects invoice: FV/2021/000001\nReason: Damaged copy\n",
+		"  1  Learn Go   -1       39.90      0.00  -38.00   5%  -1.90  -39.90\n",
+		"Amount refunded: 39.90 PLN\n",
+	} {
+		if !strings.Contains(got, want) {
+			t.Errorf("correction does not contain %q:\n%s", want, got)
+		}
+	}
+}
+
+func TestHTML(t *testing.T) {
+	t.Parallel()
+
+	_, inv := issue(t)
+	var buf bytes.Buffer
+	if err := invoice.HTML(&buf, inv); err != nil {
+		t.Fatal(err)
+	}
+
+	got := buf.String()
+	for _, want := range []string{
+		"<title>Invoice FV/2021/000001</title>",
+		"<p>Mr Jan Kowalski<br>ul. Krótka 2<br>30-001 Kraków<br>PL<br></p>",
+		`<tr><td>2</td><td>Learn Go &lt;Digital&gt;</td><td class="num">1</td><td class="num">24.60</td><td class="num">4.60</td><td class="num">16.26</td><td class="num">23%</td><td class="num">3.74</td><td class="num">20.00</td></tr>`,
+		`<tr><td class="num">5%</td><td class="num">76.00</td><td class="num">3.80</td><td class="num">79.80</td></tr>`,
+		`<tr><th class="num">Total</th><th class="num">92.26</th><th class="num">7.54</th><th class="num">99.80</th></tr>`,
+		"<p>Amount paid: 99.80 PLN</p>",
+	} {
+		if !strings.Contains(got, want) {
+			t.Errorf("HTML does not contain %q:\n%s", want, got)
+		}
+	}
+	if strings.Contains(got, "Corrects invoice") {
+		t.Error("invoice shows a corrected invoice")
+	}
+}
+
+func TestPDF(t *testing.T) {
+	t.Parallel()
+
+	_, inv := issue(t)
+	var buf bytes.Buffer
+	if err := invoice.PDF(&buf, inv); err != nil {
+		t.Fatal(err)
+	}
+
+	got := buf.String()
+	for _, want := range []string{
+		"%PDF-1.4\n",
+		"/Count 1 ",
+		"(Invoice FV/2021/000001)",
+		"(  ul. D\x08uga 1)",
+		"(                                             Total  92.26       7.54  99.80)",
+		"%%EOF\n",
+	} {
+		if !strings.Contains(got, want) {
+			t.Errorf("PDF does not contain %q", want)
+		}
+	}
+}
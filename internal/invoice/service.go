@@ -0,0 +1,265 @@
+package invoice
+
+import (
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/qba73/bookshop/internal/bookshop"
+	"github.com/qba73/bookshop/internal/bookshop/order"
+	"github.com/qba73/bookshop/internal/money"
+	"github.com/qba73/bookshop/internal/tax"
+)
+
+// Books looks up books ordered by customers,
+// for example a bookshop.Store.
+type Books interface {
+	Get(id string) (bookshop.Book, error)
+}
+
+// Service knows how to issue invoices and correction invoices.
+type Service struct {
+	store  Store
+	books  Books
+	seller Party
+}
+
+// NewService knows how to construct a service issuing invoices
+// of the seller to the store and looking up titles of ordered
+// books in books.
+func NewService(store Store, books Books, seller Party) *Service {
+	return &Service{store: store, books: books, seller: seller}
+}
+
+// Issue knows how to issue the invoice of the paid order sold to
+// the customer at the given time, addressed to the customer billing
+// address. The sale date is the date the order was paid. Tax is the
+// tax recorded on the order when it was placed, see tax.Calculator.
+// The invoiced amount must be the amount paid for the order, otherwise
+// the error matches ErrAmountMismatch. Each order gets a single invoice,
+// refunds are invoiced with Correct.
+func (s *Service) Issue(o *order.Order, c bookshop.Customer, at time.Time) (Invoice, error) {
+	switch o.CurrentStatus() {
+	case order.StatusPaid, order.StatusShipped, order.StatusDelivered:
+	default:
+		return Invoice{}, fmt.Errorf("order %s: %w", o.ID(), ErrNotPaid)
+	}
+	paid, _ := o.StatusTime(order.StatusPaid)
+
+	bd, err := tax.Order(o)
+	if err != nil {
+		return Invoice{}, err
+	}
+	if !bd.Gross.Equal(o.Paid) {
+		return Invoice{}, fmt.Errorf("order %s: %w: invoiced %v, paid %v", o.ID(), ErrAmountMismatch, bd.Gross, o.Paid)
+	}
+	inclusive := o.Tax.PricesIncludeTax
+	inv := Invoice{
+		Kind:     KindInvoice,
+		OrderID:  o.ID(),
+		Issued:   at,
+		SaleDate: paid,
+		Seller:   s.seller,
+		Buyer: Party{
+			Name:    strings.TrimSpace(c.Title + " " + c.Name),
+			Address: billingAddress(c.Billing),
+			Country: c.Billing.Country,
+		},
+		Currency:         o.Currency(),
+		PricesIncludeTax: inclusive,
+		Summary:          bd.Summary,
+		Net:              bd.Net,
+		Tax:              bd.Tax,
+		Gross:            bd.Gross,
+	}
+	for i, it := range o.Items {
+		b, err := s.books.Get(it.BookID)
+		if err != nil {
+			return Invoice{}, fmt.Errorf("order %s: %w", o.ID(), err)
+		}
+		tl := bd.Lines[i]
+		l := Line{
+			BookID:    it.BookID,
+			Title:     b.Title,
+			Quantity:  it.Quantity,
+			UnitPrice: it.ListPrice,
+			Rate:      tl.Rate,
+			Net:       tl.Net,
+			Tax:       tl.Tax,
+			Gross:     tl.Gross,
+		}
+		subtotal, err := it.Subtotal()
+		if err != nil {
+			return Invoice{}, fmt.Errorf("order %s: book %s: %w", o.ID(), it.BookID, err)
+		}
+		if l.Discount, err = subtotal.Sub(l.base(inclusive)); err != nil {
+			return Invoice{}, fmt.Errorf("order %s: book %s: %w", o.ID(), it.BookID, err)
+		}
+		if inv.Discount, err = inv.Discount.Add(l.Discount); err != nil {
+			return Invoice{}, fmt.Errorf("order %s: %w", o.ID(), err)
+		}
+		inv.Lines = append(inv.Lines, l)
+	}
+
+	if err := s.store.Issue(&inv); err != nil {
+		return Invoice{}, err
+	}
+	return inv, nil
+}
+
+// Correct knows how to issue a correction invoice of the invoice with
+// the given number for books refunded to the customer. Quantities map
+// book IDs to the number of copies refunded; nil refunds all copies
+// not refunded by earlier corrections. Refunds of some copies of a line
+// are proportional to the line value, the last copies refunded take
+// what is left of it, so corrections add up to the invoice exactly.
+func (s *Service) Correct(number string, quantities map[string]int, reason string, at time.Time) (Invoice, error) {
+	inv, err := s.store.Invoice(number)
+	if err != nil {
+		return Invoice{}, err
+	}
+	if inv.Kind != KindInvoice {
+		return Invoice{}, fmt.Errorf("invoice %s: %w: only invoices can be corrected", number, ErrInvalidCorrection)
+	}
+	for id := range quantities {
+		if !inv.hasBook(id) {
+			return Invoice{}, fmt.Errorf("invoice %s: %w: book %s not invoiced", number, ErrInvalidCorrection, id)
+		}
+	}
+
+	// Copies and amounts refunded by earlier corrections, by book ID.
+	refunded := make(map[string]int)
+	refundedBase := make(map[string]money.Money)
+	invs, err := s.store.OrderInvoices(inv.OrderID)
+	if err != nil {
+		return Invoice{}, err
+	}
+	for _, v := range invs {
+		if v.Corrects != number {
+			continue
+		}
+		for _, l := range v.Lines {
+			refunded[l.BookID] -= l.Quantity
+			if refundedBase[l.BookID], err = refundedBase[l.BookID].Sub(l.base(v.PricesIncludeTax)); err != nil {
+				return Invoice{}, fmt.Errorf("invoice %s: %w", v.Number, err)
+			}
+		}
+	}
+
+	inclusive := inv.PricesIncludeTax
+	corr := Invoice{
+		Kind:             KindCorrection,
+		OrderID:          inv.OrderID,
+		Corrects:         number,
+		Reason:           reason,
+		Issued:           at,
+		SaleDate:         inv.SaleDate,
+		Seller:           inv.Seller,
+		Buyer:            inv.Buyer,
+		Currency:         inv.Currency,
+		PricesIncludeTax: inclusive,
+	}
+	amounts := make(map[tax.Rate]money.Money)
+	for _, l := range inv.Lines {
+		left := l.Quantity - refunded[l.BookID]
+		q := left
+		if quantities != nil {
+			q = quantities[l.BookID]
+		}
+		if q == 0 {
+			continue
+		}
+		if q < 0 || q > left {
+			return Invoice{}, fmt.Errorf("invoice %s: book %s: %w: refund of %d copies, %d left", number, l.BookID, ErrInvalidCorrection, q, left)
+		}
+
+		var base money.Money
+		if q == left {
+			base, err = l.base(inclusive).Sub(refundedBase[l.BookID])
+		} else {
+			base, err = l.base(inclusive).MulRat(int64(q), int64(l.Quantity), money.RoundHalfUp)
+		}
+		if err != nil {
+			return Invoice{}, fmt.Errorf("invoice %s: book %s: %w", number, l.BookID, err)
+		}
+		c, err := correctLine(l, q, base, inclusive)
+		if err != nil {
+			return Invoice{}, fmt.Errorf("invoice %s: book %s: %w", number, l.BookID, err)
+		}
+		corr.Lines = append(corr.Lines, c)
+		if amounts[l.Rate], err = amounts[l.Rate].Add(c.base(inclusive)); err != nil {
+			return Invoice{}, fmt.Errorf("invoice %s: %w", number, err)
+		}
+		if corr.Discount, err = corr.Discount.Add(c.Discount); err != nil {
+			return Invoice{}, fmt.Errorf("invoice %s: %w", number, err)
+		}
+	}
+	if len(corr.Lines) == 0 {
+		return Invoice{}, fmt.Errorf("invoice %s: %w: nothing to refund", number, ErrInvalidCorrection)
+	}
+
+	sum, err := tax.Summarize(amounts, inclusive)
+	if err != nil {
+		return Invoice{}, fmt.Errorf("invoice %s: %w", number, err)
+	}
+	corr.Summary, corr.Net, corr.Tax, corr.Gross = sum.Summary, sum.Net, sum.Tax, sum.Gross
+
+	if err := s.store.Issue(&corr); err != nil {
+		return Invoice{}, err
+	}
+	return corr, nil
+}
+
+// billingAddress returns the address without the country,
+// which parties have on their own.
+func billingAddress(a bookshop.Address) string {
+	a.Country = ""
+	return strings.Join(a.Lines(), "\n")
+}
+
+// correctLine returns the correction of q copies of the line
+// refunded for the base amount.
+func correctLine(l Line, q int, base money.Money, inclusive bool) (Line, error) {
+	neg, err := money.New(0, base.Currency()).Sub(base)
+	if err != nil {
+		return Line{}, err
+	}
+	c := Line{
+		BookID:    l.BookID,
+		Title:     l.Title,
+		Quantity:  -q,
+		UnitPrice: l.UnitPrice,
+		Rate:      l.Rate,
+	}
+	if c.Net, c.Tax, c.Gross, err = tax.Split(neg, l.Rate, inclusive); err != nil {
+		return Line{}, err
+	}
+	subtotal, err := l.UnitPrice.Mul(int64(-q))
+	if err != nil {
+		return Line{}, err
+	}
+	if c.Discount, err = subtotal.Sub(neg); err != nil {
+		return Line{}, err
+	}
+	return c, nil
+}
+
+// base returns the amount tax of the line is calculated from,
+// the gross amount when prices include tax and the net amount
+// otherwise.
+func (l Line) base(inclusive bool) money.Money {
+	if inclusive {
+		return l.Gross
+	}
+	return l.Net
+}
+
+// hasBook reports whether the book is invoiced.
+func (inv Invoice) hasBook(bookID string) bool {
+	for _, l := range inv.Lines {
+		if l.BookID == bookID {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,92 @@
+package invoice
+
+import (
+	"fmt"
+	"sync"
+)
+
+// Store represents a storage for issued invoices.
+type Store interface {
+	// Issue numbers the invoice with the next number of its
+	// series and saves it. The number is assigned in the same
+	// transaction the invoice is saved in, so an invoice that
+	// fails to be saved leaves no gap in the series. The invoice
+	// is checked with ValidateIssue in the same transaction, so
+	// it returns an error matching ErrIssued when an invoice of
+	// the order has already been issued and ErrInvalidCorrection
+	// when a correction refunds more than is left.
+	Issue(inv *Invoice) error
+	// Invoice returns the invoice with the given number.
+	Invoice(number string) (Invoice, error)
+	// OrderInvoices returns the invoice of the order and its
+	// corrections, in the order they were issued.
+	OrderInvoices(orderID string) ([]Invoice, error)
+}
+
+// MemoryStore is a Store that keeps invoices in memory.
+// It is safe for concurrent use.
+type MemoryStore struct {
+	mu       sync.Mutex
+	invoices []Invoice
+	// last holds the last number issued in each series.
+	last map[string]int
+}
+
+// NewMemoryStore knows how to construct an empty MemoryStore.
+func NewMemoryStore() *MemoryStore {
+	return &MemoryStore{last: make(map[string]int)}
+}
+
+// Issue numbers the invoice with the next number of its series
+// and saves it.
+func (s *MemoryStore) Issue(inv *Invoice) error {
+	if err := inv.Validate(); err != nil {
+		return err
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	var issued []Invoice
+	for _, v := range s.invoices {
+		if v.OrderID == inv.OrderID {
+			issued = append(issued, v)
+		}
+	}
+	if err := inv.ValidateIssue(issued); err != nil {
+		return err
+	}
+	series := inv.Series()
+	inv.SetNumber(s.last[series] + 1)
+	s.last[series] = inv.Seq
+	s.invoices = append(s.invoices, *inv)
+	return nil
+}
+
+// Invoice returns the invoice with the given number.
+func (s *MemoryStore) Invoice(number string) (Invoice, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	for _, v := range s.invoices {
+		if v.Number == number {
+			return v, nil
+		}
+	}
+	return Invoice{}, fmt.Errorf("invoice %s: %w", number, ErrNotFound)
+}
+
+// OrderInvoices returns the invoice of the order and its
+// corrections, in the order they were issued.
+func (s *MemoryStore) OrderInvoices(orderID string) ([]Invoice, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	var invs []Invoice
+	for _, v := range s.invoices {
+		if v.OrderID == orderID {
+			invs = append(invs, v)
+		}
+	}
+	return invs, nil
+}
@@ -0,0 +1,191 @@
+// Package label prints mailing labels of shipped orders
+// on sheets of self-adhesive labels.
+package label
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"sort"
+	"strings"
+	"time"
+	"unicode/utf8"
+
+	"github.com/qba73/bookshop/internal/bookshop"
+	"github.com/qba73/bookshop/internal/bookshop/order"
+	"github.com/qba73/bookshop/internal/pdf"
+)
+
+// ErrDoesNotFit is returned when labels have more lines,
+// or longer lines, than fit on a sheet label.
+var ErrDoesNotFit = errors.New("label does not fit")
+
+// courierWidth is the width of Courier glyphs in font size units.
+const courierWidth = 0.6
+
+// Label is a mailing label of an order.
+type Label struct {
+	OrderID string
+	Lines   []string
+}
+
+// Sheet describes a sheet of labels. Lengths are in points,
+// see pdf.Mm.
+type Sheet struct {
+	Name          string
+	Page          pdf.Size
+	Columns, Rows int
+	// Width and Height are the size of a label.
+	Width, Height float64
+	// Left and Top are the page margins before
+	// the first column and row of labels.
+	Left, Top float64
+	// Padding is the blank margin inside labels.
+	Padding float64
+	// FontSize is the size of the monospaced font labels
+	// are printed in.
+	FontSize float64
+}
+
+// Avery3x8 is a sheet of 24 labels 70 x 36 mm, 3 columns
+// by 8 rows on A4, like Avery 3475.
+var Avery3x8 = Sheet{
+	Name:     "Avery 3x8",
+	Page:     pdf.A4,
+	Columns:  3,
+	Rows:     8,
+	Width:    pdf.Mm(70),
+	Height:   pdf.Mm(36),
+	Top:      pdf.Mm(4.5),
+	Padding:  pdf.Mm(5),
+	FontSize: 9,
+}
+
+// leading returns the distance between label lines.
+func (s Sheet) leading() float64 {
+	return s.FontSize * 1.2
+}
+
+// Lines returns the number of lines fitting on a label.
+func (s Sheet) Lines() int {
+	return int((s.Height - 2*s.Padding) / s.leading())
+}
+
+// Chars returns the number of characters fitting in a label line.
+func (s Sheet) Chars() int {
+	return int((s.Width - 2*s.Padding) / (s.FontSize * courierWidth))
+}
+
+// LabelOptions returns options of customer labels fitting
+// on the sheet, for parcels sent from the country.
+func (s Sheet) LabelOptions(from string) bookshop.LabelOptions {
+	return bookshop.LabelOptions{From: from, Width: s.Chars(), Lines: s.Lines()}
+}
+
+// fits reports whether the label fits on a sheet label.
+func (s Sheet) fits(l Label) bool {
+	if len(l.Lines) > s.Lines() {
+		return false
+	}
+	for _, line := range l.Lines {
+		if utf8.RuneCountInString(line) > s.Chars() {
+			return false
+		}
+	}
+	return true
+}
+
+// PDF knows how to write the labels as a PDF document of sheets.
+// Labels fill rows left to right, top to bottom, and a new page
+// is started when a sheet is full. Labels made with the sheet
+// LabelOptions always fit. Labels that do not fit are left out
+// and reported in an error matching ErrDoesNotFit, after the
+// document with the other labels is written.
+func PDF(w io.Writer, s Sheet, labels []Label) error {
+	perPage := s.Columns * s.Rows
+	if perPage <= 0 || s.FontSize <= 0 {
+		return fmt.Errorf("invalid sheet %q", s.Name)
+	}
+
+	doc := pdf.New(s.Page)
+	var (
+		page    *pdf.Page
+		n       int
+		skipped []string
+	)
+	for i, l := range labels {
+		if !s.fits(l) {
+			id := l.OrderID
+			if id == "" {
+				id = fmt.Sprintf("#%d", i+1)
+			}
+			skipped = append(skipped, id)
+			continue
+		}
+		pos := n % perPage
+		if pos == 0 {
+			page = doc.AddPage()
+		}
+		n++
+		col, row := pos%s.Columns, pos/s.Columns
+		x := s.Left + float64(col)*s.Width + s.Padding
+		// The first baseline is a font size below the label top.
+		y := s.Page.Height - s.Top - float64(row)*s.Height - s.Padding - s.FontSize
+		for _, line := range l.Lines {
+			page.Text(x, y, pdf.Courier, s.FontSize, line)
+			y -= s.leading()
+		}
+	}
+	if _, err := doc.WriteTo(w); err != nil {
+		return err
+	}
+	if len(skipped) > 0 {
+		return fmt.Errorf("orders %s: %w", strings.Join(skipped, ", "), ErrDoesNotFit)
+	}
+	return nil
+}
+
+// Customers is the interface that wraps the Customer method
+// of bookshop.CustomerStore.
+type Customers interface {
+	Customer(id string) (bookshop.Customer, error)
+}
+
+// Shipments knows how to make labels of the orders shipped on the
+// day, in the order they were shipped. The day is taken in the
+// location of day. Orders must belong to customers. Use options
+// of Sheet.LabelOptions for labels fitting on the sheet.
+func Shipments(orders []*order.Order, customers Customers, day time.Time, opts bookshop.LabelOptions) ([]Label, error) {
+	type shipment struct {
+		o  *order.Order
+		at time.Time
+	}
+	var shipped []shipment
+	y, m, d := day.Date()
+	for _, o := range orders {
+		at, ok := o.StatusTime(order.StatusShipped)
+		if !ok {
+			continue
+		}
+		if ay, am, ad := at.In(day.Location()).Date(); ay != y || am != m || ad != d {
+			continue
+		}
+		shipped = append(shipped, shipment{o: o, at: at})
+	}
+	sort.SliceStable(shipped, func(i, j int) bool {
+		return shipped[i].at.Before(shipped[j].at)
+	})
+
+	var labels []Label
+	for _, s := range shipped {
+		if s.o.CustomerID == "" {
+			return nil, fmt.Errorf("order %s: no customer", s.o.OrderID)
+		}
+		c, err := customers.Customer(s.o.CustomerID)
+		if err != nil {
+			return nil, fmt.Errorf("order %s: %w", s.o.OrderID, err)
+		}
+		labels = append(labels, Label{OrderID: s.o.OrderID, Lines: c.Label(opts)})
+	}
+	return labels, nil
+}
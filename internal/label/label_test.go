@@ -0,0 +1,155 @@
+package label_test
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/google/go-cmp/cmp"
+	"github.com/qba73/bookshop/internal/bookshop"
+	"github.com/qba73/bookshop/internal/bookshop/order"
+	"github.com/qba73/bookshop/internal/label"
+)
+
+func TestAvery3x8(t *testing.T) {
+	t.Parallel()
+
+	if got := label.Avery3x8.Lines(); got != 6 {
+		t.Errorf("Lines() = %d, want: 6", got)
+	}
+	// 60 mm of Courier 9pt glyphs 5.4pt wide.
+	if got := label.Avery3x8.Chars(); got != 31 {
+		t.Errorf("Chars() = %d, want: 31", got)
+	}
+}
+
+func TestPDF(t *testing.T) {
+	t.Parallel()
+
+	var labels []label.Label
+	for i := 1; i <= 25; i++ {
+		labels = append(labels, label.Label{
+			OrderID: fmt.Sprint(i),
+			Lines:   []string{fmt.Sprintf("Customer %d", i), "ul. Długa 1", "00-238 Warszawa"},
+		})
+	}
+	labels[1].Lines[1] = "ul. Marszałkowska 140 lok. 12 B"
+
+	var buf bytes.Buffer
+	if err := label.PDF(&buf, label.Avery3x8, labels); err != nil {
+		t.Fatal(err)
+	}
+	got := buf.String()
+	for _, want := range []string{
+		"/Count 2 /MediaBox [0 0 595.28 841.89]",
+		// First label, top left.
+		"BT /F3 9 Tf 14.17 805.96 Td (Customer 1) Tj ET",
+		"BT /F3 9 Tf 14.17 795.16 Td (ul. D\x08uga 1) Tj ET",
+		// Second column, the longest line fitting.
+		"BT /F3 9 Tf 212.6 795.16 Td (ul. Marsza\x08kowska 140 lok. 12 B) Tj ET",
+		// Second row.
+		"BT /F3 9 Tf 14.17 703.91 Td (Customer 4) Tj ET",
+		// Last label of the first sheet, bottom right.
+		"BT /F3 9 Tf 411.02 91.63 Td (Customer 24) Tj ET",
+		// Next sheet.
+		"BT /F3 9 Tf 14.17 805.96 Td (Customer 25) Tj ET",
+	} {
+		if !strings.Contains(got, want) {
+			t.Errorf("PDF does not contain %q", want)
+		}
+	}
+}
+
+func TestPDF_DoesNotFit(t *testing.T) {
+	t.Parallel()
+
+	labels := []label.Label{
+		{OrderID: "1", Lines: []string{"1", "2", "3", "4", "5", "6", "7"}},
+		{OrderID: "2", Lines: []string{"Customer 2", "ul. Długa 1", "00-238 Warszawa"}},
+		{Lines: []string{"Customer 3", "ul. Marszałkowska 140 lok. 12 klatka B"}},
+	}
+	var buf bytes.Buffer
+	err := label.PDF(&buf, label.Avery3x8, labels)
+	if !errors.Is(err, label.ErrDoesNotFit) {
+		t.Fatalf("want ErrDoesNotFit, got %v", err)
+	}
+	if want := "orders 1, #3: "; !strings.HasPrefix(err.Error(), want) {
+		t.Errorf("want error starting with %q, got %q", want, err)
+	}
+	// Labels that fit are printed from the first position.
+	if want := "BT /F3 9 Tf 14.17 805.96 Td (Customer 2) Tj ET"; !strings.Contains(buf.String(), want) {
+		t.Errorf("PDF does not contain %q", want)
+	}
+	if strings.Contains(buf.String(), "Customer 3") {
+		t.Error("PDF contains label that does not fit")
+	}
+}
+
+func TestShipments(t *testing.T) {
+	t.Parallel()
+
+	customers, err := bookshop.NewMemoryCustomerStore(
+		bookshop.Customer{
+			ID: "anna", Title: "Mrs", Name: "Anna Nowak", Email: "anna@example.com",
+			Billing: bookshop.Address{Street: "ul. Długa 12", City: "Warszawa", Postcode: "00-238", Country: "PL"},
+		},
+		bookshop.Customer{
+			ID: "james", Title: "Mr", Name: "James Brown", Email: "james@example.com",
+			Billing: bookshop.Address{Street: "43 Temple Gardens", City: "Dublin 9", Postcode: "D09 F2X3", Country: "IE"},
+		},
+	)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	warsaw := time.FixedZone("CEST", 2*60*60)
+	day := time.Date(2021, time.June, 15, 0, 0, 0, 0, warsaw)
+	newOrder := func(id, customerID string, shipped time.Time) *order.Order {
+		o, err := order.New(id)
+		if err != nil {
+			t.Fatal(err)
+		}
+		o.CustomerID = customerID
+		statuses := []order.Status{order.StatusPlaced, order.StatusPaid}
+		if !shipped.IsZero() {
+			statuses = append(statuses, order.StatusShipped)
+		}
+		for _, s := range statuses {
+			if err := o.TransitionTo(s, shipped); err != nil {
+				t.Fatal(err)
+			}
+		}
+		return o
+	}
+	orders := []*order.Order{
+		newOrder("1", "james", time.Date(2021, time.June, 15, 14, 0, 0, 0, warsaw)),
+		newOrder("2", "anna", time.Date(2021, time.June, 15, 9, 0, 0, 0, warsaw)),
+		// Shipped on June 14 in Warsaw, but June 15 in Tokyo.
+		newOrder("3", "anna", time.Date(2021, time.June, 14, 23, 30, 0, 0, warsaw).In(time.FixedZone("JST", 9*60*60))),
+		newOrder("4", "anna", time.Date(2021, time.June, 16, 9, 0, 0, 0, warsaw)),
+		newOrder("5", "anna", time.Time{}),
+	}
+
+	got, err := label.Shipments(orders, customers, day, bookshop.LabelOptions{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := []label.Label{
+		{OrderID: "2", Lines: []string{"Mrs Anna Nowak", "ul. Długa 12", "00-238 Warszawa"}},
+		{OrderID: "1", Lines: []string{"Mr James Brown", "43 Temple Gardens", "D09 F2X3 DUBLIN 9", "IRELAND"}},
+	}
+	if !cmp.Equal(want, got) {
+		t.Error(cmp.Diff(want, got))
+	}
+
+	orders = append(orders, newOrder("6", "", day.Add(time.Hour)), newOrder("7", "unknown", day.Add(time.Hour)))
+	if _, err := label.Shipments(orders[:6], customers, day, bookshop.LabelOptions{}); err == nil {
+		t.Error("want error for order without customer, got nil")
+	}
+	if _, err := label.Shipments(orders[6:], customers, day, bookshop.LabelOptions{}); !errors.Is(err, bookshop.ErrCustomerNotFound) {
+		t.Errorf("want ErrCustomerNotFound, got %v", err)
+	}
+}
@@ -0,0 +1,106 @@
+package money
+
+import (
+	"fmt"
+	"strings"
+)
+
+// Locale is a BCP 47 language tag that selects how amounts
+// are formatted for display.
+type Locale string
+
+// Locales amounts can be formatted for.
+const (
+	LocalePL Locale = "pl-PL"
+	LocaleDE Locale = "de-DE"
+	LocaleUS Locale = "en-US"
+	LocaleGB Locale = "en-GB"
+)
+
+// localeFormat describes how a locale writes amounts.
+type localeFormat struct {
+	group, decimal string
+	// symbolFirst puts the currency symbol before the number.
+	symbolFirst bool
+	// space separates the symbol from the number.
+	space bool
+}
+
+// Thousands in pl-PL are grouped with a no-break space so amounts
+// are not wrapped across lines.
+var locales = map[Locale]localeFormat{
+	LocalePL: {group: "\u00a0", decimal: ",", space: true},
+	LocaleDE: {group: ".", decimal: ",", space: true},
+	LocaleUS: {group: ",", decimal: ".", symbolFirst: true},
+	LocaleGB: {group: ",", decimal: ".", symbolFirst: true},
+}
+
+// symbols maps currencies to the symbols used in each locale.
+// Currencies missing here are written with their code.
+var symbols = map[Currency]map[Locale]string{
+	PLN: {LocalePL: "zł"},
+	EUR: {LocalePL: "€", LocaleDE: "€", LocaleUS: "€", LocaleGB: "€"},
+	USD: {LocaleUS: "$", LocaleGB: "US$"},
+	GBP: {LocaleGB: "£", LocaleUS: "£", LocaleDE: "£"},
+}
+
+// ParseLocale knows how to parse a locale tag such as "pl-PL"
+// or "en_gb" into one of the supported locales.
+func ParseLocale(s string) (Locale, error) {
+	tag := strings.Replace(strings.TrimSpace(s), "_", "-", -1)
+	for l := range locales {
+		if strings.EqualFold(string(l), tag) {
+			return l, nil
+		}
+	}
+	return "", fmt.Errorf("unsupported locale %q", s)
+}
+
+// Format knows how to format the amount for display in the locale,
+// like "1 234,56 zł" in pl-PL or "$1,234.56" in en-US. Unsupported
+// locales format the amount like String does.
+func (m Money) Format(l Locale) string {
+	f, ok := locales[l]
+	if !ok {
+		return m.String()
+	}
+
+	dec := m.Decimal()
+	sign := ""
+	if strings.HasPrefix(dec, "-") {
+		sign, dec = "-", dec[1:]
+	}
+	units, frac := dec, ""
+	if i := strings.IndexByte(dec, '.'); i >= 0 {
+		units, frac = dec[:i], dec[i+1:]
+	}
+	var b strings.Builder
+	for i := range units {
+		if i > 0 && (len(units)-i)%3 == 0 {
+			b.WriteString(f.group)
+		}
+		b.WriteByte(units[i])
+	}
+	if frac != "" {
+		b.WriteString(f.decimal)
+		b.WriteString(frac)
+	}
+	number := b.String()
+
+	symbol, ok := symbols[m.currency][l]
+	if !ok {
+		symbol = string(m.currency)
+		f.symbolFirst, f.space = false, true
+	}
+	if symbol == "" {
+		return sign + number
+	}
+	sep := ""
+	if f.space {
+		sep = "\u00a0"
+	}
+	if f.symbolFirst {
+		return sign + symbol + sep + number
+	}
+	return sign + number + sep + symbol
+}
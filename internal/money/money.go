@@ -0,0 +1,353 @@
+// Package money represents amounts of money in a currency.
+//
+// Amounts are stored as an integer number of minor units, for
+// example grosze for PLN, so arithmetic is exact. Operations on
+// amounts in different currencies and operations that would
+// overflow return errors instead of wrong results.
+package money
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"math"
+	"math/big"
+	"strings"
+)
+
+var (
+	// ErrCurrencyMismatch is returned when amounts in
+	// different currencies are combined.
+	ErrCurrencyMismatch = errors.New("currency mismatch")
+	// ErrOverflow is returned when a result does not fit
+	// in the range of amounts.
+	ErrOverflow = errors.New("amount overflow")
+	// ErrInvalidCurrency is returned for malformed currency codes.
+	ErrInvalidCurrency = errors.New("invalid currency")
+	// ErrInvalidAmount is returned when an amount cannot be parsed.
+	ErrInvalidAmount = errors.New("invalid amount")
+)
+
+// Currency is an ISO 4217 currency code.
+type Currency string
+
+// Currencies the bookshop prices books in.
+const (
+	PLN Currency = "PLN"
+	EUR Currency = "EUR"
+	USD Currency = "USD"
+	GBP Currency = "GBP"
+)
+
+// minorUnits lists currencies with other than two decimal places.
+var minorUnits = map[Currency]int{
+	"BHD": 3, "CLP": 0, "HUF": 2, "ISK": 0, "JOD": 3, "JPY": 0,
+	"KRW": 0, "KWD": 3, "OMR": 3, "TND": 3, "VND": 0,
+}
+
+// ParseCurrency knows how to parse a three letter currency code,
+// ignoring case.
+func ParseCurrency(s string) (Currency, error) {
+	code := strings.ToUpper(strings.TrimSpace(s))
+	if len(code) != 3 {
+		return "", fmt.Errorf("%w: %q", ErrInvalidCurrency, s)
+	}
+	for i := 0; i < len(code); i++ {
+		if code[i] < 'A' || code[i] > 'Z' {
+			return "", fmt.Errorf("%w: %q", ErrInvalidCurrency, s)
+		}
+	}
+	return Currency(code), nil
+}
+
+// Digits returns the number of decimal places of the currency.
+func (c Currency) Digits() int {
+	if d, ok := minorUnits[c]; ok {
+		return d
+	}
+	return 2
+}
+
+// Money is an amount in a currency. The zero value is zero
+// in no currency, it can be added to and compared with amounts
+// in any currency, so sums can start from it.
+type Money struct {
+	amount   int64
+	currency Currency
+}
+
+// New knows how to construct an amount from minor units,
+// for example New(1999, PLN) is 19.99 zł.
+func New(minor int64, c Currency) Money {
+	return Money{amount: minor, currency: c}
+}
+
+// Parse knows how to parse a decimal amount in the currency
+// such as "19.99", "19,99", "-5" or "1 234.50". At most as many
+// decimal places as the currency has are accepted.
+func Parse(s string, c Currency) (Money, error) {
+	v := strings.NewReplacer(" ", "", "\u00a0", "", "_", "").Replace(strings.TrimSpace(s))
+	v = strings.Replace(v, ",", ".", 1)
+	neg := strings.HasPrefix(v, "-")
+	v = strings.TrimPrefix(v, "-")
+
+	units, frac := v, ""
+	if i := strings.IndexByte(v, '.'); i >= 0 {
+		units, frac = v[:i], v[i+1:]
+	}
+	digits := c.Digits()
+	if units == "" || !isDigits(units) || !isDigits(frac) || len(frac) > digits || (digits == 0 && strings.Contains(v, ".")) {
+		return Money{}, fmt.Errorf("%w: %q", ErrInvalidAmount, s)
+	}
+	frac += strings.Repeat("0", digits-len(frac))
+
+	n, ok := new(big.Int).SetString(units+frac, 10)
+	if !ok {
+		return Money{}, fmt.Errorf("%w: %q", ErrInvalidAmount, s)
+	}
+	if neg {
+		n.Neg(n)
+	}
+	if !n.IsInt64() {
+		return Money{}, fmt.Errorf("%w: %q", ErrOverflow, s)
+	}
+	return Money{amount: n.Int64(), currency: c}, nil
+}
+
+// Amount returns the amount in minor units.
+func (m Money) Amount() int64 {
+	return m.amount
+}
+
+// Currency returns the currency of the amount.
+func (m Money) Currency() Currency {
+	return m.currency
+}
+
+// IsZero reports whether the amount is zero.
+func (m Money) IsZero() bool {
+	return m.amount == 0
+}
+
+// IsNegative reports whether the amount is below zero.
+func (m Money) IsNegative() bool {
+	return m.amount < 0
+}
+
+// IsPositive reports whether the amount is above zero.
+func (m Money) IsPositive() bool {
+	return m.amount > 0
+}
+
+// Equal reports whether both amounts and currencies are equal.
+func (m Money) Equal(o Money) bool {
+	return m == o
+}
+
+// Add knows how to add two amounts in the same currency.
+func (m Money) Add(o Money) (Money, error) {
+	c, err := m.common(o)
+	if err != nil {
+		return Money{}, err
+	}
+	sum := m.amount + o.amount
+	if (o.amount > 0 && sum < m.amount) || (o.amount < 0 && sum > m.amount) {
+		return Money{}, fmt.Errorf("%w: %v + %v", ErrOverflow, m, o)
+	}
+	return Money{amount: sum, currency: c}, nil
+}
+
+// Sub knows how to subtract an amount in the same currency.
+func (m Money) Sub(o Money) (Money, error) {
+	c, err := m.common(o)
+	if err != nil {
+		return Money{}, err
+	}
+	diff := m.amount - o.amount
+	if (o.amount > 0 && diff > m.amount) || (o.amount < 0 && diff < m.amount) {
+		return Money{}, fmt.Errorf("%w: %v - %v", ErrOverflow, m, o)
+	}
+	return Money{amount: diff, currency: c}, nil
+}
+
+// Mul knows how to multiply the amount by n, for example
+// a unit price by a quantity.
+func (m Money) Mul(n int64) (Money, error) {
+	if m.amount == 0 || n == 0 {
+		return Money{amount: 0, currency: m.currency}, nil
+	}
+	p := m.amount * n
+	if p/n != m.amount || (m.amount == -1 && n == math.MinInt64) || (n == -1 && m.amount == math.MinInt64) {
+		return Money{}, fmt.Errorf("%w: %v * %d", ErrOverflow, m, n)
+	}
+	return Money{amount: p, currency: m.currency}, nil
+}
+
+// MulRat knows how to multiply the amount by num/den,
+// rounding the result to minor units with the mode.
+func (m Money) MulRat(num, den int64, mode RoundingMode) (Money, error) {
+	if den == 0 {
+		return Money{}, fmt.Errorf("%w: division by zero", ErrInvalidAmount)
+	}
+	n := new(big.Int).Mul(big.NewInt(m.amount), big.NewInt(num))
+	q, err := mode.divide(n, big.NewInt(den))
+	if err != nil {
+		return Money{}, err
+	}
+	if !q.IsInt64() {
+		return Money{}, fmt.Errorf("%w: %v * %d/%d", ErrOverflow, m, num, den)
+	}
+	return Money{amount: q.Int64(), currency: m.currency}, nil
+}
+
+// Percent knows how to compute p percent of the amount,
+// rounded to minor units with the mode.
+func (m Money) Percent(p int64, mode RoundingMode) (Money, error) {
+	return m.MulRat(p, 100, mode)
+}
+
+// Discount knows how to reduce the amount by p percent. The
+// discount, not the reduced amount, is rounded with the mode,
+// so RoundDown never gives away more than p percent.
+func (m Money) Discount(p int64, mode RoundingMode) (Money, error) {
+	d, err := m.Percent(p, mode)
+	if err != nil {
+		return Money{}, err
+	}
+	return m.Sub(d)
+}
+
+// Allocate knows how to split the amount into parts proportional
+// to the weights. Parts add up to the amount exactly; minor units
+// left after rounding down go to the first parts.
+func (m Money) Allocate(weights ...int64) ([]Money, error) {
+	var total int64
+	for _, w := range weights {
+		if w < 0 {
+			return nil, fmt.Errorf("%w: negative weight %d", ErrInvalidAmount, w)
+		}
+		total += w
+	}
+	if total <= 0 {
+		return nil, fmt.Errorf("%w: weights add up to %d", ErrInvalidAmount, total)
+	}
+
+	parts := make([]Money, len(weights))
+	left := m
+	for i, w := range weights {
+		p, err := m.MulRat(w, total, RoundDown)
+		if err != nil {
+			return nil, err
+		}
+		parts[i] = p
+		left.amount -= p.amount
+	}
+	step := int64(1)
+	if left.amount < 0 {
+		step = -1
+	}
+	for i := 0; left.amount != 0; i = (i + 1) % len(parts) {
+		if weights[i] == 0 {
+			continue
+		}
+		parts[i].amount += step
+		left.amount -= step
+	}
+	return parts, nil
+}
+
+// Cmp compares two amounts in the same currency and returns
+// -1, 0 or +1 when m is less than, equal to or greater than o.
+func (m Money) Cmp(o Money) (int, error) {
+	if _, err := m.common(o); err != nil {
+		return 0, err
+	}
+	switch {
+	case m.amount < o.amount:
+		return -1, nil
+	case m.amount > o.amount:
+		return 1, nil
+	default:
+		return 0, nil
+	}
+}
+
+// Decimal returns the amount as a decimal number with
+// the number of decimal places of the currency, like "19.99".
+func (m Money) Decimal() string {
+	digits := m.currency.Digits()
+	a := new(big.Int).Abs(big.NewInt(m.amount)).String()
+	if len(a) <= digits {
+		a = strings.Repeat("0", digits-len(a)+1) + a
+	}
+	sign := ""
+	if m.amount < 0 {
+		sign = "-"
+	}
+	if digits == 0 {
+		return sign + a
+	}
+	return sign + a[:len(a)-digits] + "." + a[len(a)-digits:]
+}
+
+// String returns the amount followed by its currency code,
+// like "19.99 PLN".
+func (m Money) String() string {
+	if m.currency == "" {
+		return m.Decimal()
+	}
+	return m.Decimal() + " " + string(m.currency)
+}
+
+// moneyJSON is the JSON representation of Money.
+type moneyJSON struct {
+	Amount   int64  `json:"amount"`
+	Currency string `json:"currency,omitempty"`
+}
+
+// MarshalJSON implements json.Marshaler interface for Money.
+// Amounts are written in minor units, like {"amount":1999,"currency":"PLN"}.
+func (m Money) MarshalJSON() ([]byte, error) {
+	return json.Marshal(moneyJSON{Amount: m.amount, Currency: string(m.currency)})
+}
+
+// UnmarshalJSON implements json.Unmarshaler interface for Money.
+func (m *Money) UnmarshalJSON(data []byte) error {
+	var mj moneyJSON
+	if err := json.Unmarshal(data, &mj); err != nil {
+		return err
+	}
+	var c Currency
+	if mj.Currency != "" {
+		var err error
+		if c, err = ParseCurrency(mj.Currency); err != nil {
+			return err
+		}
+	}
+	*m = Money{amount: mj.Amount, currency: c}
+	return nil
+}
+
+// common returns the currency of a result combining m and o.
+// The zero value combines with any currency.
+func (m Money) common(o Money) (Currency, error) {
+	switch {
+	case m.currency == o.currency:
+		return m.currency, nil
+	case m == Money{}:
+		return o.currency, nil
+	case o == Money{}:
+		return m.currency, nil
+	default:
+		return "", fmt.Errorf("%w: %s and %s", ErrCurrencyMismatch, m.currency, o.currency)
+	}
+}
+
+func isDigits(s string) bool {
+	for i := 0; i < len(s); i++ {
+		if s[i] < '0' || s[i] > '9' {
+			return false
+		}
+	}
+	return true
+}
@@ -0,0 +1,269 @@
+package money_test
+
+import (
+	"encoding/json"
+	"errors"
+	"math"
+	"testing"
+
+	"github.com/google/go-cmp/cmp"
+	"github.com/qba73/bookshop/internal/money"
+)
+
+func TestParse(t *testing.T) {
+	t.Parallel()
+
+	tt := []struct {
+		name        string
+		input       string
+		currency    money.Currency
+		want        money.Money
+		expectedErr error
+	}{
+		{name: "Dot separator", input: "19.99", currency: money.PLN, want: money.New(1999, money.PLN)},
+		{name: "Comma separator", input: "19,99", currency: money.PLN, want: money.New(1999, money.PLN)},
+		{name: "Whole units", input: "20", currency: money.EUR, want: money.New(2000, money.EUR)},
+		{name: "One decimal place", input: "12.5", currency: money.PLN, want: money.New(1250, money.PLN)},
+		{name: "Grouped thousands", input: "1 234.50", currency: money.PLN, want: money.New(123450, money.PLN)},
+		{name: "Negative", input: "-5", currency: money.PLN, want: money.New(-500, money.PLN)},
+		{name: "No minor units", input: "1500", currency: "JPY", want: money.New(1500, "JPY")},
+		{name: "Three decimal places", input: "1.234", currency: "KWD", want: money.New(1234, "KWD")},
+		{name: "Too many decimal places", input: "19.999", currency: money.PLN, expectedErr: money.ErrInvalidAmount},
+		{name: "Decimals in currency without minor units", input: "15.0", currency: "JPY", expectedErr: money.ErrInvalidAmount},
+		{name: "Not a number", input: "abc", currency: money.PLN, expectedErr: money.ErrInvalidAmount},
+		{name: "Plus sign", input: "+5", currency: money.PLN, expectedErr: money.ErrInvalidAmount},
+		{name: "Empty", input: "", currency: money.PLN, expectedErr: money.ErrInvalidAmount},
+		{name: "Too large", input: "100000000000000000000", currency: money.PLN, expectedErr: money.ErrOverflow},
+	}
+
+	for _, tc := range tt {
+		got, err := money.Parse(tc.input, tc.currency)
+		if !errors.Is(err, tc.expectedErr) {
+			t.Fatalf("%s, Parse(%q) got error: %v, want: %v", tc.name, tc.input, err, tc.expectedErr)
+		}
+		if got != tc.want {
+			t.Errorf("%s, Parse(%q) = %v, want: %v", tc.name, tc.input, got, tc.want)
+		}
+	}
+}
+
+func TestParseCurrency(t *testing.T) {
+	t.Parallel()
+
+	tt := []struct {
+		input       string
+		want        money.Currency
+		expectedErr bool
+	}{
+		{input: "PLN", want: money.PLN},
+		{input: " eur ", want: money.EUR},
+		{input: "zł", expectedErr: true},
+		{input: "EURO", expectedErr: true},
+		{input: "", expectedErr: true},
+	}
+
+	for _, tc := range tt {
+		got, err := money.ParseCurrency(tc.input)
+		if (err != nil) != tc.expectedErr {
+			t.Fatalf("ParseCurrency(%q) got error: %v", tc.input, err)
+		}
+		if got != tc.want {
+			t.Errorf("ParseCurrency(%q) = %q, want: %q", tc.input, got, tc.want)
+		}
+	}
+}
+
+func TestArithmetic(t *testing.T) {
+	t.Parallel()
+
+	pln := func(a int64) money.Money { return money.New(a, money.PLN) }
+
+	tt := []struct {
+		name        string
+		fn          func() (money.Money, error)
+		want        money.Money
+		expectedErr error
+	}{
+		{name: "Add", fn: func() (money.Money, error) { return pln(1999).Add(pln(1)) }, want: pln(2000)},
+		{name: "Add to zero value", fn: func() (money.Money, error) { return money.Money{}.Add(pln(1)) }, want: pln(1)},
+		{name: "Add other currency", fn: func() (money.Money, error) { return pln(1).Add(money.New(1, money.EUR)) }, expectedErr: money.ErrCurrencyMismatch},
+		{name: "Add overflow", fn: func() (money.Money, error) { return pln(math.MaxInt64).Add(pln(1)) }, expectedErr: money.ErrOverflow},
+		{name: "Sub", fn: func() (money.Money, error) { return pln(1000).Sub(pln(1500)) }, want: pln(-500)},
+		{name: "Sub overflow", fn: func() (money.Money, error) { return pln(math.MinInt64).Sub(pln(1)) }, expectedErr: money.ErrOverflow},
+		{name: "Mul", fn: func() (money.Money, error) { return pln(1999).Mul(3) }, want: pln(5997)},
+		{name: "Mul overflow", fn: func() (money.Money, error) { return pln(math.MaxInt64 / 2).Mul(3) }, expectedErr: money.ErrOverflow},
+		{name: "Mul min by minus one", fn: func() (money.Money, error) { return pln(math.MinInt64).Mul(-1) }, expectedErr: money.ErrOverflow},
+		{name: "MulRat", fn: func() (money.Money, error) { return pln(1000).MulRat(1, 3, money.RoundHalfUp) }, want: pln(333)},
+		{name: "MulRat by zero", fn: func() (money.Money, error) { return pln(1000).MulRat(1, 0, money.RoundDown) }, expectedErr: money.ErrInvalidAmount},
+		{name: "MulRat large intermediate", fn: func() (money.Money, error) { return pln(math.MaxInt64).MulRat(2, 4, money.RoundDown) }, want: pln(math.MaxInt64 / 2)},
+		{name: "Percent", fn: func() (money.Money, error) { return pln(2499).Percent(10, money.RoundDown) }, want: pln(249)},
+		{name: "Discount", fn: func() (money.Money, error) { return pln(2499).Discount(10, money.RoundDown) }, want: pln(2250)},
+		{name: "Discount rounded half up", fn: func() (money.Money, error) { return pln(2499).Discount(10, money.RoundHalfUp) }, want: pln(2249)},
+	}
+
+	for _, tc := range tt {
+		got, err := tc.fn()
+		if !errors.Is(err, tc.expectedErr) {
+			t.Fatalf("%s got error: %v, want: %v", tc.name, err, tc.expectedErr)
+		}
+		if got != tc.want {
+			t.Errorf("%s = %v, want: %v", tc.name, got, tc.want)
+		}
+	}
+}
+
+func TestRoundingModes(t *testing.T) {
+	t.Parallel()
+
+	// Amounts are divided by ten, so 15 is a half and 14 is below.
+	tt := []struct {
+		mode money.RoundingMode
+		want map[int64]int64
+	}{
+		{mode: money.RoundDown, want: map[int64]int64{14: 1, 15: 1, 16: 1, 25: 2, -15: -1, -16: -1}},
+		{mode: money.RoundUp, want: map[int64]int64{14: 2, 15: 2, 16: 2, 25: 3, -15: -2, -16: -2}},
+		{mode: money.RoundHalfUp, want: map[int64]int64{14: 1, 15: 2, 16: 2, 25: 3, -15: -2, -16: -2}},
+		{mode: money.RoundHalfDown, want: map[int64]int64{14: 1, 15: 1, 16: 2, 25: 2, -15: -1, -16: -2}},
+		{mode: money.RoundHalfEven, want: map[int64]int64{14: 1, 15: 2, 16: 2, 25: 2, -15: -2, -16: -2}},
+	}
+
+	for _, tc := range tt {
+		for amount, want := range tc.want {
+			got, err := money.New(amount, money.PLN).MulRat(1, 10, tc.mode)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if got.Amount() != want {
+				t.Errorf("%v: %d/10 = %d, want: %d", tc.mode, amount, got.Amount(), want)
+			}
+		}
+	}
+}
+
+func TestParseRoundingMode(t *testing.T) {
+	t.Parallel()
+
+	for _, mode := range []money.RoundingMode{money.RoundDown, money.RoundUp, money.RoundHalfUp, money.RoundHalfDown, money.RoundHalfEven} {
+		got, err := money.ParseRoundingMode(mode.String())
+		if err != nil {
+			t.Fatalf("ParseRoundingMode(%q) got error: %v", mode, err)
+		}
+		if got != mode {
+			t.Errorf("ParseRoundingMode(%q) = %v, want: %v", mode, got, mode)
+		}
+	}
+	if _, err := money.ParseRoundingMode("sideways"); err == nil {
+		t.Error("ParseRoundingMode(sideways) should return error")
+	}
+}
+
+func TestAllocate(t *testing.T) {
+	t.Parallel()
+
+	tt := []struct {
+		name    string
+		amount  money.Money
+		weights []int64
+		want    []money.Money
+	}{
+		{name: "Equal parts", amount: money.New(1000, money.PLN), weights: []int64{1, 1, 1}, want: []money.Money{money.New(334, money.PLN), money.New(333, money.PLN), money.New(333, money.PLN)}},
+		{name: "Weighted parts", amount: money.New(1000, money.PLN), weights: []int64{3, 1}, want: []money.Money{money.New(750, money.PLN), money.New(250, money.PLN)}},
+		{name: "Zero weight", amount: money.New(5, money.PLN), weights: []int64{0, 1, 1}, want: []money.Money{money.New(0, money.PLN), money.New(3, money.PLN), money.New(2, money.PLN)}},
+		{name: "Negative amount", amount: money.New(-5, money.PLN), weights: []int64{1, 1}, want: []money.Money{money.New(-3, money.PLN), money.New(-2, money.PLN)}},
+	}
+
+	for _, tc := range tt {
+		got, err := tc.amount.Allocate(tc.weights...)
+		if err != nil {
+			t.Fatalf("%s, Allocate(%v) got error: %v", tc.name, tc.weights, err)
+		}
+		if !cmp.Equal(tc.want, got) {
+			t.Errorf("%s, Allocate(%v) \n%s", tc.name, tc.weights, cmp.Diff(tc.want, got))
+		}
+	}
+
+	if _, err := money.New(5, money.PLN).Allocate(0, 0); !errors.Is(err, money.ErrInvalidAmount) {
+		t.Errorf("Allocate(0, 0) got error: %v, want: %v", err, money.ErrInvalidAmount)
+	}
+}
+
+func TestCmp(t *testing.T) {
+	t.Parallel()
+
+	got, err := money.New(100, money.PLN).Cmp(money.New(200, money.PLN))
+	if err != nil || got != -1 {
+		t.Errorf("Cmp() = %d, %v, want: -1", got, err)
+	}
+	if _, err := money.New(100, money.PLN).Cmp(money.New(100, money.EUR)); !errors.Is(err, money.ErrCurrencyMismatch) {
+		t.Errorf("Cmp() in different currencies got error: %v, want: %v", err, money.ErrCurrencyMismatch)
+	}
+}
+
+func TestFormat(t *testing.T) {
+	t.Parallel()
+
+	tt := []struct {
+		amount money.Money
+		locale money.Locale
+		want   string
+	}{
+		{amount: money.New(123456, money.PLN), locale: money.LocalePL, want: "1\u00a0234,56\u00a0zł"},
+		{amount: money.New(1999, money.PLN), locale: money.LocaleUS, want: "19.99\u00a0PLN"},
+		{amount: money.New(123456, money.EUR), locale: money.LocaleDE, want: "1.234,56\u00a0€"},
+		{amount: money.New(123456, money.USD), locale: money.LocaleUS, want: "$1,234.56"},
+		{amount: money.New(-5, money.GBP), locale: money.LocaleGB, want: "-£0.05"},
+		{amount: money.New(1500, "JPY"), locale: money.LocalePL, want: "1\u00a0500\u00a0JPY"},
+		{amount: money.New(1999, money.PLN), locale: "fr-FR", want: "19.99 PLN"},
+	}
+
+	for _, tc := range tt {
+		if got := tc.amount.Format(tc.locale); got != tc.want {
+			t.Errorf("%v.Format(%s) = %q, want: %q", tc.amount, tc.locale, got, tc.want)
+		}
+	}
+}
+
+func TestString(t *testing.T) {
+	t.Parallel()
+
+	tt := []struct {
+		amount money.Money
+		want   string
+	}{
+		{amount: money.New(1999, money.PLN), want: "19.99 PLN"},
+		{amount: money.New(5, money.EUR), want: "0.05 EUR"},
+		{amount: money.New(-1234, "KWD"), want: "-1.234 KWD"},
+		{amount: money.New(1500, "JPY"), want: "1500 JPY"},
+		{amount: money.Money{}, want: "0.00"},
+	}
+
+	for _, tc := range tt {
+		if got := tc.amount.String(); got != tc.want {
+			t.Errorf("String() = %q, want: %q", got, tc.want)
+		}
+	}
+}
+
+func TestJSON(t *testing.T) {
+	t.Parallel()
+
+	m := money.New(1999, money.EUR)
+	data, err := json.Marshal(m)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want := `{"amount":1999,"currency":"EUR"}`; string(data) != want {
+		t.Errorf("Marshal() = %s, want: %s", data, want)
+	}
+
+	var got money.Money
+	if err := json.Unmarshal(data, &got); err != nil {
+		t.Fatal(err)
+	}
+	if got != m {
+		t.Errorf("Unmarshal(%s) = %v, want: %v", data, got, m)
+	}
+	if err := json.Unmarshal([]byte(`{"amount":1,"currency":"euro"}`), &got); !errors.Is(err, money.ErrInvalidCurrency) {
+		t.Errorf("Unmarshal() with invalid currency got error: %v, want: %v", err, money.ErrInvalidCurrency)
+	}
+}
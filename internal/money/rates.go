@@ -0,0 +1,261 @@
+package money
+
+import (
+	"encoding/csv"
+	"errors"
+	"fmt"
+	"io"
+	"math/big"
+	"os"
+	"sort"
+	"strings"
+	"time"
+)
+
+// ErrNoRate is returned when an exchange rate between
+// two currencies is not known.
+var ErrNoRate = errors.New("no exchange rate")
+
+// dateLayout is the layout of dates in rate tables.
+const dateLayout = "2006-01-02"
+
+// RateTable holds exchange rates published on different dates.
+// Rates published on a date replace all rates published before,
+// so each date is a complete version of the table.
+//
+// Tables are read from CSV files with a header and one rate
+// per line, where rate is the price of one unit of the from
+// currency in the to currency:
+//
+//	date,from,to,rate
+//	2021-03-01,EUR,PLN,4.5210
+//	2021-03-01,GBP,PLN,5.2433
+//
+// Lines starting with # are comments. Errors report the number
+// of the CSV record, the header is line 1.
+type RateTable struct {
+	// versions are sorted by date, oldest first.
+	versions []*Rates
+}
+
+// Rates are exchange rates published on a single date.
+type Rates struct {
+	date  time.Time
+	rates map[pair]*big.Rat
+}
+
+type pair struct {
+	from, to Currency
+}
+
+// OpenRates knows how to read a rate table from a file.
+func OpenRates(path string) (*RateTable, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	t, err := ParseRates(f)
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", path, err)
+	}
+	return t, nil
+}
+
+// ParseRates knows how to read a rate table in CSV format.
+func ParseRates(r io.Reader) (*RateTable, error) {
+	cr := csv.NewReader(r)
+	cr.Comment = '#'
+	cr.FieldsPerRecord = 4
+	cr.TrimLeadingSpace = true
+
+	header, err := cr.Read()
+	if err == io.EOF {
+		return &RateTable{}, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	want := []string{"date", "from", "to", "rate"}
+	for i := range want {
+		if strings.ToLower(strings.TrimSpace(header[i])) != want[i] {
+			return nil, fmt.Errorf("invalid header %q, want: %s", strings.Join(header, ","), strings.Join(want, ","))
+		}
+	}
+
+	byDate := make(map[time.Time]*Rates)
+	for line := 2; ; line++ {
+		record, err := cr.Read()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return nil, err
+		}
+
+		date, err := time.Parse(dateLayout, strings.TrimSpace(record[0]))
+		if err != nil {
+			return nil, fmt.Errorf("line %d: invalid date %q", line, record[0])
+		}
+		from, err := ParseCurrency(record[1])
+		if err != nil {
+			return nil, fmt.Errorf("line %d: %w", line, err)
+		}
+		to, err := ParseCurrency(record[2])
+		if err != nil {
+			return nil, fmt.Errorf("line %d: %w", line, err)
+		}
+		rate, ok := new(big.Rat).SetString(strings.TrimSpace(record[3]))
+		if !ok || rate.Sign() <= 0 || strings.ContainsAny(record[3], "/eE") {
+			return nil, fmt.Errorf("line %d: invalid rate %q", line, record[3])
+		}
+		if from == to {
+			return nil, fmt.Errorf("line %d: rate of %s to itself", line, from)
+		}
+
+		v, ok := byDate[date]
+		if !ok {
+			v = &Rates{date: date, rates: make(map[pair]*big.Rat)}
+			byDate[date] = v
+		}
+		p := pair{from: from, to: to}
+		if _, dup := v.rates[p]; dup {
+			return nil, fmt.Errorf("line %d: duplicate rate of %s to %s on %s", line, from, to, date.Format(dateLayout))
+		}
+		v.rates[p] = rate
+	}
+
+	t := &RateTable{}
+	for _, v := range byDate {
+		t.versions = append(t.versions, v)
+	}
+	sort.Slice(t.versions, func(i, j int) bool {
+		return t.versions[i].date.Before(t.versions[j].date)
+	})
+	return t, nil
+}
+
+// Dates returns dates the table has rates for, oldest first.
+func (t *RateTable) Dates() []time.Time {
+	dates := make([]time.Time, len(t.versions))
+	for i, v := range t.versions {
+		dates[i] = v.date
+	}
+	return dates
+}
+
+// At returns rates in effect at the given time, that is
+// rates published on the latest date not after it.
+func (t *RateTable) At(at time.Time) (*Rates, error) {
+	day := time.Date(at.Year(), at.Month(), at.Day(), 0, 0, 0, 0, time.UTC)
+	i := sort.Search(len(t.versions), func(i int) bool {
+		return t.versions[i].date.After(day)
+	})
+	if i == 0 {
+		return nil, fmt.Errorf("%w: no rates published before %s", ErrNoRate, day.Format(dateLayout))
+	}
+	return t.versions[i-1], nil
+}
+
+// Latest returns the most recently published rates.
+func (t *RateTable) Latest() (*Rates, error) {
+	if len(t.versions) == 0 {
+		return nil, fmt.Errorf("%w: empty rate table", ErrNoRate)
+	}
+	return t.versions[len(t.versions)-1], nil
+}
+
+// Date returns the date the rates were published on.
+func (r *Rates) Date() time.Time {
+	return r.date
+}
+
+// Rate returns the price of one unit of from in currency to.
+// Rates that are not published directly are derived from
+// the inverse rate or from rates of both currencies to
+// a third one.
+func (r *Rates) Rate(from, to Currency) (*big.Rat, error) {
+	if from == to {
+		return big.NewRat(1, 1), nil
+	}
+	if rate, ok := r.direct(from, to); ok {
+		return rate, nil
+	}
+
+	// Cross rate through a currency both have rates to,
+	// tried in a fixed order so results do not change
+	// from run to run.
+	var pivots []Currency
+	for p := range r.rates {
+		pivots = append(pivots, p.from, p.to)
+	}
+	sort.Slice(pivots, func(i, j int) bool { return pivots[i] < pivots[j] })
+	for _, via := range pivots {
+		if via == from || via == to {
+			continue
+		}
+		a, ok := r.direct(from, via)
+		if !ok {
+			continue
+		}
+		b, ok := r.direct(via, to)
+		if !ok {
+			continue
+		}
+		return new(big.Rat).Mul(a, b), nil
+	}
+	return nil, fmt.Errorf("%w: %s to %s on %s", ErrNoRate, from, to, r.date.Format(dateLayout))
+}
+
+// direct returns a published rate or the inverse of one.
+func (r *Rates) direct(from, to Currency) (*big.Rat, bool) {
+	if rate, ok := r.rates[pair{from: from, to: to}]; ok {
+		return new(big.Rat).Set(rate), true
+	}
+	if rate, ok := r.rates[pair{from: to, to: from}]; ok {
+		return new(big.Rat).Inv(rate), true
+	}
+	return nil, false
+}
+
+// Convert knows how to convert the amount to another currency,
+// rounding the result to minor units of the currency with the mode.
+func (r *Rates) Convert(m Money, to Currency, mode RoundingMode) (Money, error) {
+	if m.currency == to {
+		return m, nil
+	}
+	if m.currency == "" {
+		return Money{}, fmt.Errorf("%w: amount %v has no currency", ErrNoRate, m)
+	}
+	rate, err := r.Rate(m.currency, to)
+	if err != nil {
+		return Money{}, err
+	}
+
+	// Scale minor units of one currency to the other.
+	scale := new(big.Int).Exp(big.NewInt(10), big.NewInt(int64(abs(to.Digits()-m.currency.Digits()))), nil)
+	num := new(big.Int).Mul(big.NewInt(m.amount), rate.Num())
+	den := new(big.Int).Set(rate.Denom())
+	if to.Digits() > m.currency.Digits() {
+		num.Mul(num, scale)
+	} else {
+		den.Mul(den, scale)
+	}
+
+	q, err := mode.divide(num, den)
+	if err != nil {
+		return Money{}, err
+	}
+	if !q.IsInt64() {
+		return Money{}, fmt.Errorf("%w: %v in %s", ErrOverflow, m, to)
+	}
+	return Money{amount: q.Int64(), currency: to}, nil
+}
+
+func abs(n int) int {
+	if n < 0 {
+		return -n
+	}
+	return n
+}
@@ -0,0 +1,120 @@
+package money_test
+
+import (
+	"errors"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/google/go-cmp/cmp"
+	"github.com/qba73/bookshop/internal/money"
+)
+
+const rateTable = `# NBP average rates
+date,from,to,rate
+2021-03-01,EUR,PLN,4.5210
+2021-03-01,GBP,PLN,5.2433
+2021-03-01,PLN,JPY,28.10
+2021-03-02,EUR,PLN,4.5000
+`
+
+func day(s string) time.Time {
+	d, err := time.Parse("2006-01-02", s)
+	if err != nil {
+		panic(err)
+	}
+	return d
+}
+
+func TestRateTable(t *testing.T) {
+	t.Parallel()
+
+	table, err := money.ParseRates(strings.NewReader(rateTable))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want := []time.Time{day("2021-03-01"), day("2021-03-02")}; !cmp.Equal(want, table.Dates()) {
+		t.Errorf("Dates() \n%s", cmp.Diff(want, table.Dates()))
+	}
+
+	tt := []struct {
+		name        string
+		at          time.Time
+		amount      money.Money
+		to          money.Currency
+		mode        money.RoundingMode
+		want        money.Money
+		expectedErr error
+	}{
+		{name: "Published rate", at: day("2021-03-01"), amount: money.New(1000, money.EUR), to: money.PLN, want: money.New(4521, money.PLN)},
+		{name: "Inverse rate", at: day("2021-03-01"), amount: money.New(4521, money.PLN), to: money.EUR, want: money.New(1000, money.EUR)},
+		{name: "Cross rate", at: day("2021-03-01"), amount: money.New(1000, money.GBP), to: money.EUR, mode: money.RoundHalfUp, want: money.New(1160, money.EUR)},
+		{name: "Currency without minor units", at: day("2021-03-01"), amount: money.New(1000, money.PLN), to: "JPY", want: money.New(281, "JPY")},
+		{name: "Same currency", at: day("2021-03-01"), amount: money.New(1000, money.PLN), to: money.PLN, want: money.New(1000, money.PLN)},
+		{name: "Later version", at: time.Date(2021, time.March, 5, 12, 0, 0, 0, time.UTC), amount: money.New(1000, money.EUR), to: money.PLN, want: money.New(4500, money.PLN)},
+		{name: "Rate missing from later version", at: day("2021-03-02"), amount: money.New(1000, money.GBP), to: money.PLN, expectedErr: money.ErrNoRate},
+		{name: "Before first version", at: day("2021-02-28"), amount: money.New(1000, money.EUR), to: money.PLN, expectedErr: money.ErrNoRate},
+		{name: "Unknown currency", at: day("2021-03-01"), amount: money.New(1000, money.USD), to: money.PLN, expectedErr: money.ErrNoRate},
+	}
+
+	for _, tc := range tt {
+		var got money.Money
+		rates, err := table.At(tc.at)
+		if err == nil {
+			got, err = rates.Convert(tc.amount, tc.to, tc.mode)
+		}
+		if !errors.Is(err, tc.expectedErr) {
+			t.Fatalf("%s, Convert(%v, %s) got error: %v, want: %v", tc.name, tc.amount, tc.to, err, tc.expectedErr)
+		}
+		if got != tc.want {
+			t.Errorf("%s, Convert(%v, %s) = %v, want: %v", tc.name, tc.amount, tc.to, got, tc.want)
+		}
+	}
+}
+
+func TestParseRatesErrors(t *testing.T) {
+	t.Parallel()
+
+	tt := []struct {
+		name  string
+		input string
+	}{
+		{name: "Invalid header", input: "day,from,to,rate\n"},
+		{name: "Invalid date", input: "date,from,to,rate\n2021-13-01,EUR,PLN,4.5\n"},
+		{name: "Invalid currency", input: "date,from,to,rate\n2021-03-01,EURO,PLN,4.5\n"},
+		{name: "Invalid rate", input: "date,from,to,rate\n2021-03-01,EUR,PLN,abc\n"},
+		{name: "Fraction rate", input: "date,from,to,rate\n2021-03-01,EUR,PLN,9/2\n"},
+		{name: "Zero rate", input: "date,from,to,rate\n2021-03-01,EUR,PLN,0\n"},
+		{name: "Rate to itself", input: "date,from,to,rate\n2021-03-01,PLN,PLN,1\n"},
+		{name: "Duplicate rate", input: "date,from,to,rate\n2021-03-01,EUR,PLN,4.5\n2021-03-01,EUR,PLN,4.6\n"},
+		{name: "Missing field", input: "date,from,to,rate\n2021-03-01,EUR,PLN\n"},
+	}
+
+	for _, tc := range tt {
+		if _, err := money.ParseRates(strings.NewReader(tc.input)); err == nil {
+			t.Errorf("%s, ParseRates() should return error", tc.name)
+		}
+	}
+}
+
+func TestOpenRates(t *testing.T) {
+	t.Parallel()
+
+	path := filepath.Join(t.TempDir(), "rates.csv")
+	if err := os.WriteFile(path, []byte(rateTable), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	table, err := money.OpenRates(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	latest, err := table.Latest()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !latest.Date().Equal(day("2021-03-02")) {
+		t.Errorf("Latest() date = %v, want: 2021-03-02", latest.Date())
+	}
+}
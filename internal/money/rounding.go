@@ -0,0 +1,90 @@
+package money
+
+import (
+	"fmt"
+	"math/big"
+	"strings"
+)
+
+// RoundingMode says how amounts are rounded to minor units.
+// The zero value is RoundDown.
+type RoundingMode int
+
+// Rounding modes.
+const (
+	// RoundDown rounds toward zero.
+	RoundDown RoundingMode = iota
+	// RoundUp rounds away from zero.
+	RoundUp
+	// RoundHalfUp rounds to the nearest minor unit,
+	// halves away from zero.
+	RoundHalfUp
+	// RoundHalfDown rounds to the nearest minor unit,
+	// halves toward zero.
+	RoundHalfDown
+	// RoundHalfEven rounds to the nearest minor unit,
+	// halves to the even one (banker's rounding).
+	RoundHalfEven
+)
+
+var roundingModes = []string{
+	RoundDown:     "down",
+	RoundUp:       "up",
+	RoundHalfUp:   "half-up",
+	RoundHalfDown: "half-down",
+	RoundHalfEven: "half-even",
+}
+
+// String returns the name of the rounding mode, like "half-up".
+func (r RoundingMode) String() string {
+	if r < 0 || int(r) >= len(roundingModes) {
+		return fmt.Sprintf("RoundingMode(%d)", int(r))
+	}
+	return roundingModes[r]
+}
+
+// ParseRoundingMode knows how to parse a rounding mode name
+// as returned by String, ignoring case.
+func ParseRoundingMode(s string) (RoundingMode, error) {
+	name := strings.ToLower(strings.TrimSpace(s))
+	for i, m := range roundingModes {
+		if m == name {
+			return RoundingMode(i), nil
+		}
+	}
+	return 0, fmt.Errorf("unknown rounding mode %q", s)
+}
+
+// divide returns n/d rounded with the mode.
+func (r RoundingMode) divide(n, d *big.Int) (*big.Int, error) {
+	if r < 0 || int(r) >= len(roundingModes) {
+		return nil, fmt.Errorf("unknown rounding mode %v", r)
+	}
+	q, rem := new(big.Int).QuoRem(n, d, new(big.Int))
+	if rem.Sign() == 0 {
+		return q, nil
+	}
+	// away is the direction away from zero, +1 or -1.
+	away := int64(n.Sign() * d.Sign())
+
+	// half compares twice the remainder with the divisor.
+	half := new(big.Int).Abs(new(big.Int).Lsh(rem, 1)).Cmp(new(big.Int).Abs(d))
+
+	var up bool
+	switch r {
+	case RoundDown:
+		up = false
+	case RoundUp:
+		up = true
+	case RoundHalfUp:
+		up = half >= 0
+	case RoundHalfDown:
+		up = half > 0
+	case RoundHalfEven:
+		up = half > 0 || (half == 0 && q.Bit(0) == 1)
+	}
+	if up {
+		q.Add(q, big.NewInt(away))
+	}
+	return q, nil
+}
@@ -0,0 +1,278 @@
+package onix
+
+import (
+	"encoding/xml"
+	"errors"
+	"fmt"
+	"io"
+	"strings"
+
+	"github.com/qba73/bookshop/internal/bookshop"
+)
+
+var (
+	// ErrUnmapped is wrapped by errors of records
+	// that have no ISBN, no title or delete a product.
+	ErrUnmapped = errors.New("unmapped record")
+	// ErrInvalidRecord is wrapped by errors of records
+	// with malformed values.
+	ErrInvalidRecord = errors.New("invalid record")
+)
+
+// Options configures Import.
+type Options struct {
+	// Currency selects prices in the given ISO 4217 currency.
+	// When empty the default currency of the message is used,
+	// and prices in any currency when the message has none.
+	// Prices in another currency than the price of an existing
+	// book are added as its price in that currency.
+	Currency string
+	// DryRun maps records without changing the catalog.
+	DryRun bool
+}
+
+// RecordError describes an ONIX product record
+// that was not imported.
+type RecordError struct {
+	// Record is the position of the product in the message, from 1.
+	Record    int
+	Reference string
+	Err       error
+}
+
+// Error implements the error interface.
+func (e RecordError) Error() string {
+	if e.Reference == "" {
+		return fmt.Sprintf("record %d: %v", e.Record, e.Err)
+	}
+	return fmt.Sprintf("record %d (%s): %v", e.Record, e.Reference, e.Err)
+}
+
+// Unwrap returns the underlying error.
+func (e RecordError) Unwrap() error {
+	return e.Err
+}
+
+// Report summarizes an import.
+type Report struct {
+	// Added and Updated count books added to the catalog and books
+	// updated in it, or that would be in a dry run.
+	Added   int
+	Updated int
+	// Unmapped lists records wrapping ErrUnmapped.
+	Unmapped []RecordError
+	// Invalid lists records wrapping ErrInvalidRecord.
+	Invalid []RecordError
+}
+
+// Import knows how to read an ONIX 3.0 message and upsert
+// its products into the catalog.
+//
+// Products are matched with books by ISBN. Mapped fields of a
+// matching book are updated and its ID, discount and categories
+// are kept. Other products are added as new books. Fields
+// missing in a product keep their values.
+//
+// Records that cannot be mapped or are invalid are skipped and
+// listed in the report. The returned error is only non-nil when
+// the message cannot be read or the catalog fails.
+func Import(c *bookshop.Catalog, r io.Reader, opts Options) (Report, error) {
+	var (
+		report  Report
+		hdr     header
+		record  int
+		started bool
+	)
+	// added maps ISBNs of books added by a dry run to their IDs,
+	// so later records for the same product count as updates.
+	added := make(map[string]string)
+
+	d := xml.NewDecoder(r)
+	for {
+		tok, err := d.Token()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return report, fmt.Errorf("reading ONIX message: %w", err)
+		}
+		se, ok := tok.(xml.StartElement)
+		if !ok {
+			continue
+		}
+
+		if !started {
+			if err := checkRoot(se); err != nil {
+				return report, err
+			}
+			started = true
+			continue
+		}
+
+		switch se.Name.Local {
+		case "Header":
+			if err := d.DecodeElement(&hdr, &se); err != nil {
+				return report, fmt.Errorf("reading ONIX header: %w", err)
+			}
+		case "Product":
+			record++
+			var p product
+			if err := d.DecodeElement(&p, &se); err != nil {
+				return report, fmt.Errorf("reading ONIX record %d: %w", record, err)
+			}
+			if err := importProduct(c, p, hdr, opts, added, &report); err != nil {
+				recErr := RecordError{Record: record, Reference: strings.TrimSpace(p.RecordReference), Err: err}
+				switch {
+				case errors.Is(err, ErrUnmapped):
+					report.Unmapped = append(report.Unmapped, recErr)
+				case errors.Is(err, ErrInvalidRecord):
+					report.Invalid = append(report.Invalid, recErr)
+				default:
+					return report, recErr
+				}
+			}
+		}
+	}
+	if !started {
+		return report, errors.New("reading ONIX message: empty input")
+	}
+	return report, nil
+}
+
+// checkRoot returns an error unless el is the root element
+// of an ONIX 3.0 reference tag message.
+func checkRoot(el xml.StartElement) error {
+	switch el.Name.Local {
+	case "ONIXMessage":
+	case "ONIXmessage":
+		return errors.New("ONIX short tags are not supported")
+	default:
+		return fmt.Errorf("not an ONIX message: root element %s", el.Name.Local)
+	}
+	for _, a := range el.Attr {
+		if a.Name.Local == "release" && !strings.HasPrefix(a.Value, "3.") {
+			return fmt.Errorf("unsupported ONIX release %s", a.Value)
+		}
+	}
+	return nil
+}
+
+// importProduct maps the product to a book and upserts it.
+func importProduct(c *bookshop.Catalog, p product, hdr header, opts Options, added map[string]string, report *Report) error {
+	if strings.TrimSpace(p.NotificationType) == notificationDelete {
+		return fmt.Errorf("%w: delete notifications are not applied", ErrUnmapped)
+	}
+	isbn := p.isbn()
+	if isbn == "" {
+		return fmt.Errorf("%w: no ISBN product identifier", ErrUnmapped)
+	}
+	isbn, err := bookshop.ParseISBN(isbn)
+	if err != nil {
+		return fmt.Errorf("%w: %v", ErrInvalidRecord, err)
+	}
+
+	b, found, err := existingBook(c, isbn, added)
+	if err != nil {
+		return err
+	}
+
+	title := p.title()
+	if title == "" && !found {
+		return fmt.Errorf("%w: no distinctive title", ErrUnmapped)
+	}
+	if err := mapProduct(&b, p, hdr, opts, found); err != nil {
+		return fmt.Errorf("%w: %v", ErrInvalidRecord, err)
+	}
+	if title != "" {
+		b.Title = title
+	}
+	b.ISBN = isbn
+
+	if !opts.DryRun {
+		if err := c.AddBook(b); err != nil {
+			return err
+		}
+	}
+
+	if found {
+		report.Updated++
+		return nil
+	}
+	report.Added++
+	if opts.DryRun {
+		added[isbn] = b.ID
+	}
+	return nil
+}
+
+// existingBook returns the catalog book with the ISBN, or the book
+// added by a dry run, or a new book with a generated ID.
+func existingBook(c *bookshop.Catalog, isbn string, added map[string]string) (bookshop.Book, bool, error) {
+	if id, ok := added[isbn]; ok {
+		return bookshop.Book{ID: id}, true, nil
+	}
+	b, err := c.GetByISBN(isbn)
+	if errors.Is(err, bookshop.ErrBookNotFound) {
+		return bookshop.Book{ID: bookshop.NewID()}, false, nil
+	}
+	if err != nil {
+		return bookshop.Book{}, false, err
+	}
+	return b, true, nil
+}
+
+// mapProduct sets book fields present in the product. The price
+// replaces the price of new books, existing books get it as their
+// price in its currency.
+func mapProduct(b *bookshop.Book, p product, hdr header, opts Options, found bool) error {
+	if authors := p.authors(); len(authors) > 0 {
+		b.Authors = authors
+	}
+	if desc := p.description(); desc != "" {
+		b.Description = desc
+	}
+	if f := p.format(); f != "" {
+		b.Format = f
+	}
+
+	edition, err := p.edition()
+	if err != nil {
+		return err
+	}
+	if edition > 0 {
+		b.Edition = edition
+	}
+
+	series, err := p.seriesNumber()
+	if err != nil {
+		return err
+	}
+	if series > 0 {
+		b.SeriesNumber = series
+	}
+
+	year, err := p.releaseYear()
+	if err != nil {
+		return err
+	}
+	if year > 0 {
+		b.ReleaseYear = year
+	}
+
+	defaultCurrency := strings.TrimSpace(hdr.DefaultCurrencyCode)
+	currency := opts.Currency
+	if currency == "" {
+		currency = defaultCurrency
+	}
+	price, ok, err := p.price(currency, defaultCurrency)
+	if err != nil {
+		return err
+	}
+	if !ok {
+		return nil
+	}
+	if found && b.Price.Currency() != "" {
+		return b.SetPriceIn(price)
+	}
+	return b.SetPrice(price)
+}
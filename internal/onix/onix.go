@@ -0,0 +1,459 @@
+// Package onix imports publisher metadata sent as ONIX 3.0
+// for Books XML into the book catalog.
+//
+// Only reference tag names are supported, short tag messages
+// are rejected. Elements not listed below are ignored.
+//
+//	ProductIdentifier       ISBN-13 (15), ISBN-10 (02) or GTIN-13 (03)
+//	TitleDetail             distinctive title (01) of the product
+//	Contributor             authorship roles (A01-A99), in sequence order
+//	EditionNumber           edition
+//	Collection              part number or sequence in a publisher collection
+//	TextContent             description (03) or short description (02)
+//	PublishingDate          publication date (01) year
+//	Price                   retail price, including tax when available
+package onix
+
+import (
+	"bytes"
+	"encoding/xml"
+	"fmt"
+	"html"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/qba73/bookshop/internal/bookshop"
+	"github.com/qba73/bookshop/internal/money"
+)
+
+// ONIX code list values used by the mapping.
+const (
+	notificationDelete = "05"
+
+	idTypeISBN10 = "02"
+	idTypeGTIN13 = "03"
+	idTypeISBN13 = "15"
+
+	titleTypeDistinctive = "01"
+	titleLevelProduct    = "01"
+	titleLevelCollection = "02"
+
+	textTypeShortDescription = "02"
+	textTypeDescription      = "03"
+
+	textFormatHTML  = "02"
+	textFormatXHTML = "05"
+
+	dateRolePublication      = "01"
+	dateRoleFirstPublication = "11"
+)
+
+// priceTypes lists consumer price types in the order of preference:
+// RRP including tax, fixed retail price including tax, RRP excluding
+// tax and fixed retail price excluding tax.
+var priceTypes = []string{"02", "04", "01", "03"}
+
+type header struct {
+	DefaultCurrencyCode string `xml:"DefaultCurrencyCode"`
+}
+
+type product struct {
+	RecordReference    string              `xml:"RecordReference"`
+	NotificationType   string              `xml:"NotificationType"`
+	ProductIdentifiers []productIdentifier `xml:"ProductIdentifier"`
+	DescriptiveDetail  descriptiveDetail   `xml:"DescriptiveDetail"`
+	CollateralDetail   collateralDetail    `xml:"CollateralDetail"`
+	PublishingDetail   publishingDetail    `xml:"PublishingDetail"`
+	ProductSupplies    []productSupply     `xml:"ProductSupply"`
+}
+
+type productIdentifier struct {
+	ProductIDType string `xml:"ProductIDType"`
+	IDValue       string `xml:"IDValue"`
+}
+
+type descriptiveDetail struct {
+	ProductForm   string        `xml:"ProductForm"`
+	Collections   []collection  `xml:"Collection"`
+	TitleDetails  []titleDetail `xml:"TitleDetail"`
+	Contributors  []contributor `xml:"Contributor"`
+	EditionNumber string        `xml:"EditionNumber"`
+}
+
+type collection struct {
+	CollectionType      string               `xml:"CollectionType"`
+	CollectionSequences []collectionSequence `xml:"CollectionSequence"`
+	TitleDetails        []titleDetail        `xml:"TitleDetail"`
+}
+
+type collectionSequence struct {
+	CollectionSequenceNumber string `xml:"CollectionSequenceNumber"`
+}
+
+type titleDetail struct {
+	TitleType     string         `xml:"TitleType"`
+	TitleElements []titleElement `xml:"TitleElement"`
+}
+
+type titleElement struct {
+	TitleElementLevel  string `xml:"TitleElementLevel"`
+	PartNumber         string `xml:"PartNumber"`
+	TitleText          string `xml:"TitleText"`
+	TitlePrefix        string `xml:"TitlePrefix"`
+	TitleWithoutPrefix string `xml:"TitleWithoutPrefix"`
+	Subtitle           string `xml:"Subtitle"`
+}
+
+type contributor struct {
+	SequenceNumber     string   `xml:"SequenceNumber"`
+	ContributorRoles   []string `xml:"ContributorRole"`
+	PersonName         string   `xml:"PersonName"`
+	PersonNameInverted string   `xml:"PersonNameInverted"`
+	NamesBeforeKey     string   `xml:"NamesBeforeKey"`
+	KeyNames           string   `xml:"KeyNames"`
+	CorporateName      string   `xml:"CorporateName"`
+}
+
+type collateralDetail struct {
+	TextContents []textContent `xml:"TextContent"`
+}
+
+type textContent struct {
+	TextType string `xml:"TextType"`
+	Texts    []text `xml:"Text"`
+}
+
+type text struct {
+	TextFormat string `xml:"textformat,attr"`
+	Inner      string `xml:",innerxml"`
+}
+
+type publishingDetail struct {
+	PublishingDates []publishingDate `xml:"PublishingDate"`
+}
+
+type publishingDate struct {
+	PublishingDateRole string `xml:"PublishingDateRole"`
+	Date               string `xml:"Date"`
+}
+
+type productSupply struct {
+	SupplyDetails []supplyDetail `xml:"SupplyDetail"`
+}
+
+type supplyDetail struct {
+	Prices []price `xml:"Price"`
+}
+
+type price struct {
+	PriceType    string `xml:"PriceType"`
+	PriceAmount  string `xml:"PriceAmount"`
+	CurrencyCode string `xml:"CurrencyCode"`
+}
+
+// isbn returns the first ISBN identifier of the product,
+// with an empty string when the product has none.
+func (p product) isbn() string {
+	for _, id := range p.ProductIdentifiers {
+		v := strings.TrimSpace(id.IDValue)
+		switch id.ProductIDType {
+		case idTypeISBN13, idTypeISBN10:
+			return v
+		case idTypeGTIN13:
+			// GTIN-13 is an ISBN only in the Bookland range.
+			if strings.HasPrefix(v, "978") || strings.HasPrefix(v, "979") {
+				return v
+			}
+		}
+	}
+	return ""
+}
+
+// title returns the distinctive title of the product
+// followed by its subtitle.
+func (p product) title() string {
+	for _, td := range p.DescriptiveDetail.TitleDetails {
+		if td.TitleType != titleTypeDistinctive {
+			continue
+		}
+		for _, te := range td.TitleElements {
+			if te.TitleElementLevel != titleLevelProduct {
+				continue
+			}
+			title := strings.TrimSpace(te.TitleText)
+			if title == "" {
+				title = strings.TrimSpace(te.TitlePrefix + " " + te.TitleWithoutPrefix)
+			}
+			if sub := strings.TrimSpace(te.Subtitle); sub != "" && title != "" {
+				title += ": " + sub
+			}
+			return collapseSpace(title)
+		}
+	}
+	return ""
+}
+
+// authors returns names of contributors with an authorship role
+// ordered by their sequence numbers.
+func (p product) authors() []string {
+	contributors := append([]contributor(nil), p.DescriptiveDetail.Contributors...)
+	sort.SliceStable(contributors, func(i, j int) bool {
+		si, _ := strconv.Atoi(contributors[i].SequenceNumber)
+		sj, _ := strconv.Atoi(contributors[j].SequenceNumber)
+		return si < sj
+	})
+
+	var authors []string
+	for _, c := range contributors {
+		if !c.isAuthor() {
+			continue
+		}
+		if name := c.name(); name != "" {
+			authors = append(authors, name)
+		}
+	}
+	return authors
+}
+
+// isAuthor reports whether any of the contributor roles
+// belongs to the authorship group of ONIX code list 17.
+func (c contributor) isAuthor() bool {
+	for _, r := range c.ContributorRoles {
+		if strings.HasPrefix(strings.TrimSpace(r), "A") {
+			return true
+		}
+	}
+	return false
+}
+
+// name returns the contributor name in natural order.
+func (c contributor) name() string {
+	switch {
+	case strings.TrimSpace(c.PersonName) != "":
+		return collapseSpace(c.PersonName)
+	case strings.TrimSpace(c.KeyNames) != "":
+		return collapseSpace(c.NamesBeforeKey + " " + c.KeyNames)
+	case strings.TrimSpace(c.PersonNameInverted) != "":
+		parts := strings.SplitN(c.PersonNameInverted, ",", 2)
+		if len(parts) == 2 {
+			return collapseSpace(parts[1] + " " + parts[0])
+		}
+		return collapseSpace(parts[0])
+	default:
+		return collapseSpace(c.CorporateName)
+	}
+}
+
+// description returns the plain text description of the product,
+// falling back to the short description.
+func (p product) description() string {
+	for _, tt := range []string{textTypeDescription, textTypeShortDescription} {
+		for _, tc := range p.CollateralDetail.TextContents {
+			if tc.TextType != tt || len(tc.Texts) == 0 {
+				continue
+			}
+			return tc.Texts[0].plain()
+		}
+	}
+	return ""
+}
+
+// plain returns the text with XHTML markup and
+// escaped HTML markup removed.
+func (t text) plain() string {
+	var b strings.Builder
+	d := xml.NewDecoder(strings.NewReader("<Text>" + t.Inner + "</Text>"))
+	d.Strict = false
+	d.Entity = xml.HTMLEntity
+	for {
+		tok, err := d.Token()
+		if err != nil {
+			break
+		}
+		switch tok := tok.(type) {
+		case xml.CharData:
+			b.Write(tok)
+		case xml.StartElement, xml.EndElement:
+			// Block elements such as <p> separate words.
+			b.WriteByte(' ')
+		}
+	}
+
+	s := b.String()
+	if t.TextFormat == textFormatHTML || t.TextFormat == textFormatXHTML {
+		s = stripTags(s)
+	}
+	return collapseSpace(html.UnescapeString(s))
+}
+
+// format returns the book format of the product form, empty when
+// the form is not given or is not a book, e-book or audiobook. Forms
+// starting with B are printed books, with E digital publications and
+// with A audio recordings.
+func (p product) format() bookshop.Format {
+	switch form := strings.TrimSpace(p.DescriptiveDetail.ProductForm); {
+	case strings.HasPrefix(form, "B"):
+		return bookshop.FormatPrint
+	case strings.HasPrefix(form, "E"):
+		return bookshop.FormatEbook
+	case strings.HasPrefix(form, "A"):
+		return bookshop.FormatAudiobook
+	default:
+		return ""
+	}
+}
+
+// edition returns the edition number, zero when not given.
+func (p product) edition() (int, error) {
+	v := strings.TrimSpace(p.DescriptiveDetail.EditionNumber)
+	if v == "" {
+		return 0, nil
+	}
+	n, err := strconv.Atoi(v)
+	if err != nil || n < 0 {
+		return 0, fmt.Errorf("EditionNumber: invalid number %q", v)
+	}
+	return n, nil
+}
+
+// seriesNumber returns the part number of the product in
+// its first numbered collection, zero when not given.
+func (p product) seriesNumber() (int, error) {
+	for _, c := range p.DescriptiveDetail.Collections {
+		var v string
+		for _, td := range c.TitleDetails {
+			for _, te := range td.TitleElements {
+				if te.TitleElementLevel == titleLevelCollection && strings.TrimSpace(te.PartNumber) != "" {
+					v = te.PartNumber
+				}
+			}
+		}
+		if v == "" && len(c.CollectionSequences) > 0 {
+			v = c.CollectionSequences[0].CollectionSequenceNumber
+		}
+		if v = strings.TrimSpace(v); v == "" {
+			continue
+		}
+		n, err := strconv.Atoi(v)
+		if err != nil || n < 0 {
+			return 0, fmt.Errorf("Collection: invalid part number %q", v)
+		}
+		return n, nil
+	}
+	return 0, nil
+}
+
+// releaseYear returns the year of the publication date,
+// or of the first publication date, zero when not given.
+// All ONIX date formats start with a four digit year.
+func (p product) releaseYear() (int, error) {
+	for _, role := range []string{dateRolePublication, dateRoleFirstPublication} {
+		for _, d := range p.PublishingDetail.PublishingDates {
+			if d.PublishingDateRole != role {
+				continue
+			}
+			v := strings.TrimSpace(d.Date)
+			if len(v) < 4 {
+				return 0, fmt.Errorf("PublishingDate: invalid date %q", v)
+			}
+			year, err := strconv.Atoi(v[:4])
+			if err != nil || year <= 0 {
+				return 0, fmt.Errorf("PublishingDate: invalid date %q", v)
+			}
+			return year, nil
+		}
+	}
+	return 0, nil
+}
+
+// price returns the preferred consumer price of the product.
+// When currency is not empty, prices in other currencies are skipped.
+// Prices without a currency code in messages without a default
+// currency are in bookshop.DefaultCurrency.
+// It returns false when the product has no matching price.
+func (p product) price(currency, defaultCurrency string) (money.Money, bool, error) {
+	for _, pt := range priceTypes {
+		for _, ps := range p.ProductSupplies {
+			for _, sd := range ps.SupplyDetails {
+				for _, pr := range sd.Prices {
+					if pr.PriceType != pt || strings.TrimSpace(pr.PriceAmount) == "" {
+						continue
+					}
+					code := strings.TrimSpace(pr.CurrencyCode)
+					if code == "" {
+						code = defaultCurrency
+					}
+					if currency != "" && !strings.EqualFold(code, currency) {
+						continue
+					}
+					c := bookshop.DefaultCurrency
+					if code != "" {
+						var err error
+						if c, err = money.ParseCurrency(code); err != nil {
+							return money.Money{}, false, fmt.Errorf("CurrencyCode: %w", err)
+						}
+					}
+					m, err := parseAmount(pr.PriceAmount, c)
+					if err != nil {
+						return money.Money{}, false, err
+					}
+					return m, true, nil
+				}
+			}
+		}
+	}
+	return money.Money{}, false, nil
+}
+
+// parseAmount converts a decimal price amount to money. Trailing
+// zeros beyond the decimal places of the currency are allowed.
+func parseAmount(s string, c money.Currency) (money.Money, error) {
+	v := strings.TrimSpace(s)
+	units, frac := v, ""
+	if i := strings.IndexByte(v, '.'); i >= 0 {
+		units, frac = v[:i], strings.TrimRight(v[i+1:], "0")
+	}
+	if units == "" || !digits(units) || !digits(frac) {
+		return money.Money{}, fmt.Errorf("PriceAmount: invalid amount %q", s)
+	}
+	if frac != "" {
+		units += "." + frac
+	}
+	m, err := money.Parse(units, c)
+	if err != nil {
+		return money.Money{}, fmt.Errorf("PriceAmount: %w", err)
+	}
+	return m, nil
+}
+
+func digits(s string) bool {
+	for i := 0; i < len(s); i++ {
+		if s[i] < '0' || s[i] > '9' {
+			return false
+		}
+	}
+	return true
+}
+
+// stripTags removes everything between angle brackets.
+func stripTags(s string) string {
+	var b bytes.Buffer
+	inTag := false
+	for _, r := range s {
+		switch {
+		case r == '<':
+			inTag = true
+			b.WriteByte(' ')
+		case r == '>' && inTag:
+			inTag = false
+		case !inTag:
+			b.WriteRune(r)
+		}
+	}
+	return b.String()
+}
+
+func collapseSpace(s string) string {
+	return strings.Join(strings.Fields(s), " ")
+}
@@ -0,0 +1,391 @@
+package onix_test
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+	"testing"
+
+	"github.com/google/go-cmp/cmp"
+	"github.com/qba73/bookshop/internal/bookshop"
+	"github.com/qba73/bookshop/internal/money"
+	"github.com/qba73/bookshop/internal/onix"
+)
+
+const message = `<?xml version="1.0" encoding="UTF-8"?>
+<ONIXMessage release="3.0" xmlns="http://ns.editeur.org/onix/3.0/reference">
+  <Header>
+    <Sender><SenderName>Wydawnictwo</SenderName></Sender>
+    <SentDateTime>20210301</SentDateTime>
+    <DefaultCurrencyCode>PLN</DefaultCurrencyCode>
+  </Header>
+  <Product>
+    <RecordReference>pl.wyd.0001</RecordReference>
+    <NotificationType>03</NotificationType>
+    <ProductIdentifier>
+      <ProductIDType>01</ProductIDType>
+      <IDValue>W-0001</IDValue>
+    </ProductIdentifier>
+    <ProductIdentifier>
+      <ProductIDType>15</ProductIDType>
+      <IDValue>9780306406157</IDValue>
+    </ProductIdentifier>
+    <DescriptiveDetail>
+      <Collection>
+        <CollectionType>10</CollectionType>
+        <TitleDetail>
+          <TitleType>01</TitleType>
+          <TitleElement>
+            <TitleElementLevel>02</TitleElementLevel>
+            <PartNumber>3</PartNumber>
+            <TitleText>Tytus, Romek i A'Tomek</TitleText>
+          </TitleElement>
+        </TitleDetail>
+      </Collection>
+      <TitleDetail>
+        <TitleType>01</TitleType>
+        <TitleElement>
+          <TitleElementLevel>01</TitleElementLevel>
+          <TitlePrefix>Księga</TitlePrefix>
+          <TitleWithoutPrefix>trzecia</TitleWithoutPrefix>
+          <Subtitle>Wyprawa na Marsa</Subtitle>
+        </TitleElement>
+      </TitleDetail>
+      <Contributor>
+        <SequenceNumber>2</SequenceNumber>
+        <ContributorRole>B06</ContributorRole>
+        <PersonName>Jan Tłumacz</PersonName>
+      </Contributor>
+      <Contributor>
+        <SequenceNumber>3</SequenceNumber>
+        <ContributorRole>A12</ContributorRole>
+        <PersonNameInverted>Chmiel, Papcio</PersonNameInverted>
+      </Contributor>
+      <Contributor>
+        <SequenceNumber>1</SequenceNumber>
+        <ContributorRole>A01</ContributorRole>
+        <NamesBeforeKey>Henryk Jerzy</NamesBeforeKey>
+        <KeyNames>Chmielewski</KeyNames>
+      </Contributor>
+      <EditionNumber>2</EditionNumber>
+    </DescriptiveDetail>
+    <CollateralDetail>
+      <TextContent>
+        <TextType>02</TextType>
+        <ContentAudience>00</ContentAudience>
+        <Text>Krótki opis.</Text>
+      </TextContent>
+      <TextContent>
+        <TextType>03</TextType>
+        <ContentAudience>00</ContentAudience>
+        <Text textformat="05"><p xmlns="http://www.w3.org/1999/xhtml">Przygody <em>trzech</em> przyjaciół.</p><p>Tom&#160;3.</p></Text>
+      </TextContent>
+    </CollateralDetail>
+    <PublishingDetail>
+      <PublishingDate>
+        <PublishingDateRole>19</PublishingDateRole>
+        <Date>19650101</Date>
+      </PublishingDate>
+      <PublishingDate>
+        <PublishingDateRole>01</PublishingDateRole>
+        <Date dateformat="00">20210415</Date>
+      </PublishingDate>
+    </PublishingDetail>
+    <ProductSupply>
+      <SupplyDetail>
+        <Price>
+          <PriceType>01</PriceType>
+          <PriceAmount>37.03</PriceAmount>
+        </Price>
+        <Price>
+          <PriceType>02</PriceType>
+          <PriceAmount>9.50</PriceAmount>
+          <CurrencyCode>EUR</CurrencyCode>
+        </Price>
+        <Price>
+          <PriceType>02</PriceType>
+          <PriceAmount>39.90</PriceAmount>
+        </Price>
+      </SupplyDetail>
+    </ProductSupply>
+  </Product>
+  <Product>
+    <RecordReference>pl.wyd.0002</RecordReference>
+    <NotificationType>03</NotificationType>
+    <ProductIdentifier>
+      <ProductIDType>03</ProductIDType>
+      <IDValue>9788324000166</IDValue>
+    </ProductIdentifier>
+    <DescriptiveDetail>
+      <ProductForm>ED</ProductForm>
+      <TitleDetail>
+        <TitleType>01</TitleType>
+        <TitleElement>
+          <TitleElementLevel>01</TitleElementLevel>
+          <TitleText>Zosia Samosia</TitleText>
+        </TitleElement>
+      </TitleDetail>
+      <Contributor>
+        <ContributorRole>A01</ContributorRole>
+        <PersonName>Julian Tuwim</PersonName>
+      </Contributor>
+    </DescriptiveDetail>
+    <CollateralDetail>
+      <TextContent>
+        <TextType>02</TextType>
+        <Text textformat="02">&lt;b&gt;Wiersz&lt;/b&gt; dla dzieci</Text>
+      </TextContent>
+    </CollateralDetail>
+    <PublishingDetail>
+      <PublishingDate>
+        <PublishingDateRole>01</PublishingDateRole>
+        <Date dateformat="05">1938</Date>
+      </PublishingDate>
+    </PublishingDetail>
+    <ProductSupply>
+      <SupplyDetail>
+        <Price>
+          <PriceType>04</PriceType>
+          <PriceAmount>15</PriceAmount>
+        </Price>
+      </SupplyDetail>
+    </ProductSupply>
+  </Product>
+  <Product>
+    <RecordReference>pl.wyd.0003</RecordReference>
+    <NotificationType>03</NotificationType>
+    <ProductIdentifier>
+      <ProductIDType>03</ProductIDType>
+      <IDValue>5901234123457</IDValue>
+    </ProductIdentifier>
+    <DescriptiveDetail>
+      <TitleDetail>
+        <TitleType>01</TitleType>
+        <TitleElement>
+          <TitleElementLevel>01</TitleElementLevel>
+          <TitleText>Kalendarz</TitleText>
+        </TitleElement>
+      </TitleDetail>
+    </DescriptiveDetail>
+  </Product>
+  <Product>
+    <RecordReference>pl.wyd.0004</RecordReference>
+    <NotificationType>03</NotificationType>
+    <ProductIdentifier>
+      <ProductIDType>15</ProductIDType>
+      <IDValue>9780306406158</IDValue>
+    </ProductIdentifier>
+  </Product>
+  <Product>
+    <RecordReference>pl.wyd.0005</RecordReference>
+    <NotificationType>03</NotificationType>
+    <ProductIdentifier>
+      <ProductIDType>15</ProductIDType>
+      <IDValue>9791090636071</IDValue>
+    </ProductIdentifier>
+    <DescriptiveDetail>
+      <TitleDetail>
+        <TitleType>01</TitleType>
+        <TitleElement>
+          <TitleElementLevel>01</TitleElementLevel>
+          <TitleText>Drogi</TitleText>
+        </TitleElement>
+      </TitleDetail>
+    </DescriptiveDetail>
+    <ProductSupply>
+      <SupplyDetail>
+        <Price>
+          <PriceType>02</PriceType>
+          <PriceAmount>12,50</PriceAmount>
+        </Price>
+      </SupplyDetail>
+    </ProductSupply>
+  </Product>
+  <Product>
+    <RecordReference>pl.wyd.0006</RecordReference>
+    <NotificationType>05</NotificationType>
+    <ProductIdentifier>
+      <ProductIDType>15</ProductIDType>
+      <IDValue>9791090636071</IDValue>
+    </ProductIdentifier>
+  </Product>
+  <Product>
+    <RecordReference>pl.wyd.0007</RecordReference>
+    <NotificationType>03</NotificationType>
+    <ProductIdentifier>
+      <ProductIDType>02</ProductIDType>
+      <IDValue>0198534531</IDValue>
+    </ProductIdentifier>
+  </Product>
+</ONIXMessage>
+`
+
+func newTestCatalog(t *testing.T, books ...bookshop.Book) *bookshop.Catalog {
+	t.Helper()
+
+	var c bookshop.Catalog
+	for _, b := range books {
+		if err := c.AddBook(b); err != nil {
+			t.Fatal(err)
+		}
+	}
+	return &c
+}
+
+func TestImport(t *testing.T) {
+	t.Parallel()
+
+	existing := bookshop.Book{ID: "1", ISBN: "9780306406157", Title: "Tytus", Price: money.New(1000, money.PLN)}
+	if err := existing.SetDiscountPercent(10); err != nil {
+		t.Fatal(err)
+	}
+	if err := existing.SetCategory(bookshop.CategoryRomance); err != nil {
+		t.Fatal(err)
+	}
+	c := newTestCatalog(t, existing)
+
+	report, err := onix.Import(c, strings.NewReader(message), onix.Options{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if report.Added != 1 || report.Updated != 1 {
+		t.Errorf("Import() added %d and updated %d books, want: 1 and 1", report.Added, report.Updated)
+	}
+
+	var problems []string
+	for _, e := range append(report.Unmapped, report.Invalid...) {
+		problems = append(problems, fmt.Sprintf("%d %s", e.Record, e.Reference))
+	}
+	want := []string{"3 pl.wyd.0003", "6 pl.wyd.0006", "7 pl.wyd.0007", "4 pl.wyd.0004", "5 pl.wyd.0005"}
+	if !cmp.Equal(want, problems) {
+		t.Errorf("Import() unmapped and invalid records:\n%s", cmp.Diff(want, problems))
+	}
+	for _, e := range report.Unmapped {
+		if !errors.Is(e, onix.ErrUnmapped) {
+			t.Errorf("unmapped record error %v, want: %v", e, onix.ErrUnmapped)
+		}
+	}
+	for _, e := range report.Invalid {
+		if !errors.Is(e, onix.ErrInvalidRecord) {
+			t.Errorf("invalid record error %v, want: %v", e, onix.ErrInvalidRecord)
+		}
+	}
+
+	wantBook := bookshop.Book{
+		ID:           "1",
+		ISBN:         "9780306406157",
+		Title:        "Księga trzecia: Wyprawa na Marsa",
+		Authors:      []string{"Henryk Jerzy Chmielewski", "Papcio Chmiel"},
+		Description:  "Przygody trzech przyjaciół. Tom 3.",
+		Edition:      2,
+		ReleaseYear:  2021,
+		SeriesNumber: 3,
+		Price:        money.New(3990, money.PLN),
+	}
+	if err := wantBook.SetDiscountPercent(10); err != nil {
+		t.Fatal(err)
+	}
+	if err := wantBook.SetCategory(bookshop.CategoryRomance); err != nil {
+		t.Fatal(err)
+	}
+	got, err := c.Store().Get("1")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !cmp.Equal(wantBook, got, cmp.AllowUnexported(bookshop.Book{})) {
+		t.Errorf("updated book:\n%s", cmp.Diff(wantBook, got, cmp.AllowUnexported(bookshop.Book{})))
+	}
+
+	got, err = c.GetByISBN("9788324000166")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got.ID == "" || got.Title != "Zosia Samosia" || got.Description != "Wiersz dla dzieci" || got.ReleaseYear != 1938 || got.Price != money.New(1500, money.PLN) || got.Format != bookshop.FormatEbook {
+		t.Errorf("added book = %+v", got)
+	}
+	if !cmp.Equal([]string{"Julian Tuwim"}, got.Authors) {
+		t.Errorf("added book authors = %q", got.Authors)
+	}
+}
+
+func TestImportCurrency(t *testing.T) {
+	t.Parallel()
+
+	c := newTestCatalog(t)
+	if _, err := onix.Import(c, strings.NewReader(message), onix.Options{Currency: "EUR"}); err != nil {
+		t.Fatal(err)
+	}
+	got, err := c.GetByISBN("9780306406157")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want := money.New(950, money.EUR); got.Price != want {
+		t.Errorf("price in EUR = %v, want: %v", got.Price, want)
+	}
+	// No price in EUR, the default currency is PLN.
+	got, err = c.GetByISBN("9788324000166")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !got.Price.Equal(money.Money{}) {
+		t.Errorf("price without EUR price = %v, want none", got.Price)
+	}
+}
+
+func TestImportCurrencyExistingBook(t *testing.T) {
+	t.Parallel()
+
+	c := newTestCatalog(t, bookshop.Book{ID: "1", ISBN: "9780306406157", Title: "Tytus", Price: money.New(1000, money.PLN)})
+	if _, err := onix.Import(c, strings.NewReader(message), onix.Options{Currency: "EUR"}); err != nil {
+		t.Fatal(err)
+	}
+	got, err := c.Store().Get("1")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want := money.New(1000, money.PLN); got.Price != want {
+		t.Errorf("price = %v, want: %v", got.Price, want)
+	}
+	if p, ok := got.PriceIn(money.EUR); !ok || p != money.New(950, money.EUR) {
+		t.Errorf("PriceIn(EUR) = %v, %t, want: %v", p, ok, money.New(950, money.EUR))
+	}
+}
+
+func TestImportDryRun(t *testing.T) {
+	t.Parallel()
+
+	c := newTestCatalog(t)
+	input := strings.Replace(message, "9788324000166", "9780306406157", 1)
+
+	report, err := onix.Import(c, strings.NewReader(input), onix.Options{DryRun: true})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if report.Added != 1 || report.Updated != 1 {
+		t.Errorf("dry run added %d and updated %d books, want: 1 and 1", report.Added, report.Updated)
+	}
+	if n, _ := c.Len(); n != 0 {
+		t.Errorf("dry run added %d books to the catalog", n)
+	}
+}
+
+func TestImportMessage(t *testing.T) {
+	t.Parallel()
+
+	tt := []struct {
+		name  string
+		input string
+	}{
+		{name: "Empty input", input: ""},
+		{name: "Not ONIX", input: "<rss><channel/></rss>"},
+		{name: "Short tags", input: `<ONIXmessage release="3.0"><product/></ONIXmessage>`},
+		{name: "ONIX 2.1", input: `<ONIXMessage release="2.1"><Product/></ONIXMessage>`},
+		{name: "Malformed XML", input: `<ONIXMessage release="3.0"><Product><RecordReference>1</Product>`},
+	}
+
+	for _, tc := range tt {
+		if _, err := onix.Import(newTestCatalog(t), strings.NewReader(tc.input), onix.Options{}); err == nil {
+			t.Errorf("%s: Import() got no error", tc.name)
+		}
+	}
+}
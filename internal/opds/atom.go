@@ -0,0 +1,114 @@
+package opds
+
+import (
+	"encoding/xml"
+	"io"
+)
+
+// XML namespaces used in OPDS feeds.
+const (
+	NamespaceAtom = "http://www.w3.org/2005/Atom"
+	NamespaceOPDS = "http://opds-spec.org/2010/catalog"
+	NamespaceDC   = "http://purl.org/dc/terms/"
+	NamespaceThr  = "http://purl.org/syndication/thread/1.0"
+)
+
+// Media types of OPDS catalog feeds.
+const (
+	TypeNavigation  = "application/atom+xml;profile=opds-catalog;kind=navigation"
+	TypeAcquisition = "application/atom+xml;profile=opds-catalog;kind=acquisition"
+)
+
+// Link relations used in OPDS feeds.
+const (
+	RelSelf       = "self"
+	RelStart      = "start"
+	RelUp         = "up"
+	RelFirst      = "first"
+	RelLast       = "last"
+	RelNext       = "next"
+	RelPrevious   = "previous"
+	RelSubsection = "subsection"
+	RelRelated    = "related"
+	RelFeatured   = "http://opds-spec.org/featured"
+	RelAcquireBuy = "http://opds-spec.org/acquisition/buy"
+)
+
+// Feed is an Atom feed of an OPDS catalog.
+type Feed struct {
+	XMLName   xml.Name `xml:"feed"`
+	Xmlns     string   `xml:"xmlns,attr"`
+	XmlnsOPDS string   `xml:"xmlns:opds,attr"`
+	XmlnsDC   string   `xml:"xmlns:dc,attr"`
+	XmlnsThr  string   `xml:"xmlns:thr,attr"`
+	ID        string   `xml:"id"`
+	Title     string   `xml:"title"`
+	Updated   string   `xml:"updated"`
+	Author    *Person  `xml:"author,omitempty"`
+	Links     []Link   `xml:"link"`
+	Entries   []Entry  `xml:"entry"`
+}
+
+// Entry is an Atom entry describing a book
+// or a navigation subsection.
+type Entry struct {
+	ID         string     `xml:"id"`
+	Title      string     `xml:"title"`
+	Updated    string     `xml:"updated"`
+	Authors    []Person   `xml:"author,omitempty"`
+	Identifier string     `xml:"dc:identifier,omitempty"`
+	Issued     string     `xml:"dc:issued,omitempty"`
+	Categories []Category `xml:"category,omitempty"`
+	Summary    *Text      `xml:"summary,omitempty"`
+	Content    *Text      `xml:"content,omitempty"`
+	Links      []Link     `xml:"link"`
+}
+
+// Person is an Atom person construct.
+type Person struct {
+	Name string `xml:"name"`
+	URI  string `xml:"uri,omitempty"`
+}
+
+// Category is an Atom category.
+type Category struct {
+	Scheme string `xml:"scheme,attr,omitempty"`
+	Term   string `xml:"term,attr"`
+	Label  string `xml:"label,attr,omitempty"`
+}
+
+// Text is an Atom text construct.
+type Text struct {
+	Type string `xml:"type,attr,omitempty"`
+	Body string `xml:",chardata"`
+}
+
+// Link is an Atom link with OPDS extensions.
+type Link struct {
+	Rel   string `xml:"rel,attr,omitempty"`
+	Href  string `xml:"href,attr"`
+	Type  string `xml:"type,attr,omitempty"`
+	Title string `xml:"title,attr,omitempty"`
+	Count int    `xml:"thr:count,attr,omitempty"`
+	Price *Price `xml:"opds:price,omitempty"`
+}
+
+// Price is the OPDS price of an acquisition link.
+type Price struct {
+	CurrencyCode string `xml:"currencycode,attr"`
+	Value        string `xml:",chardata"`
+}
+
+// Encode knows how to write the feed as an XML document.
+func (f *Feed) Encode(w io.Writer) error {
+	if _, err := io.WriteString(w, xml.Header); err != nil {
+		return err
+	}
+	enc := xml.NewEncoder(w)
+	enc.Indent("", "  ")
+	if err := enc.Encode(f); err != nil {
+		return err
+	}
+	_, err := io.WriteString(w, "\n")
+	return err
+}
@@ -0,0 +1,476 @@
+// Package opds publishes the book catalog as OPDS 1.2 catalog
+// feeds for e-reader apps.
+//
+// Feeds are served under a path prefix, "/opds" by default:
+//
+//	GET /opds                         root navigation feed
+//	GET /opds/books                   all books
+//	GET /opds/featured                pick of the month books
+//	GET /opds/categories              top level categories
+//	GET /opds/categories?parent=slug  subcategories of a category
+//	GET /opds/categories/{slug}       books in a category and its subcategories
+//	GET /opds/authors                 authors
+//	GET /opds/authors/{name}          books by an author
+//
+// Paginated feeds accept a ?page=n parameter and link
+// to the first, previous, next and last pages.
+package opds
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/qba73/bookshop/internal/bookshop"
+)
+
+// ErrPageNotFound is returned when a requested page
+// is past the last page of a feed.
+var ErrPageNotFound = errors.New("page not found")
+
+// Config configures OPDS feeds. Zero fields use defaults.
+type Config struct {
+	// Title of the catalog, "Bookshop" by default.
+	Title string
+	// Prefix is the URL path feeds are served under, "/opds" by default.
+	Prefix string
+	// PageSize is the number of entries per page,
+	// bookshop.DefaultPageSize by default.
+	PageSize int
+	// BuyURL is the URL of the page where a book can be bought,
+	// with "{id}" replaced by the book ID. It is "/books/{id}"
+	// by default.
+	BuyURL string
+	// Now returns the time feeds are updated at, time.Now by default.
+	Now func() time.Time
+}
+
+// Feeds generates OPDS feeds from a catalog.
+type Feeds struct {
+	catalog *bookshop.Catalog
+	cfg     Config
+}
+
+// NewFeeds knows how to construct OPDS feeds of the catalog.
+func NewFeeds(c *bookshop.Catalog, cfg Config) *Feeds {
+	if cfg.Title == "" {
+		cfg.Title = "Bookshop"
+	}
+	if cfg.Prefix == "" {
+		cfg.Prefix = "/opds"
+	}
+	cfg.Prefix = strings.TrimSuffix(cfg.Prefix, "/")
+	if cfg.PageSize <= 0 {
+		cfg.PageSize = bookshop.DefaultPageSize
+	}
+	if cfg.BuyURL == "" {
+		cfg.BuyURL = "/books/{id}"
+	}
+	if cfg.Now == nil {
+		cfg.Now = time.Now
+	}
+	return &Feeds{catalog: c, cfg: cfg}
+}
+
+// Root knows how to build the root navigation feed.
+func (f *Feeds) Root() *Feed {
+	feed := f.newFeed("root", f.cfg.Title, f.path(""), TypeNavigation)
+	feed.Links = append(feed.Links, Link{Rel: RelFeatured, Href: f.path("/featured"), Type: TypeAcquisition, Title: "Pick of the month"})
+	feed.Entries = []Entry{
+		f.navEntry("books", "All books", "All books in the catalog", RelSubsection, f.path("/books"), TypeAcquisition, 0),
+		f.navEntry("featured", "Pick of the month", "Books picked this month", RelFeatured, f.path("/featured"), TypeAcquisition, 0),
+		f.navEntry("categories", "By category", "Books by category", RelSubsection, f.path("/categories"), TypeNavigation, 0),
+		f.navEntry("authors", "By author", "Books by author", RelSubsection, f.path("/authors"), TypeNavigation, 0),
+	}
+	return feed
+}
+
+// Books knows how to build the acquisition feed
+// of all books sorted by title.
+func (f *Feeds) Books(page int) (*Feed, error) {
+	return f.acquisition("books", "All books", f.path("/books"), bookshop.Query{}, page)
+}
+
+// Featured knows how to build the acquisition feed
+// of pick of the month books.
+func (f *Feeds) Featured(page int) (*Feed, error) {
+	return f.acquisition("featured", "Pick of the month", f.path("/featured"), bookshop.Query{PickOfTheMonth: true}, page)
+}
+
+// Category knows how to build the acquisition feed of books
+// in the category with the slug and its subcategories.
+func (f *Feeds) Category(slug string, page int) (*Feed, error) {
+	cat, err := f.catalog.Taxonomy().BySlug(slug)
+	if err != nil {
+		return nil, err
+	}
+	feed, err := f.acquisition("categories:"+cat.Slug, cat.Name, f.path("/categories/"+url.PathEscape(cat.Slug)), bookshop.Query{Categories: []int{cat.ID}}, page)
+	if err != nil {
+		return nil, err
+	}
+	feed.Links = append(feed.Links, Link{Rel: RelUp, Href: f.categoriesPath(cat.ParentID), Type: TypeNavigation})
+	return feed, nil
+}
+
+// Categories knows how to build the navigation feed of
+// subcategories of the parent category. Top level categories
+// are listed for bookshop.NoParent. A category with subcategories
+// links to its own navigation feed, preceded by an entry for
+// all books in the parent category.
+func (f *Feeds) Categories(parentID int) (*Feed, error) {
+	t := f.catalog.Taxonomy()
+	title := "Categories"
+	if parentID != bookshop.NoParent {
+		parent, err := t.Get(parentID)
+		if err != nil {
+			return nil, err
+		}
+		title = parent.Name
+	}
+
+	books, err := f.catalog.GetAllBooks()
+	if err != nil {
+		return nil, err
+	}
+	// count returns the number of books in the category
+	// and its subcategories.
+	count := func(id int) int {
+		ids, err := t.Subtree(id)
+		if err != nil {
+			return 0
+		}
+		n := 0
+		for _, b := range books {
+			if b.InCategory(ids...) {
+				n++
+			}
+		}
+		return n
+	}
+
+	feed := f.newFeed("categories:"+strconv.Itoa(parentID), title, f.categoriesPath(parentID), TypeNavigation)
+	if parentID != bookshop.NoParent {
+		parent, _ := t.Get(parentID)
+		feed.Links = append(feed.Links, Link{Rel: RelUp, Href: f.categoriesPath(parent.ParentID), Type: TypeNavigation})
+		feed.Entries = append(feed.Entries, f.navEntry("categories:"+parent.Slug, "All in "+parent.Name, "",
+			RelSubsection, f.path("/categories/"+url.PathEscape(parent.Slug)), TypeAcquisition, count(parent.ID)))
+	}
+	for _, c := range t.Children(parentID) {
+		href, typ := f.path("/categories/"+url.PathEscape(c.Slug)), TypeAcquisition
+		if len(t.Children(c.ID)) > 0 {
+			href, typ = f.categoriesPath(c.ID), TypeNavigation
+		}
+		var content string
+		if parentID != bookshop.NoParent {
+			content = strings.Join(categoryNames(t, c.ID), " / ")
+		}
+		feed.Entries = append(feed.Entries, f.navEntry("categories:"+c.Slug, c.Name, content, RelSubsection, href, typ, count(c.ID)))
+	}
+	return feed, nil
+}
+
+// Authors knows how to build the navigation feed of authors
+// sorted by name, with an entry per unique author.
+func (f *Feeds) Authors(page int) (*Feed, error) {
+	authors, err := f.catalog.GetUniqueAuthors()
+	if err != nil {
+		return nil, err
+	}
+	books, err := f.catalog.GetAllBooks()
+	if err != nil {
+		return nil, err
+	}
+	counts := make(map[string]int)
+	for _, b := range books {
+		for _, a := range b.Authors {
+			counts[a]++
+		}
+	}
+
+	feed := f.newFeed("authors", "Authors", f.path("/authors"), TypeNavigation)
+	start, end, err := f.paginate(feed, f.path("/authors"), TypeNavigation, len(authors), page)
+	if err != nil {
+		return nil, err
+	}
+	for _, a := range authors[start:end] {
+		feed.Entries = append(feed.Entries, f.navEntry("authors:"+a, a, "", RelSubsection, f.authorPath(a), TypeAcquisition, counts[a]))
+	}
+	return feed, nil
+}
+
+// Author knows how to build the acquisition feed of books
+// by the author, matched ignoring case.
+func (f *Feeds) Author(name string, page int) (*Feed, error) {
+	feed, err := f.acquisition("authors:"+name, name, f.authorPath(name), bookshop.Query{Author: name}, page)
+	if err != nil {
+		return nil, err
+	}
+	feed.Links = append(feed.Links, Link{Rel: RelUp, Href: f.path("/authors"), Type: TypeNavigation})
+	return feed, nil
+}
+
+// ServeHTTP implements http.Handler interface.
+func (f *Feeds) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet && r.Method != http.MethodHead {
+		w.Header().Set("Allow", "GET, HEAD")
+		http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	if !strings.HasPrefix(r.URL.Path, f.cfg.Prefix) {
+		http.NotFound(w, r)
+		return
+	}
+	path := strings.TrimSuffix(strings.TrimPrefix(r.URL.Path, f.cfg.Prefix), "/")
+
+	page := 1
+	if v := r.URL.Query().Get("page"); v != "" {
+		n, err := strconv.Atoi(v)
+		if err != nil || n < 1 {
+			http.Error(w, fmt.Sprintf("invalid page: %q", v), http.StatusBadRequest)
+			return
+		}
+		page = n
+	}
+
+	var (
+		feed *Feed
+		err  error
+	)
+	switch {
+	case path == "":
+		feed = f.Root()
+	case path == "/books":
+		feed, err = f.Books(page)
+	case path == "/featured":
+		feed, err = f.Featured(page)
+	case path == "/categories":
+		parentID := bookshop.NoParent
+		if slug := r.URL.Query().Get("parent"); slug != "" {
+			var parent bookshop.Category
+			parent, err = f.catalog.Taxonomy().BySlug(slug)
+			parentID = parent.ID
+		}
+		if err == nil {
+			feed, err = f.Categories(parentID)
+		}
+	case strings.HasPrefix(path, "/categories/"):
+		feed, err = f.Category(strings.TrimPrefix(path, "/categories/"), page)
+	case path == "/authors":
+		feed, err = f.Authors(page)
+	case strings.HasPrefix(path, "/authors/"):
+		feed, err = f.Author(strings.TrimPrefix(path, "/authors/"), page)
+	default:
+		http.NotFound(w, r)
+		return
+	}
+
+	switch {
+	case errors.Is(err, ErrPageNotFound), errors.Is(err, bookshop.ErrCategoryNotFound):
+		http.Error(w, err.Error(), http.StatusNotFound)
+		return
+	case err != nil:
+		http.Error(w, "internal server error", http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", feedType(feed)+";charset=utf-8")
+	if r.Method == http.MethodHead {
+		return
+	}
+	_ = feed.Encode(w)
+}
+
+// acquisition builds a paginated feed of books
+// matching the query, sorted by title.
+func (f *Feeds) acquisition(key, title, path string, q bookshop.Query, page int) (*Feed, error) {
+	q.SortBy = bookshop.SortByTitle
+	books, err := queryAll(f.catalog, q)
+	if err != nil {
+		return nil, err
+	}
+
+	feed := f.newFeed(key, title, path, TypeAcquisition)
+	start, end, err := f.paginate(feed, path, TypeAcquisition, len(books), page)
+	if err != nil {
+		return nil, err
+	}
+	for _, b := range books[start:end] {
+		feed.Entries = append(feed.Entries, f.bookEntry(b))
+	}
+	return feed, nil
+}
+
+// paginate adds pagination links to the feed and returns
+// bounds of the page in a list of total entries.
+func (f *Feeds) paginate(feed *Feed, path, typ string, total, page int) (int, int, error) {
+	if page < 1 {
+		return 0, 0, fmt.Errorf("%w: %d", ErrPageNotFound, page)
+	}
+	last := (total + f.cfg.PageSize - 1) / f.cfg.PageSize
+	if last == 0 {
+		last = 1
+	}
+	if page > last {
+		return 0, 0, fmt.Errorf("%w: %d of %d", ErrPageNotFound, page, last)
+	}
+
+	pageHref := func(n int) string {
+		if n == 1 {
+			return path
+		}
+		return path + "?page=" + strconv.Itoa(n)
+	}
+	feed.Links[0].Href = pageHref(page)
+	if last > 1 {
+		feed.Links = append(feed.Links,
+			Link{Rel: RelFirst, Href: pageHref(1), Type: typ},
+			Link{Rel: RelLast, Href: pageHref(last), Type: typ})
+	}
+	if page > 1 {
+		feed.Links = append(feed.Links, Link{Rel: RelPrevious, Href: pageHref(page - 1), Type: typ})
+	}
+	if page < last {
+		feed.Links = append(feed.Links, Link{Rel: RelNext, Href: pageHref(page + 1), Type: typ})
+	}
+
+	start := (page - 1) * f.cfg.PageSize
+	end := start + f.cfg.PageSize
+	if end > total {
+		end = total
+	}
+	return start, end, nil
+}
+
+// newFeed returns a feed with self and start links.
+// The self link is always the first one.
+func (f *Feeds) newFeed(key, title, path, typ string) *Feed {
+	return &Feed{
+		Xmlns:     NamespaceAtom,
+		XmlnsOPDS: NamespaceOPDS,
+		XmlnsDC:   NamespaceDC,
+		XmlnsThr:  NamespaceThr,
+		ID:        "urn:bookshop:opds:" + key,
+		Title:     title,
+		Updated:   f.updated(),
+		Author:    &Person{Name: f.cfg.Title},
+		Links: []Link{
+			{Rel: RelSelf, Href: path, Type: typ},
+			{Rel: RelStart, Href: f.path(""), Type: TypeNavigation},
+		},
+	}
+}
+
+func (f *Feeds) navEntry(key, title, content, rel, href, typ string, count int) Entry {
+	e := Entry{
+		ID:      "urn:bookshop:opds:" + key,
+		Title:   title,
+		Updated: f.updated(),
+		Links:   []Link{{Rel: rel, Href: href, Type: typ, Count: count}},
+	}
+	if content != "" {
+		e.Content = &Text{Type: "text", Body: content}
+	}
+	return e
+}
+
+func (f *Feeds) bookEntry(b bookshop.Book) Entry {
+	e := Entry{
+		ID:      "urn:bookshop:book:" + b.ID,
+		Title:   b.Title,
+		Updated: f.updated(),
+	}
+	for _, a := range b.Authors {
+		e.Authors = append(e.Authors, Person{Name: a, URI: f.authorPath(a)})
+	}
+	if b.ISBN != "" {
+		e.Identifier = "urn:isbn:" + b.ISBN
+	}
+	if b.ReleaseYear > 0 {
+		e.Issued = strconv.Itoa(b.ReleaseYear)
+	}
+	t := f.catalog.Taxonomy()
+	for _, id := range b.Categories() {
+		c, err := t.Get(id)
+		if err != nil {
+			continue
+		}
+		e.Categories = append(e.Categories, Category{Scheme: f.path("/categories"), Term: c.Slug, Label: c.Name})
+	}
+	if b.Description != "" {
+		e.Summary = &Text{Type: "text", Body: b.Description}
+	}
+
+	buy := Link{Rel: RelAcquireBuy, Href: strings.Replace(f.cfg.BuyURL, "{id}", url.PathEscape(b.ID), -1), Type: "text/html"}
+	// Books that have never been priced get no opds:price.
+	if sale := b.SalePrice(); sale.Currency() != "" {
+		buy.Price = &Price{CurrencyCode: string(sale.Currency()), Value: sale.Decimal()}
+	}
+	e.Links = append(e.Links, buy)
+	for _, a := range b.Authors {
+		e.Links = append(e.Links, Link{Rel: RelRelated, Href: f.authorPath(a), Type: TypeAcquisition, Title: "Books by " + a})
+	}
+	return e
+}
+
+func (f *Feeds) updated() string {
+	return f.cfg.Now().UTC().Format(time.RFC3339)
+}
+
+func (f *Feeds) path(p string) string {
+	return f.cfg.Prefix + p
+}
+
+func (f *Feeds) authorPath(name string) string {
+	return f.path("/authors/" + url.PathEscape(name))
+}
+
+func (f *Feeds) categoriesPath(parentID int) string {
+	if parentID == bookshop.NoParent {
+		return f.path("/categories")
+	}
+	c, err := f.catalog.Taxonomy().Get(parentID)
+	if err != nil {
+		return f.path("/categories")
+	}
+	return f.path("/categories?parent=" + url.QueryEscape(c.Slug))
+}
+
+// categoryNames returns names of the category and its ancestors,
+// starting from the top level.
+func categoryNames(t *bookshop.Taxonomy, id int) []string {
+	path, err := t.Path(id)
+	if err != nil {
+		return nil
+	}
+	names := make([]string, len(path))
+	for i, c := range path {
+		names[i] = c.Name
+	}
+	return names
+}
+
+// feedType returns the media type of the feed from its self link.
+func feedType(f *Feed) string {
+	return f.Links[0].Type
+}
+
+// queryAll returns all books matching the query.
+func queryAll(c *bookshop.Catalog, q bookshop.Query) ([]bookshop.Book, error) {
+	q.Limit = bookshop.MaxPageSize
+	var books []bookshop.Book
+	for {
+		page, err := c.Query(q)
+		if err != nil {
+			return nil, err
+		}
+		books = append(books, page.Books...)
+		if page.NextCursor == "" {
+			return books, nil
+		}
+		q.Cursor = page.NextCursor
+	}
+}
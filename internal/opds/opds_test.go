@@ -0,0 +1,301 @@
+package opds_test
+
+import (
+	"errors"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/google/go-cmp/cmp"
+	"github.com/qba73/bookshop/internal/bookshop"
+	"github.com/qba73/bookshop/internal/money"
+	"github.com/qba73/bookshop/internal/opds"
+)
+
+var now = time.Date(2021, time.March, 1, 12, 0, 0, 0, time.UTC)
+
+// newTestFeeds returns feeds with a page size of two over
+// a catalog with a "Go" subcategory of programming.
+func newTestFeeds(t *testing.T) *opds.Feeds {
+	t.Helper()
+
+	tax := bookshop.NewTaxonomy()
+	goCat, err := tax.Add("Go", bookshop.CategoryProgramming)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	books := []struct {
+		id, title, author string
+		category          int
+		pick              bool
+	}{
+		{id: "1", title: "Zosia Samosia", author: "Julian Tuwim", category: bookshop.CategoryRomance, pick: true},
+		{id: "2", title: "Lokomotywa", author: "Julian Tuwim", category: bookshop.CategoryRomance},
+		{id: "3", title: "Go w praktyce", author: "Jan Kowalski", category: goCat.ID, pick: true},
+		{id: "4", title: "Algorytmy", author: "Anna Nowak", category: bookshop.CategoryProgramming},
+		{id: "5", title: "Akademia pana Kleksa", author: "Jan Brzechwa", category: bookshop.CategoryAutobiography},
+	}
+
+	c := bookshop.NewCatalog(bookshop.NewMemoryStore(nil))
+	c.SetTaxonomy(tax)
+	for _, b := range books {
+		book := bookshop.Book{ID: b.id, Title: b.title, Authors: []string{b.author}, PickOfTheMonth: b.pick, Price: money.New(2000, money.PLN)}
+		if err := book.SetCategory(b.category); err != nil {
+			t.Fatal(err)
+		}
+		if err := c.AddBook(book); err != nil {
+			t.Fatal(err)
+		}
+	}
+	return opds.NewFeeds(c, opds.Config{PageSize: 2, Now: func() time.Time { return now }})
+}
+
+func entryTitles(f *opds.Feed) []string {
+	var titles []string
+	for _, e := range f.Entries {
+		titles = append(titles, e.Title)
+	}
+	return titles
+}
+
+func links(f *opds.Feed) map[string]string {
+	m := make(map[string]string)
+	for _, l := range f.Links {
+		m[l.Rel] = l.Href
+	}
+	return m
+}
+
+func TestBooksPagination(t *testing.T) {
+	t.Parallel()
+
+	f := newTestFeeds(t)
+
+	tt := []struct {
+		name   string
+		page   int
+		titles []string
+		links  map[string]string
+	}{
+		{
+			name:   "First page",
+			page:   1,
+			titles: []string{"Akademia pana Kleksa", "Algorytmy"},
+			links: map[string]string{
+				opds.RelSelf: "/opds/books", opds.RelStart: "/opds",
+				opds.RelFirst: "/opds/books", opds.RelLast: "/opds/books?page=3", opds.RelNext: "/opds/books?page=2",
+			},
+		},
+		{
+			name:   "Middle page",
+			page:   2,
+			titles: []string{"Go w praktyce", "Lokomotywa"},
+			links: map[string]string{
+				opds.RelSelf: "/opds/books?page=2", opds.RelStart: "/opds",
+				opds.RelFirst: "/opds/books", opds.RelLast: "/opds/books?page=3",
+				opds.RelPrevious: "/opds/books", opds.RelNext: "/opds/books?page=3",
+			},
+		},
+		{
+			name:   "Last page",
+			page:   3,
+			titles: []string{"Zosia Samosia"},
+			links: map[string]string{
+				opds.RelSelf: "/opds/books?page=3", opds.RelStart: "/opds",
+				opds.RelFirst: "/opds/books", opds.RelLast: "/opds/books?page=3", opds.RelPrevious: "/opds/books?page=2",
+			},
+		},
+	}
+
+	for _, tc := range tt {
+		feed, err := f.Books(tc.page)
+		if err != nil {
+			t.Fatalf("%s: %v", tc.name, err)
+		}
+		if !cmp.Equal(tc.titles, entryTitles(feed)) {
+			t.Errorf("%s titles:\n%s", tc.name, cmp.Diff(tc.titles, entryTitles(feed)))
+		}
+		if !cmp.Equal(tc.links, links(feed)) {
+			t.Errorf("%s links:\n%s", tc.name, cmp.Diff(tc.links, links(feed)))
+		}
+	}
+
+	if _, err := f.Books(4); !errors.Is(err, opds.ErrPageNotFound) {
+		t.Errorf("Books(4) = %v, want: %v", err, opds.ErrPageNotFound)
+	}
+}
+
+func TestBookEntry(t *testing.T) {
+	t.Parallel()
+
+	f := newTestFeeds(t)
+	feed, err := f.Featured(1)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	want := opds.Entry{
+		ID:         "urn:bookshop:book:3",
+		Title:      "Go w praktyce",
+		Updated:    "2021-03-01T12:00:00Z",
+		Authors:    []opds.Person{{Name: "Jan Kowalski", URI: "/opds/authors/Jan%20Kowalski"}},
+		Categories: []opds.Category{{Scheme: "/opds/categories", Term: "go", Label: "Go"}},
+		Links: []opds.Link{
+			{Rel: opds.RelAcquireBuy, Href: "/books/3", Type: "text/html", Price: &opds.Price{CurrencyCode: "PLN", Value: "20.00"}},
+			{Rel: opds.RelRelated, Href: "/opds/authors/Jan%20Kowalski", Type: opds.TypeAcquisition, Title: "Books by Jan Kowalski"},
+		},
+	}
+	if len(feed.Entries) != 2 {
+		t.Fatalf("Featured() has %d entries, want: 2", len(feed.Entries))
+	}
+	if !cmp.Equal(want, feed.Entries[0]) {
+		t.Error(cmp.Diff(want, feed.Entries[0]))
+	}
+}
+
+func TestCategories(t *testing.T) {
+	t.Parallel()
+
+	f := newTestFeeds(t)
+
+	feed, err := f.Categories(bookshop.NoParent)
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := []opds.Link{
+		{Rel: opds.RelSubsection, Href: "/opds/categories/autobiography", Type: opds.TypeAcquisition, Count: 1},
+		{Rel: opds.RelSubsection, Href: "/opds/categories/tech", Type: opds.TypeAcquisition},
+		{Rel: opds.RelSubsection, Href: "/opds/categories/romance", Type: opds.TypeAcquisition, Count: 2},
+		{Rel: opds.RelSubsection, Href: "/opds/categories?parent=programming", Type: opds.TypeNavigation, Count: 2},
+	}
+	var got []opds.Link
+	for _, e := range feed.Entries {
+		got = append(got, e.Links...)
+	}
+	if !cmp.Equal(want, got) {
+		t.Error(cmp.Diff(want, got))
+	}
+
+	feed, err = f.Categories(bookshop.CategoryProgramming)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if titles := entryTitles(feed); !cmp.Equal([]string{"All in Programming", "Go"}, titles) {
+		t.Errorf("Categories(programming) titles = %q", titles)
+	}
+	if feed.Entries[1].Content == nil || feed.Entries[1].Content.Body != "Programming / Go" {
+		t.Errorf("Categories(programming) Go entry content = %+v", feed.Entries[1].Content)
+	}
+
+	feed, err = f.Category("programming", 1)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if titles := entryTitles(feed); !cmp.Equal([]string{"Algorytmy", "Go w praktyce"}, titles) {
+		t.Errorf("Category(programming) titles = %q", titles)
+	}
+	if up := links(feed)[opds.RelUp]; up != "/opds/categories" {
+		t.Errorf("Category(programming) up link = %q", up)
+	}
+
+	if _, err := f.Category("nonexistent", 1); !errors.Is(err, bookshop.ErrCategoryNotFound) {
+		t.Errorf("Category(nonexistent) = %v, want: %v", err, bookshop.ErrCategoryNotFound)
+	}
+}
+
+func TestAuthors(t *testing.T) {
+	t.Parallel()
+
+	f := newTestFeeds(t)
+
+	feed, err := f.Authors(1)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if titles := entryTitles(feed); !cmp.Equal([]string{"Anna Nowak", "Jan Brzechwa"}, titles) {
+		t.Errorf("Authors(1) titles = %q", titles)
+	}
+	feed, err = f.Authors(2)
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := []opds.Link{{Rel: opds.RelSubsection, Href: "/opds/authors/Julian%20Tuwim", Type: opds.TypeAcquisition, Count: 2}}
+	if len(feed.Entries) != 2 || !cmp.Equal(want, feed.Entries[1].Links) {
+		t.Errorf("Authors(2) entries = %+v", feed.Entries)
+	}
+
+	feed, err = f.Author("julian tuwim", 1)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if titles := entryTitles(feed); !cmp.Equal([]string{"Lokomotywa", "Zosia Samosia"}, titles) {
+		t.Errorf("Author(julian tuwim) titles = %q", titles)
+	}
+}
+
+func TestServeHTTP(t *testing.T) {
+	t.Parallel()
+
+	ts := httptest.NewServer(newTestFeeds(t))
+	defer ts.Close()
+
+	tt := []struct {
+		name        string
+		path        string
+		status      int
+		contentType string
+		contains    string
+	}{
+		{name: "Root", path: "/opds", status: http.StatusOK, contentType: opds.TypeNavigation, contains: `rel="http://opds-spec.org/featured" href="/opds/featured"`},
+		{name: "Books", path: "/opds/books?page=2", status: http.StatusOK, contentType: opds.TypeAcquisition, contains: `<opds:price currencycode="PLN">20.00</opds:price>`},
+		{name: "Featured", path: "/opds/featured", status: http.StatusOK, contentType: opds.TypeAcquisition, contains: "<title>Zosia Samosia</title>"},
+		{name: "Subcategories", path: "/opds/categories?parent=programming", status: http.StatusOK, contentType: opds.TypeNavigation, contains: `thr:count="1"`},
+		{name: "Category", path: "/opds/categories/go", status: http.StatusOK, contentType: opds.TypeAcquisition, contains: "<title>Go w praktyce</title>"},
+		{name: "Author", path: "/opds/authors/Jan%20Brzechwa", status: http.StatusOK, contentType: opds.TypeAcquisition, contains: "<title>Akademia pana Kleksa</title>"},
+		{name: "Unknown category", path: "/opds/categories/nonexistent", status: http.StatusNotFound},
+		{name: "Unknown parent", path: "/opds/categories?parent=nonexistent", status: http.StatusNotFound},
+		{name: "Page past the end", path: "/opds/books?page=9", status: http.StatusNotFound},
+		{name: "Invalid page", path: "/opds/books?page=abc", status: http.StatusBadRequest},
+		{name: "Unknown feed", path: "/opds/nonexistent", status: http.StatusNotFound},
+	}
+
+	for _, tc := range tt {
+		resp, err := http.Get(ts.URL + tc.path)
+		if err != nil {
+			t.Fatal(err)
+		}
+		var body strings.Builder
+		_, err = io.Copy(&body, resp.Body)
+		resp.Body.Close()
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		if resp.StatusCode != tc.status {
+			t.Errorf("%s: GET %s status = %d, want: %d", tc.name, tc.path, resp.StatusCode, tc.status)
+			continue
+		}
+		if tc.status != http.StatusOK {
+			continue
+		}
+		if got := resp.Header.Get("Content-Type"); got != tc.contentType+";charset=utf-8" {
+			t.Errorf("%s: Content-Type = %q, want: %q", tc.name, got, tc.contentType)
+		}
+		if !strings.Contains(body.String(), tc.contains) {
+			t.Errorf("%s: GET %s body does not contain %s:\n%s", tc.name, tc.path, tc.contains, body.String())
+		}
+	}
+
+	resp, err := http.Post(ts.URL+"/opds", "text/plain", nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	resp.Body.Close()
+	if resp.StatusCode != http.StatusMethodNotAllowed {
+		t.Errorf("POST /opds status = %d, want: %d", resp.StatusCode, http.StatusMethodNotAllowed)
+	}
+}
@@ -0,0 +1,230 @@
+package payment
+
+import (
+	"context"
+	"fmt"
+	"sync"
+
+	"github.com/qba73/bookshop/internal/money"
+)
+
+// Operation names a Gateway method.
+type Operation string
+
+// Gateway operations.
+const (
+	OpAuthorize Operation = "authorize"
+	OpLookup    Operation = "lookup"
+	OpCapture   Operation = "capture"
+	OpVoid      Operation = "void"
+	OpRefund    Operation = "refund"
+)
+
+// Fault describes how the fake gateway misbehaves on a single call.
+type Fault struct {
+	Op  Operation
+	Err error
+	// Applied makes the gateway perform the operation before
+	// returning Err, simulating a response lost after success.
+	Applied bool
+}
+
+// FakeGateway is a deterministic in-memory Gateway for tests.
+// Transaction IDs are assigned sequentially, "tx-1", "tx-2" and
+// so on. Faults injected with Inject are consumed in order, one
+// per call of the matching operation. It is safe for concurrent use.
+type FakeGateway struct {
+	mu     sync.Mutex
+	nextID int
+	txs    map[string]*Transaction
+	keys   map[string]string
+	faults map[Operation][]Fault
+	calls  map[Operation]int
+}
+
+// NewFakeGateway knows how to construct a fake gateway
+// that accepts every valid request.
+func NewFakeGateway() *FakeGateway {
+	return &FakeGateway{
+		txs:    make(map[string]*Transaction),
+		keys:   make(map[string]string),
+		faults: make(map[Operation][]Fault),
+		calls:  make(map[Operation]int),
+	}
+}
+
+// Inject queues faults for subsequent calls.
+func (g *FakeGateway) Inject(faults ...Fault) {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+
+	for _, f := range faults {
+		g.faults[f.Op] = append(g.faults[f.Op], f)
+	}
+}
+
+// Calls returns how many times the operation has been called.
+func (g *FakeGateway) Calls(op Operation) int {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+
+	return g.calls[op]
+}
+
+// Transaction returns the gateway view of the transaction.
+func (g *FakeGateway) Transaction(id string) (Transaction, bool) {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+
+	tx, ok := g.txs[id]
+	if !ok {
+		return Transaction{}, false
+	}
+	return *tx, true
+}
+
+// Authorize holds funds for the order and returns the new transaction.
+func (g *FakeGateway) Authorize(ctx context.Context, req AuthorizeRequest) (Transaction, error) {
+	return g.do(ctx, OpAuthorize, func() (*Transaction, error) {
+		if err := req.Validate(); err != nil {
+			return nil, err
+		}
+		if id, ok := g.keys[req.IdempotencyKey]; ok && req.IdempotencyKey != "" {
+			tx := g.txs[id]
+			if tx.OrderID != req.OrderID || tx.Authorized != req.Amount {
+				return nil, fmt.Errorf("key %s: %w", req.IdempotencyKey, ErrIdempotencyMismatch)
+			}
+			return tx, nil
+		}
+		g.nextID++
+		tx := Transaction{
+			ID:         fmt.Sprintf("tx-%d", g.nextID),
+			OrderID:    req.OrderID,
+			Authorized: req.Amount,
+			Status:     StatusAuthorized,
+		}
+		g.txs[tx.ID] = &tx
+		if req.IdempotencyKey != "" {
+			g.keys[req.IdempotencyKey] = tx.ID
+		}
+		return &tx, nil
+	})
+}
+
+// Lookup returns the transaction authorized with the idempotency key.
+func (g *FakeGateway) Lookup(ctx context.Context, idempotencyKey string) (Transaction, error) {
+	return g.do(ctx, OpLookup, func() (*Transaction, error) {
+		id, ok := g.keys[idempotencyKey]
+		if !ok || idempotencyKey == "" {
+			return nil, fmt.Errorf("key %s: %w", idempotencyKey, ErrTransactionNotFound)
+		}
+		return g.txs[id], nil
+	})
+}
+
+// Capture collects up to the authorized amount.
+func (g *FakeGateway) Capture(ctx context.Context, txID string, amount money.Money) (Transaction, error) {
+	return g.do(ctx, OpCapture, func() (*Transaction, error) {
+		tx, err := g.lookup(txID, StatusAuthorized)
+		if err != nil {
+			return nil, err
+		}
+		if !within(amount, tx.Authorized) {
+			return nil, fmt.Errorf("%w: capture %v of %v authorized", ErrInvalidAmount, amount, tx.Authorized)
+		}
+		tx.Captured = amount
+		tx.Status = StatusCaptured
+		return tx, nil
+	})
+}
+
+// Void releases an authorization that has not been captured.
+func (g *FakeGateway) Void(ctx context.Context, txID string) (Transaction, error) {
+	return g.do(ctx, OpVoid, func() (*Transaction, error) {
+		tx, err := g.lookup(txID, StatusAuthorized)
+		if err != nil {
+			return nil, err
+		}
+		tx.Status = StatusVoided
+		return tx, nil
+	})
+}
+
+// Refund returns up to the captured amount to the customer.
+func (g *FakeGateway) Refund(ctx context.Context, txID string, amount money.Money) (Transaction, error) {
+	return g.do(ctx, OpRefund, func() (*Transaction, error) {
+		tx, err := g.lookup(txID, StatusCaptured, StatusPartiallyRefunded)
+		if err != nil {
+			return nil, err
+		}
+		left, err := tx.Captured.Sub(tx.Refunded)
+		if err != nil {
+			return nil, err
+		}
+		if !within(amount, left) {
+			return nil, fmt.Errorf("%w: refund %v of %v captured", ErrInvalidAmount, amount, left)
+		}
+		if tx.Refunded, err = tx.Refunded.Add(amount); err != nil {
+			return nil, err
+		}
+		tx.Status = StatusPartiallyRefunded
+		if tx.Refunded == tx.Captured {
+			tx.Status = StatusRefunded
+		}
+		return tx, nil
+	})
+}
+
+// do runs the operation applying the next queued fault, if any.
+func (g *FakeGateway) do(ctx context.Context, op Operation, apply func() (*Transaction, error)) (Transaction, error) {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+
+	g.calls[op]++
+
+	if err := ctx.Err(); err != nil {
+		return Transaction{}, fmt.Errorf("%w: %v", ErrTimeout, err)
+	}
+
+	var fault *Fault
+	if q := g.faults[op]; len(q) > 0 {
+		fault = &q[0]
+		g.faults[op] = q[1:]
+	}
+
+	if fault != nil && !fault.Applied {
+		return Transaction{}, fault.Err
+	}
+
+	tx, err := apply()
+	if err != nil {
+		return Transaction{}, err
+	}
+	if fault != nil {
+		return Transaction{}, fault.Err
+	}
+	return *tx, nil
+}
+
+func (g *FakeGateway) lookup(id string, allowed ...Status) (*Transaction, error) {
+	tx, ok := g.txs[id]
+	if !ok {
+		return nil, fmt.Errorf("transaction %s: %w", id, ErrTransactionNotFound)
+	}
+	for _, s := range allowed {
+		if tx.Status == s {
+			return tx, nil
+		}
+	}
+	return nil, fmt.Errorf("transaction %s is %s: %w", id, tx.Status, ErrInvalidState)
+}
+
+// within reports whether amount is positive and at most
+// limit in the same currency.
+func within(amount, limit money.Money) bool {
+	if !amount.IsPositive() || amount.Currency() != limit.Currency() {
+		return false
+	}
+	c, err := amount.Cmp(limit)
+	return err == nil && c <= 0
+}
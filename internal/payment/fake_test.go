@@ -0,0 +1,244 @@
+package payment_test
+
+import (
+	"context"
+	"errors"
+	"testing"
+
+	"github.com/google/go-cmp/cmp"
+	"github.com/qba73/bookshop/internal/money"
+	"github.com/qba73/bookshop/internal/payment"
+)
+
+var _ payment.Gateway = (*payment.FakeGateway)(nil)
+
+func TestFakeGatewayLifecycle(t *testing.T) {
+	t.Parallel()
+
+	ctx := context.Background()
+	g := payment.NewFakeGateway()
+
+	tx, err := g.Authorize(ctx, payment.AuthorizeRequest{OrderID: "12282", Amount: money.New(3000, money.PLN)})
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := payment.Transaction{ID: "tx-1", OrderID: "12282", Authorized: money.New(3000, money.PLN), Status: payment.StatusAuthorized}
+	if !cmp.Equal(tx, want) {
+		t.Errorf("Authorize() \n%s", cmp.Diff(want, tx))
+	}
+
+	tt := []struct {
+		name        string
+		fn          func() (payment.Transaction, error)
+		want        payment.Transaction
+		expectedErr error
+	}{
+		{
+			name:        "Capture over authorized",
+			fn:          func() (payment.Transaction, error) { return g.Capture(ctx, "tx-1", money.New(3500, money.PLN)) },
+			expectedErr: payment.ErrInvalidAmount,
+		},
+		{
+			name:        "Capture in other currency",
+			fn:          func() (payment.Transaction, error) { return g.Capture(ctx, "tx-1", money.New(2500, money.EUR)) },
+			expectedErr: payment.ErrInvalidAmount,
+		},
+		{
+			name: "Capture",
+			fn:   func() (payment.Transaction, error) { return g.Capture(ctx, "tx-1", money.New(2500, money.PLN)) },
+			want: payment.Transaction{ID: "tx-1", OrderID: "12282", Authorized: money.New(3000, money.PLN), Captured: money.New(2500, money.PLN), Status: payment.StatusCaptured},
+		},
+		{
+			name:        "Void captured",
+			fn:          func() (payment.Transaction, error) { return g.Void(ctx, "tx-1") },
+			expectedErr: payment.ErrInvalidState,
+		},
+		{
+			name: "Partial refund",
+			fn:   func() (payment.Transaction, error) { return g.Refund(ctx, "tx-1", money.New(1000, money.PLN)) },
+			want: payment.Transaction{ID: "tx-1", OrderID: "12282", Authorized: money.New(3000, money.PLN), Captured: money.New(2500, money.PLN), Refunded: money.New(1000, money.PLN), Status: payment.StatusPartiallyRefunded},
+		},
+		{
+			name:        "Refund over captured",
+			fn:          func() (payment.Transaction, error) { return g.Refund(ctx, "tx-1", money.New(2000, money.PLN)) },
+			expectedErr: payment.ErrInvalidAmount,
+		},
+		{
+			name: "Full refund",
+			fn:   func() (payment.Transaction, error) { return g.Refund(ctx, "tx-1", money.New(1500, money.PLN)) },
+			want: payment.Transaction{ID: "tx-1", OrderID: "12282", Authorized: money.New(3000, money.PLN), Captured: money.New(2500, money.PLN), Refunded: money.New(2500, money.PLN), Status: payment.StatusRefunded},
+		},
+		{
+			name:        "Unknown transaction",
+			fn:          func() (payment.Transaction, error) { return g.Capture(ctx, "tx-9", money.New(100, money.PLN)) },
+			expectedErr: payment.ErrTransactionNotFound,
+		},
+	}
+
+	for _, tc := range tt {
+		got, err := tc.fn()
+		if !errors.Is(err, tc.expectedErr) {
+			t.Fatalf("%s got error: %v, want: %v", tc.name, err, tc.expectedErr)
+		}
+		if tc.expectedErr == nil && !cmp.Equal(got, tc.want) {
+			t.Errorf("%s \n%s", tc.name, cmp.Diff(tc.want, got))
+		}
+	}
+}
+
+func TestFakeGatewayVoid(t *testing.T) {
+	t.Parallel()
+
+	ctx := context.Background()
+	g := payment.NewFakeGateway()
+
+	tx, err := g.Authorize(ctx, payment.AuthorizeRequest{OrderID: "12282", Amount: money.New(3000, money.PLN)})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	tx, err = g.Void(ctx, tx.ID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if tx.Status != payment.StatusVoided {
+		t.Errorf("Void() status = %s, want: %s", tx.Status, payment.StatusVoided)
+	}
+
+	if _, err := g.Capture(ctx, tx.ID, money.New(3000, money.PLN)); !errors.Is(err, payment.ErrInvalidState) {
+		t.Errorf("Capture() voided transaction = %v, want: %v", err, payment.ErrInvalidState)
+	}
+}
+
+func TestFakeGatewayFaults(t *testing.T) {
+	t.Parallel()
+
+	tt := []struct {
+		name           string
+		faults         []payment.Fault
+		wantAuthErr    error
+		wantCaptureErr error
+		wantStatus     payment.Status
+	}{
+		{
+			name:        "Decline",
+			faults:      []payment.Fault{{Op: payment.OpAuthorize, Err: payment.ErrDeclined}},
+			wantAuthErr: payment.ErrDeclined,
+		},
+		{
+			name:        "Authorization timeout",
+			faults:      []payment.Fault{{Op: payment.OpAuthorize, Err: payment.ErrTimeout}},
+			wantAuthErr: payment.ErrTimeout,
+		},
+		{
+			name:           "Capture fails after authorization",
+			faults:         []payment.Fault{{Op: payment.OpCapture, Err: payment.ErrDeclined}},
+			wantCaptureErr: payment.ErrDeclined,
+			wantStatus:     payment.StatusAuthorized,
+		},
+		{
+			name:           "Capture response lost",
+			faults:         []payment.Fault{{Op: payment.OpCapture, Err: payment.ErrTimeout, Applied: true}},
+			wantCaptureErr: payment.ErrTimeout,
+			wantStatus:     payment.StatusCaptured,
+		},
+	}
+
+	for _, tc := range tt {
+		tc := tc
+		t.Run(tc.name, func(t *testing.T) {
+			ctx := context.Background()
+			g := payment.NewFakeGateway()
+			g.Inject(tc.faults...)
+
+			tx, err := g.Authorize(ctx, payment.AuthorizeRequest{OrderID: "12282", Amount: money.New(1000, money.PLN)})
+			if !errors.Is(err, tc.wantAuthErr) {
+				t.Fatalf("%s Authorize() = %v, want: %v", tc.name, err, tc.wantAuthErr)
+			}
+			if err != nil {
+				return
+			}
+
+			_, err = g.Capture(ctx, tx.ID, money.New(1000, money.PLN))
+			if !errors.Is(err, tc.wantCaptureErr) {
+				t.Fatalf("%s Capture() = %v, want: %v", tc.name, err, tc.wantCaptureErr)
+			}
+
+			got, ok := g.Transaction(tx.ID)
+			if !ok {
+				t.Fatalf("%s Transaction(%s) not found", tc.name, tx.ID)
+			}
+			if got.Status != tc.wantStatus {
+				t.Errorf("%s gateway status = %s, want: %s", tc.name, got.Status, tc.wantStatus)
+			}
+
+			// Faults are consumed, the retry succeeds.
+			if tc.wantStatus == payment.StatusAuthorized {
+				if _, err := g.Capture(ctx, tx.ID, money.New(1000, money.PLN)); err != nil {
+					t.Errorf("%s retried Capture() got error: %v", tc.name, err)
+				}
+			}
+			if g.Calls(payment.OpCapture) == 0 {
+				t.Errorf("%s Calls(%s) = 0", tc.name, payment.OpCapture)
+			}
+		})
+	}
+}
+
+func TestFakeGatewayIdempotentAuthorize(t *testing.T) {
+	t.Parallel()
+
+	ctx := context.Background()
+	g := payment.NewFakeGateway()
+
+	req := payment.AuthorizeRequest{OrderID: "12282", Amount: money.New(1000, money.PLN), IdempotencyKey: "key-1"}
+
+	first, err := g.Authorize(ctx, req)
+	if err != nil {
+		t.Fatal(err)
+	}
+	second, err := g.Authorize(ctx, req)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !cmp.Equal(first, second) {
+		t.Errorf("repeated Authorize() \n%s", cmp.Diff(first, second))
+	}
+
+	req.Amount = money.New(2000, money.PLN)
+	if _, err := g.Authorize(ctx, req); !errors.Is(err, payment.ErrIdempotencyMismatch) {
+		t.Errorf("Authorize() with reused key = %v, want: %v", err, payment.ErrIdempotencyMismatch)
+	}
+
+	req.IdempotencyKey = "key-2"
+	third, err := g.Authorize(ctx, req)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if third.ID == first.ID {
+		t.Errorf("Authorize() with new key returned transaction %s again", third.ID)
+	}
+
+	got, err := g.Lookup(ctx, "key-1")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !cmp.Equal(got, first) {
+		t.Errorf("Lookup() \n%s", cmp.Diff(first, got))
+	}
+	if _, err := g.Lookup(ctx, "key-3"); !errors.Is(err, payment.ErrTransactionNotFound) {
+		t.Errorf("Lookup() unknown key = %v, want: %v", err, payment.ErrTransactionNotFound)
+	}
+}
+
+func TestFakeGatewayContextDeadline(t *testing.T) {
+	t.Parallel()
+
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+
+	g := payment.NewFakeGateway()
+	if _, err := g.Authorize(ctx, payment.AuthorizeRequest{OrderID: "12282", Amount: money.New(1000, money.PLN)}); !errors.Is(err, payment.ErrTimeout) {
+		t.Errorf("Authorize() with cancelled context = %v, want: %v", err, payment.ErrTimeout)
+	}
+}
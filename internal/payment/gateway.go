@@ -0,0 +1,91 @@
+package payment
+
+import (
+	"context"
+	"errors"
+	"fmt"
+
+	"github.com/qba73/bookshop/internal/money"
+)
+
+var (
+	// ErrDeclined is returned when the gateway refuses a payment.
+	ErrDeclined = errors.New("payment declined")
+	// ErrTimeout is returned when the gateway does not respond in time.
+	// The outcome of the operation is unknown to the caller.
+	ErrTimeout = errors.New("payment gateway timeout")
+	// ErrTransactionNotFound is returned for unknown transaction IDs
+	// and idempotency keys.
+	ErrTransactionNotFound = errors.New("transaction not found")
+	// ErrInvalidAmount is returned when an amount is not positive,
+	// is in another currency or exceeds what the transaction allows.
+	ErrInvalidAmount = errors.New("invalid amount")
+	// ErrInvalidState is returned when an operation is not allowed
+	// in the current transaction status.
+	ErrInvalidState = errors.New("invalid transaction state")
+	// ErrIdempotencyMismatch is returned when an idempotency key
+	// is reused for a different authorization.
+	ErrIdempotencyMismatch = errors.New("idempotency key reused with different request")
+)
+
+// Status represents a stage of a payment transaction.
+type Status string
+
+// Transaction statuses.
+const (
+	StatusAuthorized        Status = "authorized"
+	StatusCaptured          Status = "captured"
+	StatusVoided            Status = "voided"
+	StatusPartiallyRefunded Status = "partially_refunded"
+	StatusRefunded          Status = "refunded"
+)
+
+// Transaction represents a payment for an order total
+// as seen by the gateway. All amounts are in the currency
+// of the authorization.
+type Transaction struct {
+	ID         string
+	OrderID    string
+	Authorized money.Money
+	Captured   money.Money
+	Refunded   money.Money
+	Status     Status
+}
+
+// AuthorizeRequest holds details of a payment authorization.
+// Requests sent again with the same IdempotencyKey return the
+// original transaction instead of authorizing twice.
+type AuthorizeRequest struct {
+	OrderID        string
+	Amount         money.Money
+	IdempotencyKey string
+}
+
+// Validate knows how to check if the request can be sent to a gateway.
+func (r AuthorizeRequest) Validate() error {
+	if r.OrderID == "" {
+		return errors.New("invalid order id")
+	}
+	if !r.Amount.IsPositive() || r.Amount.Currency() == "" {
+		return fmt.Errorf("%w: %v", ErrInvalidAmount, r.Amount)
+	}
+	return nil
+}
+
+// Gateway defines how the bookshop talks to a payment provider.
+// Funds are first authorized (held) for an order total, then
+// captured when the order is fulfilled. An authorization that
+// is not needed is voided and captured funds are returned with
+// a refund.
+type Gateway interface {
+	// Authorize holds funds for the order and returns the new transaction.
+	Authorize(ctx context.Context, req AuthorizeRequest) (Transaction, error)
+	// Lookup returns the transaction authorized with the idempotency key.
+	Lookup(ctx context.Context, idempotencyKey string) (Transaction, error)
+	// Capture collects up to the authorized amount.
+	Capture(ctx context.Context, txID string, amount money.Money) (Transaction, error)
+	// Void releases an authorization that has not been captured.
+	Void(ctx context.Context, txID string) (Transaction, error)
+	// Refund returns up to the captured amount to the customer.
+	Refund(ctx context.Context, txID string, amount money.Money) (Transaction, error)
+}
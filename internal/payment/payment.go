@@ -1,10 +1,12 @@
 package payment
 
+import "github.com/qba73/bookshop/internal/money"
+
 // Processor defines how payment function signatures should look like.
-type Processor func(bookID string, price int) (bool, error)
+type Processor func(bookID string, price money.Money) (bool, error)
 
 // Pay knows how to process payment for the books.
 // Upon successfull transaction it returns true, false otherwise.
-func Pay(bookID string, price int) (bool, error) {
+func Pay(bookID string, price money.Money) (bool, error) {
 	return true, nil
 }
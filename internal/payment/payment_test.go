@@ -3,6 +3,7 @@ package payment_test
 import (
 	"testing"
 
+	"github.com/qba73/bookshop/internal/money"
 	"github.com/qba73/bookshop/internal/payment"
 )
 
@@ -10,11 +11,11 @@ func TestPay(t *testing.T) {
 	tt := []struct {
 		name        string
 		bookID      string
-		price       int
+		price       money.Money
 		want        bool
 		expectedErr bool
 	}{
-		{"Single book valid transaction", "1912bbf7-3f26-4196-b062-071b81b855e9", 1000, true, false},
+		{"Single book valid transaction", "1912bbf7-3f26-4196-b062-071b81b855e9", money.New(1000, money.PLN), true, false},
 	}
 
 	for _, tc := range tt {
@@ -0,0 +1,270 @@
+// Package pdf writes simple PDF documents with text and lines,
+// such as invoices and sheets of mailing labels.
+//
+// Documents use the standard Type 1 fonts every PDF reader has,
+// so nothing is embedded. Text is written in WinAnsiEncoding with
+// unused codes remapped to the Central European letters it lacks,
+// like Polish ł or ą and Czech ř, which the standard fonts have.
+// Other characters outside the encoding are written as question
+// marks.
+package pdf
+
+import (
+	"bufio"
+	"bytes"
+	"fmt"
+	"io"
+	"strconv"
+	"strings"
+)
+
+// Font is one of the standard Type 1 fonts.
+type Font string
+
+// Standard fonts.
+const (
+	Helvetica     Font = "Helvetica"
+	HelveticaBold Font = "Helvetica-Bold"
+	Courier       Font = "Courier"
+	CourierBold   Font = "Courier-Bold"
+)
+
+// fonts lists fonts in the order they are written to documents.
+var fonts = []Font{Helvetica, HelveticaBold, Courier, CourierBold}
+
+// Size is a page size in points, 1/72 of an inch.
+type Size struct {
+	Width, Height float64
+}
+
+// Page sizes.
+var (
+	A4     = Size{Width: 595.28, Height: 841.89}
+	Letter = Size{Width: 612, Height: 792}
+)
+
+// Mm returns the length in millimetres in points.
+func Mm(mm float64) float64 {
+	return mm * 72 / 25.4
+}
+
+// Document is a PDF document. The zero value is not usable,
+// use New.
+type Document struct {
+	size  Size
+	pages []*Page
+}
+
+// New knows how to construct an empty document with pages
+// of the given size.
+func New(size Size) *Document {
+	return &Document{size: size}
+}
+
+// Size returns the page size of the document.
+func (d *Document) Size() Size {
+	return d.size
+}
+
+// AddPage knows how to add a new page at the end of the document.
+func (d *Document) AddPage() *Page {
+	p := &Page{}
+	d.pages = append(d.pages, p)
+	return p
+}
+
+// Pages returns the number of pages.
+func (d *Document) Pages() int {
+	return len(d.pages)
+}
+
+// Page is a page of a document. Coordinates are in points,
+// from the bottom left corner of the page.
+type Page struct {
+	content bytes.Buffer
+}
+
+// Text knows how to write the text with its baseline starting at x, y.
+func (p *Page) Text(x, y float64, f Font, size float64, s string) {
+	fmt.Fprintf(&p.content, "BT /F%d %s Tf %s %s Td (%s) Tj ET\n",
+		fontIndex(f)+1, num(size), num(x), num(y), escape(encode(s)))
+}
+
+// Line knows how to draw a line of the width from x1, y1 to x2, y2.
+func (p *Page) Line(x1, y1, x2, y2, width float64) {
+	fmt.Fprintf(&p.content, "%s w %s %s m %s %s l S\n",
+		num(width), num(x1), num(y1), num(x2), num(y2))
+}
+
+// Rect knows how to draw the outline of a rectangle with the
+// bottom left corner at x, y.
+func (p *Page) Rect(x, y, width, height, lineWidth float64) {
+	fmt.Fprintf(&p.content, "%s w %s %s %s %s re S\n",
+		num(lineWidth), num(x), num(y), num(width), num(height))
+}
+
+// WriteTo knows how to write the document to w. Documents
+// without pages get a single blank page.
+func (d *Document) WriteTo(w io.Writer) (int64, error) {
+	pages := d.pages
+	if len(pages) == 0 {
+		pages = []*Page{{}}
+	}
+
+	cw := &countWriter{w: bufio.NewWriter(w)}
+	var offsets []int64
+	obj := func(body string) {
+		offsets = append(offsets, cw.n)
+		fmt.Fprintf(cw, "%d 0 obj\n%s\nendobj\n", len(offsets), body)
+	}
+
+	// Objects: catalog, page tree, fonts, then each page
+	// followed by its content stream.
+	first := 3 + len(fonts)
+	kids := make([]string, len(pages))
+	for i := range pages {
+		kids[i] = fmt.Sprintf("%d 0 R", first+2*i)
+	}
+	var fontRefs strings.Builder
+	for i := range fonts {
+		fmt.Fprintf(&fontRefs, "/F%d %d 0 R ", i+1, 3+i)
+	}
+
+	io.WriteString(cw, "%PDF-1.4\n%\xe2\xe3\xcf\xd3\n")
+	obj("<< /Type /Catalog /Pages 2 0 R >>")
+	obj(fmt.Sprintf("<< /Type /Pages /Kids [%s] /Count %d /MediaBox [0 0 %s %s] >>",
+		strings.Join(kids, " "), len(pages), num(d.size.Width), num(d.size.Height)))
+	for _, f := range fonts {
+		obj(fmt.Sprintf("<< /Type /Font /Subtype /Type1 /BaseFont /%s /Encoding %s >>", f, encoding))
+	}
+	for i, p := range pages {
+		obj(fmt.Sprintf("<< /Type /Page /Parent 2 0 R /Resources << /Font << %s>> >> /Contents %d 0 R >>",
+			fontRefs.String(), first+2*i+1))
+		obj(fmt.Sprintf("<< /Length %d >>\nstream\n%sendstream", p.content.Len(), p.content.Bytes()))
+	}
+
+	xref := cw.n
+	fmt.Fprintf(cw, "xref\n0 %d\n0000000000 65535 f \n", len(offsets)+1)
+	for _, off := range offsets {
+		fmt.Fprintf(cw, "%010d 00000 n \n", off)
+	}
+	fmt.Fprintf(cw, "trailer\n<< /Size %d /Root 1 0 R >>\nstartxref\n%d\n%%%%EOF\n", len(offsets)+1, xref)
+
+	if cw.err != nil {
+		return cw.n, cw.err
+	}
+	return cw.n, cw.w.Flush()
+}
+
+// countWriter counts bytes written and remembers the first error.
+type countWriter struct {
+	w   *bufio.Writer
+	n   int64
+	err error
+}
+
+func (c *countWriter) Write(p []byte) (int, error) {
+	if c.err != nil {
+		return 0, c.err
+	}
+	n, err := c.w.Write(p)
+	c.n += int64(n)
+	c.err = err
+	return n, err
+}
+
+func fontIndex(f Font) int {
+	for i, v := range fonts {
+		if v == f {
+			return i
+		}
+	}
+	return 0
+}
+
+// num formats a number with at most two decimal places.
+func num(f float64) string {
+	s := strconv.FormatFloat(f, 'f', 2, 64)
+	return strings.TrimSuffix(strings.TrimRight(s, "0"), ".")
+}
+
+// escape escapes characters with special meaning in PDF strings.
+func escape(b []byte) string {
+	r := strings.NewReplacer(`\`, `\\`, "(", `\(`, ")", `\)`, "\r", `\r`, "\n", `\n`)
+	return r.Replace(string(b))
+}
+
+// winAnsi maps characters of WinAnsiEncoding outside Latin-1
+// to their codes.
+var winAnsi = map[rune]byte{
+	'€': 0x80, '‚': 0x82, 'ƒ': 0x83, '„': 0x84, '…': 0x85, '†': 0x86,
+	'‡': 0x87, 'ˆ': 0x88, '‰': 0x89, 'Š': 0x8a, '‹': 0x8b, 'Œ': 0x8c,
+	'Ž': 0x8e, '‘': 0x91, '’': 0x92, '“': 0x93, '”': 0x94, '•': 0x95,
+	'–': 0x96, '—': 0x97, '˜': 0x98, '™': 0x99, 'š': 0x9a, '›': 0x9b,
+	'œ': 0x9c, 'ž': 0x9e, 'Ÿ': 0x9f,
+}
+
+// extra lists letters missing in WinAnsiEncoding with their
+// glyph names in the standard fonts. They are written with codes
+// WinAnsiEncoding leaves unused, see extraCodes.
+var extra = []struct {
+	r     rune
+	glyph string
+}{
+	{'Ą', "Aogonek"}, {'ą', "aogonek"}, {'Ć', "Cacute"}, {'ć', "cacute"},
+	{'Ę', "Eogonek"}, {'ę', "eogonek"}, {'Ł', "Lslash"}, {'ł', "lslash"},
+	{'Ń', "Nacute"}, {'ń', "nacute"}, {'Ś', "Sacute"}, {'ś', "sacute"},
+	{'Ź', "Zacute"}, {'ź', "zacute"}, {'Ż', "Zdotaccent"}, {'ż', "zdotaccent"},
+	{'Č', "Ccaron"}, {'č', "ccaron"}, {'Ď', "Dcaron"}, {'ď', "dcaron"},
+	{'Ě', "Ecaron"}, {'ě', "ecaron"}, {'Ň', "Ncaron"}, {'ň', "ncaron"},
+	{'Ř', "Rcaron"}, {'ř', "rcaron"}, {'Ť', "Tcaron"}, {'ť', "tcaron"},
+	{'Ů', "Uring"}, {'ů', "uring"}, {'Ő', "Ohungarumlaut"}, {'ő', "ohungarumlaut"},
+	{'Ű', "Uhungarumlaut"}, {'ű', "uhungarumlaut"},
+}
+
+// extraCodes are codes with no character in WinAnsiEncoding:
+// control codes other than tab and line breaks, and the gaps
+// in the 0x7f-0x9f range.
+var extraCodes = []byte{
+	0x01, 0x02, 0x03, 0x04, 0x05, 0x06, 0x07, 0x08, 0x0b, 0x0c,
+	0x0e, 0x0f, 0x10, 0x11, 0x12, 0x13, 0x14, 0x15, 0x16, 0x17,
+	0x18, 0x19, 0x1a, 0x1b, 0x1c, 0x1d, 0x1e, 0x1f, 0x7f, 0x81,
+	0x8d, 0x8f, 0x90, 0x9d,
+}
+
+// encoding is the font encoding, WinAnsiEncoding with
+// extra letters, and extraCode maps the letters to codes.
+var encoding, extraCode = func() (string, map[rune]byte) {
+	codes := make(map[rune]byte, len(extra))
+	var diffs strings.Builder
+	for i, e := range extra {
+		c := extraCodes[i]
+		if i == 0 || c != extraCodes[i-1]+1 {
+			fmt.Fprintf(&diffs, " %d", c)
+		}
+		fmt.Fprintf(&diffs, " /%s", e.glyph)
+		codes[e.r] = c
+	}
+	return fmt.Sprintf("<< /Type /Encoding /BaseEncoding /WinAnsiEncoding /Differences [%s] >>", strings.TrimSpace(diffs.String())), codes
+}()
+
+// encode returns the text in the font encoding. Characters that
+// cannot be encoded are replaced with a question mark.
+func encode(s string) []byte {
+	b := make([]byte, 0, len(s))
+	for _, r := range s {
+		switch {
+		case extraCode[r] != 0:
+			b = append(b, extraCode[r])
+		case r < 0x20:
+			b = append(b, '?')
+		case r < 0x7f || (r >= 0xa0 && r <= 0xff):
+			b = append(b, byte(r))
+		case winAnsi[r] != 0:
+			b = append(b, winAnsi[r])
+		default:
+			b = append(b, '?')
+		}
+	}
+	return b
+}
@@ -0,0 +1,80 @@
+package pdf_test
+
+import (
+	"bytes"
+	"fmt"
+	"regexp"
+	"strconv"
+	"strings"
+	"testing"
+
+	"github.com/qba73/bookshop/internal/pdf"
+)
+
+func TestDocument_WriteTo(t *testing.T) {
+	t.Parallel()
+
+	d := pdf.New(pdf.A4)
+	p := d.AddPage()
+	p.Text(pdf.Mm(20), pdf.Mm(270), pdf.Helvetica, 12, "Faktura (kopia) 9,99 €")
+	p.Line(0, 10, 100, 10, 0.5)
+	d.AddPage().Text(10, 10, pdf.CourierBold, 9, "Łódź, ul. Żółta 1")
+
+	var buf bytes.Buffer
+	n, err := d.WriteTo(&buf)
+	if err != nil {
+		t.Fatal(err)
+	}
+	out := buf.Bytes()
+	if n != int64(len(out)) {
+		t.Errorf("WriteTo() = %d bytes, wrote %d", n, len(out))
+	}
+
+	for _, want := range []string{
+		"%PDF-1.4\n",
+		"/Count 2 /MediaBox [0 0 595.28 841.89]",
+		"/BaseFont /Helvetica /Encoding << /Type /Encoding /BaseEncoding /WinAnsiEncoding /Differences [1 /Aogonek /aogonek",
+		"/tcaron 127 /Uring 129 /uring 141 /Ohungarumlaut 143 /ohungarumlaut /Uhungarumlaut 157 /uhungarumlaut] >>",
+		`BT /F1 12 Tf 56.69 765.35 Td (Faktura \(kopia\) 9,99 ` + "\x80" + `) Tj ET`,
+		"0.5 w 0 10 m 100 10 l S",
+		"BT /F4 9 Tf 10 10 Td (\x07\xf3d\x11, ul. \x12\xf3\x08ta 1) Tj ET",
+		"%%EOF\n",
+	} {
+		if !bytes.Contains(out, []byte(want)) {
+			t.Errorf("document does not contain %q", want)
+		}
+	}
+
+	// Every object in the cross-reference table starts where
+	// the table says it does.
+	m := regexp.MustCompile(`(?s)xref\n0 (\d+)\n(.*)trailer`).FindSubmatch(out)
+	if m == nil {
+		t.Fatal("no cross-reference table")
+	}
+	entries := strings.Split(strings.TrimSpace(string(m[2])), "\n")
+	if size, _ := strconv.Atoi(string(m[1])); size != len(entries) {
+		t.Fatalf("cross-reference table has %d entries, want %d", len(entries), size)
+	}
+	for i, e := range entries[1:] {
+		off, err := strconv.Atoi(e[:10])
+		if err != nil {
+			t.Fatal(err)
+		}
+		want := fmt.Sprintf("%d 0 obj", i+1)
+		if !bytes.HasPrefix(out[off:], []byte(want)) {
+			t.Errorf("object %d not found at offset %d", i+1, off)
+		}
+	}
+}
+
+func TestDocument_WriteToWithoutPages(t *testing.T) {
+	t.Parallel()
+
+	var buf bytes.Buffer
+	if _, err := pdf.New(pdf.Letter).WriteTo(&buf); err != nil {
+		t.Fatal(err)
+	}
+	if !strings.Contains(buf.String(), "/Count 1 /MediaBox [0 0 612 792]") {
+		t.Errorf("want a single blank page, got\n%s", buf.String())
+	}
+}
@@ -0,0 +1,346 @@
+// Package promo applies promotion rules to orders.
+package promo
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/qba73/bookshop/internal/bookshop"
+	"github.com/qba73/bookshop/internal/bookshop/order"
+	"github.com/qba73/bookshop/internal/money"
+)
+
+// Books looks up books ordered by customers,
+// for example a bookshop.Store.
+type Books interface {
+	Get(id string) (bookshop.Book, error)
+}
+
+// Engine evaluates promotion rules against orders.
+// Rules are applied on top of book discounts, in order of
+// priority, each to what is left of the price after rules
+// applied before it. Rules with the same priority apply
+// in the order they were given.
+type Engine struct {
+	books    Books
+	taxonomy *bookshop.Taxonomy
+	rules    []Rule
+}
+
+// Saving is the amount a rule took off the price.
+type Saving struct {
+	RuleID string
+	Name   string
+	Amount money.Money
+}
+
+// Line is the breakdown of promotions applied to an order line.
+type Line struct {
+	BookID   string
+	Quantity int
+	// Price is the line total before promotions.
+	Price money.Money
+	// Savings lists rules that discounted the line,
+	// in the order they were applied.
+	Savings []Saving
+	// Total is the line total after promotions.
+	Total money.Money
+}
+
+// Result is the itemised breakdown of promotions
+// applied to an order.
+type Result struct {
+	Lines []Line
+	// Savings lists the amount each rule saved
+	// on the whole order, in the order applied.
+	Savings  []Saving
+	Subtotal money.Money
+	Discount money.Money
+	Total    money.Money
+}
+
+// NewEngine knows how to construct an engine evaluating the rules.
+// It returns an error when any of the rules is not valid or two
+// rules have the same ID.
+func NewEngine(books Books, rules ...Rule) (*Engine, error) {
+	seen := make(map[string]bool, len(rules))
+	for _, r := range rules {
+		if err := r.Validate(); err != nil {
+			return nil, err
+		}
+		if seen[r.ID] {
+			return nil, fmt.Errorf("%w: duplicate id %s", ErrInvalidRule, r.ID)
+		}
+		seen[r.ID] = true
+	}
+
+	e := Engine{books: books, rules: append([]Rule(nil), rules...)}
+	sort.SliceStable(e.rules, func(i, j int) bool {
+		return e.rules[i].Priority > e.rules[j].Priority
+	})
+	return &e, nil
+}
+
+// SetTaxonomy sets the taxonomy used to match books
+// in subcategories of rule categories.
+func (e *Engine) SetTaxonomy(t *bookshop.Taxonomy) {
+	e.taxonomy = t
+}
+
+// Rules returns the engine rules in the order they are applied.
+func (e *Engine) Rules() []Rule {
+	return append([]Rule(nil), e.rules...)
+}
+
+// line is an order line being evaluated.
+type line struct {
+	book    bookshop.Book
+	item    order.Item
+	left    money.Money
+	savings []Saving
+	// locked lines were discounted by an exclusive rule.
+	locked bool
+}
+
+// Evaluate knows how to apply rules active at the given time to the
+// order items and return the breakdown of savings. The order is not
+// changed and adjustments it already has are ignored.
+func (e *Engine) Evaluate(o *order.Order, at time.Time) (Result, error) {
+	lines := make([]*line, 0, len(o.Items))
+	for _, it := range o.Items {
+		b, err := e.books.Get(it.BookID)
+		if err != nil {
+			return Result{}, fmt.Errorf("order %s: %w", o.ID(), err)
+		}
+		total, err := it.Total()
+		if err != nil {
+			return Result{}, fmt.Errorf("order %s: book %s: %w", o.ID(), it.BookID, err)
+		}
+		lines = append(lines, &line{book: b, item: it, left: total})
+	}
+
+	var res Result
+	for _, r := range e.rules {
+		if !r.Active(at) {
+			continue
+		}
+		matched := e.match(r, lines)
+		if len(matched) == 0 {
+			continue
+		}
+		savings, err := r.savings(matched)
+		if err != nil {
+			return Result{}, fmt.Errorf("order %s: rule %s: %w", o.ID(), r.ID, err)
+		}
+
+		var saved money.Money
+		for i, l := range matched {
+			s := savings[i]
+			if !s.IsPositive() {
+				continue
+			}
+			if l.left, err = l.left.Sub(s); err != nil {
+				return Result{}, fmt.Errorf("order %s: rule %s: %w", o.ID(), r.ID, err)
+			}
+			l.savings = append(l.savings, Saving{RuleID: r.ID, Name: r.Name, Amount: s})
+			l.locked = r.Exclusive
+			if saved, err = saved.Add(s); err != nil {
+				return Result{}, fmt.Errorf("order %s: rule %s: %w", o.ID(), r.ID, err)
+			}
+		}
+		if saved.IsPositive() {
+			res.Savings = append(res.Savings, Saving{RuleID: r.ID, Name: r.Name, Amount: saved})
+		}
+	}
+
+	for _, l := range lines {
+		price, err := l.item.Total()
+		if err != nil {
+			return Result{}, err
+		}
+		res.Lines = append(res.Lines, Line{
+			BookID:   l.item.BookID,
+			Quantity: l.item.Quantity,
+			Price:    price,
+			Savings:  l.savings,
+			Total:    l.left,
+		})
+		if res.Subtotal, err = res.Subtotal.Add(price); err != nil {
+			return Result{}, fmt.Errorf("order %s: %w", o.ID(), err)
+		}
+		if res.Total, err = res.Total.Add(l.left); err != nil {
+			return Result{}, fmt.Errorf("order %s: %w", o.ID(), err)
+		}
+	}
+	var err error
+	if res.Discount, err = res.Subtotal.Sub(res.Total); err != nil {
+		return Result{}, fmt.Errorf("order %s: %w", o.ID(), err)
+	}
+	return res, nil
+}
+
+// Apply knows how to evaluate rules against the order and
+// record the savings as order adjustments, replacing
+// adjustments the order had before.
+func (e *Engine) Apply(o *order.Order, at time.Time) (Result, error) {
+	res, err := e.Evaluate(o, at)
+	if err != nil {
+		return Result{}, err
+	}
+	if err := o.SetAdjustments(res.Adjustments()); err != nil {
+		return Result{}, err
+	}
+	return res, nil
+}
+
+// Adjustments returns savings of order lines
+// as order adjustments.
+func (r Result) Adjustments() []order.Adjustment {
+	var adj []order.Adjustment
+	for _, l := range r.Lines {
+		for _, s := range l.Savings {
+			adj = append(adj, order.Adjustment{
+				BookID:      l.BookID,
+				Source:      s.RuleID,
+				Description: s.Name,
+				Amount:      s.Amount,
+			})
+		}
+	}
+	return adj
+}
+
+// match returns lines the rule can discount.
+func (e *Engine) match(r Rule, lines []*line) []*line {
+	categories := e.categories(r)
+	var matched []*line
+	for _, l := range lines {
+		if l.locked || !l.left.IsPositive() {
+			continue
+		}
+		if r.Exclusive && len(l.savings) > 0 {
+			continue
+		}
+		if len(categories) > 0 && !l.book.InCategory(categories...) {
+			continue
+		}
+		if len(r.Authors) > 0 && !hasAuthor(l.book, r.Authors) {
+			continue
+		}
+		if len(r.BookIDs) > 0 && !contains(r.BookIDs, l.book.ID) {
+			continue
+		}
+		matched = append(matched, l)
+	}
+	return matched
+}
+
+// categories returns rule categories with their subcategories
+// when the engine has a taxonomy.
+func (e *Engine) categories(r Rule) []int {
+	return e.taxonomy.Expand(r.Categories...)
+}
+
+// savings returns amounts the rule takes off the matched lines.
+func (r Rule) savings(lines []*line) ([]money.Money, error) {
+	savings := make([]money.Money, len(lines))
+	switch r.Kind {
+	case KindPercent:
+		return percentOff(lines, r.Percent)
+
+	case KindBundle:
+		// Order items are merged by book, so each
+		// line holds a different book.
+		if len(lines) < r.Buy {
+			return savings, nil
+		}
+		return percentOff(lines, r.Percent)
+
+	case KindFixed:
+		var total money.Money
+		weights := make([]int64, len(lines))
+		for i, l := range lines {
+			if l.left.Currency() != r.Amount.Currency() {
+				return savings, nil
+			}
+			var err error
+			if total, err = total.Add(l.left); err != nil {
+				return nil, err
+			}
+			weights[i] = l.left.Amount()
+		}
+		amount := r.Amount
+		if c, err := amount.Cmp(total); err != nil {
+			return nil, err
+		} else if c > 0 {
+			amount = total
+		}
+		return amount.Allocate(weights...)
+
+	case KindBuyXPayY:
+		type unit struct {
+			line  int
+			price money.Money
+		}
+		var units []unit
+		for i, l := range lines {
+			price, err := l.left.MulRat(1, int64(l.item.Quantity), money.RoundDown)
+			if err != nil {
+				return nil, err
+			}
+			for q := 0; q < l.item.Quantity; q++ {
+				units = append(units, unit{line: i, price: price})
+			}
+		}
+		sort.SliceStable(units, func(i, j int) bool {
+			return units[i].price.Amount() > units[j].price.Amount()
+		})
+		// The cheapest Buy-Pay units of every group of Buy are free.
+		for n := 0; n+r.Buy <= len(units); n += r.Buy {
+			for _, u := range units[n+r.Pay : n+r.Buy] {
+				var err error
+				if savings[u.line], err = savings[u.line].Add(u.price); err != nil {
+					return nil, err
+				}
+			}
+		}
+		return savings, nil
+	}
+	return nil, fmt.Errorf("%w: unknown kind %q", ErrInvalidRule, r.Kind)
+}
+
+// percentOff returns p percent of what is left of the line totals.
+// Savings are rounded down, so a rule never takes more than p percent.
+func percentOff(lines []*line, p int) ([]money.Money, error) {
+	savings := make([]money.Money, len(lines))
+	for i, l := range lines {
+		s, err := l.left.Percent(int64(p), money.RoundDown)
+		if err != nil {
+			return nil, err
+		}
+		savings[i] = s
+	}
+	return savings, nil
+}
+
+func hasAuthor(b bookshop.Book, authors []string) bool {
+	for _, a := range b.Authors {
+		for _, want := range authors {
+			if strings.EqualFold(strings.TrimSpace(a), strings.TrimSpace(want)) {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+func contains(ids []string, id string) bool {
+	for _, v := range ids {
+		if v == id {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,255 @@
+package promo_test
+
+import (
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/google/go-cmp/cmp"
+	"github.com/qba73/bookshop/internal/bookshop"
+	"github.com/qba73/bookshop/internal/bookshop/order"
+	"github.com/qba73/bookshop/internal/money"
+	"github.com/qba73/bookshop/internal/promo"
+)
+
+var now = time.Date(2021, time.June, 15, 12, 0, 0, 0, time.UTC)
+
+func pln(minor int64) money.Money {
+	return money.New(minor, money.PLN)
+}
+
+// newOrder returns an order of two books by Sapkowski, fantasy and
+// dark fantasy, a programming book and two copies of a book with
+// a catalog discount, with the taxonomy holding the categories.
+func newOrder(t *testing.T) (*order.Order, *bookshop.MemoryStore, *bookshop.Taxonomy, int) {
+	t.Helper()
+
+	tax := bookshop.NewTaxonomy()
+	fantasy, err := tax.Add("Fantasy", bookshop.NoParent)
+	if err != nil {
+		t.Fatal(err)
+	}
+	dark, err := tax.Add("Dark fantasy", fantasy.ID)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	books := []struct {
+		id, author string
+		price      int64
+		discount   int
+		category   int
+		quantity   int
+	}{
+		{id: "w1", author: "Andrzej Sapkowski", price: 4000, category: fantasy.ID, quantity: 1},
+		{id: "w2", author: "Andrzej Sapkowski", price: 3000, category: dark.ID, quantity: 1},
+		{id: "go", author: "Brian Kernighan", price: 10000, category: bookshop.CategoryProgramming, quantity: 1},
+		{id: "tytus", author: "Papcio Chmiel", price: 2000, discount: 10, category: bookshop.CategoryAutobiography, quantity: 2},
+	}
+
+	store := bookshop.NewMemoryStore(nil)
+	o, err := order.New("12282")
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, v := range books {
+		b := bookshop.Book{ID: v.id, Title: v.id, Authors: []string{v.author}, Price: pln(v.price)}
+		if err := b.SetDiscountPercent(v.discount); err != nil {
+			t.Fatal(err)
+		}
+		if err := b.SetCategory(v.category); err != nil {
+			t.Fatal(err)
+		}
+		if err := store.Put(b); err != nil {
+			t.Fatal(err)
+		}
+		if err := o.AddBook(b, v.quantity); err != nil {
+			t.Fatal(err)
+		}
+	}
+	return o, store, tax, fantasy.ID
+}
+
+func TestEngine_Evaluate(t *testing.T) {
+	t.Parallel()
+
+	o, store, tax, fantasy := newOrder(t)
+
+	tt := []struct {
+		name  string
+		rules []promo.Rule
+		want  []promo.Saving
+		total money.Money
+	}{
+		{
+			name:  "Category sale with subcategories",
+			rules: []promo.Rule{{ID: "fantasy", Name: "Fantasy week", Kind: promo.KindPercent, Percent: 10, Categories: []int{fantasy}}},
+			want:  []promo.Saving{{RuleID: "fantasy", Name: "Fantasy week", Amount: pln(700)}},
+			total: pln(19900),
+		},
+		{
+			name:  "Fixed amount off books by author",
+			rules: []promo.Rule{{ID: "witcher", Kind: promo.KindFixed, Amount: pln(1000), Authors: []string{"andrzej sapkowski"}}},
+			want:  []promo.Saving{{RuleID: "witcher", Amount: pln(1000)}},
+			total: pln(19600),
+		},
+		{
+			name:  "Fixed amount larger than the value of books",
+			rules: []promo.Rule{{ID: "go", Kind: promo.KindFixed, Amount: pln(20000), BookIDs: []string{"go"}}},
+			want:  []promo.Saving{{RuleID: "go", Amount: pln(10000)}},
+			total: pln(10600),
+		},
+		{
+			name:  "Fixed amount in other currency",
+			rules: []promo.Rule{{ID: "euro", Kind: promo.KindFixed, Amount: money.New(500, money.EUR)}},
+			total: pln(20600),
+		},
+		{
+			name:  "Buy 3 pay for 2",
+			rules: []promo.Rule{{ID: "3for2", Kind: promo.KindBuyXPayY, Buy: 3, Pay: 2}},
+			want:  []promo.Saving{{RuleID: "3for2", Amount: pln(3000)}},
+			total: pln(17600),
+		},
+		{
+			name:  "Author bundle",
+			rules: []promo.Rule{{ID: "bundle", Kind: promo.KindBundle, Buy: 2, Percent: 15, Authors: []string{"Andrzej Sapkowski"}}},
+			want:  []promo.Saving{{RuleID: "bundle", Amount: pln(1050)}},
+			total: pln(19550),
+		},
+		{
+			name:  "Incomplete author bundle",
+			rules: []promo.Rule{{ID: "bundle", Kind: promo.KindBundle, Buy: 3, Percent: 15, Authors: []string{"Andrzej Sapkowski"}}},
+			total: pln(20600),
+		},
+		{
+			name: "Campaigns outside of their time",
+			rules: []promo.Rule{
+				{ID: "ended", Kind: promo.KindPercent, Percent: 50, Ends: now.Add(-time.Hour)},
+				{ID: "upcoming", Kind: promo.KindPercent, Percent: 50, Starts: now.Add(time.Hour)},
+				{ID: "running", Kind: promo.KindPercent, Percent: 10, Starts: now.Add(-time.Hour), Ends: now.Add(time.Hour), BookIDs: []string{"go"}},
+			},
+			want:  []promo.Saving{{RuleID: "running", Amount: pln(1000)}},
+			total: pln(19600),
+		},
+		{
+			name: "Stacked rules apply by priority",
+			rules: []promo.Rule{
+				{ID: "all", Kind: promo.KindPercent, Percent: 10, Priority: 1},
+				{ID: "go", Kind: promo.KindFixed, Amount: pln(1000), BookIDs: []string{"go"}, Priority: 2},
+			},
+			want:  []promo.Saving{{RuleID: "go", Amount: pln(1000)}, {RuleID: "all", Amount: pln(1960)}},
+			total: pln(17640),
+		},
+		{
+			name: "Exclusive rule locks books",
+			rules: []promo.Rule{
+				{ID: "all", Kind: promo.KindPercent, Percent: 10, Priority: 1},
+				{ID: "go", Kind: promo.KindPercent, Percent: 50, BookIDs: []string{"go"}, Priority: 2, Exclusive: true},
+			},
+			want:  []promo.Saving{{RuleID: "go", Amount: pln(5000)}, {RuleID: "all", Amount: pln(1060)}},
+			total: pln(14540),
+		},
+		{
+			name: "Exclusive rule skips discounted books",
+			rules: []promo.Rule{
+				{ID: "all", Kind: promo.KindPercent, Percent: 10, BookIDs: []string{"go", "w1"}, Priority: 2},
+				{ID: "half", Kind: promo.KindPercent, Percent: 50, Exclusive: true},
+			},
+			want:  []promo.Saving{{RuleID: "all", Amount: pln(1400)}, {RuleID: "half", Amount: pln(3300)}},
+			total: pln(15900),
+		},
+	}
+
+	for _, tc := range tt {
+		e, err := promo.NewEngine(store, tc.rules...)
+		if err != nil {
+			t.Fatalf("%s, NewEngine() got error: %v", tc.name, err)
+		}
+		e.SetTaxonomy(tax)
+
+		got, err := e.Evaluate(o, now)
+		if err != nil {
+			t.Fatalf("%s, Evaluate() got error: %v", tc.name, err)
+		}
+		if !cmp.Equal(tc.want, got.Savings) {
+			t.Errorf("%s, Evaluate() savings \n%s", tc.name, cmp.Diff(tc.want, got.Savings))
+		}
+		if got.Total != tc.total {
+			t.Errorf("%s, Evaluate() total = %v, want: %v", tc.name, got.Total, tc.total)
+		}
+		if got.Subtotal != pln(20600) {
+			t.Errorf("%s, Evaluate() subtotal = %v, want: %v", tc.name, got.Subtotal, pln(20600))
+		}
+	}
+}
+
+func TestEngine_ApplyBreakdown(t *testing.T) {
+	t.Parallel()
+
+	o, store, _, _ := newOrder(t)
+	e, err := promo.NewEngine(store,
+		promo.Rule{ID: "3for2", Name: "3 for 2", Kind: promo.KindBuyXPayY, Buy: 3, Pay: 2},
+		promo.Rule{ID: "witcher", Name: "Witcher days", Kind: promo.KindPercent, Percent: 10, Authors: []string{"Andrzej Sapkowski"}, Priority: 1},
+	)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	got, err := e.Apply(o, now)
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := promo.Result{
+		Lines: []promo.Line{
+			{BookID: "w1", Quantity: 1, Price: pln(4000), Savings: []promo.Saving{{RuleID: "witcher", Name: "Witcher days", Amount: pln(400)}}, Total: pln(3600)},
+			{BookID: "w2", Quantity: 1, Price: pln(3000), Savings: []promo.Saving{{RuleID: "witcher", Name: "Witcher days", Amount: pln(300)}, {RuleID: "3for2", Name: "3 for 2", Amount: pln(2700)}}, Total: pln(0)},
+			{BookID: "go", Quantity: 1, Price: pln(10000), Total: pln(10000)},
+			{BookID: "tytus", Quantity: 2, Price: pln(3600), Total: pln(3600)},
+		},
+		Savings: []promo.Saving{
+			{RuleID: "witcher", Name: "Witcher days", Amount: pln(700)},
+			{RuleID: "3for2", Name: "3 for 2", Amount: pln(2700)},
+		},
+		Subtotal: pln(20600),
+		Discount: pln(3400),
+		Total:    pln(17200),
+	}
+	if !cmp.Equal(want, got) {
+		t.Errorf("Apply() \n%s", cmp.Diff(want, got))
+	}
+
+	if total, err := o.Total(); err != nil || total != want.Total {
+		t.Errorf("order Total() = %v, %v, want: %v", total, err, want.Total)
+	}
+	if d, err := o.DiscountTotal(); err != nil || d != pln(3800) {
+		t.Errorf("order DiscountTotal() = %v, %v, want: %v", d, err, pln(3800))
+	}
+	if len(o.Adjustments) != 3 {
+		t.Errorf("order adjustments = %v, want 3", o.Adjustments)
+	}
+}
+
+func TestNewEngine_InvalidRules(t *testing.T) {
+	t.Parallel()
+
+	tt := []struct {
+		name  string
+		rules []promo.Rule
+	}{
+		{name: "Missing id", rules: []promo.Rule{{Kind: promo.KindPercent, Percent: 10}}},
+		{name: "Unknown kind", rules: []promo.Rule{{ID: "a", Kind: "free"}}},
+		{name: "Percent over 100", rules: []promo.Rule{{ID: "a", Kind: promo.KindPercent, Percent: 101}}},
+		{name: "Zero amount", rules: []promo.Rule{{ID: "a", Kind: promo.KindFixed}}},
+		{name: "Pay for more than bought", rules: []promo.Rule{{ID: "a", Kind: promo.KindBuyXPayY, Buy: 2, Pay: 2}}},
+		{name: "Bundle of one book", rules: []promo.Rule{{ID: "a", Kind: promo.KindBundle, Buy: 1, Percent: 10, Authors: []string{"Bolek"}}}},
+		{name: "Bundle of any books", rules: []promo.Rule{{ID: "a", Kind: promo.KindBundle, Buy: 2, Percent: 10}}},
+		{name: "Ends before it starts", rules: []promo.Rule{{ID: "a", Kind: promo.KindPercent, Percent: 10, Starts: now, Ends: now}}},
+		{name: "Duplicate id", rules: []promo.Rule{{ID: "a", Kind: promo.KindPercent, Percent: 10}, {ID: "a", Kind: promo.KindPercent, Percent: 20}}},
+	}
+
+	for _, tc := range tt {
+		if _, err := promo.NewEngine(bookshop.NewMemoryStore(nil), tc.rules...); !errors.Is(err, promo.ErrInvalidRule) {
+			t.Errorf("%s, NewEngine() got error: %v, want: %v", tc.name, err, promo.ErrInvalidRule)
+		}
+	}
+}
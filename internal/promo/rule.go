@@ -0,0 +1,115 @@
+package promo
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/qba73/bookshop/internal/money"
+)
+
+// ErrInvalidRule is returned when a promotion rule is not valid.
+var ErrInvalidRule = errors.New("invalid promotion rule")
+
+// Kind is the type of a promotion rule.
+type Kind string
+
+// Kinds of promotion rules.
+const (
+	// KindPercent takes Percent percent off matching books.
+	KindPercent Kind = "percent"
+	// KindFixed takes Amount off the value of matching books,
+	// split between them in proportion to their value.
+	KindFixed Kind = "fixed"
+	// KindBuyXPayY makes customers pay for Pay out of every Buy
+	// matching books, the cheapest ones in each group are free.
+	KindBuyXPayY Kind = "buy-x-pay-y"
+	// KindBundle takes Percent percent off matching books when
+	// the order holds at least Buy different matching books,
+	// for example books by the same author.
+	KindBundle Kind = "bundle"
+)
+
+// Rule describes a promotion. Books match the rule when they
+// match all of the Categories, Authors and BookIDs filters
+// that are set; a rule without filters applies to all books.
+type Rule struct {
+	ID   string `json:"id"`
+	Name string `json:"name"`
+	Kind Kind   `json:"kind"`
+
+	Percent int         `json:"percent,omitempty"`
+	Amount  money.Money `json:"amount"`
+	Buy     int         `json:"buy,omitempty"`
+	Pay     int         `json:"pay,omitempty"`
+
+	// Categories match books in any of the categories or,
+	// when the engine has a taxonomy, their subcategories.
+	Categories []int `json:"categories,omitempty"`
+	// Authors match books written by any of the authors.
+	Authors []string `json:"authors,omitempty"`
+	// BookIDs match any of the books.
+	BookIDs []string `json:"book_ids,omitempty"`
+
+	// Starts and Ends bound the campaign. Rules apply from Starts
+	// until, but not including, Ends. Zero times leave it open.
+	Starts time.Time `json:"starts"`
+	Ends   time.Time `json:"ends"`
+
+	// Priority orders rules, higher priority rules apply first
+	// and later rules discount what is left of the price.
+	Priority int `json:"priority,omitempty"`
+	// Exclusive rules do not stack. They skip books already
+	// discounted by a rule and no other rule applies to books
+	// they discounted.
+	Exclusive bool `json:"exclusive,omitempty"`
+}
+
+// Validate returns an error when the rule is not valid.
+func (r Rule) Validate() error {
+	if strings.TrimSpace(r.ID) == "" {
+		return fmt.Errorf("%w: missing id", ErrInvalidRule)
+	}
+	switch r.Kind {
+	case KindPercent:
+		if r.Percent <= 0 || r.Percent > 100 {
+			return fmt.Errorf("%w %s: invalid percent: %d", ErrInvalidRule, r.ID, r.Percent)
+		}
+	case KindFixed:
+		if !r.Amount.IsPositive() || r.Amount.Currency() == "" {
+			return fmt.Errorf("%w %s: invalid amount: %v", ErrInvalidRule, r.ID, r.Amount)
+		}
+	case KindBuyXPayY:
+		if r.Pay <= 0 || r.Buy <= r.Pay {
+			return fmt.Errorf("%w %s: invalid buy %d pay %d", ErrInvalidRule, r.ID, r.Buy, r.Pay)
+		}
+	case KindBundle:
+		if r.Percent <= 0 || r.Percent > 100 {
+			return fmt.Errorf("%w %s: invalid percent: %d", ErrInvalidRule, r.ID, r.Percent)
+		}
+		if r.Buy < 2 {
+			return fmt.Errorf("%w %s: bundle of %d books", ErrInvalidRule, r.ID, r.Buy)
+		}
+		if len(r.Categories) == 0 && len(r.Authors) == 0 && len(r.BookIDs) == 0 {
+			return fmt.Errorf("%w %s: bundle of any books", ErrInvalidRule, r.ID)
+		}
+	default:
+		return fmt.Errorf("%w %s: unknown kind %q", ErrInvalidRule, r.ID, r.Kind)
+	}
+	if !r.Starts.IsZero() && !r.Ends.IsZero() && !r.Ends.After(r.Starts) {
+		return fmt.Errorf("%w %s: ends before it starts", ErrInvalidRule, r.ID)
+	}
+	return nil
+}
+
+// Active reports whether the campaign of the rule runs at the time.
+func (r Rule) Active(at time.Time) bool {
+	if !r.Starts.IsZero() && at.Before(r.Starts) {
+		return false
+	}
+	if !r.Ends.IsZero() && !at.Before(r.Ends) {
+		return false
+	}
+	return true
+}
@@ -0,0 +1,132 @@
+package search
+
+// Fuzzy knows how to find books whose titles or authors approximately
+// match the query, so misspelled queries like "Papcio Chmeil" still
+// find "Papcio Chmiel". Every query term must be within a few edits
+// of a title or author term, see MaxEdits. A Result's Score is
+// between 0 and 1, where 1 means all query terms matched exactly.
+// Results are ranked by score, highest first. At most limit results
+// are returned, all of them when limit is not positive.
+func (ix *Index) Fuzzy(query string, limit int) []Result {
+	tokens := Tokenize(query)
+	if len(tokens) == 0 {
+		return nil
+	}
+
+	ix.mu.RLock()
+	defer ix.mu.RUnlock()
+
+	var scores map[string]float64
+
+	for _, tok := range tokens {
+		maxEdits := MaxEdits(tok)
+		tokScores := make(map[string]float64)
+		for term, docs := range ix.names {
+			d := Distance(tok, term)
+			if d > maxEdits {
+				continue
+			}
+			s := similarity(tok, term, d)
+			for id := range docs {
+				if s > tokScores[id] {
+					tokScores[id] = s
+				}
+			}
+		}
+
+		if scores == nil {
+			scores = tokScores
+			continue
+		}
+		for id := range scores {
+			s, ok := tokScores[id]
+			if !ok {
+				delete(scores, id)
+				continue
+			}
+			scores[id] += s
+		}
+	}
+
+	results := make([]Result, 0, len(scores))
+	for id, s := range scores {
+		results = append(results, Result{BookID: id, Title: ix.titles[id], Score: s / float64(len(tokens))})
+	}
+	sortResults(results)
+
+	if limit > 0 && len(results) > limit {
+		results = results[:limit]
+	}
+	return results
+}
+
+// MaxEdits returns the number of typos tolerated in the term.
+// Short terms must match exactly, longer ones allow more typos.
+func MaxEdits(term string) int {
+	switch n := len([]rune(term)); {
+	case n <= 2:
+		return 0
+	case n <= 5:
+		return 1
+	default:
+		return 2
+	}
+}
+
+// Distance knows how to count edits needed to turn a into b. An edit
+// is an insertion, deletion or substitution of a letter, or
+// a transposition of two adjacent letters, so "chmeil" is a single
+// edit away from "chmiel".
+func Distance(a, b string) int {
+	ra, rb := []rune(a), []rune(b)
+
+	// d[i][j] is the distance between the first i runes
+	// of a and the first j runes of b.
+	d := make([][]int, len(ra)+1)
+	for i := range d {
+		d[i] = make([]int, len(rb)+1)
+		d[i][0] = i
+	}
+	for j := range d[0] {
+		d[0][j] = j
+	}
+
+	for i := 1; i <= len(ra); i++ {
+		for j := 1; j <= len(rb); j++ {
+			cost := 1
+			if ra[i-1] == rb[j-1] {
+				cost = 0
+			}
+			d[i][j] = min3(d[i-1][j]+1, d[i][j-1]+1, d[i-1][j-1]+cost)
+			if i > 1 && j > 1 && ra[i-1] == rb[j-2] && ra[i-2] == rb[j-1] {
+				if t := d[i-2][j-2] + 1; t < d[i][j] {
+					d[i][j] = t
+				}
+			}
+		}
+	}
+	return d[len(ra)][len(rb)]
+}
+
+// similarity turns the edit distance d between a and b into
+// a score between 0 and 1.
+func similarity(a, b string, d int) float64 {
+	n := len([]rune(a))
+	if m := len([]rune(b)); m > n {
+		n = m
+	}
+	if n == 0 {
+		return 1
+	}
+	return 1 - float64(d)/float64(n)
+}
+
+func min3(a, b, c int) int {
+	if b < a {
+		a = b
+	}
+	if c < a {
+		a = c
+	}
+	return a
+}
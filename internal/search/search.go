@@ -0,0 +1,262 @@
+// Package search provides full-text search over the book catalog.
+package search
+
+import (
+	"math"
+	"sort"
+	"strings"
+	"sync"
+	"unicode"
+
+	"github.com/qba73/bookshop/internal/bookshop"
+)
+
+// Field weights used for ranking. A match in the title counts
+// more than a match in the authors or in the description.
+const (
+	titleWeight       = 3.0
+	authorWeight      = 2.0
+	descriptionWeight = 1.0
+
+	// prefixPenalty scales the score of terms matched by prefix only.
+	prefixPenalty = 0.5
+)
+
+// Tokenize knows how to split text into lower case search terms.
+// Polish diacritics are folded, so "Koziołek Matołek" and
+// "koziolek matolek" produce the same terms.
+func Tokenize(s string) []string {
+	var tokens []string
+	var b strings.Builder
+
+	flush := func() {
+		if b.Len() > 0 {
+			tokens = append(tokens, b.String())
+			b.Reset()
+		}
+	}
+
+	for _, r := range bookshop.Fold(s) {
+		if !unicode.IsLetter(r) && !unicode.IsDigit(r) {
+			flush()
+			continue
+		}
+		b.WriteRune(unicode.ToLower(r))
+	}
+	flush()
+
+	return tokens
+}
+
+// Result represents a single search hit.
+type Result struct {
+	BookID string
+	Title  string
+	Score  float64
+}
+
+// Index is an inverted index over book titles, authors and
+// descriptions. It is safe for concurrent use.
+type Index struct {
+	mu       sync.RWMutex
+	titles   map[string]string
+	postings map[string]map[string]float64
+	names    map[string]map[string]float64 // title and author terms
+	terms    []string                      // sorted, nil when stale
+}
+
+// NewIndex knows how to construct an index holding the given books.
+func NewIndex(books ...bookshop.Book) *Index {
+	ix := Index{
+		titles:   make(map[string]string),
+		postings: make(map[string]map[string]float64),
+		names:    make(map[string]map[string]float64),
+	}
+	for _, b := range books {
+		ix.add(b)
+	}
+	return &ix
+}
+
+// Add indexes the book, replacing the previous version
+// of a book with the same ID.
+func (ix *Index) Add(b bookshop.Book) {
+	ix.mu.Lock()
+	defer ix.mu.Unlock()
+
+	ix.remove(b.ID)
+	ix.add(b)
+}
+
+// Remove drops the book from the index.
+func (ix *Index) Remove(bookID string) {
+	ix.mu.Lock()
+	defer ix.mu.Unlock()
+
+	ix.remove(bookID)
+}
+
+// Len returns the number of indexed books.
+func (ix *Index) Len() int {
+	ix.mu.RLock()
+	defer ix.mu.RUnlock()
+
+	return len(ix.titles)
+}
+
+// Search knows how to find books matching all terms of the query.
+// A query term matches index terms equal to it or starting with it,
+// so "kozi" finds "Koziołek Matołek". Results are ranked by score,
+// highest first. At most limit results are returned, all of them
+// when limit is not positive.
+func (ix *Index) Search(query string, limit int) []Result {
+	tokens := Tokenize(query)
+	if len(tokens) == 0 {
+		return nil
+	}
+
+	// Search may rebuild the sorted term list, so it takes
+	// the write lock.
+	ix.mu.Lock()
+	defer ix.mu.Unlock()
+
+	if ix.terms == nil {
+		ix.terms = make([]string, 0, len(ix.postings))
+		for t := range ix.postings {
+			ix.terms = append(ix.terms, t)
+		}
+		sort.Strings(ix.terms)
+	}
+
+	n := float64(len(ix.titles))
+	var scores map[string]float64
+
+	for _, tok := range tokens {
+		tokScores := make(map[string]float64)
+		for _, term := range ix.matching(tok) {
+			weight := 1.0
+			if term != tok {
+				weight = prefixPenalty
+			}
+			for id, tf := range ix.postings[term] {
+				if s := tf * weight; s > tokScores[id] {
+					tokScores[id] = s
+				}
+			}
+		}
+		// Terms found in fewer books tell more about the match.
+		idf := math.Log(1 + n/float64(len(tokScores)))
+		for id := range tokScores {
+			tokScores[id] *= idf
+		}
+
+		if scores == nil {
+			scores = tokScores
+			continue
+		}
+		for id := range scores {
+			s, ok := tokScores[id]
+			if !ok {
+				delete(scores, id)
+				continue
+			}
+			scores[id] += s
+		}
+	}
+
+	results := make([]Result, 0, len(scores))
+	for id, s := range scores {
+		results = append(results, Result{BookID: id, Title: ix.titles[id], Score: s})
+	}
+	sortResults(results)
+
+	if limit > 0 && len(results) > limit {
+		results = results[:limit]
+	}
+	return results
+}
+
+// matching returns index terms equal to or starting with prefix.
+func (ix *Index) matching(prefix string) []string {
+	i := sort.SearchStrings(ix.terms, prefix)
+	var terms []string
+	for ; i < len(ix.terms) && strings.HasPrefix(ix.terms[i], prefix); i++ {
+		terms = append(terms, ix.terms[i])
+	}
+	return terms
+}
+
+func (ix *Index) add(b bookshop.Book) {
+	ix.titles[b.ID] = b.Title
+
+	weights := make(map[string]float64)
+	for _, t := range Tokenize(b.Title) {
+		weights[t] += titleWeight
+	}
+	for _, a := range b.Authors {
+		for _, t := range Tokenize(a) {
+			weights[t] += authorWeight
+		}
+	}
+	for t, w := range weights {
+		addPosting(ix.names, t, b.ID, w)
+	}
+	for _, t := range Tokenize(b.Description) {
+		weights[t] += descriptionWeight
+	}
+
+	for t, w := range weights {
+		docs, ok := ix.postings[t]
+		if !ok {
+			docs = make(map[string]float64)
+			ix.postings[t] = docs
+			ix.terms = nil
+		}
+		docs[b.ID] = w
+	}
+}
+
+func (ix *Index) remove(bookID string) {
+	if _, ok := ix.titles[bookID]; !ok {
+		return
+	}
+	delete(ix.titles, bookID)
+
+	for t, docs := range ix.postings {
+		if _, ok := docs[bookID]; !ok {
+			continue
+		}
+		delete(docs, bookID)
+		if len(docs) == 0 {
+			delete(ix.postings, t)
+			ix.terms = nil
+		}
+	}
+	for t, docs := range ix.names {
+		delete(docs, bookID)
+		if len(docs) == 0 {
+			delete(ix.names, t)
+		}
+	}
+}
+
+func addPosting(postings map[string]map[string]float64, term, bookID string, w float64) {
+	docs, ok := postings[term]
+	if !ok {
+		docs = make(map[string]float64)
+		postings[term] = docs
+	}
+	docs[bookID] = w
+}
+
+func sortResults(results []Result) {
+	sort.Slice(results, func(i, j int) bool {
+		if results[i].Score != results[j].Score {
+			return results[i].Score > results[j].Score
+		}
+		if results[i].Title != results[j].Title {
+			return results[i].Title < results[j].Title
+		}
+		return results[i].BookID < results[j].BookID
+	})
+}
@@ -0,0 +1,250 @@
+package search_test
+
+import (
+	"testing"
+
+	"github.com/google/go-cmp/cmp"
+	"github.com/google/go-cmp/cmp/cmpopts"
+	"github.com/qba73/bookshop/internal/bookshop"
+	"github.com/qba73/bookshop/internal/search"
+)
+
+var testBooks = []bookshop.Book{
+	{
+		ID:          "1",
+		Title:       "Koziołek Matołek",
+		Authors:     []string{"Kornel Makuszyński"},
+		Description: "Przygody koziołka, który szukał Pacanowa.",
+	},
+	{
+		ID:          "2",
+		Title:       "Zosia Samosia",
+		Authors:     []string{"Julian Tuwim"},
+		Description: "Wiersz o dziewczynce, która wszystko robi sama.",
+	},
+	{
+		ID:          "3",
+		Title:       "Pan Samochodzik i templariusze",
+		Authors:     []string{"Zbigniew Nienacki"},
+		Description: "Pan Tomasz szuka skarbu templariuszy w samochodzie.",
+	},
+	{
+		ID:          "4",
+		Title:       "Tytus, Romek i A'Tomek",
+		Authors:     []string{"Papcio Chmiel"},
+		Description: "Przygody harcerzy i szympansa Tytusa, ilustrował Papcio Chmiel.",
+	},
+}
+
+func resultIDs(results []search.Result) []string {
+	ids := make([]string, 0, len(results))
+	for _, r := range results {
+		ids = append(ids, r.BookID)
+	}
+	return ids
+}
+
+func TestTokenize(t *testing.T) {
+	t.Parallel()
+
+	tt := []struct {
+		name  string
+		input string
+		want  []string
+	}{
+		{name: "Polish diacritics", input: "Koziołek Matołek", want: []string{"koziolek", "matolek"}},
+		{name: "Upper case diacritics", input: "ŻÓŁW Źdźbło ĄĘŚĆŃ", want: []string{"zolw", "zdzblo", "aescn"}},
+		{name: "Punctuation", input: "Tytus, Romek i A'Tomek!", want: []string{"tytus", "romek", "i", "a", "tomek"}},
+		{name: "Digits", input: "Edition 2, 1997", want: []string{"edition", "2", "1997"}},
+		{name: "Empty", input: " - ", want: nil},
+	}
+
+	for _, tc := range tt {
+		got := search.Tokenize(tc.input)
+		if !cmp.Equal(got, tc.want) {
+			t.Errorf("%s Tokenize(%q) \n%s", tc.name, tc.input, cmp.Diff(tc.want, got))
+		}
+	}
+}
+
+func TestSearch(t *testing.T) {
+	t.Parallel()
+
+	ix := search.NewIndex(testBooks...)
+
+	tt := []struct {
+		name  string
+		query string
+		limit int
+		want  []string
+	}{
+		{name: "Title without diacritics", query: "koziolek matolek", want: []string{"1"}},
+		{name: "Title with diacritics", query: "Koziołek", want: []string{"1"}},
+		{name: "Author", query: "makuszynski", want: []string{"1"}},
+		{name: "Description", query: "pacanowa", want: []string{"1"}},
+		{name: "Prefix", query: "samo", want: []string{"3", "2"}},
+		{name: "Title and description", query: "tytus", want: []string{"4"}},
+		{name: "Author and description", query: "papcio chmiel", want: []string{"4"}},
+		{name: "Title ranks above description match", query: "przygody", want: []string{"1", "4"}},
+		{name: "All terms must match", query: "samosia tuwim", want: []string{"2"}},
+		{name: "No match", query: "samosia nienacki", want: []string{}},
+		{name: "Limit", query: "samo", limit: 1, want: []string{"3"}},
+		{name: "Empty query", query: "  ", want: []string{}},
+	}
+
+	for _, tc := range tt {
+		got := resultIDs(ix.Search(tc.query, tc.limit))
+		if !cmp.Equal(got, tc.want) {
+			t.Errorf("%s Search(%q) \n%s", tc.name, tc.query, cmp.Diff(tc.want, got))
+		}
+	}
+}
+
+func TestSearchRanking(t *testing.T) {
+	t.Parallel()
+
+	ix := search.NewIndex(
+		bookshop.Book{ID: "a", Title: "Opowieści", Description: "Tuwim dla dzieci"},
+		bookshop.Book{ID: "b", Title: "Wiersze", Authors: []string{"Julian Tuwim"}},
+		bookshop.Book{ID: "c", Title: "Tuwim"},
+		bookshop.Book{ID: "d", Title: "Tuwimiada"},
+	)
+
+	want := []string{"c", "b", "d", "a"}
+	if got := resultIDs(ix.Search("tuwim", 0)); !cmp.Equal(got, want) {
+		t.Errorf("Search() \n%s", cmp.Diff(want, got))
+	}
+}
+
+func TestStoreUpdatesIndex(t *testing.T) {
+	t.Parallel()
+
+	s, err := search.NewStore(bookshop.NewMemoryStore(map[string]bookshop.Book{"1": testBooks[0]}))
+	if err != nil {
+		t.Fatal(err)
+	}
+	c := bookshop.NewCatalog(s)
+
+	if err := c.AddBook(testBooks[1]); err != nil {
+		t.Fatal(err)
+	}
+	if got, want := resultIDs(s.Index().Search("zosia", 0)), []string{"2"}; !cmp.Equal(got, want) {
+		t.Errorf("Search() after AddBook() \n%s", cmp.Diff(want, got))
+	}
+
+	updated := testBooks[1]
+	updated.Title = "Zosia Samosia i przyjaciele"
+	if err := s.Put(updated); err != nil {
+		t.Fatal(err)
+	}
+	if got, want := resultIDs(s.Index().Search("przyjaciele", 0)), []string{"2"}; !cmp.Equal(got, want) {
+		t.Errorf("Search() after Put() \n%s", cmp.Diff(want, got))
+	}
+
+	if err := s.Delete("1"); err != nil {
+		t.Fatal(err)
+	}
+	if got := s.Index().Search("koziolek", 0); len(got) != 0 {
+		t.Errorf("Search() after Delete() = %v, want no results", got)
+	}
+	if n := s.Index().Len(); n != 1 {
+		t.Errorf("Len() = %d, want: 1", n)
+	}
+}
+
+func TestFuzzy(t *testing.T) {
+	t.Parallel()
+
+	ix := search.NewIndex(testBooks...)
+
+	tt := []struct {
+		name  string
+		query string
+		want  []search.Result
+	}{
+		{
+			name:  "Transposed letters",
+			query: "Papcio Chmeil",
+			want:  []search.Result{{BookID: "4", Title: "Tytus, Romek i A'Tomek", Score: 1 - 1.0/6/2}},
+		},
+		{
+			name:  "Missing diacritics and typo",
+			query: "Kozilek Makuszynski",
+			want:  []search.Result{{BookID: "1", Title: "Koziołek Matołek", Score: 1 - 1.0/8/2}},
+		},
+		{
+			name:  "Missing letter",
+			query: "samosa",
+			want:  []search.Result{{BookID: "2", Title: "Zosia Samosia", Score: 1 - 1.0/7}},
+		},
+		{
+			name:  "Exact match",
+			query: "tuwim",
+			want:  []search.Result{{BookID: "2", Title: "Zosia Samosia", Score: 1}},
+		},
+		{
+			name:  "Too many typos",
+			query: "chmxyz",
+			want:  []search.Result{},
+		},
+		{
+			name:  "Short terms must match exactly",
+			query: "pn",
+			want:  []search.Result{},
+		},
+		{
+			name:  "Description is not searched",
+			query: "pacanowa",
+			want:  []search.Result{},
+		},
+	}
+
+	for _, tc := range tt {
+		got := ix.Fuzzy(tc.query, 0)
+		if got == nil {
+			got = []search.Result{}
+		}
+		if !cmp.Equal(got, tc.want, cmpopts.EquateApprox(0, 1e-9)) {
+			t.Errorf("%s Fuzzy(%q) \n%s", tc.name, tc.query, cmp.Diff(tc.want, got, cmpopts.EquateApprox(0, 1e-9)))
+		}
+	}
+}
+
+func TestFuzzyRanking(t *testing.T) {
+	t.Parallel()
+
+	ix := search.NewIndex(
+		bookshop.Book{ID: "a", Title: "Chmurka", Authors: []string{"Papcio Chmiel"}},
+		bookshop.Book{ID: "b", Title: "Chmiel"},
+		bookshop.Book{ID: "c", Title: "Chmielnik"},
+	)
+
+	want := []string{"b", "a"}
+	if got := resultIDs(ix.Fuzzy("chmeil", 0)); !cmp.Equal(got, want) {
+		t.Errorf("Fuzzy() \n%s", cmp.Diff(want, got))
+	}
+}
+
+func TestDistance(t *testing.T) {
+	t.Parallel()
+
+	tt := []struct {
+		a, b string
+		want int
+	}{
+		{a: "chmiel", b: "chmiel", want: 0},
+		{a: "chmeil", b: "chmiel", want: 1},
+		{a: "chmil", b: "chmiel", want: 1},
+		{a: "chmiels", b: "chmiel", want: 1},
+		{a: "chmial", b: "chmiel", want: 1},
+		{a: "kitten", b: "sitting", want: 3},
+		{a: "", b: "abc", want: 3},
+		{a: "żółw", b: "zolw", want: 3},
+	}
+
+	for _, tc := range tt {
+		if got := search.Distance(tc.a, tc.b); got != tc.want {
+			t.Errorf("Distance(%q, %q) = %d, want: %d", tc.a, tc.b, got, tc.want)
+		}
+	}
+}
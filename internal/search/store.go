@@ -0,0 +1,65 @@
+package search
+
+import (
+	"github.com/qba73/bookshop/internal/bookshop"
+)
+
+// Store is a bookshop.Store that keeps an Index in sync with
+// the books it holds. Wrap a store with it and pass it to
+// bookshop.NewCatalog, so books added through Catalog.AddBook
+// are searchable right away.
+type Store struct {
+	bookshop.Store
+	index *Index
+}
+
+// NewStore knows how to wrap the store and index all books
+// it already holds.
+func NewStore(s bookshop.Store) (*Store, error) {
+	books, err := s.List()
+	if err != nil {
+		return nil, err
+	}
+	return &Store{Store: s, index: NewIndex(books...)}, nil
+}
+
+// Index returns the index kept in sync with the store.
+func (s *Store) Index() *Index {
+	return s.index
+}
+
+// Put stores the book and updates the index.
+func (s *Store) Put(b bookshop.Book) error {
+	if err := s.Store.Put(b); err != nil {
+		return err
+	}
+	s.index.Add(b)
+	return nil
+}
+
+// Create adds the book to the store and the index.
+func (s *Store) Create(b bookshop.Book) error {
+	if err := s.Store.Create(b); err != nil {
+		return err
+	}
+	s.index.Add(b)
+	return nil
+}
+
+// Replace replaces the book in the store and the index.
+func (s *Store) Replace(b bookshop.Book) error {
+	if err := s.Store.Replace(b); err != nil {
+		return err
+	}
+	s.index.Add(b)
+	return nil
+}
+
+// Delete removes the book from the store and the index.
+func (s *Store) Delete(id string) error {
+	if err := s.Store.Delete(id); err != nil {
+		return err
+	}
+	s.index.Remove(id)
+	return nil
+}
@@ -0,0 +1,380 @@
+// Package tax calculates VAT of books and orders.
+package tax
+
+import (
+	"errors"
+	"fmt"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/qba73/bookshop/internal/bookshop"
+	"github.com/qba73/bookshop/internal/bookshop/order"
+	"github.com/qba73/bookshop/internal/money"
+)
+
+var (
+	// ErrInvalidTable is returned when a tax table is not valid.
+	ErrInvalidTable = errors.New("invalid tax table")
+	// ErrNotAssessed is returned when tax of an order
+	// is calculated before it was recorded on the order.
+	ErrNotAssessed = errors.New("order tax not assessed")
+)
+
+// Rate is a tax rate in basis points, 500 is 5%.
+type Rate int
+
+// String returns the rate as a percentage, for example 5% or 5.5%.
+func (r Rate) String() string {
+	s := strconv.FormatFloat(float64(r)/100, 'f', -1, 64)
+	return s + "%"
+}
+
+// Rule sets the tax rate of books sold to a country. Books match
+// the rule when they match all of the Format and Categories filters
+// that are set. Rules without a country apply in the home country.
+type Rule struct {
+	Country    string          `json:"country,omitempty"`
+	Format     bookshop.Format `json:"format,omitempty"`
+	Categories []int           `json:"categories,omitempty"`
+	Rate       Rate            `json:"rate"`
+}
+
+// Table holds tax rates of a shop. Books sold to the home country
+// are taxed at the rate of the most specific matching rule, or the
+// standard rate when no rule matches. Books sold to other countries
+// are exports and are not taxed unless a rule for the country
+// matches them.
+type Table struct {
+	Home     string `json:"home"`
+	Standard Rate   `json:"standard"`
+	Rules    []Rule `json:"rules"`
+	// PricesIncludeTax tells whether catalog prices include tax. Prices
+	// including tax are what customers pay in every country, only the
+	// tax part of them depends on the customer country.
+	PricesIncludeTax bool `json:"prices_include_tax"`
+}
+
+// PL is the tax table of a Polish bookshop selling at prices including
+// VAT. Printed books carry the reduced 5% rate, e-books and audiobooks
+// the standard 23% rate and exports none.
+var PL = Table{
+	Home:     "PL",
+	Standard: 2300,
+	Rules: []Rule{
+		{Format: bookshop.FormatPrint, Rate: 500},
+	},
+	PricesIncludeTax: true,
+}
+
+// Validate returns an error when the table is not valid.
+func (t Table) Validate() error {
+	if !isCountry(t.Home) {
+		return fmt.Errorf("%w: invalid home country %q", ErrInvalidTable, t.Home)
+	}
+	if !t.Standard.valid() {
+		return fmt.Errorf("%w: invalid standard rate %d", ErrInvalidTable, t.Standard)
+	}
+	for i, r := range t.Rules {
+		if r.Country != "" && !isCountry(r.Country) {
+			return fmt.Errorf("%w: rule %d: invalid country %q", ErrInvalidTable, i+1, r.Country)
+		}
+		if r.Format != "" {
+			if _, err := bookshop.ParseFormat(string(r.Format)); err != nil {
+				return fmt.Errorf("%w: rule %d: %v", ErrInvalidTable, i+1, err)
+			}
+		}
+		if !r.Rate.valid() {
+			return fmt.Errorf("%w: rule %d: invalid rate %d", ErrInvalidTable, i+1, r.Rate)
+		}
+	}
+	return nil
+}
+
+// Rate returns the tax rate of the book sold to the country.
+// Categories of the book are matched against rule categories
+// expanded with their subcategories, see Calculator.
+func (t Table) Rate(country string, b bookshop.Book) Rate {
+	return t.rate(country, b, nil)
+}
+
+func (t Table) rate(country string, b bookshop.Book, tax *bookshop.Taxonomy) Rate {
+	country = normalizeCountry(country, t.Home)
+	format := b.Format
+	if format == "" {
+		format = bookshop.FormatPrint
+	}
+
+	best, found := -1, false
+	var rate Rate
+	for _, r := range t.Rules {
+		ruleCountry := r.Country
+		if ruleCountry == "" {
+			ruleCountry = t.Home
+		}
+		if bookshop.NormalizeCountry(ruleCountry) != country {
+			continue
+		}
+		if r.Format != "" && r.Format != format {
+			continue
+		}
+		if len(r.Categories) > 0 && !b.InCategory(tax.Expand(r.Categories...)...) {
+			continue
+		}
+
+		specificity := 0
+		for _, set := range []bool{r.Country != "", r.Format != "", len(r.Categories) > 0} {
+			if set {
+				specificity++
+			}
+		}
+		if specificity > best {
+			best, rate, found = specificity, r.Rate, true
+		}
+	}
+	switch {
+	case found:
+		return rate
+	case country == bookshop.NormalizeCountry(t.Home):
+		return t.Standard
+	default:
+		return 0
+	}
+}
+
+// Split knows how to split the amount into net amount and tax at the
+// rate. The amount includes tax when inclusive is true. Tax is rounded
+// half up to minor units.
+func Split(amount money.Money, rate Rate, inclusive bool) (net, tax, gross money.Money, err error) {
+	if inclusive {
+		if tax, err = amount.MulRat(int64(rate), 10000+int64(rate), money.RoundHalfUp); err != nil {
+			return
+		}
+		net, err = amount.Sub(tax)
+		return net, tax, amount, err
+	}
+	if tax, err = amount.MulRat(int64(rate), 10000, money.RoundHalfUp); err != nil {
+		return
+	}
+	gross, err = amount.Add(tax)
+	return amount, tax, gross, err
+}
+
+// Books looks up books ordered by customers,
+// for example a bookshop.Store.
+type Books interface {
+	Get(id string) (bookshop.Book, error)
+}
+
+// Calculator knows how to calculate tax of orders and
+// prices shown to customers.
+type Calculator struct {
+	table    Table
+	books    Books
+	taxonomy *bookshop.Taxonomy
+}
+
+// Line is the tax of an order line.
+type Line struct {
+	BookID   string
+	Quantity int
+	Rate     Rate
+	Net      money.Money
+	Tax      money.Money
+	Gross    money.Money
+}
+
+// Summary is the tax of all order lines taxed at a rate.
+type Summary struct {
+	Rate  Rate
+	Net   money.Money
+	Tax   money.Money
+	Gross money.Money
+}
+
+// Breakdown is the tax of an order sold to a country. Tax in the
+// summary is calculated from the total of lines at each rate, as on
+// invoices, so it may differ by a minor unit from the sum of line
+// taxes. Order totals are the totals of the summary.
+type Breakdown struct {
+	Country string
+	Lines   []Line
+	// Summary lists totals per rate, highest rate first.
+	Summary []Summary
+	Net     money.Money
+	Tax     money.Money
+	Gross   money.Money
+}
+
+// NewCalculator knows how to construct a calculator using the tax
+// table and looking up ordered books in books. It returns an error
+// when the table is not valid.
+func NewCalculator(t Table, books Books) (*Calculator, error) {
+	if err := t.Validate(); err != nil {
+		return nil, err
+	}
+	t.Home = strings.ToUpper(t.Home)
+	return &Calculator{table: t, books: books}, nil
+}
+
+// Table returns the tax table of the calculator.
+func (c *Calculator) Table() Table {
+	return c.table
+}
+
+// SetTaxonomy sets the taxonomy used to match books in
+// subcategories of rule categories.
+func (c *Calculator) SetTaxonomy(t *bookshop.Taxonomy) {
+	c.taxonomy = t
+}
+
+// Rate returns the tax rate of the book sold to the country.
+func (c *Calculator) Rate(country string, b bookshop.Book) Rate {
+	return c.table.rate(country, b, c.taxonomy)
+}
+
+// Price knows how to calculate the sale price of the book shown to
+// customers in the country, including tax when inclusive is true.
+func (c *Calculator) Price(b bookshop.Book, country string, inclusive bool) (money.Money, error) {
+	net, _, gross, err := Split(b.SalePrice(), c.Rate(country, b), c.table.PricesIncludeTax)
+	if err != nil {
+		return money.Money{}, fmt.Errorf("book id %s: %w", b.ID, err)
+	}
+	if inclusive {
+		return gross, nil
+	}
+	return net, nil
+}
+
+// Assess knows how to record tax of the draft order sold to the
+// customer: the country it is taxed in, whether its prices include
+// tax and the rate of each ordered book. Orders are taxed in the
+// country of the customer shipping address, the home country when
+// the customer has no address. Assess orders when they are placed,
+// as rates depend on books and the customer at that time.
+func (c *Calculator) Assess(o *order.Order, cust bookshop.Customer) error {
+	country := normalizeCountry(cust.ShippingAddress().Country, c.table.Home)
+	rates := make(map[string]int, len(o.Items))
+	for _, it := range o.Items {
+		b, err := c.books.Get(it.BookID)
+		if err != nil {
+			return fmt.Errorf("order %s: %w", o.ID(), err)
+		}
+		rates[it.BookID] = int(c.Rate(country, b))
+	}
+	return o.SetTax(order.Tax{
+		Country:          country,
+		PricesIncludeTax: c.table.PricesIncludeTax,
+		Rates:            rates,
+	})
+}
+
+// Order knows how to calculate tax of the order, per line and per
+// rate, from the tax recorded on it, see Calculator.Assess. Order
+// adjustments reduce the taxed amount. It returns ErrNotAssessed
+// when the order has no tax recorded.
+func Order(o *order.Order) (Breakdown, error) {
+	if o.Tax == nil {
+		return Breakdown{}, fmt.Errorf("order %s: %w", o.ID(), ErrNotAssessed)
+	}
+	inclusive := o.Tax.PricesIncludeTax
+	bd := Breakdown{Country: o.Tax.Country}
+
+	byRate := make(map[Rate]money.Money)
+	for _, it := range o.Items {
+		r, ok := o.Tax.Rates[it.BookID]
+		if !ok {
+			return Breakdown{}, fmt.Errorf("order %s: book %s: %w", o.ID(), it.BookID, ErrNotAssessed)
+		}
+		rate := Rate(r)
+		amount, err := it.Total()
+		if err != nil {
+			return Breakdown{}, fmt.Errorf("order %s: book %s: %w", o.ID(), it.BookID, err)
+		}
+		for _, a := range o.Adjustments {
+			if a.BookID != it.BookID {
+				continue
+			}
+			if amount, err = amount.Sub(a.Amount); err != nil {
+				return Breakdown{}, fmt.Errorf("order %s: book %s: %w", o.ID(), it.BookID, err)
+			}
+		}
+
+		net, tax, gross, err := Split(amount, rate, inclusive)
+		if err != nil {
+			return Breakdown{}, fmt.Errorf("order %s: book %s: %w", o.ID(), it.BookID, err)
+		}
+		bd.Lines = append(bd.Lines, Line{
+			BookID:   it.BookID,
+			Quantity: it.Quantity,
+			Rate:     rate,
+			Net:      net,
+			Tax:      tax,
+			Gross:    gross,
+		})
+		if byRate[rate], err = byRate[rate].Add(amount); err != nil {
+			return Breakdown{}, fmt.Errorf("order %s: %w", o.ID(), err)
+		}
+	}
+
+	sum, err := Summarize(byRate, inclusive)
+	if err != nil {
+		return Breakdown{}, fmt.Errorf("order %s: %w", o.ID(), err)
+	}
+	bd.Summary, bd.Net, bd.Tax, bd.Gross = sum.Summary, sum.Net, sum.Tax, sum.Gross
+	return bd, nil
+}
+
+// Summarize knows how to calculate tax of amounts taxed at each
+// rate, as on invoices. Amounts include tax when inclusive is true.
+// The breakdown has the summary and totals, but no lines.
+func Summarize(amounts map[Rate]money.Money, inclusive bool) (Breakdown, error) {
+	rates := make([]Rate, 0, len(amounts))
+	for r := range amounts {
+		rates = append(rates, r)
+	}
+	sort.Slice(rates, func(i, j int) bool { return rates[i] > rates[j] })
+
+	var bd Breakdown
+	for _, r := range rates {
+		net, tax, gross, err := Split(amounts[r], r, inclusive)
+		if err != nil {
+			return Breakdown{}, err
+		}
+		bd.Summary = append(bd.Summary, Summary{Rate: r, Net: net, Tax: tax, Gross: gross})
+		for _, v := range []struct {
+			total *money.Money
+			add   money.Money
+		}{{&bd.Net, net}, {&bd.Tax, tax}, {&bd.Gross, gross}} {
+			if *v.total, err = v.total.Add(v.add); err != nil {
+				return Breakdown{}, err
+			}
+		}
+	}
+	return bd, nil
+}
+
+func (r Rate) valid() bool {
+	return r >= 0 && r <= 10000
+}
+
+// normalizeCountry returns the country the sale is taxed in,
+// the home country when it is not given.
+func normalizeCountry(country, home string) string {
+	if strings.TrimSpace(country) == "" {
+		country = home
+	}
+	return bookshop.NormalizeCountry(country)
+}
+
+func isCountry(s string) bool {
+	if len(s) != 2 {
+		return false
+	}
+	for _, r := range strings.ToUpper(s) {
+		if r < 'A' || r > 'Z' {
+			return false
+		}
+	}
+	return true
+}
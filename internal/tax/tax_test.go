@@ -0,0 +1,336 @@
+package tax_test
+
+import (
+	"errors"
+	"testing"
+
+	"github.com/google/go-cmp/cmp"
+	"github.com/qba73/bookshop/internal/bookshop"
+	"github.com/qba73/bookshop/internal/bookshop/order"
+	"github.com/qba73/bookshop/internal/money"
+	"github.com/qba73/bookshop/internal/tax"
+)
+
+func pln(minor int64) money.Money {
+	return money.New(minor, money.PLN)
+}
+
+func newBook(t *testing.T, id string, price int64, format bookshop.Format, category int) bookshop.Book {
+	t.Helper()
+
+	b := bookshop.Book{ID: id, Title: id, Price: pln(price), Format: format}
+	if err := b.SetCategory(category); err != nil {
+		t.Fatal(err)
+	}
+	return b
+}
+
+func TestRate_String(t *testing.T) {
+	t.Parallel()
+
+	tt := []struct {
+		rate tax.Rate
+		want string
+	}{
+		{rate: 0, want: "0%"},
+		{rate: 500, want: "5%"},
+		{rate: 550, want: "5.5%"},
+		{rate: 2300, want: "23%"},
+	}
+	for _, tc := range tt {
+		if got := tc.rate.String(); got != tc.want {
+			t.Errorf("Rate(%d).String() = %q, want %q", int(tc.rate), got, tc.want)
+		}
+	}
+}
+
+func TestTable_Rate(t *testing.T) {
+	t.Parallel()
+
+	table := tax.PL
+	table.Rules = append([]tax.Rule{
+		{Country: "DE", Format: bookshop.FormatPrint, Rate: 700},
+		{Country: "GB", Rate: 2000},
+		{Format: bookshop.FormatAudiobook, Categories: []int{bookshop.CategoryRomance}, Rate: 800},
+	}, table.Rules...)
+
+	printed := newBook(t, "print", 3990, bookshop.FormatPrint, bookshop.CategoryTech)
+	tt := []struct {
+		name    string
+		country string
+		book    bookshop.Book
+		want    tax.Rate
+	}{
+		{name: "Printed book at home", country: "PL", book: printed, want: 500},
+		{name: "Book without format is printed", country: "PL", book: newBook(t, "b", 3990, "", bookshop.CategoryTech), want: 500},
+		{name: "E-book at home", country: "PL", book: newBook(t, "b", 2460, bookshop.FormatEbook, bookshop.CategoryTech), want: 2300},
+		{name: "Audiobook at home", country: "PL", book: newBook(t, "b", 2000, bookshop.FormatAudiobook, bookshop.CategoryTech), want: 2300},
+		{name: "Category rule", country: "PL", book: newBook(t, "b", 2000, bookshop.FormatAudiobook, bookshop.CategoryRomance), want: 800},
+		{name: "Customer without country", country: "", book: printed, want: 500},
+		{name: "Country in lower case", country: " pl ", book: printed, want: 500},
+		{name: "Country rule", country: "DE", book: printed, want: 700},
+		{name: "United Kingdom as GB", country: "gb", book: printed, want: 2000},
+		{name: "United Kingdom as UK", country: "UK", book: printed, want: 2000},
+		{name: "Export without rule", country: "DE", book: newBook(t, "b", 2460, bookshop.FormatEbook, bookshop.CategoryTech), want: 0},
+		{name: "Export", country: "US", book: printed, want: 0},
+	}
+	for _, tc := range tt {
+		tc := tc
+		t.Run(tc.name, func(t *testing.T) {
+			t.Parallel()
+			if got := table.Rate(tc.country, tc.book); got != tc.want {
+				t.Errorf("Rate(%q) = %v, want %v", tc.country, got, tc.want)
+			}
+		})
+	}
+}
+
+func TestTable_Validate(t *testing.T) {
+	t.Parallel()
+
+	tt := []struct {
+		name  string
+		table tax.Table
+	}{
+		{name: "Missing home country", table: tax.Table{Standard: 2300}},
+		{name: "Invalid home country", table: tax.Table{Home: "POL", Standard: 2300}},
+		{name: "Negative standard rate", table: tax.Table{Home: "PL", Standard: -1}},
+		{name: "Invalid rule country", table: tax.Table{Home: "PL", Rules: []tax.Rule{{Country: "P1", Rate: 500}}}},
+		{name: "Invalid rule format", table: tax.Table{Home: "PL", Rules: []tax.Rule{{Format: "vinyl", Rate: 500}}}},
+		{name: "Rate over 100%", table: tax.Table{Home: "PL", Rules: []tax.Rule{{Rate: 10001}}}},
+	}
+	for _, tc := range tt {
+		tc := tc
+		t.Run(tc.name, func(t *testing.T) {
+			t.Parallel()
+			if err := tc.table.Validate(); !errors.Is(err, tax.ErrInvalidTable) {
+				t.Errorf("want ErrInvalidTable, got %v", err)
+			}
+		})
+	}
+	if err := tax.PL.Validate(); err != nil {
+		t.Errorf("PL: %v", err)
+	}
+}
+
+func TestSplit(t *testing.T) {
+	t.Parallel()
+
+	tt := []struct {
+		name      string
+		amount    money.Money
+		rate      tax.Rate
+		inclusive bool
+		net       money.Money
+		tax       money.Money
+		gross     money.Money
+	}{
+		{name: "Inclusive reduced rate", amount: pln(3990), rate: 500, inclusive: true, net: pln(3800), tax: pln(190), gross: pln(3990)},
+		{name: "Inclusive rounded half up", amount: pln(2000), rate: 2300, inclusive: true, net: pln(1626), tax: pln(374), gross: pln(2000)},
+		{name: "Exclusive", amount: pln(1000), rate: 2300, net: pln(1000), tax: pln(230), gross: pln(1230)},
+		{name: "Zero rate", amount: pln(1000), rate: 0, inclusive: true, net: pln(1000), tax: pln(0), gross: pln(1000)},
+	}
+	for _, tc := range tt {
+		tc := tc
+		t.Run(tc.name, func(t *testing.T) {
+			t.Parallel()
+			net, tx, gross, err := tax.Split(tc.amount, tc.rate, tc.inclusive)
+			if err != nil {
+				t.Fatal(err)
+			}
+			got := []money.Money{net, tx, gross}
+			want := []money.Money{tc.net, tc.tax, tc.gross}
+			if !cmp.Equal(want, got) {
+				t.Error(cmp.Diff(want, got))
+			}
+		})
+	}
+}
+
+func TestCalculator_Price(t *testing.T) {
+	t.Parallel()
+
+	printed := newBook(t, "print", 3990, bookshop.FormatPrint, bookshop.CategoryTech)
+	books := bookshop.NewMemoryStore(nil)
+	c, err := tax.NewCalculator(tax.PL, books)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	exclusive := tax.Table{Home: "PL", Standard: 2300}
+	ce, err := tax.NewCalculator(exclusive, books)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	tt := []struct {
+		name      string
+		calc      *tax.Calculator
+		country   string
+		inclusive bool
+		want      money.Money
+	}{
+		{name: "Inclusive price at home", calc: c, country: "PL", inclusive: true, want: pln(3990)},
+		{name: "Exclusive price at home", calc: c, country: "PL", want: pln(3800)},
+		{name: "Export price", calc: c, country: "US", inclusive: true, want: pln(3990)},
+		{name: "Inclusive price of net catalog", calc: ce, country: "PL", inclusive: true, want: pln(4908)},
+		{name: "Exclusive price of net catalog", calc: ce, country: "PL", want: pln(3990)},
+	}
+	for _, tc := range tt {
+		tc := tc
+		t.Run(tc.name, func(t *testing.T) {
+			t.Parallel()
+			got, err := tc.calc.Price(printed, tc.country, tc.inclusive)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if !cmp.Equal(tc.want, got) {
+				t.Error(cmp.Diff(tc.want, got))
+			}
+		})
+	}
+}
+
+func TestCalculator_Order(t *testing.T) {
+	t.Parallel()
+
+	books := bookshop.NewMemoryStore(nil)
+	o, err := order.New("12282")
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, v := range []struct {
+		book     bookshop.Book
+		quantity int
+	}{
+		{book: newBook(t, "print", 3990, bookshop.FormatPrint, bookshop.CategoryTech), quantity: 2},
+		{book: newBook(t, "ebook", 2460, bookshop.FormatEbook, bookshop.CategoryTech), quantity: 1},
+		{book: newBook(t, "audiobook", 2000, bookshop.FormatAudiobook, bookshop.CategoryRomance), quantity: 1},
+	} {
+		if err := books.Put(v.book); err != nil {
+			t.Fatal(err)
+		}
+		if err := o.AddBook(v.book, v.quantity); err != nil {
+			t.Fatal(err)
+		}
+	}
+	err = o.SetAdjustments([]order.Adjustment{
+		{BookID: "ebook", Source: "spring", Amount: pln(460)},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	c, err := tax.NewCalculator(tax.PL, books)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	tt := []struct {
+		name     string
+		customer bookshop.Customer
+		want     tax.Breakdown
+	}{
+		{
+			name:     "Home country",
+			customer: bookshop.Customer{Name: "Jan Kowalski", Billing: bookshop.Address{Country: "PL"}},
+			want: tax.Breakdown{
+				Country: "PL",
+				Lines: []tax.Line{
+					{BookID: "print", Quantity: 2, Rate: 500, Net: pln(7600), Tax: pln(380), Gross: pln(7980)},
+					{BookID: "ebook", Quantity: 1, Rate: 2300, Net: pln(1626), Tax: pln(374), Gross: pln(2000)},
+					{BookID: "audiobook", Quantity: 1, Rate: 2300, Net: pln(1626), Tax: pln(374), Gross: pln(2000)},
+				},
+				Summary: []tax.Summary{
+					{Rate: 2300, Net: pln(3252), Tax: pln(748), Gross: pln(4000)},
+					{Rate: 500, Net: pln(7600), Tax: pln(380), Gross: pln(7980)},
+				},
+				Net:   pln(10852),
+				Tax:   pln(1128),
+				Gross: pln(11980),
+			},
+		},
+		{
+			name: "Export",
+			customer: bookshop.Customer{
+				Name:     "John Smith",
+				Billing:  bookshop.Address{Country: "PL"},
+				Shipping: bookshop.Address{Country: "us"},
+			},
+			want: tax.Breakdown{
+				Country: "US",
+				Lines: []tax.Line{
+					{BookID: "print", Quantity: 2, Rate: 0, Net: pln(7980), Tax: pln(0), Gross: pln(7980)},
+					{BookID: "ebook", Quantity: 1, Rate: 0, Net: pln(2000), Tax: pln(0), Gross: pln(2000)},
+					{BookID: "audiobook", Quantity: 1, Rate: 0, Net: pln(2000), Tax: pln(0), Gross: pln(2000)},
+				},
+				Summary: []tax.Summary{
+					{Rate: 0, Net: pln(11980), Tax: pln(0), Gross: pln(11980)},
+				},
+				Net:   pln(11980),
+				Tax:   pln(0),
+				Gross: pln(11980),
+			},
+		},
+	}
+	for _, tc := range tt {
+		tc := tc
+		t.Run(tc.name, func(t *testing.T) {
+			t.Parallel()
+			o := *o
+			if err := c.Assess(&o, tc.customer); err != nil {
+				t.Fatal(err)
+			}
+			got, err := tax.Order(&o)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if !cmp.Equal(tc.want, got) {
+				t.Error(cmp.Diff(tc.want, got))
+			}
+		})
+	}
+}
+
+func TestOrder_KeepsAssessedTax(t *testing.T) {
+	t.Parallel()
+
+	books := bookshop.NewMemoryStore(nil)
+	b := newBook(t, "print", 3990, bookshop.FormatPrint, bookshop.CategoryTech)
+	if err := books.Put(b); err != nil {
+		t.Fatal(err)
+	}
+	o, err := order.New("12282")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := o.AddBook(b, 1); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := tax.Order(o); !errors.Is(err, tax.ErrNotAssessed) {
+		t.Errorf("Order() before Assess() = %v, want: %v", err, tax.ErrNotAssessed)
+	}
+
+	c, err := tax.NewCalculator(tax.PL, books)
+	if err != nil {
+		t.Fatal(err)
+	}
+	cust := bookshop.Customer{Name: "Jan Kowalski", Billing: bookshop.Address{Country: "PL"}}
+	if err := c.Assess(o, cust); err != nil {
+		t.Fatal(err)
+	}
+
+	// The book becomes an e-book after the order was placed.
+	b.Format = bookshop.FormatEbook
+	if err := books.Put(b); err != nil {
+		t.Fatal(err)
+	}
+
+	got, err := tax.Order(o)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got.Country != "PL" || got.Lines[0].Rate != 500 {
+		t.Errorf("Order() country %s, rate %v, want: PL, 5%%", got.Country, got.Lines[0].Rate)
+	}
+}